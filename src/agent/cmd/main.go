@@ -16,12 +16,35 @@ import (
 )
 
 var (
-	iface         string
-	logLevel      string
-	statsInterval int
-	enableAPI     bool
-	apiHost       string
-	apiPort       int
+	ifaces                []string
+	logLevel              string
+	statsInterval         int
+	enableAPI             bool
+	apiHost               string
+	apiPort               int
+	enableEgress          bool
+	hookMode              string
+	xdpMode               string
+	defaultAction         string
+	safetyExemptions      bool
+	monitorMode           bool
+	dropInvalidTCP        bool
+	decapVXLAN            bool
+	decapGeneve           bool
+	fragmentAction        string
+	malformedAction       string
+	sourceSessionLimit    uint32
+	sourcePrefixV4        uint8
+	sourcePrefixV6        uint8
+	pinPath               string
+	takeover              bool
+	enableMetrics         bool
+	perCPUMetrics         bool
+	gcInterval            time.Duration
+	tcpEstablishedTimeout time.Duration
+	tcpTransitoryTimeout  time.Duration
+	udpTimeout            time.Duration
+	icmpTimeout           time.Duration
 )
 
 var rootCmd = &cobra.Command{
@@ -32,12 +55,38 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&iface, "interface", "i", "lo", "Network interface to attach eBPF program")
+	rootCmd.Flags().StringSliceVarP(&ifaces, "interface", "i", []string{"lo"}, "Network interfaces or glob patterns to attach eBPF program (repeatable, comma-separated)")
 	rootCmd.Flags().StringVarP(&logLevel, "log-level", "l", "info", "Log level (debug, info, warn, error)")
 	rootCmd.Flags().IntVarP(&statsInterval, "stats-interval", "s", 5, "Statistics print interval in seconds")
 	rootCmd.Flags().BoolVarP(&enableAPI, "enable-api", "a", true, "Enable REST API server")
 	rootCmd.Flags().StringVar(&apiHost, "api-host", "127.0.0.1", "API server host")
 	rootCmd.Flags().IntVar(&apiPort, "api-port", 8080, "API server port")
+	rootCmd.Flags().BoolVar(&enableMetrics, "enable-metrics", true, "Serve Prometheus metrics on /metrics of the API server")
+	rootCmd.Flags().BoolVar(&perCPUMetrics, "metrics-per-cpu", false, "Export data plane counters per CPU")
+	rootCmd.Flags().BoolVar(&enableEgress, "enable-egress", false, "Also enforce policies on the egress hook")
+	rootCmd.Flags().StringVar(&hookMode, "hook", string(dataplane.HookModeTC), "Ingress enforcement hooks (tc, xdp, xdp+tc)")
+	rootCmd.Flags().StringVar(&xdpMode, "xdp-mode", string(dataplane.XDPModeAuto), "XDP attach mode (auto, native, generic)")
+	rootCmd.Flags().StringVar(&defaultAction, "default-action", "allow", "Action for traffic no policy matches (allow, deny)")
+	rootCmd.Flags().BoolVar(&safetyExemptions, "safety-exemptions", true, "Always allow loopback traffic and the API port")
+	rootCmd.Flags().BoolVar(&monitorMode, "monitor", false, "Report denied traffic without dropping it")
+	rootCmd.Flags().BoolVar(&dropInvalidTCP, "drop-invalid-tcp", false, "Drop TCP packets with invalid flag combinations (NULL, XMAS, SYN+FIN, ...)")
+	rootCmd.Flags().BoolVar(&decapVXLAN, "decap-vxlan", false, "Evaluate policy on the inner flow of VXLAN packets (UDP 4789)")
+	rootCmd.Flags().BoolVar(&decapGeneve, "decap-geneve", false, "Evaluate policy on the inner flow of Geneve packets (UDP 6081)")
+	rootCmd.Flags().StringVar(&fragmentAction, "fragment-action", "deny", "Action for non-first fragments whose first fragment was not seen (allow, deny)")
+	rootCmd.Flags().StringVar(&malformedAction, "malformed-action", "deny", "Action for packets with malformed IP headers (allow, deny)")
+	rootCmd.Flags().Uint32Var(&sourceSessionLimit, "source-session-limit", 0, "Maximum active sessions per source, new sessions beyond it are denied (0 = unlimited)")
+	rootCmd.Flags().Uint8Var(&sourcePrefixV4, "source-prefix-v4", 0, "Count sessions per IPv4 prefix of this length instead of per address (0 = per address)")
+	rootCmd.Flags().Uint8Var(&sourcePrefixV6, "source-prefix-v6", 0, "Count sessions per IPv6 prefix of this length instead of per address (0 = per address)")
+	rootCmd.Flags().StringVar(&pinPath, "pin-path", "", "bpffs directory to pin maps in so state survives restarts (e.g. /sys/fs/bpf/microsegment)")
+	rootCmd.Flags().BoolVar(&takeover, "takeover", false, "Adopt the programs a previous agent left attached under --pin-path and replace them atomically")
+	rootCmd.Flags().MarkDeprecated("takeover", "attachments under --pin-path are always adopted")
+
+	gcDefaults := dataplane.DefaultSessionGCConfig()
+	rootCmd.Flags().DurationVar(&gcInterval, "session-gc-interval", gcDefaults.Interval, "Idle session sweep interval (0 disables)")
+	rootCmd.Flags().DurationVar(&tcpEstablishedTimeout, "tcp-established-timeout", gcDefaults.TCPEstablishedTimeout, "Idle timeout for established TCP sessions")
+	rootCmd.Flags().DurationVar(&tcpTransitoryTimeout, "tcp-transitory-timeout", gcDefaults.TCPTransitoryTimeout, "Idle timeout for TCP sessions in handshake or teardown")
+	rootCmd.Flags().DurationVar(&udpTimeout, "udp-timeout", gcDefaults.UDPTimeout, "Idle timeout for UDP and other sessions")
+	rootCmd.Flags().DurationVar(&icmpTimeout, "icmp-timeout", gcDefaults.ICMPTimeout, "Idle timeout for ICMP sessions")
 }
 
 func runAgent(cmd *cobra.Command, args []string) {
@@ -51,35 +100,82 @@ func runAgent(cmd *cobra.Command, args []string) {
 		FullTimestamp: true,
 	})
 
-	log.Infof("Starting microsegmentation agent on interface %s", iface)
+	log.Infof("Starting microsegmentation agent on interfaces %v", ifaces)
+
+	hook, err := dataplane.ParseHookMode(hookMode)
+	if err != nil {
+		log.Fatalf("Invalid --hook: %v", err)
+	}
+	xdp, err := dataplane.ParseXDPMode(xdpMode)
+	if err != nil {
+		log.Fatalf("Invalid --xdp-mode: %v", err)
+	}
+	defAction, err := dataplane.ParseDefaultAction(defaultAction)
+	if err != nil {
+		log.Fatalf("Invalid --default-action: %v", err)
+	}
+	fragAction, err := dataplane.ParseDefaultAction(fragmentAction)
+	if err != nil {
+		log.Fatalf("Invalid --fragment-action: %v", err)
+	}
+	badAction, err := dataplane.ParseDefaultAction(malformedAction)
+	if err != nil {
+		log.Fatalf("Invalid --malformed-action: %v", err)
+	}
+
+	// Keep the API reachable under default-deny
+	var exemptPort uint16
+	if enableAPI {
+		exemptPort = uint16(apiPort)
+	}
 
 	// Create data plane
-	dp, err := dataplane.New(iface)
+	dp, err := dataplane.NewWithConfig(&dataplane.Config{
+		Interfaces:   ifaces,
+		EnableEgress: enableEgress,
+		Hook:         hook,
+		XDPMode:      xdp,
+
+		DefaultAction:           defAction,
+		DisableSafetyExemptions: !safetyExemptions,
+		APIPort:                 exemptPort,
+		MonitorMode:             monitorMode,
+		DropInvalidTCP:          dropInvalidTCP,
+		DecapVXLAN:              decapVXLAN,
+		DecapGeneve:             decapGeneve,
+		FragmentAction:          fragAction,
+		MalformedAction:         badAction,
+		SourceSessionLimit:      sourceSessionLimit,
+		SourcePrefixV4:          sourcePrefixV4,
+		SourcePrefixV6:          sourcePrefixV6,
+		PinPath:                 pinPath,
+		Takeover:                takeover,
+		SessionGC: dataplane.SessionGCConfig{
+			Interval:              gcInterval,
+			TCPEstablishedTimeout: tcpEstablishedTimeout,
+			TCPTransitoryTimeout:  tcpTransitoryTimeout,
+			UDPTimeout:            udpTimeout,
+			ICMPTimeout:           icmpTimeout,
+		},
+	})
 	if err != nil {
 		log.Fatalf("Failed to create data plane: %v", err)
 	}
 	defer dp.Close()
 
+	for _, st := range dp.ListInterfaces() {
+		log.Infof("✓ Attached to %s", st.Name)
+	}
 	log.Info("✓ Data plane initialized")
 
 	// Create policy manager
 	pm := policy.NewManager(dp)
 
-	// Add default allow-all policy for testing
-	err = pm.AddPolicy(&policy.Policy{
-		RuleID:   1,
-		SrcIP:    "0.0.0.0/0",
-		DstIP:    "0.0.0.0/0",
-		DstPort:  0,
-		Protocol: "any",
-		Action:   "allow",
-	})
-	if err != nil {
-		log.Warnf("Failed to add default policy: %v", err)
+	log.Infof("✓ Policy manager initialized (default action: %s)", defAction)
+	if monitorMode {
+		log.Warn("Monitor mode enabled: denied traffic is reported but not dropped")
 	}
 
-	log.Info("✓ Policy manager initialized")
-
 	// Start API server if enabled
 	var apiServer *api.Server
 	if enableAPI {
@@ -88,6 +184,9 @@ func runAgent(cmd *cobra.Command, args []string) {
 			Port:       apiPort,
 			EnableCORS: true,
 			LogLevel:   logLevel,
+
+			EnableMetrics: enableMetrics,
+			PerCPUMetrics: perCPUMetrics,
 		}
 
 		apiServer, err = api.NewAPIServer(apiConfig, dp, pm)
@@ -116,9 +215,41 @@ func runAgent(cmd *cobra.Command, args []string) {
 			log.Infof("  Total Packets:    %d", stats.TotalPackets)
 			log.Infof("  Allowed Packets:  %d", stats.AllowedPackets)
 			log.Infof("  Denied Packets:   %d", stats.DeniedPackets)
+			if stats.WouldDeny > 0 {
+				log.Infof("  Would Deny:       %d", stats.WouldDeny)
+			}
+			if stats.InvalidTCPDrops > 0 {
+				log.Infof("  Invalid TCP:      %d", stats.InvalidTCPDrops)
+			}
+			if stats.RateLimited > 0 {
+				log.Infof("  Rate Limited:     %d", stats.RateLimited)
+			}
+			if stats.RejectsSent > 0 {
+				log.Infof("  Rejects Sent:     %d", stats.RejectsSent)
+			}
+			if stats.SessionLimitDrops > 0 {
+				log.Infof("  Session Limit:    %d", stats.SessionLimitDrops)
+			}
+			if stats.FragmentDrops > 0 || stats.MalformedDrops > 0 {
+				log.Infof("  Fragment/Malformed Drops: %d/%d", stats.FragmentDrops, stats.MalformedDrops)
+			}
+			if hook != dataplane.HookModeTC {
+				log.Infof("  XDP Dropped:      %d", stats.XDPDropped)
+			}
+			if enableEgress {
+				log.Infof("  Ingress Allow/Deny: %d/%d", stats.IngressAllowed, stats.IngressDenied)
+				log.Infof("  Egress Allow/Deny:  %d/%d", stats.EgressAllowed, stats.EgressDenied)
+			}
 			log.Infof("  New Sessions:     %d", stats.NewSessions)
+			log.Infof("  Active Sessions:  %d", stats.ActiveSessions)
+			log.Infof("  Expired Sessions: %d (last sweep %d in %s)",
+				stats.SessionGC.ExpiredSessions, stats.SessionGC.LastSweepExpired,
+				stats.SessionGC.LastSweepDuration)
 			log.Infof("  Policy Hits:      %d", stats.PolicyHits)
 			log.Infof("  Policy Misses:    %d", stats.PolicyMisses)
+			if stats.FlowEvents.Dropped > 0 {
+				log.Infof("  Flow Events Dropped: %d", stats.FlowEvents.Dropped)
+			}
 		}
 	}()
 
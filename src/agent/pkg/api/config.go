@@ -24,17 +24,24 @@ type Config struct {
 
 	// LogLevel sets the log level for API server (debug, info, warn, error)
 	LogLevel string `json:"log_level" yaml:"log_level"`
+
+	// EnableMetrics serves Prometheus metrics on /metrics
+	EnableMetrics bool `json:"enable_metrics" yaml:"enable_metrics"`
+
+	// PerCPUMetrics exports data plane counters per CPU instead of summed
+	PerCPUMetrics bool `json:"per_cpu_metrics" yaml:"per_cpu_metrics"`
 }
 
 // DefaultConfig returns default API configuration
 func DefaultConfig() *Config {
 	return &Config{
-		Host:         "127.0.0.1",
-		Port:         8080,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
-		EnableCORS:   true,
-		LogLevel:     "info",
+		Host:          "127.0.0.1",
+		Port:          8080,
+		ReadTimeout:   10 * time.Second,
+		WriteTimeout:  10 * time.Second,
+		IdleTimeout:   60 * time.Second,
+		EnableCORS:    true,
+		LogLevel:      "info",
+		EnableMetrics: true,
 	}
 }
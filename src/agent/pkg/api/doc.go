@@ -45,12 +45,43 @@
 //   - PUT    /api/v1/policies/:id - Update policy
 //   - DELETE /api/v1/policies/:id - Delete policy
 //
+// Security identities (label set -> numeric identity -> CIDRs, matched by
+// the src_identity and dst_identity of policies):
+//   - POST   /api/v1/identities     - Create identity ({"identity": 100,
+//     "labels": ["app=web"], "cidrs": ["10.0.1.0/24"]})
+//   - GET    /api/v1/identities     - List all identities
+//   - GET    /api/v1/identities/:id - Get specific identity
+//   - PUT    /api/v1/identities/:id - Update labels and CIDRs
+//   - DELETE /api/v1/identities/:id - Delete identity
+//
+// Sessions:
+//   - GET /api/v1/sessions             - Live session table (?limit=N)
+//   - GET /api/v1/sessions/top-sources - Sources with the most active
+//     sessions (?limit=N, 10 by default)
+//
+// Interfaces:
+//   - GET    /api/v1/interfaces       - List attached interfaces and hook modes
+//   - POST   /api/v1/interfaces       - Attach an interface ({"name": "eth1"})
+//   - DELETE /api/v1/interfaces/:name - Detach an interface
+//   - PUT    /api/v1/interfaces/:name/monitor - Toggle monitor mode ({"enabled": true})
+//
+// Configuration:
+//   - GET /api/v1/config - Current configuration, including the default action
+//   - PUT /api/v1/config - Update log level, default action, safety exemptions,
+//     monitor mode, invalid TCP flag dropping, VXLAN/Geneve decapsulation,
+//     the fragment and malformed packet actions or the per-source session
+//     limit
+//
 // Statistics:
 //   - GET /api/v1/stats          - All statistics
 //   - GET /api/v1/stats/packets  - Packet statistics
 //   - GET /api/v1/stats/sessions - Session statistics
 //   - GET /api/v1/stats/policies - Policy statistics
 //
+// Metrics (when Config.EnableMetrics is set):
+//   - GET /metrics - Prometheus exposition of data plane, policy and API
+//     metrics (see package metrics)
+//
 // # Configuration
 //
 // Server configuration can be customized:
@@ -69,6 +100,7 @@
 // The server includes the following middleware:
 //   - Recovery: Catches panics and prevents server crashes
 //   - Logger: Logs all HTTP requests with timing information
+//   - Metrics: Records request latency per route for /metrics
 //   - CORS: Enables cross-origin resource sharing for web UIs
 //
 // # Thread Safety
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ConfigHandler handles runtime configuration requests
+type ConfigHandler struct {
+	runtime dataplane.RuntimeConfigurer
+	apiHost string
+	apiPort int
+}
+
+// NewConfigHandler creates a new config handler
+func NewConfigHandler(rc dataplane.RuntimeConfigurer, apiHost string, apiPort int) *ConfigHandler {
+	return &ConfigHandler{
+		runtime: rc,
+		apiHost: apiHost,
+		apiPort: apiPort,
+	}
+}
+
+// GetConfig handles GET /api/v1/config
+func (h *ConfigHandler) GetConfig(c *gin.Context) {
+	rc, err := h.runtime.RuntimeConfig()
+	if err != nil {
+		log.Errorf("Failed to read runtime config: %v", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			http.StatusInternalServerError,
+			"dataplane_error",
+			"Failed to read configuration",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.configToResponse(&rc))
+}
+
+// UpdateConfig handles PUT /api/v1/config
+func (h *ConfigHandler) UpdateConfig(c *gin.Context) {
+	var req models.ConfigUpdateRequest
+
+	// Bind and validate JSON request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid request body",
+			err.Error(),
+		))
+		return
+	}
+
+	// The data plane applies the patch to its current settings under its
+	// config lock, so concurrent updates don't undo each other
+	patch := func(rc *dataplane.RuntimeConfig) {
+		if req.DefaultAction != nil {
+			// Already validated by the binding
+			rc.DefaultAction, _ = dataplane.ParseDefaultAction(*req.DefaultAction)
+		}
+		if req.SafetyExemptions != nil {
+			rc.SafetyExemptions = *req.SafetyExemptions
+		}
+		if req.MonitorMode != nil {
+			rc.MonitorMode = *req.MonitorMode
+		}
+		if req.DropInvalidTCP != nil {
+			rc.DropInvalidTCP = *req.DropInvalidTCP
+		}
+		if req.DecapVXLAN != nil {
+			rc.DecapVXLAN = *req.DecapVXLAN
+		}
+		if req.DecapGeneve != nil {
+			rc.DecapGeneve = *req.DecapGeneve
+		}
+		if req.FragmentAction != nil {
+			rc.FragmentAction, _ = dataplane.ParseDefaultAction(*req.FragmentAction)
+		}
+		if req.MalformedAction != nil {
+			rc.MalformedAction, _ = dataplane.ParseDefaultAction(*req.MalformedAction)
+		}
+		if req.SourceSessionLimit != nil {
+			rc.SourceSessionLimit = *req.SourceSessionLimit
+		}
+		if req.SourcePrefixV4 != nil {
+			rc.SourcePrefixV4 = *req.SourcePrefixV4
+		}
+		if req.SourcePrefixV6 != nil {
+			rc.SourcePrefixV6 = *req.SourcePrefixV6
+		}
+	}
+
+	var rc dataplane.RuntimeConfig
+	var err error
+	if req.DefaultAction != nil || req.SafetyExemptions != nil || req.MonitorMode != nil ||
+		req.DropInvalidTCP != nil || req.DecapVXLAN != nil || req.DecapGeneve != nil ||
+		req.FragmentAction != nil || req.MalformedAction != nil || req.SourceSessionLimit != nil ||
+		req.SourcePrefixV4 != nil || req.SourcePrefixV6 != nil {
+		if rc, err = h.runtime.UpdateRuntimeConfig(patch); err != nil {
+			log.Errorf("Failed to update runtime config: %v", err)
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+				http.StatusInternalServerError,
+				"dataplane_error",
+				"Failed to update configuration",
+				err.Error(),
+			))
+			return
+		}
+	} else if rc, err = h.runtime.RuntimeConfig(); err != nil {
+		log.Errorf("Failed to read runtime config: %v", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			http.StatusInternalServerError,
+			"dataplane_error",
+			"Failed to read configuration",
+			err.Error(),
+		))
+		return
+	}
+
+	if req.LogLevel != nil {
+		level, _ := log.ParseLevel(*req.LogLevel)
+		log.SetLevel(level)
+		log.Infof("Log level set to %s", level)
+	}
+
+	c.JSON(http.StatusOK, h.configToResponse(&rc))
+}
+
+// configToResponse builds the API representation of the current configuration
+func (h *ConfigHandler) configToResponse(rc *dataplane.RuntimeConfig) models.ConfigResponse {
+	ifaceNames := ""
+	if im, ok := h.runtime.(dataplane.InterfaceManager); ok {
+		var names []string
+		for _, st := range im.ListInterfaces() {
+			names = append(names, st.Name)
+		}
+		ifaceNames = strings.Join(names, ",")
+	}
+
+	return models.ConfigResponse{
+		Interface:        ifaceNames,
+		LogLevel:         log.GetLevel().String(),
+		APIHost:          h.apiHost,
+		APIPort:          h.apiPort,
+		DefaultAction:    rc.DefaultAction.String(),
+		SafetyExemptions: rc.SafetyExemptions,
+		MonitorMode:      rc.MonitorMode,
+		DropInvalidTCP:   rc.DropInvalidTCP,
+		DecapVXLAN:       rc.DecapVXLAN,
+		DecapGeneve:      rc.DecapGeneve,
+		FragmentAction:   rc.FragmentAction.String(),
+		MalformedAction:  rc.MalformedAction.String(),
+
+		SourceSessionLimit: rc.SourceSessionLimit,
+		SourcePrefixV4:     rc.SourcePrefixV4,
+		SourcePrefixV6:     rc.SourcePrefixV6,
+	}
+}
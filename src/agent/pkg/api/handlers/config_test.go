@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockRuntimeConfigurer is an in-memory RuntimeConfigurer
+type MockRuntimeConfigurer struct {
+	config  dataplane.RuntimeConfig
+	sets    int
+	failSet bool
+}
+
+func (m *MockRuntimeConfigurer) RuntimeConfig() (dataplane.RuntimeConfig, error) {
+	return m.config, nil
+}
+
+func (m *MockRuntimeConfigurer) SetRuntimeConfig(rc dataplane.RuntimeConfig) error {
+	if m.failSet {
+		return errors.New("config map unavailable")
+	}
+	m.config = rc
+	m.sets++
+	return nil
+}
+
+func (m *MockRuntimeConfigurer) UpdateRuntimeConfig(fn func(rc *dataplane.RuntimeConfig)) (dataplane.RuntimeConfig, error) {
+	if m.failSet {
+		return dataplane.RuntimeConfig{}, errors.New("config map unavailable")
+	}
+	fn(&m.config)
+	m.sets++
+	return m.config, nil
+}
+
+// setupConfigTestRouter creates a test router with config handler
+func setupConfigTestRouter(rc *MockRuntimeConfigurer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	handler := NewConfigHandler(rc, "127.0.0.1", 8080)
+	router.GET("/api/v1/config", handler.GetConfig)
+	router.PUT("/api/v1/config", handler.UpdateConfig)
+
+	return router
+}
+
+// TestGetConfig tests reading the runtime configuration
+func TestGetConfig(t *testing.T) {
+	rc := &MockRuntimeConfigurer{config: dataplane.RuntimeConfig{
+		DefaultAction:    dataplane.DefaultActionDeny,
+		SafetyExemptions: true,
+		APIPort:          8080,
+		MonitorMode:      true,
+	}}
+	router := setupConfigTestRouter(rc)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/config", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.ConfigResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "deny", response.DefaultAction)
+	assert.True(t, response.SafetyExemptions)
+	assert.Equal(t, "127.0.0.1", response.APIHost)
+	assert.Equal(t, 8080, response.APIPort)
+	assert.True(t, response.MonitorMode)
+}
+
+// TestUpdateConfig tests changing the default action and exemptions
+func TestUpdateConfig(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedAction string
+		expectedExempt bool
+		expectedMon    bool
+		expectedSets   int
+	}{
+		{"default deny", `{"default_action":"deny"}`, http.StatusOK, "deny", true, false, 1},
+		{"disable exemptions", `{"safety_exemptions":false}`, http.StatusOK, "allow", false, false, 1},
+		{"monitor mode", `{"monitor_mode":true}`, http.StatusOK, "allow", true, true, 1},
+		{"log level only", `{"log_level":"debug"}`, http.StatusOK, "allow", true, false, 0},
+		{"invalid action", `{"default_action":"drop"}`, http.StatusBadRequest, "", false, false, 0},
+		{"invalid log level", `{"log_level":"trace"}`, http.StatusBadRequest, "", false, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &MockRuntimeConfigurer{config: dataplane.RuntimeConfig{SafetyExemptions: true, APIPort: 8080}}
+			router := setupConfigTestRouter(rc)
+
+			req, _ := http.NewRequest(http.MethodPut, "/api/v1/config", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedSets, rc.sets)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.ConfigResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedAction, response.DefaultAction)
+			assert.Equal(t, tt.expectedExempt, response.SafetyExemptions)
+			assert.Equal(t, tt.expectedMon, response.MonitorMode)
+			assert.Equal(t, uint16(8080), rc.config.APIPort, "API port is preserved")
+		})
+	}
+}
+
+// TestUpdateConfig_DropInvalidTCP tests toggling the invalid TCP flag filter
+func TestUpdateConfig_DropInvalidTCP(t *testing.T) {
+	rc := &MockRuntimeConfigurer{config: dataplane.RuntimeConfig{SafetyExemptions: true}}
+	router := setupConfigTestRouter(rc)
+
+	req, _ := http.NewRequest(http.MethodPut, "/api/v1/config", bytes.NewBufferString(`{"drop_invalid_tcp":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, rc.sets)
+	assert.True(t, rc.config.DropInvalidTCP)
+	assert.True(t, rc.config.SafetyExemptions, "other settings are preserved")
+
+	var response models.ConfigResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.DropInvalidTCP)
+}
+
+// TestUpdateConfig_Decap tests enabling tunnel decapsulation
+func TestUpdateConfig_Decap(t *testing.T) {
+	rc := &MockRuntimeConfigurer{}
+	router := setupConfigTestRouter(rc)
+
+	req, _ := http.NewRequest(http.MethodPut, "/api/v1/config", bytes.NewBufferString(`{"decap_vxlan":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, rc.sets)
+	assert.True(t, rc.config.DecapVXLAN)
+	assert.False(t, rc.config.DecapGeneve)
+
+	var response models.ConfigResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.DecapVXLAN)
+	assert.False(t, response.DecapGeneve)
+}
+
+// TestUpdateConfig_FragmentActions tests setting the fragment and
+// malformed packet actions
+func TestUpdateConfig_FragmentActions(t *testing.T) {
+	tests := []struct {
+		name              string
+		body              string
+		expectedStatus    int
+		expectedFragment  dataplane.DefaultAction
+		expectedMalformed dataplane.DefaultAction
+	}{
+		{"deny fragments", `{"fragment_action":"deny"}`, http.StatusOK, dataplane.DefaultActionDeny, dataplane.DefaultActionAllow},
+		{"deny malformed", `{"malformed_action":"deny"}`, http.StatusOK, dataplane.DefaultActionAllow, dataplane.DefaultActionDeny},
+		{"invalid action", `{"fragment_action":"log"}`, http.StatusBadRequest, dataplane.DefaultActionAllow, dataplane.DefaultActionAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &MockRuntimeConfigurer{}
+			router := setupConfigTestRouter(rc)
+
+			req, _ := http.NewRequest(http.MethodPut, "/api/v1/config", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedFragment, rc.config.FragmentAction)
+			assert.Equal(t, tt.expectedMalformed, rc.config.MalformedAction)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.ConfigResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedFragment.String(), response.FragmentAction)
+			assert.Equal(t, tt.expectedMalformed.String(), response.MalformedAction)
+		})
+	}
+}
+
+// TestUpdateConfig_SourceSessionLimit tests setting the per-source session
+// limit and the prefixes sources are grouped by
+func TestUpdateConfig_SourceSessionLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedLimit  uint32
+		expectedV4     uint8
+		expectedV6     uint8
+	}{
+		{"limit only", `{"source_session_limit":500}`, http.StatusOK, 500, 0, 0},
+		{"limit per prefix", `{"source_session_limit":2000,"source_prefix_v4":24,"source_prefix_v6":64}`, http.StatusOK, 2000, 24, 64},
+		{"invalid IPv4 prefix", `{"source_prefix_v4":33}`, http.StatusBadRequest, 0, 0, 0},
+		{"invalid IPv6 prefix", `{"source_prefix_v6":129}`, http.StatusBadRequest, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &MockRuntimeConfigurer{}
+			router := setupConfigTestRouter(rc)
+
+			req, _ := http.NewRequest(http.MethodPut, "/api/v1/config", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLimit, rc.config.SourceSessionLimit)
+			assert.Equal(t, tt.expectedV4, rc.config.SourcePrefixV4)
+			assert.Equal(t, tt.expectedV6, rc.config.SourcePrefixV6)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.ConfigResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedLimit, response.SourceSessionLimit)
+			assert.Equal(t, tt.expectedV4, response.SourcePrefixV4)
+			assert.Equal(t, tt.expectedV6, response.SourcePrefixV6)
+		})
+	}
+}
+
+// TestUpdateConfig_DataPlaneError tests reporting config map failures
+func TestUpdateConfig_DataPlaneError(t *testing.T) {
+	rc := &MockRuntimeConfigurer{failSet: true}
+	router := setupConfigTestRouter(rc)
+
+	req, _ := http.NewRequest(http.MethodPut, "/api/v1/config", bytes.NewBufferString(`{"default_action":"deny"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// TestGetStatus_MonitorMode tests reporting global monitor mode in status
+func TestGetStatus_MonitorMode(t *testing.T) {
+	dp := struct {
+		*MockDataPlane
+		*MockRuntimeConfigurer
+	}{
+		NewMockDataPlane(),
+		&MockRuntimeConfigurer{config: dataplane.RuntimeConfig{MonitorMode: true}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/v1/status", NewHealthHandler(dp, NewMockPolicyManagerForHealth()).GetStatus)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.MonitorMode)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
@@ -65,12 +66,36 @@ func (h *HealthHandler) GetStatus(c *gin.Context) {
 		overallStatus = "degraded"
 	}
 
+	// Report attached interfaces when the data plane manages them
+	var interfaces []models.InterfaceResponse
+	ifaceNames := "lo"
+	if im, ok := h.dataPlane.(dataplane.InterfaceManager); ok {
+		attached := im.ListInterfaces()
+		interfaces = interfacesToResponse(attached)
+
+		names := make([]string, 0, len(attached))
+		for _, st := range attached {
+			names = append(names, st.Name)
+		}
+		ifaceNames = strings.Join(names, ",")
+	}
+
+	// Report global monitor mode when the runtime settings are available
+	monitorMode := false
+	if rc, ok := h.dataPlane.(dataplane.RuntimeConfigurer); ok {
+		if cfg, err := rc.RuntimeConfig(); err == nil {
+			monitorMode = cfg.MonitorMode
+		}
+	}
+
 	// Build response
 	response := models.StatusResponse{
-		Status:    overallStatus,
-		Version:   "0.1.0", // TODO: Get from build info
-		Interface: "lo",    // TODO: Get from config
-		DataPlane: dataPlaneStatus,
+		Status:      overallStatus,
+		Version:     "0.1.0", // TODO: Get from build info
+		Interface:   ifaceNames,
+		Interfaces:  interfaces,
+		MonitorMode: monitorMode,
+		DataPlane:   dataPlaneStatus,
 		API: models.APIStatus{
 			Status:  "running",
 			Message: "API server is operational",
@@ -84,6 +109,10 @@ func (h *HealthHandler) GetStatus(c *gin.Context) {
 			ActiveSessions: stats.ActiveSessions,
 			PolicyHits:     stats.PolicyHits,
 			PolicyMisses:   stats.PolicyMisses,
+			IngressAllowed: stats.IngressAllowed,
+			IngressDenied:  stats.IngressDenied,
+			EgressAllowed:  stats.EgressAllowed,
+			EgressDenied:   stats.EgressDenied,
 		},
 		PolicyCount: policyCount,
 		Uptime:      int64(time.Since(startTime).Seconds()),
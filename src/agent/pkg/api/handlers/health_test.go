@@ -75,6 +75,10 @@ func (m *MockPolicyManagerForHealth) AddPolicy(p *policy.Policy) error {
 	return nil
 }
 
+func (m *MockPolicyManagerForHealth) UpdatePolicy(p *policy.Policy) error {
+	return nil
+}
+
 func (m *MockPolicyManagerForHealth) DeletePolicy(p *policy.Policy) error {
 	return nil
 }
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
+	"github.com/ebpf-microsegment/src/agent/pkg/policy"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// IdentityHandler handles security identity management requests
+type IdentityHandler struct {
+	identities policy.IdentityManager
+}
+
+// NewIdentityHandler creates a new identity handler
+func NewIdentityHandler(im policy.IdentityManager) *IdentityHandler {
+	return &IdentityHandler{
+		identities: im,
+	}
+}
+
+// CreateIdentity handles POST /api/v1/identities
+func (h *IdentityHandler) CreateIdentity(c *gin.Context) {
+	id, ok := bindIdentity(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.identities.GetIdentity(id.ID); err == nil {
+		c.JSON(http.StatusConflict, models.NewErrorResponse(
+			http.StatusConflict,
+			"conflict",
+			fmt.Sprintf("Identity %d already exists", id.ID),
+			nil,
+		))
+		return
+	}
+
+	if err := h.identities.SetIdentity(id); err != nil {
+		log.Errorf("Failed to add identity: %v", err)
+		respondIdentityError(c, "Failed to add identity", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, identityToResponse(id))
+}
+
+// ListIdentities handles GET /api/v1/identities
+func (h *IdentityHandler) ListIdentities(c *gin.Context) {
+	identities := h.identities.ListIdentities()
+
+	response := models.IdentityListResponse{
+		Identities: make([]models.IdentityResponse, 0, len(identities)),
+		Count:      len(identities),
+	}
+	for i := range identities {
+		response.Identities = append(response.Identities, identityToResponse(&identities[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetIdentity handles GET /api/v1/identities/:id
+func (h *IdentityHandler) GetIdentity(c *gin.Context) {
+	idNum, ok := identityParam(c)
+	if !ok {
+		return
+	}
+
+	id, err := h.identities.GetIdentity(idNum)
+	if err != nil {
+		respondIdentityError(c, fmt.Sprintf("Identity %d not found", idNum), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, identityToResponse(&id))
+}
+
+// UpdateIdentity handles PUT /api/v1/identities/:id
+func (h *IdentityHandler) UpdateIdentity(c *gin.Context) {
+	idNum, ok := identityParam(c)
+	if !ok {
+		return
+	}
+
+	id, ok := bindIdentity(c)
+	if !ok {
+		return
+	}
+
+	// Ensure identity matches
+	if id.ID != idNum {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Identity in URL does not match identity in request body",
+			nil,
+		))
+		return
+	}
+
+	if _, err := h.identities.GetIdentity(idNum); err != nil {
+		respondIdentityError(c, fmt.Sprintf("Identity %d not found", idNum), err)
+		return
+	}
+
+	if err := h.identities.SetIdentity(id); err != nil {
+		log.Errorf("Failed to update identity: %v", err)
+		respondIdentityError(c, "Failed to update identity", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, identityToResponse(id))
+}
+
+// DeleteIdentity handles DELETE /api/v1/identities/:id
+func (h *IdentityHandler) DeleteIdentity(c *gin.Context) {
+	idNum, ok := identityParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.identities.DeleteIdentity(idNum); err != nil {
+		log.Errorf("Failed to delete identity %d: %v", idNum, err)
+		respondIdentityError(c, "Failed to delete identity", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Identity %d deleted successfully", idNum),
+	})
+}
+
+// identityParam parses the identity in the URL, answering 400 if invalid
+func identityParam(c *gin.Context) (uint32, bool) {
+	idNum, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid identity",
+			err.Error(),
+		))
+		return 0, false
+	}
+	return uint32(idNum), true
+}
+
+// bindIdentity binds and validates an identity request, answering 400 if
+// invalid
+func bindIdentity(c *gin.Context) (*policy.Identity, bool) {
+	var req models.IdentityRequest
+
+	// Bind and validate JSON request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid request body",
+			err.Error(),
+		))
+		return nil, false
+	}
+
+	id := &policy.Identity{ID: req.Identity, Labels: req.Labels, CIDRs: req.CIDRs}
+
+	// Validate labels and CIDRs
+	if err := policy.ValidateIdentity(id); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid identity",
+			err.Error(),
+		))
+		return nil, false
+	}
+	return id, true
+}
+
+// respondIdentityError maps identity manager errors to HTTP statuses
+func respondIdentityError(c *gin.Context, message string, err error) {
+	status, code := http.StatusInternalServerError, "identity_error"
+	switch {
+	case errors.Is(err, policy.ErrIdentityNotFound):
+		status, code = http.StatusNotFound, "not_found"
+	case errors.Is(err, policy.ErrIdentityConflict):
+		status, code = http.StatusConflict, "conflict"
+	}
+
+	c.JSON(status, models.NewErrorResponse(status, code, message, err.Error()))
+}
+
+// identityToResponse converts an identity to its API representation
+func identityToResponse(id *policy.Identity) models.IdentityResponse {
+	resp := models.IdentityResponse{
+		Identity: id.ID,
+		Labels:   id.Labels,
+		CIDRs:    id.CIDRs,
+	}
+	if resp.CIDRs == nil {
+		resp.CIDRs = []string{}
+	}
+	return resp
+}
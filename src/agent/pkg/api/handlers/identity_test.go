@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
+	"github.com/ebpf-microsegment/src/agent/pkg/policy"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockIdentityManager is an in-memory IdentityManager
+type MockIdentityManager struct {
+	identities map[uint32]policy.Identity
+}
+
+func NewMockIdentityManager() *MockIdentityManager {
+	return &MockIdentityManager{identities: make(map[uint32]policy.Identity)}
+}
+
+func (m *MockIdentityManager) SetIdentity(id *policy.Identity) error {
+	for _, other := range m.identities {
+		if other.ID != id.ID && fmt.Sprint(other.Labels) == fmt.Sprint(id.Labels) {
+			return fmt.Errorf("%w: labels %v", policy.ErrIdentityConflict, id.Labels)
+		}
+	}
+	m.identities[id.ID] = *id
+	return nil
+}
+
+func (m *MockIdentityManager) DeleteIdentity(id uint32) error {
+	if _, ok := m.identities[id]; !ok {
+		return fmt.Errorf("%w: %d", policy.ErrIdentityNotFound, id)
+	}
+	delete(m.identities, id)
+	return nil
+}
+
+func (m *MockIdentityManager) GetIdentity(id uint32) (policy.Identity, error) {
+	identity, ok := m.identities[id]
+	if !ok {
+		return policy.Identity{}, fmt.Errorf("%w: %d", policy.ErrIdentityNotFound, id)
+	}
+	return identity, nil
+}
+
+func (m *MockIdentityManager) ListIdentities() []policy.Identity {
+	result := make([]policy.Identity, 0, len(m.identities))
+	for _, id := range m.identities {
+		result = append(result, id)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// setupIdentityTestRouter creates a test router with identity handler
+func setupIdentityTestRouter(im *MockIdentityManager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	handler := NewIdentityHandler(im)
+	router.POST("/api/v1/identities", handler.CreateIdentity)
+	router.GET("/api/v1/identities", handler.ListIdentities)
+	router.GET("/api/v1/identities/:id", handler.GetIdentity)
+	router.PUT("/api/v1/identities/:id", handler.UpdateIdentity)
+	router.DELETE("/api/v1/identities/:id", handler.DeleteIdentity)
+
+	return router
+}
+
+func serveIdentity(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestCreateIdentity tests creating identities
+func TestCreateIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"create", `{"identity":200,"labels":["app=db"],"cidrs":["10.0.2.0/24","2001:db8::7"]}`, http.StatusCreated},
+		{"without cidrs", `{"identity":200,"labels":["app=db"]}`, http.StatusCreated},
+		{"existing identity", `{"identity":100,"labels":["app=db"]}`, http.StatusConflict},
+		{"labels of another identity", `{"identity":200,"labels":["app=web"]}`, http.StatusConflict},
+		{"missing labels", `{"identity":200,"cidrs":["10.0.2.0/24"]}`, http.StatusBadRequest},
+		{"invalid label", `{"identity":200,"labels":["db"]}`, http.StatusBadRequest},
+		{"invalid cidr", `{"identity":200,"labels":["app=db"],"cidrs":["10.0.2.0/40"]}`, http.StatusBadRequest},
+		{"reserved identity", `{"identity":0,"labels":["app=db"]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := NewMockIdentityManager()
+			require.NoError(t, im.SetIdentity(&policy.Identity{ID: 100, Labels: []string{"app=web"}}))
+			router := setupIdentityTestRouter(im)
+
+			w := serveIdentity(router, http.MethodPost, "/api/v1/identities", tt.body)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var response models.IdentityResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, uint32(200), response.Identity)
+			assert.Equal(t, []string{"app=db"}, response.Labels)
+			assert.NotNil(t, response.CIDRs)
+		})
+	}
+}
+
+// TestUpdateIdentity tests moving an identity to new addresses
+func TestUpdateIdentity(t *testing.T) {
+	im := NewMockIdentityManager()
+	require.NoError(t, im.SetIdentity(&policy.Identity{ID: 100, Labels: []string{"app=web"}, CIDRs: []string{"10.0.1.5"}}))
+	router := setupIdentityTestRouter(im)
+
+	w := serveIdentity(router, http.MethodPut, "/api/v1/identities/100",
+		`{"identity":100,"labels":["app=web"],"cidrs":["10.0.1.6","10.0.1.7"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	id, err := im.GetIdentity(100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.1.6", "10.0.1.7"}, id.CIDRs)
+
+	w = serveIdentity(router, http.MethodPut, "/api/v1/identities/101", `{"identity":100,"labels":["app=web"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveIdentity(router, http.MethodPut, "/api/v1/identities/300", `{"identity":300,"labels":["app=cache"]}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestListAndDeleteIdentities tests listing, reading and deleting identities
+func TestListAndDeleteIdentities(t *testing.T) {
+	im := NewMockIdentityManager()
+	require.NoError(t, im.SetIdentity(&policy.Identity{ID: 200, Labels: []string{"app=db"}}))
+	require.NoError(t, im.SetIdentity(&policy.Identity{ID: 100, Labels: []string{"app=web"}, CIDRs: []string{"10.0.1.0/24"}}))
+	router := setupIdentityTestRouter(im)
+
+	w := serveIdentity(router, http.MethodGet, "/api/v1/identities", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list models.IdentityListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Equal(t, 2, list.Count)
+	assert.Equal(t, uint32(100), list.Identities[0].Identity)
+	assert.Equal(t, []string{"10.0.1.0/24"}, list.Identities[0].CIDRs)
+
+	w = serveIdentity(router, http.MethodGet, "/api/v1/identities/200", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveIdentity(router, http.MethodGet, "/api/v1/identities/abc", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveIdentity(router, http.MethodDelete, "/api/v1/identities/200", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveIdentity(router, http.MethodDelete, "/api/v1/identities/200", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serveIdentity(router, http.MethodGet, "/api/v1/identities/200", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
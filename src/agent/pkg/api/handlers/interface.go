@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// InterfaceHandler handles interface attach/detach requests
+type InterfaceHandler struct {
+	interfaces dataplane.InterfaceManager
+}
+
+// NewInterfaceHandler creates a new interface handler
+func NewInterfaceHandler(im dataplane.InterfaceManager) *InterfaceHandler {
+	return &InterfaceHandler{
+		interfaces: im,
+	}
+}
+
+// ListInterfaces handles GET /api/v1/interfaces
+func (h *InterfaceHandler) ListInterfaces(c *gin.Context) {
+	interfaces := h.interfaces.ListInterfaces()
+
+	response := models.InterfaceListResponse{
+		Interfaces: interfacesToResponse(interfaces),
+		Count:      len(interfaces),
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AttachInterface handles POST /api/v1/interfaces
+func (h *InterfaceHandler) AttachInterface(c *gin.Context) {
+	var req models.InterfaceRequest
+
+	// Bind and validate JSON request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid request body",
+			err.Error(),
+		))
+		return
+	}
+
+	if err := h.interfaces.AttachInterface(req.Name); err != nil {
+		log.Errorf("Failed to attach interface %s: %v", req.Name, err)
+		respondInterfaceError(c, "Failed to attach interface", err)
+		return
+	}
+
+	// Return the new attachment
+	for _, st := range h.interfaces.ListInterfaces() {
+		if st.Name == req.Name {
+			c.JSON(http.StatusCreated, interfaceToResponse(&st))
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, models.InterfaceResponse{Name: req.Name})
+}
+
+// DetachInterface handles DELETE /api/v1/interfaces/:name
+func (h *InterfaceHandler) DetachInterface(c *gin.Context) {
+	name := c.Param("name")
+
+	if err := h.interfaces.DetachInterface(name); err != nil {
+		log.Errorf("Failed to detach interface %s: %v", name, err)
+		respondInterfaceError(c, "Failed to detach interface", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Interface %s detached successfully", name),
+	})
+}
+
+// SetInterfaceMonitor handles PUT /api/v1/interfaces/:name/monitor
+func (h *InterfaceHandler) SetInterfaceMonitor(c *gin.Context) {
+	name := c.Param("name")
+
+	var req models.InterfaceMonitorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid request body",
+			err.Error(),
+		))
+		return
+	}
+
+	if err := h.interfaces.SetInterfaceMonitor(name, *req.Enabled); err != nil {
+		log.Errorf("Failed to set monitor mode on interface %s: %v", name, err)
+		respondInterfaceError(c, "Failed to set monitor mode", err)
+		return
+	}
+
+	for _, st := range h.interfaces.ListInterfaces() {
+		if st.Name == name {
+			c.JSON(http.StatusOK, interfaceToResponse(&st))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.InterfaceResponse{Name: name, Monitor: *req.Enabled})
+}
+
+// respondInterfaceError maps data plane interface errors to HTTP responses
+func respondInterfaceError(c *gin.Context, message string, err error) {
+	status, code := http.StatusInternalServerError, "dataplane_error"
+	switch {
+	case errors.Is(err, dataplane.ErrInterfaceNotFound),
+		errors.Is(err, dataplane.ErrInterfaceNotAttached):
+		status, code = http.StatusNotFound, "not_found"
+	case errors.Is(err, dataplane.ErrInterfaceAttached):
+		status, code = http.StatusConflict, "conflict"
+	}
+
+	c.JSON(status, models.NewErrorResponse(status, code, message, err.Error()))
+}
+
+// interfacesToResponse converts attached interfaces to their API representation
+func interfacesToResponse(interfaces []dataplane.InterfaceStatus) []models.InterfaceResponse {
+	result := make([]models.InterfaceResponse, 0, len(interfaces))
+	for i := range interfaces {
+		result = append(result, interfaceToResponse(&interfaces[i]))
+	}
+	return result
+}
+
+// interfaceToResponse converts one attached interface to its API representation
+func interfaceToResponse(st *dataplane.InterfaceStatus) models.InterfaceResponse {
+	resp := models.InterfaceResponse{
+		Name:       st.Name,
+		Index:      st.Index,
+		Hooks:      make([]models.HookResponse, 0, len(st.Hooks)),
+		AttachedAt: st.AttachedAt,
+		Monitor:    st.Monitor,
+	}
+	for _, hook := range st.Hooks {
+		resp.Hooks = append(resp.Hooks, models.HookResponse{
+			Direction: hook.Direction.String(),
+			Mode:      string(hook.Mode),
+		})
+	}
+	return resp
+}
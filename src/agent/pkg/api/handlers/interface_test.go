@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockInterfaceManager is an in-memory InterfaceManager; only interfaces
+// listed in available can be attached
+type MockInterfaceManager struct {
+	MockDataPlane
+	available map[string]int
+	attached  map[string]dataplane.InterfaceStatus
+}
+
+func NewMockInterfaceManager(available ...string) *MockInterfaceManager {
+	m := &MockInterfaceManager{
+		MockDataPlane: *NewMockDataPlane(),
+		available:     make(map[string]int),
+		attached:      make(map[string]dataplane.InterfaceStatus),
+	}
+	for i, name := range available {
+		m.available[name] = i + 1
+	}
+	return m
+}
+
+func (m *MockInterfaceManager) AttachInterface(name string) error {
+	if _, ok := m.attached[name]; ok {
+		return fmt.Errorf("%s: %w", name, dataplane.ErrInterfaceAttached)
+	}
+	index, ok := m.available[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, dataplane.ErrInterfaceNotFound)
+	}
+	m.attached[name] = dataplane.InterfaceStatus{
+		Name:  name,
+		Index: index,
+		Hooks: []dataplane.HookStatus{{Direction: dataplane.DirectionIngress, Mode: dataplane.AttachModeLegacy}},
+	}
+	return nil
+}
+
+func (m *MockInterfaceManager) DetachInterface(name string) error {
+	if _, ok := m.attached[name]; !ok {
+		return fmt.Errorf("%s: %w", name, dataplane.ErrInterfaceNotAttached)
+	}
+	delete(m.attached, name)
+	return nil
+}
+
+func (m *MockInterfaceManager) ListInterfaces() []dataplane.InterfaceStatus {
+	result := make([]dataplane.InterfaceStatus, 0, len(m.attached))
+	for _, st := range m.attached {
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (m *MockInterfaceManager) SetInterfaceMonitor(name string, enabled bool) error {
+	st, ok := m.attached[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, dataplane.ErrInterfaceNotAttached)
+	}
+	st.Monitor = enabled
+	m.attached[name] = st
+	return nil
+}
+
+// setupInterfaceTestRouter creates a test router with interface handler
+func setupInterfaceTestRouter(im *MockInterfaceManager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	handler := NewInterfaceHandler(im)
+	router.GET("/api/v1/interfaces", handler.ListInterfaces)
+	router.POST("/api/v1/interfaces", handler.AttachInterface)
+	router.DELETE("/api/v1/interfaces/:name", handler.DetachInterface)
+	router.PUT("/api/v1/interfaces/:name/monitor", handler.SetInterfaceMonitor)
+
+	return router
+}
+
+// TestAttachInterface tests attaching interfaces at runtime
+func TestAttachInterface(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"attach", `{"name":"veth0"}`, http.StatusCreated},
+		{"already attached", `{"name":"eth0"}`, http.StatusConflict},
+		{"unknown interface", `{"name":"eth9"}`, http.StatusNotFound},
+		{"missing name", `{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := NewMockInterfaceManager("eth0", "veth0")
+			require.NoError(t, im.AttachInterface("eth0"))
+			router := setupInterfaceTestRouter(im)
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/interfaces", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var response models.InterfaceResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "veth0", response.Name)
+			assert.Equal(t, 2, response.Index)
+			require.Len(t, response.Hooks, 1)
+			assert.Equal(t, "ingress", response.Hooks[0].Direction)
+			assert.Equal(t, "legacy", response.Hooks[0].Mode)
+		})
+	}
+}
+
+// TestDetachInterface tests detaching interfaces at runtime
+func TestDetachInterface(t *testing.T) {
+	im := NewMockInterfaceManager("eth0")
+	require.NoError(t, im.AttachInterface("eth0"))
+	router := setupInterfaceTestRouter(im)
+
+	req, _ := http.NewRequest(http.MethodDelete, "/api/v1/interfaces/eth0", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, im.ListInterfaces())
+
+	// Detaching again fails
+	req, _ = http.NewRequest(http.MethodDelete, "/api/v1/interfaces/eth0", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestSetInterfaceMonitor tests switching monitor mode per interface
+func TestSetInterfaceMonitor(t *testing.T) {
+	tests := []struct {
+		name        string
+		iface       string
+		body        string
+		wantStatus  int
+		wantMonitor bool
+	}{
+		{"enable", "eth0", `{"enabled":true}`, http.StatusOK, true},
+		{"disable", "eth0", `{"enabled":false}`, http.StatusOK, false},
+		{"not attached", "eth1", `{"enabled":true}`, http.StatusNotFound, false},
+		{"missing enabled", "eth0", `{}`, http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := NewMockInterfaceManager("eth0", "eth1")
+			require.NoError(t, im.AttachInterface("eth0"))
+			router := setupInterfaceTestRouter(im)
+
+			url := "/api/v1/interfaces/" + tt.iface + "/monitor"
+			req, _ := http.NewRequest(http.MethodPut, url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response models.InterfaceResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.iface, response.Name)
+			assert.Equal(t, tt.wantMonitor, response.Monitor)
+			assert.Equal(t, tt.wantMonitor, im.ListInterfaces()[0].Monitor)
+		})
+	}
+}
+
+// TestListInterfaces tests listing attached interfaces
+func TestListInterfaces(t *testing.T) {
+	im := NewMockInterfaceManager("eth0", "eth1", "lo")
+	require.NoError(t, im.AttachInterface("eth1"))
+	require.NoError(t, im.AttachInterface("eth0"))
+	router := setupInterfaceTestRouter(im)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/interfaces", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.InterfaceListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.Count)
+	assert.Equal(t, "eth0", response.Interfaces[0].Name)
+	assert.Equal(t, "eth1", response.Interfaces[1].Name)
+}
+
+// TestGetStatus_Interfaces tests reporting attached interfaces in status
+func TestGetStatus_Interfaces(t *testing.T) {
+	im := NewMockInterfaceManager("eth0", "veth0")
+	require.NoError(t, im.AttachInterface("eth0"))
+	require.NoError(t, im.AttachInterface("veth0"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/v1/status", NewHealthHandler(im, NewMockPolicyManagerForHealth()).GetStatus)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "eth0,veth0", response.Interface)
+	require.Len(t, response.Interfaces, 2)
+	assert.Equal(t, "legacy", response.Interfaces[1].Hooks[0].Mode)
+}
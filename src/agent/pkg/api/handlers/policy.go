@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -12,7 +13,7 @@ import (
 )
 
 // PolicyHandler handles policy management requests
-type PolicyHandler struct{
+type PolicyHandler struct {
 	policyManager policy.Manager
 }
 
@@ -39,40 +40,28 @@ func (h *PolicyHandler) CreatePolicy(c *gin.Context) {
 	}
 
 	// Convert to internal policy format
-	p := &policy.Policy{
-		RuleID:   req.RuleID,
-		SrcIP:    req.SrcIP,
-		DstIP:    req.DstIP,
-		SrcPort:  req.SrcPort,
-		DstPort:  req.DstPort,
-		Protocol: req.Protocol,
-		Action:   req.Action,
-		Priority: req.Priority,
+	p := policyFromRequest(&req)
+
+	// Validate the fields the request binding can't
+	if err := policy.Validate(p); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid policy",
+			err.Error(),
+		))
+		return
 	}
 
 	// Add policy
 	if err := h.policyManager.AddPolicy(p); err != nil {
 		log.Errorf("Failed to add policy: %v", err)
-		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
-			http.StatusInternalServerError,
-			"policy_error",
-			"Failed to add policy",
-			err.Error(),
-		))
+		respondPolicyError(c, "Failed to add policy", err)
 		return
 	}
 
 	// Return created policy
-	response := models.PolicyResponse{
-		RuleID:   p.RuleID,
-		SrcIP:    p.SrcIP,
-		DstIP:    p.DstIP,
-		SrcPort:  p.SrcPort,
-		DstPort:  p.DstPort,
-		Protocol: p.Protocol,
-		Action:   p.Action,
-		Priority: p.Priority,
-	}
+	response := policyToResponse(p)
 
 	c.JSON(http.StatusCreated, response)
 }
@@ -95,16 +84,7 @@ func (h *PolicyHandler) ListPolicies(c *gin.Context) {
 	// Convert to response format
 	var policyResponses []models.PolicyResponse
 	for _, p := range policies {
-		policyResponses = append(policyResponses, models.PolicyResponse{
-			RuleID:   p.RuleID,
-			SrcIP:    p.SrcIP,
-			DstIP:    p.DstIP,
-			SrcPort:  p.SrcPort,
-			DstPort:  p.DstPort,
-			Protocol: p.Protocol,
-			Action:   p.Action,
-			Priority: p.Priority,
-		})
+		policyResponses = append(policyResponses, policyToResponse(&p))
 	}
 
 	response := models.PolicyListResponse{
@@ -115,6 +95,19 @@ func (h *PolicyHandler) ListPolicies(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// respondPolicyError maps policy manager errors to HTTP statuses
+func respondPolicyError(c *gin.Context, message string, err error) {
+	status, code := http.StatusInternalServerError, "policy_error"
+	switch {
+	case errors.Is(err, policy.ErrUnsupportedRule):
+		status, code = http.StatusBadRequest, "validation_error"
+	case errors.Is(err, policy.ErrPolicyExists):
+		status, code = http.StatusConflict, "conflict"
+	}
+
+	c.JSON(status, models.NewErrorResponse(status, code, message, err.Error()))
+}
+
 // GetPolicy handles GET /api/v1/policies/:id
 func (h *PolicyHandler) GetPolicy(c *gin.Context) {
 	// Get rule ID from URL parameter
@@ -146,17 +139,7 @@ func (h *PolicyHandler) GetPolicy(c *gin.Context) {
 	// Find policy with matching rule ID
 	for _, p := range policies {
 		if p.RuleID == uint32(ruleID) {
-			response := models.PolicyResponse{
-				RuleID:   p.RuleID,
-				SrcIP:    p.SrcIP,
-				DstIP:    p.DstIP,
-				SrcPort:  p.SrcPort,
-				DstPort:  p.DstPort,
-				Protocol: p.Protocol,
-				Action:   p.Action,
-				Priority: p.Priority,
-			}
-			c.JSON(http.StatusOK, response)
+			c.JSON(http.StatusOK, policyToResponse(&p))
 			return
 		}
 	}
@@ -210,46 +193,29 @@ func (h *PolicyHandler) UpdatePolicy(c *gin.Context) {
 	}
 
 	// Convert to internal policy format
-	p := &policy.Policy{
-		RuleID:   req.RuleID,
-		SrcIP:    req.SrcIP,
-		DstIP:    req.DstIP,
-		SrcPort:  req.SrcPort,
-		DstPort:  req.DstPort,
-		Protocol: req.Protocol,
-		Action:   req.Action,
-		Priority: req.Priority,
-	}
+	p := policyFromRequest(&req)
 
-	// Delete old policy first
-	if err := h.policyManager.DeletePolicy(p); err != nil {
-		// If delete fails, policy might not exist
-		log.Warnf("Failed to delete old policy during update: %v", err)
+	// Validate the fields the request binding can't
+	if err := policy.Validate(p); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid policy",
+			err.Error(),
+		))
+		return
 	}
 
-	// Add updated policy
-	if err := h.policyManager.AddPolicy(p); err != nil {
+	// Replace the installed rule with the same ID; the old entries keep
+	// enforcing until the new ones are in place
+	if err := h.policyManager.UpdatePolicy(p); err != nil {
 		log.Errorf("Failed to update policy: %v", err)
-		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
-			http.StatusInternalServerError,
-			"policy_error",
-			"Failed to update policy",
-			err.Error(),
-		))
+		respondPolicyError(c, "Failed to update policy", err)
 		return
 	}
 
 	// Return updated policy
-	response := models.PolicyResponse{
-		RuleID:   p.RuleID,
-		SrcIP:    p.SrcIP,
-		DstIP:    p.DstIP,
-		SrcPort:  p.SrcPort,
-		DstPort:  p.DstPort,
-		Protocol: p.Protocol,
-		Action:   p.Action,
-		Priority: p.Priority,
-	}
+	response := policyToResponse(p)
 
 	c.JSON(http.StatusOK, response)
 }
@@ -318,3 +284,73 @@ func (h *PolicyHandler) DeletePolicy(c *gin.Context) {
 	})
 }
 
+// policyFromRequest converts an API request into the internal policy format
+func policyFromRequest(req *models.PolicyRequest) *policy.Policy {
+	return &policy.Policy{
+		RuleID:       req.RuleID,
+		SrcIP:        req.SrcIP,
+		DstIP:        req.DstIP,
+		SrcPort:      req.SrcPort,
+		DstPort:      req.DstPort,
+		SrcPorts:     req.SrcPorts,
+		DstPorts:     req.DstPorts,
+		SrcPortRange: req.SrcPortRange,
+		DstPortRange: req.DstPortRange,
+		Protocol:     req.Protocol,
+		Action:       req.Action,
+		Priority:     req.Priority,
+		Direction:    req.Direction,
+		Monitor:      req.Monitor,
+		IcmpType:     req.IcmpType,
+		IcmpCode:     req.IcmpCode,
+		ConnStates:   req.ConnStates,
+		VlanID:       req.VlanID,
+		VNI:          req.VNI,
+		Rate:         req.Rate,
+		Burst:        req.Burst,
+		RateUnit:     req.RateUnit,
+		SessionLimit: req.SessionLimit,
+		Mirror:       req.Mirror,
+		MirrorSample: req.MirrorSample,
+		SrcIdentity:  req.SrcIdentity,
+		DstIdentity:  req.DstIdentity,
+	}
+}
+
+// policyToResponse converts an internal policy into the API response format
+func policyToResponse(p *policy.Policy) models.PolicyResponse {
+	direction := p.Direction
+	if direction == "" {
+		direction = "both"
+	}
+
+	return models.PolicyResponse{
+		RuleID:       p.RuleID,
+		SrcIP:        p.SrcIP,
+		DstIP:        p.DstIP,
+		SrcPort:      p.SrcPort,
+		DstPort:      p.DstPort,
+		SrcPorts:     p.SrcPorts,
+		DstPorts:     p.DstPorts,
+		SrcPortRange: p.SrcPortRange,
+		DstPortRange: p.DstPortRange,
+		Protocol:     p.Protocol,
+		Action:       p.Action,
+		Priority:     p.Priority,
+		Direction:    direction,
+		Monitor:      p.Monitor,
+		IcmpType:     p.IcmpType,
+		IcmpCode:     p.IcmpCode,
+		ConnStates:   p.ConnStates,
+		VlanID:       p.VlanID,
+		VNI:          p.VNI,
+		Rate:         p.Rate,
+		Burst:        p.Burst,
+		RateUnit:     p.RateUnit,
+		SessionLimit: p.SessionLimit,
+		Mirror:       p.Mirror,
+		MirrorSample: p.MirrorSample,
+		SrcIdentity:  p.SrcIdentity,
+		DstIdentity:  p.DstIdentity,
+	}
+}
@@ -26,6 +26,11 @@ func (m *MockPolicyManager) AddPolicy(p *policy.Policy) error {
 	return args.Error(0)
 }
 
+func (m *MockPolicyManager) UpdatePolicy(p *policy.Policy) error {
+	args := m.Called(p)
+	return args.Error(0)
+}
+
 func (m *MockPolicyManager) DeletePolicy(p *policy.Policy) error {
 	args := m.Called(p)
 	return args.Error(0)
@@ -229,6 +234,639 @@ func TestCreatePolicy_InvalidProtocol(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
+// TestCreatePolicy_IPv6 tests policy creation with IPv6 addresses
+func TestCreatePolicy_IPv6(t *testing.T) {
+	// Setup
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+
+	// Mock expectations
+	mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
+
+	// Prepare request
+	reqBody := models.PolicyRequest{
+		RuleID:   10,
+		SrcIP:    "2001:db8:1::/64",
+		DstIP:    "2001:db8::10",
+		DstPort:  443,
+		Protocol: "tcp",
+		Action:   "allow",
+	}
+
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.PolicyResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8:1::/64", response.SrcIP)
+	assert.Equal(t, "2001:db8::10", response.DstIP)
+
+	mockPM.AssertExpectations(t)
+}
+
+// TestCreatePolicy_MixedAddressFamilies tests that IPv4 and IPv6 can't be mixed
+func TestCreatePolicy_MixedAddressFamilies(t *testing.T) {
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+
+	reqBody := models.PolicyRequest{
+		RuleID:   11,
+		SrcIP:    "10.0.0.0/8",
+		DstIP:    "2001:db8::10",
+		DstPort:  443,
+		Protocol: "tcp",
+		Action:   "deny",
+	}
+
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockPM.AssertNotCalled(t, "AddPolicy", mock.Anything)
+}
+
+// TestCreatePolicy_UnsupportedRule tests that rules the hooks can't
+// enforce are rejected as invalid
+func TestCreatePolicy_UnsupportedRule(t *testing.T) {
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+
+	mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).
+		Return(fmt.Errorf("%w: vlan_id", policy.ErrUnsupportedRule))
+
+	reqBody := models.PolicyRequest{
+		RuleID:   12,
+		SrcIP:    "10.0.0.0/8",
+		DstIP:    "192.168.1.10",
+		Protocol: "tcp",
+		Action:   "allow",
+		VlanID:   10,
+	}
+
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response models.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "validation_error", response.Error)
+	mockPM.AssertExpectations(t)
+}
+
+// TestCreatePolicy_Exists tests that creating a policy with a rule ID that
+// is already installed is a conflict
+func TestCreatePolicy_Exists(t *testing.T) {
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+
+	mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).
+		Return(fmt.Errorf("%w: rule_id=13", policy.ErrPolicyExists))
+
+	reqBody := models.PolicyRequest{
+		RuleID:   13,
+		SrcIP:    "10.0.0.0/8",
+		DstIP:    "192.168.1.10",
+		Protocol: "tcp",
+		Action:   "allow",
+	}
+
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var response models.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "conflict", response.Error)
+	mockPM.AssertExpectations(t)
+	mockPM.AssertNotCalled(t, "UpdatePolicy", mock.Anything)
+}
+
+// TestCreatePolicy_Direction tests direction handling in create requests
+func TestCreatePolicy_Direction(t *testing.T) {
+	testCases := []struct {
+		name           string
+		direction      string
+		expectedStatus int
+		expectedDir    string
+	}{
+		{name: "egress", direction: "egress", expectedStatus: http.StatusCreated, expectedDir: "egress"},
+		{name: "default both", direction: "", expectedStatus: http.StatusCreated, expectedDir: "both"},
+		{name: "invalid", direction: "sideways", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPM := new(MockPolicyManager)
+			router := setupTestRouter(mockPM)
+			mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
+
+			reqBody := models.PolicyRequest{
+				RuleID:    1,
+				SrcIP:     "10.0.0.1",
+				DstIP:     "10.0.0.2",
+				DstPort:   80,
+				Protocol:  "tcp",
+				Action:    "allow",
+				Direction: tc.direction,
+			}
+
+			jsonBody, _ := json.Marshal(reqBody)
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			var response models.PolicyResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tc.expectedDir, response.Direction)
+		})
+	}
+}
+
+// TestCreatePolicy_Monitor tests creating a deny rule in monitor mode
+func TestCreatePolicy_Monitor(t *testing.T) {
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+	mockPM.On("AddPolicy", mock.MatchedBy(func(p *policy.Policy) bool {
+		return p.Monitor
+	})).Return(nil)
+
+	reqBody := models.PolicyRequest{
+		RuleID:   1,
+		SrcIP:    "10.0.0.0/24",
+		DstIP:    "10.0.1.1",
+		DstPort:  22,
+		Protocol: "tcp",
+		Action:   "deny",
+		Monitor:  true,
+	}
+
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.PolicyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Monitor)
+	mockPM.AssertExpectations(t)
+}
+
+// TestCreatePolicy_Ports tests creating policies with port lists and ranges
+func TestCreatePolicy_Ports(t *testing.T) {
+	testCases := []struct {
+		name           string
+		srcPortRange   string
+		dstPorts       []uint16
+		dstPortRange   string
+		expectedStatus int
+	}{
+		{name: "port list", dstPorts: []uint16{80, 443}, expectedStatus: http.StatusCreated},
+		{name: "port ranges", srcPortRange: "1024-65535", dstPortRange: "8000-8080,9000-9100", expectedStatus: http.StatusCreated},
+		{name: "reversed range", dstPortRange: "8080-8000", expectedStatus: http.StatusBadRequest},
+		{name: "malformed range", dstPortRange: "80-", expectedStatus: http.StatusBadRequest},
+		{name: "zero in list", dstPorts: []uint16{0}, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPM := new(MockPolicyManager)
+			router := setupTestRouter(mockPM)
+			mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
+
+			reqBody := models.PolicyRequest{
+				RuleID:       1,
+				SrcIP:        "10.0.0.0/24",
+				DstIP:        "10.0.1.1",
+				DstPorts:     tc.dstPorts,
+				SrcPortRange: tc.srcPortRange,
+				DstPortRange: tc.dstPortRange,
+				Protocol:     "tcp",
+				Action:       "allow",
+			}
+
+			jsonBody, _ := json.Marshal(reqBody)
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus != http.StatusCreated {
+				mockPM.AssertNotCalled(t, "AddPolicy", mock.Anything)
+				return
+			}
+
+			var response models.PolicyResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tc.dstPorts, response.DstPorts)
+			assert.Equal(t, tc.srcPortRange, response.SrcPortRange)
+			assert.Equal(t, tc.dstPortRange, response.DstPortRange)
+		})
+	}
+}
+
+// TestCreatePolicy_ICMP tests creating policies matching ICMP type and code
+func TestCreatePolicy_ICMP(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedType   *uint8
+		expectedCode   *uint8
+	}{
+		{
+			name:           "echo reply",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.1","protocol":"icmp","action":"allow","icmp_type":0}`,
+			expectedStatus: http.StatusCreated,
+			expectedType:   uint8Ptr(0),
+		},
+		{
+			name:           "fragmentation needed",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.1","protocol":"icmp","action":"allow","icmp_type":3,"icmp_code":4}`,
+			expectedStatus: http.StatusCreated,
+			expectedType:   uint8Ptr(3),
+			expectedCode:   uint8Ptr(4),
+		},
+		{
+			name:           "code without type",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.1","protocol":"icmp","action":"deny","icmp_code":4}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "type on tcp",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.1","protocol":"tcp","action":"deny","icmp_type":8}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "port on icmp",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.1","protocol":"icmp","action":"deny","dst_port":80}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPM := new(MockPolicyManager)
+			router := setupTestRouter(mockPM)
+			mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus != http.StatusCreated {
+				mockPM.AssertNotCalled(t, "AddPolicy", mock.Anything)
+				return
+			}
+
+			var response models.PolicyResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tc.expectedType, response.IcmpType)
+			assert.Equal(t, tc.expectedCode, response.IcmpCode)
+		})
+	}
+}
+
+func uint8Ptr(v uint8) *uint8 { return &v }
+
+// TestCreatePolicy_ConnStates tests creating policies matching connection state
+func TestCreatePolicy_ConnStates(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedStates []string
+	}{
+		{
+			name:           "established and related",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.1","protocol":"tcp","action":"allow","conn_states":["established","related"]}`,
+			expectedStatus: http.StatusCreated,
+			expectedStates: []string{"established", "related"},
+		},
+		{
+			name:           "unknown state",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.1","protocol":"tcp","action":"deny","conn_states":["closing"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPM := new(MockPolicyManager)
+			router := setupTestRouter(mockPM)
+			mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus != http.StatusCreated {
+				mockPM.AssertNotCalled(t, "AddPolicy", mock.Anything)
+				return
+			}
+
+			var response models.PolicyResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tc.expectedStates, response.ConnStates)
+		})
+	}
+}
+
+// TestCreatePolicy_Encap tests creating policies scoped to a VLAN or VNI
+func TestCreatePolicy_Encap(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedVlan   uint16
+		expectedVNI    uint32
+	}{
+		{
+			name:           "vlan and vni",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.0/24","protocol":"any","action":"deny","vlan_id":100,"vni":5001}`,
+			expectedStatus: http.StatusCreated,
+			expectedVlan:   100,
+			expectedVNI:    5001,
+		},
+		{
+			name:           "reserved vlan",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.0/24","protocol":"any","action":"deny","vlan_id":4095}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "vni too large",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.0/24","protocol":"any","action":"deny","vni":16777216}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPM := new(MockPolicyManager)
+			router := setupTestRouter(mockPM)
+			mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus != http.StatusCreated {
+				mockPM.AssertNotCalled(t, "AddPolicy", mock.Anything)
+				return
+			}
+
+			var response models.PolicyResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tc.expectedVlan, response.VlanID)
+			assert.Equal(t, tc.expectedVNI, response.VNI)
+		})
+	}
+}
+
+// TestCreatePolicy_RateLimit tests the token bucket of rate_limit policies
+func TestCreatePolicy_RateLimit(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedRate   uint64
+		expectedUnit   string
+	}{
+		{
+			name:           "packets per second",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","dst_port":53,"protocol":"udp","action":"rate_limit","rate":100,"burst":200}`,
+			expectedStatus: http.StatusCreated,
+			expectedRate:   100,
+		},
+		{
+			name:           "connections per second",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","dst_port":5432,"protocol":"tcp","action":"rate_limit","rate":50,"rate_unit":"connections"}`,
+			expectedStatus: http.StatusCreated,
+			expectedRate:   50,
+			expectedUnit:   "connections",
+		},
+		{
+			name:           "bytes per second",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","protocol":"any","action":"rate_limit","rate":1048576,"rate_unit":"bytes"}`,
+			expectedStatus: http.StatusCreated,
+			expectedRate:   1048576,
+			expectedUnit:   "bytes",
+		},
+		{
+			name:           "missing rate",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","protocol":"tcp","action":"rate_limit"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "rate without rate_limit",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","protocol":"tcp","action":"allow","rate":100}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown unit",
+			body:           `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","protocol":"tcp","action":"rate_limit","rate":100,"rate_unit":"bits"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPM := new(MockPolicyManager)
+			router := setupTestRouter(mockPM)
+			mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
+
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus != http.StatusCreated {
+				mockPM.AssertNotCalled(t, "AddPolicy", mock.Anything)
+				return
+			}
+
+			var response models.PolicyResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "rate_limit", response.Action)
+			assert.Equal(t, tc.expectedRate, response.Rate)
+			assert.Equal(t, tc.expectedUnit, response.RateUnit)
+		})
+	}
+}
+
+// TestCreatePolicy_SessionLimit tests passing a per-policy session limit
+func TestCreatePolicy_SessionLimit(t *testing.T) {
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+	mockPM.On("AddPolicy", mock.MatchedBy(func(p *policy.Policy) bool {
+		return p.SessionLimit == 25
+	})).Return(nil)
+
+	body := `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","dst_port":443,"protocol":"tcp","action":"allow","session_limit":25}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockPM.AssertExpectations(t)
+
+	var response models.PolicyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, uint32(25), response.SessionLimit)
+}
+
+// TestCreatePolicy_Mirror tests passing a mirror target
+func TestCreatePolicy_Mirror(t *testing.T) {
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+	mockPM.On("AddPolicy", mock.MatchedBy(func(p *policy.Policy) bool {
+		return p.Mirror == "lo" && p.MirrorSample == 10
+	})).Return(nil)
+
+	body := `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","dst_port":443,"protocol":"tcp","action":"allow","mirror":"lo","mirror_sample":10}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockPM.AssertExpectations(t)
+
+	var response models.PolicyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "lo", response.Mirror)
+	assert.Equal(t, uint32(10), response.MirrorSample)
+}
+
+// TestCreatePolicy_InvalidMirror tests rejection of unknown mirror interfaces
+func TestCreatePolicy_InvalidMirror(t *testing.T) {
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+
+	body := `{"rule_id":1,"src_ip":"0.0.0.0/0","dst_ip":"10.0.1.5","protocol":"tcp","action":"allow","mirror":"nonexistent0"}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockPM.AssertNotCalled(t, "AddPolicy", mock.Anything)
+}
+
+// TestCreatePolicy_Identity tests policies between identities without addresses
+func TestCreatePolicy_Identity(t *testing.T) {
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+	mockPM.On("AddPolicy", mock.MatchedBy(func(p *policy.Policy) bool {
+		return p.SrcIdentity == 100 && p.DstIdentity == 200 && p.SrcIP == "" && p.DstIP == ""
+	})).Return(nil)
+
+	body := `{"rule_id":1,"src_identity":100,"dst_identity":200,"dst_port":5432,"protocol":"tcp","action":"allow"}`
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockPM.AssertExpectations(t)
+
+	var response models.PolicyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, uint32(100), response.SrcIdentity)
+	assert.Equal(t, uint32(200), response.DstIdentity)
+
+	// An address is still required on a side without an identity
+	body = `{"rule_id":2,"src_identity":100,"dst_port":5432,"protocol":"tcp","action":"allow"}`
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestCreatePolicy_InvalidIP tests rejection of malformed addresses
+func TestCreatePolicy_InvalidIP(t *testing.T) {
+	// Setup
+	mockPM := new(MockPolicyManager)
+	router := setupTestRouter(mockPM)
+
+	// Prepare request with invalid source address
+	reqBody := map[string]interface{}{
+		"rule_id":  1,
+		"src_ip":   "2001:db8::zz",
+		"dst_ip":   "10.0.0.1",
+		"protocol": "tcp",
+		"action":   "allow",
+	}
+
+	jsonBody, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/policies", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockPM.AssertNotCalled(t, "AddPolicy", mock.Anything)
+}
+
 // TestCreatePolicy_InvalidAction tests invalid action value
 func TestCreatePolicy_InvalidAction(t *testing.T) {
 	// Setup
@@ -492,8 +1130,7 @@ func TestUpdatePolicy_Success(t *testing.T) {
 	router := setupTestRouter(mockPM)
 
 	// Mock expectations
-	mockPM.On("DeletePolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
-	mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
+	mockPM.On("UpdatePolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
 
 	// Prepare request
 	reqBody := models.PolicyRequest{
@@ -559,15 +1196,14 @@ func TestUpdatePolicy_RuleIDMismatch(t *testing.T) {
 	assert.Contains(t, response.Message, "does not match")
 }
 
-// TestUpdatePolicy_AddError tests error when adding updated policy
+// TestUpdatePolicy_AddError tests error when installing the updated policy
 func TestUpdatePolicy_AddError(t *testing.T) {
 	// Setup
 	mockPM := new(MockPolicyManager)
 	router := setupTestRouter(mockPM)
 
 	// Mock expectations
-	mockPM.On("DeletePolicy", mock.AnythingOfType("*policy.Policy")).Return(nil)
-	mockPM.On("AddPolicy", mock.AnythingOfType("*policy.Policy")).Return(errors.New("failed to add"))
+	mockPM.On("UpdatePolicy", mock.AnythingOfType("*policy.Policy")).Return(errors.New("failed to add"))
 
 	// Prepare request
 	reqBody := models.PolicyRequest{
@@ -749,7 +1385,7 @@ func TestPolicyHandler_AllProtocols(t *testing.T) {
 
 // TestPolicyHandler_AllActions tests all valid action values
 func TestPolicyHandler_AllActions(t *testing.T) {
-	actions := []string{"allow", "deny", "log"}
+	actions := []string{"allow", "deny", "log", "reject"}
 
 	for _, action := range actions {
 		t.Run(fmt.Sprintf("action_%s", action), func(t *testing.T) {
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/ebpf-microsegment/src/agent/pkg/policy"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultSessionLimit caps the number of sessions returned when no limit is given
+const defaultSessionLimit = 1000
+
+// defaultTopSourcesLimit is the number of sources returned when no limit is given
+const defaultTopSourcesLimit = 10
+
+// SessionHandler handles session table requests
+type SessionHandler struct {
+	sessions dataplane.SessionLister
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sl dataplane.SessionLister) *SessionHandler {
+	return &SessionHandler{
+		sessions: sl,
+	}
+}
+
+// ListSessions handles GET /api/v1/sessions
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	limit, ok := queryLimit(c, defaultSessionLimit)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessions.ListSessions(limit)
+	if err != nil {
+		log.Errorf("Failed to list sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			http.StatusInternalServerError,
+			"dataplane_error",
+			"Failed to list sessions",
+			err.Error(),
+		))
+		return
+	}
+
+	response := models.SessionListResponse{
+		Sessions: make([]models.SessionResponse, 0, len(sessions)),
+		Total:    len(sessions),
+	}
+	for i := range sessions {
+		response.Sessions = append(response.Sessions, sessionToResponse(&sessions[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// TopSources handles GET /api/v1/sessions/top-sources
+func (h *SessionHandler) TopSources(c *gin.Context) {
+	limit, ok := queryLimit(c, defaultTopSourcesLimit)
+	if !ok {
+		return
+	}
+
+	sources, err := h.sessions.TopSources(limit)
+	if err != nil {
+		log.Errorf("Failed to list top sources: %v", err)
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+			http.StatusInternalServerError,
+			"dataplane_error",
+			"Failed to list top sources",
+			err.Error(),
+		))
+		return
+	}
+
+	response := models.TopSourcesResponse{
+		Sources: make([]models.SourceSessionsResponse, 0, len(sources)),
+		Total:   len(sources),
+	}
+	for _, s := range sources {
+		response.Sources = append(response.Sources, models.SourceSessionsResponse{
+			Source:   s.Source.String(),
+			Sessions: s.Sessions,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// queryLimit parses the optional limit query parameter. On an invalid
+// value it writes a 400 response and returns false.
+func queryLimit(c *gin.Context, def int) (int, bool) {
+	limitStr := c.Query("limit")
+	if limitStr == "" {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(limitStr)
+	if err != nil || n < 0 {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			http.StatusBadRequest,
+			"validation_error",
+			"Invalid limit",
+			"limit must be a non-negative integer",
+		))
+		return 0, false
+	}
+	return n, true
+}
+
+// sessionToResponse converts a data plane session to its API representation
+func sessionToResponse(s *dataplane.Session) models.SessionResponse {
+	var tcpState string
+	if s.Protocol == 6 {
+		tcpState = s.TCPState.String()
+	}
+
+	return models.SessionResponse{
+		SrcIP:           s.SrcIP.String(),
+		DstIP:           s.DstIP.String(),
+		SrcPort:         s.SrcPort,
+		DstPort:         s.DstPort,
+		Protocol:        policy.ProtocolName(s.Protocol),
+		Direction:       s.Direction.String(),
+		Action:          policy.ActionName(s.PolicyAction),
+		RuleID:          s.RuleID,
+		State:           s.State.String(),
+		TCPState:        tcpState,
+		VlanID:          s.VlanID,
+		VNI:             s.VNI,
+		PacketsToServer: s.PacketsToServer,
+		BytesToServer:   s.BytesToServer,
+		PacketsToClient: s.PacketsToClient,
+		BytesToClient:   s.BytesToClient,
+		CreatedAt:       s.CreatedAt,
+		LastSeen:        s.LastSeen,
+	}
+}
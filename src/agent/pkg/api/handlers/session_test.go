@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// MockSessionLister is a mock implementation of SessionLister
+type MockSessionLister struct {
+	sessions  []dataplane.Session
+	sources   []dataplane.SourceSessions
+	err       error
+	lastLimit int
+}
+
+func (m *MockSessionLister) ListSessions(limit int) ([]dataplane.Session, error) {
+	m.lastLimit = limit
+	if m.err != nil {
+		return nil, m.err
+	}
+	if limit > 0 && len(m.sessions) > limit {
+		return m.sessions[:limit], nil
+	}
+	return m.sessions, nil
+}
+
+func (m *MockSessionLister) TopSources(n int) ([]dataplane.SourceSessions, error) {
+	m.lastLimit = n
+	if m.err != nil {
+		return nil, m.err
+	}
+	if n > 0 && len(m.sources) > n {
+		return m.sources[:n], nil
+	}
+	return m.sources, nil
+}
+
+// setupSessionTestRouter creates a test router with session handler
+func setupSessionTestRouter(sl *MockSessionLister) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	handler := NewSessionHandler(sl)
+	router.GET("/api/v1/sessions", handler.ListSessions)
+	router.GET("/api/v1/sessions/top-sources", handler.TopSources)
+
+	return router
+}
+
+// TestListSessions_Success tests listing sessions with reply counters
+func TestListSessions_Success(t *testing.T) {
+	mock := &MockSessionLister{
+		sessions: []dataplane.Session{
+			{
+				SrcIP:           net.ParseIP("10.0.0.1").To4(),
+				DstIP:           net.ParseIP("10.0.0.2").To4(),
+				SrcPort:         40000,
+				DstPort:         80,
+				Protocol:        6,
+				Direction:       dataplane.DirectionIngress,
+				State:           dataplane.SessionStateClosing,
+				TCPState:        dataplane.TCPStateFinWait1,
+				PacketsToServer: 5,
+				PacketsToClient: 4,
+				BytesToServer:   500,
+				BytesToClient:   4000,
+			},
+			{
+				SrcIP:     net.ParseIP("2001:db8::1"),
+				DstIP:     net.ParseIP("2001:db8::2"),
+				SrcPort:   5353,
+				DstPort:   53,
+				Protocol:  17,
+				Direction: dataplane.DirectionEgress,
+				VlanID:    100,
+				VNI:       5001,
+				RuleID:    42,
+			},
+		},
+	}
+	router := setupSessionTestRouter(mock)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, defaultSessionLimit, mock.lastLimit)
+
+	var response models.SessionListResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, response.Total)
+
+	first := response.Sessions[0]
+	assert.Equal(t, "10.0.0.1", first.SrcIP)
+	assert.Equal(t, "tcp", first.Protocol)
+	assert.Equal(t, "ingress", first.Direction)
+	assert.Equal(t, "allow", first.Action)
+	assert.Equal(t, "closing", first.State)
+	assert.Equal(t, "fin_wait1", first.TCPState)
+	assert.Equal(t, uint64(5), first.PacketsToServer)
+	assert.Equal(t, uint64(4), first.PacketsToClient)
+	assert.Equal(t, uint64(4000), first.BytesToClient)
+
+	second := response.Sessions[1]
+	assert.Equal(t, "2001:db8::1", second.SrcIP)
+	assert.Equal(t, "udp", second.Protocol)
+	assert.Equal(t, "egress", second.Direction)
+	assert.Equal(t, "new", second.State)
+	assert.Empty(t, second.TCPState, "tcp_state is only reported for TCP sessions")
+	assert.Equal(t, uint16(100), second.VlanID)
+	assert.Equal(t, uint32(5001), second.VNI)
+	assert.Equal(t, uint32(42), second.RuleID)
+	assert.Zero(t, first.VlanID)
+}
+
+// TestListSessions_Limit tests the limit query parameter
+func TestListSessions_Limit(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantLimit  int
+	}{
+		{"explicit limit", "?limit=1", http.StatusOK, 1},
+		{"zero means all", "?limit=0", http.StatusOK, 0},
+		{"negative", "?limit=-1", http.StatusBadRequest, 0},
+		{"not a number", "?limit=abc", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockSessionLister{
+				sessions: []dataplane.Session{
+					{SrcIP: net.ParseIP("10.0.0.1"), DstIP: net.ParseIP("10.0.0.2")},
+					{SrcIP: net.ParseIP("10.0.0.3"), DstIP: net.ParseIP("10.0.0.4")},
+				},
+			}
+			router := setupSessionTestRouter(mock)
+
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/sessions"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantLimit, mock.lastLimit)
+			}
+		})
+	}
+}
+
+// TestListSessions_Error tests data plane errors are reported
+func TestListSessions_Error(t *testing.T) {
+	mock := &MockSessionLister{err: errors.New("map closed")}
+	router := setupSessionTestRouter(mock)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// TestTopSources tests listing the sources with the most sessions
+func TestTopSources(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.1.2.0/24")
+	mock := &MockSessionLister{
+		sources: []dataplane.SourceSessions{
+			{Source: subnet, Sessions: 300},
+			{Source: &net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(128, 128)}, Sessions: 20},
+		},
+	}
+	router := setupSessionTestRouter(mock)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/sessions/top-sources", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, defaultTopSourcesLimit, mock.lastLimit)
+
+	var response models.TopSourcesResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, response.Total)
+	assert.Equal(t, "10.1.2.0/24", response.Sources[0].Source)
+	assert.Equal(t, uint64(300), response.Sources[0].Sessions)
+	assert.Equal(t, "2001:db8::1/128", response.Sources[1].Source)
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/sessions/top-sources?limit=1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, mock.lastLimit)
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/sessions/top-sources?limit=-5", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
 	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
@@ -33,6 +34,13 @@ func (h *StatisticsHandler) GetAllStats(c *gin.Context) {
 		ActiveSessions: stats.ActiveSessions,
 		PolicyHits:     stats.PolicyHits,
 		PolicyMisses:   stats.PolicyMisses,
+		IngressAllowed: stats.IngressAllowed,
+		IngressDenied:  stats.IngressDenied,
+		EgressAllowed:  stats.EgressAllowed,
+		EgressDenied:   stats.EgressDenied,
+		ReplyPackets:   stats.ReplyPackets,
+		XDPDropped:     stats.XDPDropped,
+		WouldDeny:      stats.WouldDeny,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -55,6 +63,16 @@ func (h *StatisticsHandler) GetPacketStats(c *gin.Context) {
 		DeniedPackets:  stats.DeniedPackets,
 		AllowRate:      allowRate,
 		DenyRate:       denyRate,
+		Ingress: models.DirectionStats{
+			AllowedPackets: stats.IngressAllowed,
+			DeniedPackets:  stats.IngressDenied,
+		},
+		Egress: models.DirectionStats{
+			AllowedPackets: stats.EgressAllowed,
+			DeniedPackets:  stats.EgressDenied,
+		},
+		XDPDropped: stats.XDPDropped,
+		WouldDeny:  stats.WouldDeny,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -64,10 +82,23 @@ func (h *StatisticsHandler) GetPacketStats(c *gin.Context) {
 func (h *StatisticsHandler) GetSessionStats(c *gin.Context) {
 	stats := h.dataPlane.GetStatistics()
 
+	gc := stats.SessionGC
 	response := models.SessionStatsResponse{
 		NewSessions:    stats.NewSessions,
 		ClosedSessions: stats.ClosedSessions,
 		ActiveSessions: stats.ActiveSessions,
+		ReplyPackets:   stats.ReplyPackets,
+
+		SessionsReevaluated: stats.SessionsReevaluated,
+		GC: models.SessionGCStats{
+			Sweeps:              gc.Sweeps,
+			ExpiredSessions:     gc.ExpiredSessions,
+			LastSweepExpired:    gc.LastSweepExpired,
+			LastSweepDurationMs: float64(gc.LastSweepDuration) / float64(time.Millisecond),
+		},
+	}
+	if !gc.LastSweepAt.IsZero() {
+		response.GC.LastSweepAt = gc.LastSweepAt.Format(time.RFC3339)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -88,6 +119,8 @@ func (h *StatisticsHandler) GetPolicyStats(c *gin.Context) {
 		PolicyHits:   stats.PolicyHits,
 		PolicyMisses: stats.PolicyMisses,
 		HitRate:      hitRate,
+
+		ExemptedFlows: stats.ExemptedFlows,
 	}
 
 	c.JSON(http.StatusOK, response)
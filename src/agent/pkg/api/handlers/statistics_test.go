@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ebpf-microsegment/src/agent/pkg/api/models"
 	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
@@ -272,6 +273,43 @@ func TestGetPacketStats_AllDenied(t *testing.T) {
 	assert.InDelta(t, 100.0, response.DenyRate, 0.01)
 }
 
+// TestGetPacketStats_PerDirection tests the ingress/egress verdict breakdown
+func TestGetPacketStats_PerDirection(t *testing.T) {
+	// Setup
+	mockDP := NewMockDataPlaneForStats()
+	mockDP.SetStatistics(dataplane.Statistics{
+		TotalPackets:   100,
+		AllowedPackets: 70,
+		DeniedPackets:  30,
+		IngressAllowed: 40,
+		IngressDenied:  25,
+		EgressAllowed:  30,
+		EgressDenied:   5,
+		XDPDropped:     20,
+		WouldDeny:      3,
+	})
+	router := setupStatsTestRouter(mockDP)
+
+	// Execute
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/stats/packets", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.PacketStatsResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(40), response.Ingress.AllowedPackets)
+	assert.Equal(t, uint64(25), response.Ingress.DeniedPackets)
+	assert.Equal(t, uint64(30), response.Egress.AllowedPackets)
+	assert.Equal(t, uint64(5), response.Egress.DeniedPackets)
+	assert.Equal(t, uint64(20), response.XDPDropped)
+	assert.Equal(t, uint64(3), response.WouldDeny)
+}
+
 // TestGetSessionStats_Success tests successful session statistics retrieval
 func TestGetSessionStats_Success(t *testing.T) {
 	// Setup
@@ -548,3 +586,38 @@ func TestStatistics_ContentType(t *testing.T) {
 		})
 	}
 }
+
+// TestGetSessionStats_GC tests session sweeper statistics are reported
+func TestGetSessionStats_GC(t *testing.T) {
+	sweptAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mockDP := NewMockDataPlaneForStats()
+	mockDP.SetStatistics(dataplane.Statistics{
+		SessionsReevaluated: 7,
+		SessionGC: dataplane.SessionGCStats{
+			Sweeps:            12,
+			ExpiredSessions:   40,
+			LastSweepExpired:  3,
+			LastSweepDuration: 1500 * time.Microsecond,
+			LastSweepAt:       sweptAt,
+		},
+	})
+	router := setupStatsTestRouter(mockDP)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/stats/sessions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.SessionStatsResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(7), response.SessionsReevaluated)
+	assert.Equal(t, uint64(12), response.GC.Sweeps)
+	assert.Equal(t, uint64(40), response.GC.ExpiredSessions)
+	assert.Equal(t, uint64(3), response.GC.LastSweepExpired)
+	assert.InDelta(t, 1.5, response.GC.LastSweepDurationMs, 0.001)
+	assert.Equal(t, sweptAt.Format(time.RFC3339), response.GC.LastSweepAt)
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"time"
 
+	"github.com/ebpf-microsegment/src/agent/pkg/metrics"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
@@ -15,6 +16,11 @@ func (s *Server) setupMiddleware() {
 	// Logger middleware - log all requests
 	s.router.Use(loggerMiddleware())
 
+	// Metrics middleware - record request latency
+	if s.apiMetrics != nil {
+		s.router.Use(metricsMiddleware(s.apiMetrics))
+	}
+
 	// CORS middleware - allow cross-origin requests
 	if s.config.EnableCORS {
 		s.router.Use(corsMiddleware())
@@ -54,6 +60,17 @@ func loggerMiddleware() gin.HandlerFunc {
 	}
 }
 
+// metricsMiddleware records request latency by route pattern
+func metricsMiddleware(m *metrics.APIMetrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		m.ObserveRequest(c.Request.Method, c.FullPath(), c.Writer.Status(), time.Since(start))
+	}
+}
+
 // corsMiddleware handles CORS headers
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
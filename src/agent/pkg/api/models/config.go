@@ -2,16 +2,37 @@ package models
 
 // ConfigResponse represents the current system configuration
 type ConfigResponse struct {
-	Interface     string `json:"interface"`
-	LogLevel      string `json:"log_level"`
-	StatsInterval int    `json:"stats_interval"`
-	APIHost       string `json:"api_host"`
-	APIPort       int    `json:"api_port"`
+	Interface        string `json:"interface"`
+	LogLevel         string `json:"log_level"`
+	APIHost          string `json:"api_host"`
+	APIPort          int    `json:"api_port"`
+	DefaultAction    string `json:"default_action"`    // "allow" or "deny"
+	SafetyExemptions bool   `json:"safety_exemptions"` // Loopback and API port bypass policy
+	MonitorMode      bool   `json:"monitor_mode"`      // Denies are reported, not enforced
+	DropInvalidTCP   bool   `json:"drop_invalid_tcp"`  // Invalid TCP flag combinations are dropped
+	DecapVXLAN       bool   `json:"decap_vxlan"`       // Policy applies to the inner flow of VXLAN packets
+	DecapGeneve      bool   `json:"decap_geneve"`      // Policy applies to the inner flow of Geneve packets
+	FragmentAction   string `json:"fragment_action"`   // Fragments whose first fragment was not seen
+	MalformedAction  string `json:"malformed_action"`  // Packets with malformed IP headers
+
+	SourceSessionLimit uint32 `json:"source_session_limit"` // Active sessions per source, 0 = unlimited
+	SourcePrefixV4     uint8  `json:"source_prefix_v4"`     // IPv4 prefix sources are grouped by, 0 = per address
+	SourcePrefixV6     uint8  `json:"source_prefix_v6"`     // IPv6 prefix sources are grouped by, 0 = per address
 }
 
 // ConfigUpdateRequest represents a configuration update request
 type ConfigUpdateRequest struct {
-	LogLevel      *string `json:"log_level,omitempty" binding:"omitempty,oneof=debug info warn error"`
-	StatsInterval *int    `json:"stats_interval,omitempty" binding:"omitempty,min=1,max=300"`
-}
+	LogLevel         *string `json:"log_level,omitempty" binding:"omitempty,oneof=debug info warn error"`
+	DefaultAction    *string `json:"default_action,omitempty" binding:"omitempty,oneof=allow deny"`
+	SafetyExemptions *bool   `json:"safety_exemptions,omitempty"`
+	MonitorMode      *bool   `json:"monitor_mode,omitempty"`
+	DropInvalidTCP   *bool   `json:"drop_invalid_tcp,omitempty"`
+	DecapVXLAN       *bool   `json:"decap_vxlan,omitempty"`
+	DecapGeneve      *bool   `json:"decap_geneve,omitempty"`
+	FragmentAction   *string `json:"fragment_action,omitempty" binding:"omitempty,oneof=allow deny"`
+	MalformedAction  *string `json:"malformed_action,omitempty" binding:"omitempty,oneof=allow deny"`
 
+	SourceSessionLimit *uint32 `json:"source_session_limit,omitempty"`
+	SourcePrefixV4     *uint8  `json:"source_prefix_v4,omitempty" binding:"omitempty,max=32"`
+	SourcePrefixV6     *uint8  `json:"source_prefix_v6,omitempty" binding:"omitempty,max=128"`
+}
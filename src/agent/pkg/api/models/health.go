@@ -11,6 +11,8 @@ type StatusResponse struct {
 	Status      string                 `json:"status"` // "ok", "degraded", "down"
 	Version     string                 `json:"version"`
 	Interface   string                 `json:"interface"`
+	Interfaces  []InterfaceResponse    `json:"interfaces,omitempty"`
+	MonitorMode bool                   `json:"monitor_mode"`
 	DataPlane   DataPlaneStatus        `json:"data_plane"`
 	API         APIStatus              `json:"api"`
 	Statistics  *StatisticsResponse    `json:"statistics,omitempty"`
@@ -0,0 +1,21 @@
+package models
+
+// IdentityRequest represents a security identity creation/update request
+type IdentityRequest struct {
+	Identity uint32   `json:"identity" binding:"required"`            // Numeric identity, 0 is reserved
+	Labels   []string `json:"labels" binding:"required,min=1"`        // "key=value" labels selecting the workloads
+	CIDRs    []string `json:"cidrs" binding:"omitempty,dive,ip|cidr"` // Addresses or prefixes of the workloads
+}
+
+// IdentityResponse represents a security identity in API responses
+type IdentityResponse struct {
+	Identity uint32   `json:"identity"`
+	Labels   []string `json:"labels"`
+	CIDRs    []string `json:"cidrs"`
+}
+
+// IdentityListResponse represents a list of security identities
+type IdentityListResponse struct {
+	Identities []IdentityResponse `json:"identities"`
+	Count      int                `json:"count"`
+}
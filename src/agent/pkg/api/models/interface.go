@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// InterfaceRequest represents a request to attach an interface
+type InterfaceRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// HookResponse represents one attached hook of an interface
+type HookResponse struct {
+	Direction string `json:"direction"` // "ingress", "egress"
+	Mode      string `json:"mode"`      // "tcx", "legacy"
+}
+
+// InterfaceResponse represents an attached interface
+type InterfaceResponse struct {
+	Name       string         `json:"name"`
+	Index      int            `json:"index"`
+	Hooks      []HookResponse `json:"hooks"`
+	AttachedAt time.Time      `json:"attached_at"`
+	Monitor    bool           `json:"monitor"` // Denies are reported, not enforced
+}
+
+// InterfaceMonitorRequest switches monitor mode for an interface
+type InterfaceMonitorRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// InterfaceListResponse represents the list of attached interfaces
+type InterfaceListResponse struct {
+	Interfaces []InterfaceResponse `json:"interfaces"`
+	Count      int                 `json:"count"`
+}
@@ -2,26 +2,64 @@ package models
 
 // PolicyRequest represents a policy creation/update request
 type PolicyRequest struct {
-	RuleID   uint32 `json:"rule_id" binding:"required"`
-	SrcIP    string `json:"src_ip" binding:"required"`
-	DstIP    string `json:"dst_ip" binding:"required"`
-	SrcPort  uint16 `json:"src_port"`
-	DstPort  uint16 `json:"dst_port"`
-	Protocol string `json:"protocol" binding:"required,oneof=tcp udp icmp any"`
-	Action   string `json:"action" binding:"required,oneof=allow deny log"`
-	Priority uint16 `json:"priority"`
+	RuleID       uint32   `json:"rule_id" binding:"required"`
+	SrcIP        string   `json:"src_ip" binding:"required_without=SrcIdentity,omitempty,ip|cidr"` // IPv4 or IPv6 address/CIDR, omitted = any of src_identity
+	DstIP        string   `json:"dst_ip" binding:"required_without=DstIdentity,omitempty,ip|cidr"` // IPv4 or IPv6 address/CIDR, omitted = any of dst_identity
+	SrcPort      uint16   `json:"src_port"`
+	DstPort      uint16   `json:"dst_port"`
+	SrcPorts     []uint16 `json:"src_ports,omitempty"`      // Additional source ports
+	DstPorts     []uint16 `json:"dst_ports,omitempty"`      // Additional destination ports
+	SrcPortRange string   `json:"src_port_range,omitempty"` // e.g. "1024-65535" or "8000-8080,9000-9100"
+	DstPortRange string   `json:"dst_port_range,omitempty"` // e.g. "8000-8080"
+	Protocol     string   `json:"protocol" binding:"required,oneof=tcp udp icmp icmpv6 any"`
+	Action       string   `json:"action" binding:"required,oneof=allow deny log rate_limit reject"`
+	Priority     uint16   `json:"priority"`
+	Direction    string   `json:"direction" binding:"omitempty,oneof=ingress egress both"` // Empty = both
+	Monitor      bool     `json:"monitor"`                                                 // Report denies instead of dropping
+	IcmpType     *uint8   `json:"icmp_type,omitempty"`                                     // icmp/icmpv6 only, omitted = any type
+	IcmpCode     *uint8   `json:"icmp_code,omitempty"`                                     // Requires icmp_type, omitted = any code
+	ConnStates   []string `json:"conn_states,omitempty"`                                   // new, established, related, invalid; omitted = any
+	VlanID       uint16   `json:"vlan_id,omitempty"`                                       // Outer VLAN ID, omitted = any
+	VNI          uint32   `json:"vni,omitempty"`                                           // VXLAN/Geneve VNI, omitted = any
+	Rate         uint64   `json:"rate,omitempty"`                                          // rate_limit only: tokens per second
+	Burst        uint64   `json:"burst,omitempty"`                                         // rate_limit only: bucket size, omitted = rate
+	RateUnit     string   `json:"rate_unit,omitempty" binding:"omitempty,oneof=packets bytes connections"`
+	SessionLimit uint32   `json:"session_limit,omitempty"` // Active sessions per source, omitted = global limit
+	Mirror       string   `json:"mirror,omitempty"`        // Interface receiving copies of the rule's packets
+	MirrorSample uint32   `json:"mirror_sample,omitempty"` // Mirror one packet in N, omitted = every packet
+	SrcIdentity  uint32   `json:"src_identity,omitempty"`  // Source security identity, omitted = any
+	DstIdentity  uint32   `json:"dst_identity,omitempty"`  // Destination security identity, omitted = any
 }
 
 // PolicyResponse represents a policy in API responses
 type PolicyResponse struct {
-	RuleID   uint32 `json:"rule_id"`
-	SrcIP    string `json:"src_ip"`
-	DstIP    string `json:"dst_ip"`
-	SrcPort  uint16 `json:"src_port"`
-	DstPort  uint16 `json:"dst_port"`
-	Protocol string `json:"protocol"`
-	Action   string `json:"action"`
-	Priority uint16 `json:"priority"`
+	RuleID       uint32   `json:"rule_id"`
+	SrcIP        string   `json:"src_ip"`
+	DstIP        string   `json:"dst_ip"`
+	SrcPort      uint16   `json:"src_port"`
+	DstPort      uint16   `json:"dst_port"`
+	SrcPorts     []uint16 `json:"src_ports,omitempty"`
+	DstPorts     []uint16 `json:"dst_ports,omitempty"`
+	SrcPortRange string   `json:"src_port_range,omitempty"`
+	DstPortRange string   `json:"dst_port_range,omitempty"`
+	Protocol     string   `json:"protocol"`
+	Action       string   `json:"action"`
+	Priority     uint16   `json:"priority"`
+	Direction    string   `json:"direction"`
+	Monitor      bool     `json:"monitor"`
+	IcmpType     *uint8   `json:"icmp_type,omitempty"`
+	IcmpCode     *uint8   `json:"icmp_code,omitempty"`
+	ConnStates   []string `json:"conn_states,omitempty"`
+	VlanID       uint16   `json:"vlan_id,omitempty"`
+	VNI          uint32   `json:"vni,omitempty"`
+	Rate         uint64   `json:"rate,omitempty"`
+	Burst        uint64   `json:"burst,omitempty"`
+	RateUnit     string   `json:"rate_unit,omitempty"`
+	SessionLimit uint32   `json:"session_limit,omitempty"`
+	Mirror       string   `json:"mirror,omitempty"`
+	MirrorSample uint32   `json:"mirror_sample,omitempty"`
+	SrcIdentity  uint32   `json:"src_identity,omitempty"`
+	DstIdentity  uint32   `json:"dst_identity,omitempty"`
 }
 
 // PolicyListResponse represents a list of policies
@@ -29,4 +67,3 @@ type PolicyListResponse struct {
 	Policies []PolicyResponse `json:"policies"`
 	Count    int              `json:"count"`
 }
-
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// SessionResponse represents one tracked session
+type SessionResponse struct {
+	SrcIP     string `json:"src_ip"`
+	DstIP     string `json:"dst_ip"`
+	SrcPort   uint16 `json:"src_port"`
+	DstPort   uint16 `json:"dst_port"`
+	Protocol  string `json:"protocol"`
+	Direction string `json:"direction"`
+	Action    string `json:"action"`
+	RuleID    uint32 `json:"rule_id,omitempty"`
+	State     string `json:"state"`
+	TCPState  string `json:"tcp_state,omitempty"`
+	VlanID    uint16 `json:"vlan_id,omitempty"`
+	VNI       uint32 `json:"vni,omitempty"`
+
+	// Initiator -> responder
+	PacketsToServer uint64 `json:"packets_to_server"`
+	BytesToServer   uint64 `json:"bytes_to_server"`
+
+	// Responder -> initiator (reply traffic)
+	PacketsToClient uint64 `json:"packets_to_client"`
+	BytesToClient   uint64 `json:"bytes_to_client"`
+
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// SessionListResponse represents a list of sessions
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+	Total    int               `json:"total"`
+}
+
+// SourceSessionsResponse represents the active session count of one source
+type SourceSessionsResponse struct {
+	Source   string `json:"source"` // Address or CIDR, depending on the source prefix
+	Sessions uint64 `json:"sessions"`
+}
+
+// TopSourcesResponse represents the sources with the most active sessions
+type TopSourcesResponse struct {
+	Sources []SourceSessionsResponse `json:"sources"`
+	Total   int                      `json:"total"`
+}
@@ -10,6 +10,13 @@ type StatisticsResponse struct {
 	ActiveSessions uint64 `json:"active_sessions"`
 	PolicyHits     uint64 `json:"policy_hits"`
 	PolicyMisses   uint64 `json:"policy_misses"`
+	IngressAllowed uint64 `json:"ingress_allowed"`
+	IngressDenied  uint64 `json:"ingress_denied"`
+	EgressAllowed  uint64 `json:"egress_allowed"`
+	EgressDenied   uint64 `json:"egress_denied"`
+	ReplyPackets   uint64 `json:"reply_packets"`
+	XDPDropped     uint64 `json:"xdp_dropped"`
+	WouldDeny      uint64 `json:"would_deny"`
 }
 
 // PacketStatsResponse represents packet-specific statistics
@@ -19,6 +26,22 @@ type PacketStatsResponse struct {
 	DeniedPackets  uint64  `json:"denied_packets"`
 	AllowRate      float64 `json:"allow_rate"`
 	DenyRate       float64 `json:"deny_rate"`
+
+	// Verdicts broken down by the TC hook that saw the packet
+	Ingress DirectionStats `json:"ingress"`
+	Egress  DirectionStats `json:"egress"`
+
+	// Ingress drops made by XDP before skb allocation (part of ingress denied)
+	XDPDropped uint64 `json:"xdp_dropped"`
+
+	// Denied packets let through by monitor mode (counted as allowed)
+	WouldDeny uint64 `json:"would_deny"`
+}
+
+// DirectionStats represents verdict counters for one TC hook
+type DirectionStats struct {
+	AllowedPackets uint64 `json:"allowed_packets"`
+	DeniedPackets  uint64 `json:"denied_packets"`
 }
 
 // SessionStatsResponse represents session-specific statistics
@@ -26,6 +49,22 @@ type SessionStatsResponse struct {
 	NewSessions    uint64 `json:"new_sessions"`
 	ClosedSessions uint64 `json:"closed_sessions"`
 	ActiveSessions uint64 `json:"active_sessions"`
+	ReplyPackets   uint64 `json:"reply_packets"`
+
+	// Cached decisions recomputed after policy changes
+	SessionsReevaluated uint64 `json:"sessions_reevaluated"`
+
+	// Idle sessions removed by the userspace sweeper
+	GC SessionGCStats `json:"gc"`
+}
+
+// SessionGCStats represents session garbage collector activity
+type SessionGCStats struct {
+	Sweeps              uint64  `json:"sweeps"`
+	ExpiredSessions     uint64  `json:"expired_sessions"`
+	LastSweepExpired    uint64  `json:"last_sweep_expired"`
+	LastSweepDurationMs float64 `json:"last_sweep_duration_ms"`
+	LastSweepAt         string  `json:"last_sweep_at,omitempty"`
 }
 
 // PolicyStatsResponse represents policy-specific statistics
@@ -33,5 +72,8 @@ type PolicyStatsResponse struct {
 	PolicyHits   uint64  `json:"policy_hits"`
 	PolicyMisses uint64  `json:"policy_misses"`
 	HitRate      float64 `json:"hit_rate"`
+
+	// Lookups bypassed by the loopback/API safety exemptions
+	ExemptedFlows uint64 `json:"exempted_flows"`
 }
 
@@ -3,6 +3,7 @@ package api
 import (
 	"github.com/ebpf-microsegment/src/agent/pkg/api/handlers"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // setupRoutes configures all API routes
@@ -10,7 +11,16 @@ func (s *Server) setupRoutes() {
 	// Create handlers
 	healthHandler := handlers.NewHealthHandler(s.dataPlane, s.policyManager)
 	policyHandler := handlers.NewPolicyHandler(s.policyManager)
+	identityHandler := handlers.NewIdentityHandler(s.policyManager)
 	statsHandler := handlers.NewStatisticsHandler(s.dataPlane)
+	sessionHandler := handlers.NewSessionHandler(s.dataPlane)
+	interfaceHandler := handlers.NewInterfaceHandler(s.dataPlane)
+	configHandler := handlers.NewConfigHandler(s.dataPlane, s.config.Host, s.config.Port)
+
+	// Prometheus scrape endpoint
+	if s.registry != nil {
+		s.router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})))
+	}
 
 	// API v1 group
 	v1 := s.router.Group("/api/v1")
@@ -29,6 +39,29 @@ func (s *Server) setupRoutes() {
 			policies.DELETE("/:id", policyHandler.DeletePolicy)
 		}
 
+		// Security identity endpoints
+		identities := v1.Group("/identities")
+		{
+			identities.POST("", identityHandler.CreateIdentity)
+			identities.GET("", identityHandler.ListIdentities)
+			identities.GET("/:id", identityHandler.GetIdentity)
+			identities.PUT("/:id", identityHandler.UpdateIdentity)
+			identities.DELETE("/:id", identityHandler.DeleteIdentity)
+		}
+
+		// Session table endpoints
+		v1.GET("/sessions", sessionHandler.ListSessions)
+		v1.GET("/sessions/top-sources", sessionHandler.TopSources)
+
+		// Interface attachment endpoints
+		interfaces := v1.Group("/interfaces")
+		{
+			interfaces.GET("", interfaceHandler.ListInterfaces)
+			interfaces.POST("", interfaceHandler.AttachInterface)
+			interfaces.DELETE("/:name", interfaceHandler.DetachInterface)
+			interfaces.PUT("/:name/monitor", interfaceHandler.SetInterfaceMonitor)
+		}
+
 		// Statistics endpoints
 		stats := v1.Group("/stats")
 		{
@@ -38,22 +71,12 @@ func (s *Server) setupRoutes() {
 			stats.GET("/policies", statsHandler.GetPolicyStats)
 		}
 
-		// Configuration endpoints (to be implemented)
+		// Runtime configuration endpoints
 		config := v1.Group("/config")
 		{
-			config.GET("", s.handleGetConfig)
-			config.PUT("", s.handleUpdateConfig)
+			config.GET("", configHandler.GetConfig)
+			config.PUT("", configHandler.UpdateConfig)
 		}
 	}
 }
 
-// Placeholder handlers (will be implemented in separate files)
-
-func (s *Server) handleGetConfig(c *gin.Context) {
-	c.JSON(501, gin.H{"error": "Not implemented yet"})
-}
-
-func (s *Server) handleUpdateConfig(c *gin.Context) {
-	c.JSON(501, gin.H{"error": "Not implemented yet"})
-}
-
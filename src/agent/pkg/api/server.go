@@ -10,8 +10,11 @@ import (
 	"time"
 
 	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/ebpf-microsegment/src/agent/pkg/metrics"
 	"github.com/ebpf-microsegment/src/agent/pkg/policy"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -24,6 +27,8 @@ type Server struct {
 	policyManager *policy.PolicyManager
 	httpServer    *http.Server
 	router        *gin.Engine
+	registry      *prometheus.Registry // nil when metrics are disabled
+	apiMetrics    *metrics.APIMetrics
 }
 
 // NewAPIServer creates and initializes a new API server instance.
@@ -59,6 +64,10 @@ func NewAPIServer(cfg *Config, dp *dataplane.DataPlane, pm *policy.PolicyManager
 		router:        router,
 	}
 
+	if cfg.EnableMetrics {
+		server.setupMetrics()
+	}
+
 	// Setup routes and middleware
 	server.setupMiddleware()
 	server.setupRoutes()
@@ -66,6 +75,18 @@ func NewAPIServer(cfg *Config, dp *dataplane.DataPlane, pm *policy.PolicyManager
 	return server, nil
 }
 
+// setupMetrics creates the Prometheus registry with the data plane, policy
+// and API collectors
+func (s *Server) setupMetrics() {
+	s.registry = prometheus.NewRegistry()
+	s.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.NewCollector(s.dataPlane, s.policyManager, s.config.PerCPUMetrics),
+	)
+	s.apiMetrics = metrics.NewAPIMetrics(s.registry)
+}
+
 // Start starts the HTTP server in a background goroutine.
 // The server will listen on the configured host and port.
 // This method returns immediately; the server runs asynchronously.
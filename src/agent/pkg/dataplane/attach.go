@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Direction identifies the TC hook a program is attached to.
+// Values match enum traffic_direction in common_types.h.
+type Direction uint8
+
+const (
+	DirectionIngress Direction = 0
+	DirectionEgress  Direction = 1
+)
+
+// String returns the lowercase name of the direction
+func (d Direction) String() string {
+	switch d {
+	case DirectionIngress:
+		return "ingress"
+	case DirectionEgress:
+		return "egress"
+	default:
+		return fmt.Sprintf("direction(%d)", uint8(d))
+	}
+}
+
+// hookAttachment tracks a program attached to one TC or XDP hook
+type hookAttachment struct {
+	direction Direction
+	mode      AttachMode
+	link      link.Link          // TCX and XDP modes
+	filter    *netlink.BpfFilter // Legacy TC mode
+	pin       string             // bpffs path of the link, empty if not pinned
+}
+
+// legacy reports whether the attachment uses the netlink-based TC hook
+func (a *hookAttachment) legacy() bool {
+	return a.filter != nil
+}
+
+// close detaches the program from its hook
+func (a *hookAttachment) close() error {
+	if a.filter != nil {
+		if err := netlink.FilterDel(a.filter); err != nil {
+			return fmt.Errorf("removing TC %s filter: %w", a.direction, err)
+		}
+		return nil
+	}
+	if a.link != nil {
+		if a.pin != "" {
+			if err := a.link.Unpin(); err != nil {
+				return fmt.Errorf("unpinning %s %s link: %w", a.mode, a.direction, err)
+			}
+		}
+		if err := a.link.Close(); err != nil {
+			return fmt.Errorf("detaching %s %s program: %w", a.mode, a.direction, err)
+		}
+	}
+	return nil
+}
+
+// release gives up the attachment without detaching the program. Pinned
+// links and legacy filters stay in the kernel for the next agent to take
+// over.
+func (a *hookAttachment) release() error {
+	if a.link != nil {
+		if err := a.link.Close(); err != nil {
+			return fmt.Errorf("releasing %s %s link: %w", a.mode, a.direction, err)
+		}
+	}
+	return nil
+}
+
+// pinLink pins l at path so it outlives the agent
+func pinLink(l link.Link, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating link pin directory: %w", err)
+	}
+	if err := l.Pin(path); err != nil {
+		l.Close()
+		return fmt.Errorf("pinning link: %w", err)
+	}
+	return nil
+}
+
+// attachTC attaches prog to the given hook of the interface.
+// It tries TCX first (kernel >= 6.6) and falls back to the legacy TC hook.
+// A TCX link is pinned at pin unless it is empty.
+func attachTC(iface string, ifaceIdx int, prog *ebpf.Program, name string, dir Direction, pin string) (*hookAttachment, error) {
+	attachType := ebpf.AttachTCXIngress
+	if dir == DirectionEgress {
+		attachType = ebpf.AttachTCXEgress
+	}
+
+	tcLink, err := link.AttachTCX(link.TCXOptions{
+		Interface: ifaceIdx,
+		Program:   prog,
+		Attach:    attachType,
+	})
+	if err == nil {
+		if pin != "" {
+			if err := pinLink(tcLink, pin); err != nil {
+				return nil, err
+			}
+		}
+		log.Infof("✓ TC program attached to %s %s (TCX mode, kernel >= 6.6)", iface, dir)
+		return &hookAttachment{direction: dir, mode: AttachModeTCX, link: tcLink, pin: pin}, nil
+	}
+
+	// TCX not supported (kernel < 6.6), fallback to legacy netlink-based TC hook
+	log.Warnf("TCX attach failed (requires kernel >= 6.6), falling back to legacy TC hook: %v", err)
+
+	filter, err := attachLegacyTC(iface, ifaceIdx, prog, name, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("✓ TC program attached to %s %s (legacy netlink mode, kernel < 6.6)", iface, dir)
+	return &hookAttachment{direction: dir, mode: AttachModeLegacy, filter: filter}, nil
+}
+
+// attachXDP attaches prog to the XDP hook of the interface.
+// XDPModeAuto tries native (driver) mode first and falls back to generic
+// mode for drivers without XDP support. The link is pinned at pin unless
+// it is empty.
+func attachXDP(iface string, ifaceIdx int, prog *ebpf.Program, mode XDPMode, pin string) (*hookAttachment, error) {
+	if mode != XDPModeGeneric {
+		xdpLink, err := link.AttachXDP(link.XDPOptions{
+			Program:   prog,
+			Interface: ifaceIdx,
+			Flags:     link.XDPDriverMode,
+		})
+		if err == nil {
+			if pin != "" {
+				if err := pinLink(xdpLink, pin); err != nil {
+					return nil, err
+				}
+			}
+			log.Infof("✓ XDP program attached to %s (native mode)", iface)
+			return &hookAttachment{direction: DirectionIngress, mode: AttachModeXDPNative, link: xdpLink, pin: pin}, nil
+		}
+		if mode == XDPModeNative {
+			return nil, fmt.Errorf("attaching XDP program in native mode: %w", err)
+		}
+
+		log.Warnf("Native XDP attach failed on %s, falling back to generic mode: %v", iface, err)
+	}
+
+	xdpLink, err := link.AttachXDP(link.XDPOptions{
+		Program:   prog,
+		Interface: ifaceIdx,
+		Flags:     link.XDPGenericMode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("attaching XDP program in generic mode: %w", err)
+	}
+
+	if pin != "" {
+		if err := pinLink(xdpLink, pin); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("✓ XDP program attached to %s (generic mode)", iface)
+	return &hookAttachment{direction: DirectionIngress, mode: AttachModeXDPGeneric, link: xdpLink, pin: pin}, nil
+}
+
+// Handle and priority of the legacy TC filter. Keeping them fixed lets a
+// new agent replace the filter of a previous one in place.
+const (
+	legacyFilterHandle   = 1
+	legacyFilterPriority = 1
+)
+
+// attachLegacyTC attaches prog using a clsact qdisc and a direct-action
+// BPF filter (compatible with kernel >= 4.18). A filter left by a previous
+// run is replaced atomically, so traffic is never seen without a filter.
+func attachLegacyTC(iface string, ifaceIdx int, prog *ebpf.Program, name string, dir Direction) (*netlink.BpfFilter, error) {
+	nlLink, err := netlink.LinkByIndex(ifaceIdx)
+	if err != nil {
+		return nil, fmt.Errorf("getting netlink interface: %w", err)
+	}
+
+	// Create clsact qdisc if not exists
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: ifaceIdx,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+
+	// Try to add qdisc, ignore "file exists" error
+	if err := netlink.QdiscAdd(qdisc); err != nil {
+		// Check if it's "file exists" error (qdisc already present)
+		if !isFileExistsError(err) {
+			return nil, fmt.Errorf("adding clsact qdisc: %w", err)
+		}
+		log.Debugf("clsact qdisc already exists on %s", iface)
+	} else {
+		log.Debugf("Added clsact qdisc to %s", iface)
+	}
+
+	parent := uint32(netlink.HANDLE_MIN_INGRESS)
+	if dir == DirectionEgress {
+		parent = netlink.HANDLE_MIN_EGRESS
+	}
+
+	// Clean up our filters at other handles or priorities (from older
+	// versions); the one at our handle is replaced in place below
+	existingFilters, err := netlink.FilterList(nlLink, parent)
+	if err == nil {
+		for _, f := range existingFilters {
+			bpfFilter, ok := f.(*netlink.BpfFilter)
+			if !ok || bpfFilter.Name != name {
+				continue
+			}
+			if bpfFilter.Handle == legacyFilterHandle && bpfFilter.Priority == legacyFilterPriority {
+				log.Infof("Replacing existing BPF %s filter on %s", dir, iface)
+				continue
+			}
+			netlink.FilterDel(bpfFilter)
+			log.Debugf("Removed old BPF %s filter from %s", dir, iface)
+		}
+	}
+
+	// Attach BPF filter
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifaceIdx,
+			Parent:    parent,
+			Handle:    legacyFilterHandle,
+			Protocol:  unix.ETH_P_ALL,
+			Priority:  legacyFilterPriority,
+		},
+		Fd:           prog.FD(),
+		Name:         name,
+		DirectAction: true,
+	}
+
+	// Replace creates the filter if none exists yet
+	if err := netlink.FilterReplace(filter); err != nil {
+		return nil, fmt.Errorf("attaching TC %s filter: %w", dir, err)
+	}
+
+	return filter, nil
+}
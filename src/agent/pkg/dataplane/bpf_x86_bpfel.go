@@ -13,65 +13,231 @@ import (
 	"github.com/cilium/ebpf"
 )
 
+type bpfCidrRuleSet struct {
+	_         structs.HostLayout
+	Count     uint32
+	Prefixlen uint32
+	Slots     [64]uint32
+}
+
 type bpfFlowKey struct {
-	_        structs.HostLayout
-	SrcIp    uint32
-	DstIp    uint32
-	SrcPort  uint16
-	DstPort  uint16
-	Protocol uint8
-	Pad      [3]uint8
+	_         structs.HostLayout
+	SrcIp     [4]uint32
+	DstIp     [4]uint32
+	SrcPort   uint16
+	DstPort   uint16
+	Protocol  uint8
+	Direction uint8
+	Pad       [2]uint8
+}
+
+type bpfFragKey struct {
+	_         structs.HostLayout
+	SrcIp     [4]uint32
+	DstIp     [4]uint32
+	Id        uint32
+	Protocol  uint8
+	Direction uint8
+	Pad       [2]uint8
+}
+
+type bpfFragValue struct {
+	_         structs.HostLayout
+	CreatedTs uint64
+	Drop      uint8
+	Pad       [7]uint8
+}
+
+type bpfGlobalConfig struct {
+	_                  structs.HostLayout
+	PolicyGeneration   uint32
+	ApiPort            uint16
+	DefaultAction      uint8
+	SafetyExemptions   uint8
+	MonitorMode        uint8
+	DropInvalidTcp     uint8
+	DecapTunnels       uint8
+	FragmentAction     uint8
+	MalformedAction    uint8
+	SourcePrefixV4     uint8
+	SourcePrefixV6     uint8
+	Pad                uint8
+	SourceSessionLimit uint32
+}
+
+type bpfLpmKey struct {
+	_         structs.HostLayout
+	Prefixlen uint32
+	Addr      [4]uint32
+}
+
+type bpfMirrorInflight struct {
+	_       structs.HostLayout
+	Ifindex uint32
+	Mark    uint32
+}
+
+type bpfMirrorStats struct {
+	_       structs.HostLayout
+	Packets uint64
+	Bytes   uint64
+	Errors  uint64
+}
+
+type bpfMirrorTarget struct {
+	_          structs.HostLayout
+	Ifindex    uint32
+	SampleRate uint32
+}
+
+type bpfPacketScratch struct {
+	_    structs.HostLayout
+	Key  bpfFlowKey
+	Meta struct {
+		_            structs.HostLayout
+		TcpFlags     uint8
+		HasL4        uint8
+		IcmpError    uint8
+		_            [1]byte
+		VlanId       uint16
+		_            [2]byte
+		Vni          uint32
+		Frag         uint8
+		Malformed    uint8
+		Decapsulated uint8
+		_            [1]byte
+		UdpPayload   uint16
+		_            [2]byte
+		FragId       uint32
+		RuleId       uint32
+		Related      bpfFlowKey
+	}
+	InnerKey  bpfFlowKey
+	InnerMeta struct {
+		_            structs.HostLayout
+		TcpFlags     uint8
+		HasL4        uint8
+		IcmpError    uint8
+		_            [1]byte
+		VlanId       uint16
+		_            [2]byte
+		Vni          uint32
+		Frag         uint8
+		Malformed    uint8
+		Decapsulated uint8
+		_            [1]byte
+		UdpPayload   uint16
+		_            [2]byte
+		FragId       uint32
+		RuleId       uint32
+		Related      bpfFlowKey
+	}
 }
 
 type bpfPolicyKey struct {
-	_        structs.HostLayout
-	SrcIp    uint32
-	DstIp    uint32
-	SrcPort  uint16
-	DstPort  uint16
-	Protocol uint8
-	Pad      [3]uint8
+	_         structs.HostLayout
+	SrcIp     [4]uint32
+	DstIp     [4]uint32
+	SrcPort   uint16
+	DstPort   uint16
+	Protocol  uint8
+	Direction uint8
+	Pad       [2]uint8
 }
 
 type bpfPolicyValue struct {
-	_          structs.HostLayout
-	Action     uint8
-	LogEnabled uint8
-	Priority   uint16
-	RuleId     uint32
-	HitCount   uint64
+	_            structs.HostLayout
+	Action       uint8
+	LogEnabled   uint8
+	Priority     uint16
+	RuleId       uint32
+	HitCount     uint64
+	Monitor      uint8
+	Pad          [3]uint8
+	SessionLimit uint32
+}
+
+type bpfRateLimit struct {
+	_      structs.HostLayout
+	Rate   uint64
+	Burst  uint64
+	Tokens uint64
+	LastTs uint64
+	Unit   uint8
+	Pad    [3]uint8
+	Lock   struct {
+		_   structs.HostLayout
+		Val uint32
+	}
+}
+
+type bpfRejectKey struct {
+	_         structs.HostLayout
+	Ifindex   uint32
+	Direction uint32
+}
+
+type bpfRejectPending struct {
+	_         structs.HostLayout
+	Count     int64
+	ExpiresTs uint64
 }
 
 type bpfSessionValue struct {
-	_               structs.HostLayout
-	CreatedTs       uint64
-	LastSeenTs      uint64
-	PacketsToServer uint64
-	PacketsToClient uint64
-	BytesToServer   uint64
-	BytesToClient   uint64
-	State           uint8
-	TcpState        uint8
-	PolicyAction    uint8
-	Flags           uint8
-	Pad             uint32
+	_                structs.HostLayout
+	CreatedTs        uint64
+	LastSeenTs       uint64
+	PacketsToServer  uint64
+	PacketsToClient  uint64
+	BytesToServer    uint64
+	BytesToClient    uint64
+	State            uint8
+	TcpState         uint8
+	PolicyAction     uint8
+	Flags            uint8
+	Direction        uint8
+	ConnState        uint8
+	VlanId           uint16
+	PolicyGeneration uint32
+	Vni              uint32
+	RuleId           uint32
+	Pad              uint32
+}
+
+type bpfSourceKey struct {
+	_         structs.HostLayout
+	Prefixlen uint32
+	Addr      [4]uint32
 }
 
 type bpfWildcardPolicy struct {
-	_          structs.HostLayout
-	SrcIp      uint32
-	SrcIpMask  uint32
-	DstIp      uint32
-	DstIpMask  uint32
-	SrcPort    uint16
-	DstPort    uint16
-	Protocol   uint8
-	Action     uint8
-	LogEnabled uint8
-	Pad1       uint8
-	Priority   uint16
-	Pad2       uint16
-	RuleId     uint32
+	_            structs.HostLayout
+	SrcIp        [4]uint32
+	SrcIpMask    [4]uint32
+	DstIp        [4]uint32
+	DstIpMask    [4]uint32
+	SrcPortLo    uint16
+	SrcPortHi    uint16
+	DstPortLo    uint16
+	DstPortHi    uint16
+	Protocol     uint8
+	Action       uint8
+	LogEnabled   uint8
+	Direction    uint8
+	Priority     uint16
+	Monitor      uint8
+	IcmpMatch    uint8
+	RuleId       uint32
+	IcmpType     uint8
+	IcmpCode     uint8
+	ConnStates   uint8
+	Pad2         uint8
+	VlanId       uint16
+	Pad3         uint16
+	Vni          uint32
+	SessionLimit uint32
+	SrcIdentity  uint32
+	DstIdentity  uint32
 }
 
 // loadBpf returns the embedded CollectionSpec for bpf.
@@ -116,16 +282,36 @@ type bpfSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfProgramSpecs struct {
-	TcMicrosegmentFilter *ebpf.ProgramSpec `ebpf:"tc_microsegment_filter"`
+	TcMicrosegmentEgress  *ebpf.ProgramSpec `ebpf:"tc_microsegment_egress"`
+	TcMicrosegmentFilter  *ebpf.ProgramSpec `ebpf:"tc_microsegment_filter"`
+	XdpMicrosegmentFilter *ebpf.ProgramSpec `ebpf:"xdp_microsegment_filter"`
 }
 
 // bpfMapSpecs contains maps before they are loaded into the kernel.
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfMapSpecs struct {
+	ConfigMap         *ebpf.MapSpec `ebpf:"config_map"`
+	DstCidrMap        *ebpf.MapSpec `ebpf:"dst_cidr_map"`
+	DstIdentityMap    *ebpf.MapSpec `ebpf:"dst_identity_map"`
 	FlowEvents        *ebpf.MapSpec `ebpf:"flow_events"`
+	FragMap           *ebpf.MapSpec `ebpf:"frag_map"`
+	IpcacheMap        *ebpf.MapSpec `ebpf:"ipcache_map"`
+	MirrorInflightMap *ebpf.MapSpec `ebpf:"mirror_inflight_map"`
+	MirrorMap         *ebpf.MapSpec `ebpf:"mirror_map"`
+	MirrorStatsMap    *ebpf.MapSpec `ebpf:"mirror_stats_map"`
+	MonitorIfaceMap   *ebpf.MapSpec `ebpf:"monitor_iface_map"`
+	PacketScratchMap  *ebpf.MapSpec `ebpf:"packet_scratch_map"`
 	PolicyMap         *ebpf.MapSpec `ebpf:"policy_map"`
+	RateLimitMap      *ebpf.MapSpec `ebpf:"rate_limit_map"`
+	RateLimitedMap    *ebpf.MapSpec `ebpf:"rate_limited_map"`
+	RejectPendingMap  *ebpf.MapSpec `ebpf:"reject_pending_map"`
+	RuleHitsMap       *ebpf.MapSpec `ebpf:"rule_hits_map"`
 	SessionMap        *ebpf.MapSpec `ebpf:"session_map"`
+	SessionScratchMap *ebpf.MapSpec `ebpf:"session_scratch_map"`
+	SourceSessionsMap *ebpf.MapSpec `ebpf:"source_sessions_map"`
+	SrcCidrMap        *ebpf.MapSpec `ebpf:"src_cidr_map"`
+	SrcIdentityMap    *ebpf.MapSpec `ebpf:"src_identity_map"`
 	StatsMap          *ebpf.MapSpec `ebpf:"stats_map"`
 	WildcardPolicyMap *ebpf.MapSpec `ebpf:"wildcard_policy_map"`
 }
@@ -156,18 +342,54 @@ func (o *bpfObjects) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfMaps struct {
+	ConfigMap         *ebpf.Map `ebpf:"config_map"`
+	DstCidrMap        *ebpf.Map `ebpf:"dst_cidr_map"`
+	DstIdentityMap    *ebpf.Map `ebpf:"dst_identity_map"`
 	FlowEvents        *ebpf.Map `ebpf:"flow_events"`
+	FragMap           *ebpf.Map `ebpf:"frag_map"`
+	IpcacheMap        *ebpf.Map `ebpf:"ipcache_map"`
+	MirrorInflightMap *ebpf.Map `ebpf:"mirror_inflight_map"`
+	MirrorMap         *ebpf.Map `ebpf:"mirror_map"`
+	MirrorStatsMap    *ebpf.Map `ebpf:"mirror_stats_map"`
+	MonitorIfaceMap   *ebpf.Map `ebpf:"monitor_iface_map"`
+	PacketScratchMap  *ebpf.Map `ebpf:"packet_scratch_map"`
 	PolicyMap         *ebpf.Map `ebpf:"policy_map"`
+	RateLimitMap      *ebpf.Map `ebpf:"rate_limit_map"`
+	RateLimitedMap    *ebpf.Map `ebpf:"rate_limited_map"`
+	RejectPendingMap  *ebpf.Map `ebpf:"reject_pending_map"`
+	RuleHitsMap       *ebpf.Map `ebpf:"rule_hits_map"`
 	SessionMap        *ebpf.Map `ebpf:"session_map"`
+	SessionScratchMap *ebpf.Map `ebpf:"session_scratch_map"`
+	SourceSessionsMap *ebpf.Map `ebpf:"source_sessions_map"`
+	SrcCidrMap        *ebpf.Map `ebpf:"src_cidr_map"`
+	SrcIdentityMap    *ebpf.Map `ebpf:"src_identity_map"`
 	StatsMap          *ebpf.Map `ebpf:"stats_map"`
 	WildcardPolicyMap *ebpf.Map `ebpf:"wildcard_policy_map"`
 }
 
 func (m *bpfMaps) Close() error {
 	return _BpfClose(
+		m.ConfigMap,
+		m.DstCidrMap,
+		m.DstIdentityMap,
 		m.FlowEvents,
+		m.FragMap,
+		m.IpcacheMap,
+		m.MirrorInflightMap,
+		m.MirrorMap,
+		m.MirrorStatsMap,
+		m.MonitorIfaceMap,
+		m.PacketScratchMap,
 		m.PolicyMap,
+		m.RateLimitMap,
+		m.RateLimitedMap,
+		m.RejectPendingMap,
+		m.RuleHitsMap,
 		m.SessionMap,
+		m.SessionScratchMap,
+		m.SourceSessionsMap,
+		m.SrcCidrMap,
+		m.SrcIdentityMap,
 		m.StatsMap,
 		m.WildcardPolicyMap,
 	)
@@ -183,12 +405,16 @@ type bpfVariables struct {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfPrograms struct {
-	TcMicrosegmentFilter *ebpf.Program `ebpf:"tc_microsegment_filter"`
+	TcMicrosegmentEgress  *ebpf.Program `ebpf:"tc_microsegment_egress"`
+	TcMicrosegmentFilter  *ebpf.Program `ebpf:"tc_microsegment_filter"`
+	XdpMicrosegmentFilter *ebpf.Program `ebpf:"xdp_microsegment_filter"`
 }
 
 func (p *bpfPrograms) Close() error {
 	return _BpfClose(
+		p.TcMicrosegmentEgress,
 		p.TcMicrosegmentFilter,
+		p.XdpMicrosegmentFilter,
 	)
 }
 
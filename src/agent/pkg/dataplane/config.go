@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"fmt"
+	"time"
+)
+
+// HookMode selects which hooks enforce ingress policy
+type HookMode string
+
+const (
+	HookModeTC    HookMode = "tc"     // TC ingress only
+	HookModeXDP   HookMode = "xdp"    // XDP ingress only
+	HookModeXDPTC HookMode = "xdp+tc" // XDP drops early, TC handles what XDP passes on
+)
+
+// usesXDP reports whether the XDP program is attached
+func (m HookMode) usesXDP() bool {
+	return m == HookModeXDP || m == HookModeXDPTC
+}
+
+// usesTC reports whether the TC ingress program is attached
+func (m HookMode) usesTC() bool {
+	return m != HookModeXDP
+}
+
+// ParseHookMode validates a hook mode name
+func ParseHookMode(s string) (HookMode, error) {
+	switch m := HookMode(s); m {
+	case HookModeTC, HookModeXDP, HookModeXDPTC:
+		return m, nil
+	case "":
+		return HookModeTC, nil
+	default:
+		return "", fmt.Errorf("invalid hook mode %q (expected tc, xdp or xdp+tc)", s)
+	}
+}
+
+// XDPMode selects how the XDP program is attached
+type XDPMode string
+
+const (
+	XDPModeAuto    XDPMode = "auto"    // Native, falling back to generic
+	XDPModeNative  XDPMode = "native"  // Driver mode only
+	XDPModeGeneric XDPMode = "generic" // Generic (skb) mode only
+)
+
+// ParseXDPMode validates an XDP mode name
+func ParseXDPMode(s string) (XDPMode, error) {
+	switch m := XDPMode(s); m {
+	case XDPModeAuto, XDPModeNative, XDPModeGeneric:
+		return m, nil
+	case "":
+		return XDPModeAuto, nil
+	default:
+		return "", fmt.Errorf("invalid XDP mode %q (expected auto, native or generic)", s)
+	}
+}
+
+// Config holds data plane configuration
+type Config struct {
+	// Interface is the network interface to attach the eBPF programs to
+	Interface string `json:"interface" yaml:"interface"`
+
+	// Interfaces lists interface names or glob patterns (e.g. "veth*") to
+	// attach to. When non-empty it takes precedence over Interface.
+	Interfaces []string `json:"interfaces" yaml:"interfaces"`
+
+	// EnableEgress additionally attaches the filter to the egress hook so
+	// outbound connections are evaluated against policy
+	EnableEgress bool `json:"enable_egress" yaml:"enable_egress"`
+
+	// Hook selects the ingress enforcement hooks (egress always uses TC)
+	Hook HookMode `json:"hook" yaml:"hook"`
+
+	// XDPMode selects native or generic XDP when Hook uses XDP
+	XDPMode XDPMode `json:"xdp_mode" yaml:"xdp_mode"`
+
+	// DefaultAction applies to traffic no policy matches
+	DefaultAction DefaultAction `json:"default_action" yaml:"default_action"`
+
+	// DisableSafetyExemptions subjects loopback and API traffic to policy
+	DisableSafetyExemptions bool `json:"disable_safety_exemptions" yaml:"disable_safety_exemptions"`
+
+	// MonitorMode reports denied packets on every interface without dropping them
+	MonitorMode bool `json:"monitor_mode" yaml:"monitor_mode"`
+
+	// DropInvalidTCP drops TCP packets with invalid flag combinations
+	DropInvalidTCP bool `json:"drop_invalid_tcp" yaml:"drop_invalid_tcp"`
+
+	// DecapVXLAN and DecapGeneve also evaluate policy on the inner flow of
+	// VXLAN (UDP 4789) and Geneve (UDP 6081) packets whose outer flow is
+	// allowed
+	DecapVXLAN  bool `json:"decap_vxlan" yaml:"decap_vxlan"`
+	DecapGeneve bool `json:"decap_geneve" yaml:"decap_geneve"`
+
+	// FragmentAction applies to non-first fragments whose first fragment
+	// was not seen; other fragments follow their first fragment's verdict
+	FragmentAction DefaultAction `json:"fragment_action" yaml:"fragment_action"`
+
+	// MalformedAction applies to packets with malformed IP headers
+	MalformedAction DefaultAction `json:"malformed_action" yaml:"malformed_action"`
+
+	// SourceSessionLimit caps the active sessions of one source (0 =
+	// unlimited). Sources are grouped by SourcePrefixV4 and SourcePrefixV6,
+	// e.g. 24 for one quota per IPv4 /24 (0 = per address).
+	SourceSessionLimit uint32 `json:"source_session_limit" yaml:"source_session_limit"`
+	SourcePrefixV4     uint8  `json:"source_prefix_v4" yaml:"source_prefix_v4"`
+	SourcePrefixV6     uint8  `json:"source_prefix_v6" yaml:"source_prefix_v6"`
+
+	// PinPath is a bpffs directory (e.g. /sys/fs/bpf/microsegment) where the
+	// session, policy, config and statistics maps are pinned so they survive
+	// agent restarts. The programs then stay attached when the data plane is
+	// closed. Empty disables pinning.
+	PinPath string `json:"pin_path" yaml:"pin_path"`
+
+	// Takeover requires PinPath, under which the programs a previous agent
+	// left attached are adopted and replaced atomically. Pinned links are
+	// adopted whenever PinPath is set.
+	//
+	// Deprecated: set PinPath only.
+	Takeover bool `json:"takeover" yaml:"takeover"`
+
+	// APIPort is the agent API port kept reachable by the safety exemptions
+	APIPort uint16 `json:"api_port" yaml:"api_port"`
+
+	// SessionGC configures the userspace session sweeper
+	SessionGC SessionGCConfig `json:"session_gc" yaml:"session_gc"`
+}
+
+// SessionGCConfig holds session garbage collection settings.
+// Sessions idle for longer than the timeout of their class are removed.
+type SessionGCConfig struct {
+	// Interval between sweeps (0 disables the sweeper)
+	Interval time.Duration `json:"interval" yaml:"interval"`
+
+	// TCPEstablishedTimeout applies to TCP sessions in the established state
+	TCPEstablishedTimeout time.Duration `json:"tcp_established_timeout" yaml:"tcp_established_timeout"`
+
+	// TCPTransitoryTimeout applies to TCP sessions in handshake or teardown
+	TCPTransitoryTimeout time.Duration `json:"tcp_transitory_timeout" yaml:"tcp_transitory_timeout"`
+
+	// UDPTimeout applies to UDP and other non-TCP, non-ICMP sessions
+	UDPTimeout time.Duration `json:"udp_timeout" yaml:"udp_timeout"`
+
+	// ICMPTimeout applies to ICMP and ICMPv6 sessions
+	ICMPTimeout time.Duration `json:"icmp_timeout" yaml:"icmp_timeout"`
+}
+
+// DefaultConfig returns default data plane configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Interface:    "lo",
+		EnableEgress: false,
+		Hook:         HookModeTC,
+		XDPMode:      XDPModeAuto,
+		SessionGC:    DefaultSessionGCConfig(),
+
+		FragmentAction:  DefaultActionDeny,
+		MalformedAction: DefaultActionDeny,
+	}
+}
+
+// DefaultSessionGCConfig returns default session garbage collection settings
+func DefaultSessionGCConfig() SessionGCConfig {
+	return SessionGCConfig{
+		Interval:              10 * time.Second,
+		TCPEstablishedTimeout: 6 * time.Hour,
+		TCPTransitoryTimeout:  60 * time.Second,
+		UDPTimeout:            60 * time.Second,
+		ICMPTimeout:           30 * time.Second,
+	}
+}
+
+// withDefaults returns a copy of c with unset timeouts replaced by defaults
+func (c SessionGCConfig) withDefaults() SessionGCConfig {
+	def := DefaultSessionGCConfig()
+	if c.TCPEstablishedTimeout <= 0 {
+		c.TCPEstablishedTimeout = def.TCPEstablishedTimeout
+	}
+	if c.TCPTransitoryTimeout <= 0 {
+		c.TCPTransitoryTimeout = def.TCPTransitoryTimeout
+	}
+	if c.UDPTimeout <= 0 {
+		c.UDPTimeout = def.UDPTimeout
+	}
+	if c.ICMPTimeout <= 0 {
+		c.ICMPTimeout = def.ICMPTimeout
+	}
+	return c
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseHookMode tests hook mode validation and the hooks each mode uses
+func TestParseHookMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    HookMode
+		xdp     bool
+		tc      bool
+		wantErr bool
+	}{
+		{"", HookModeTC, false, true, false},
+		{"tc", HookModeTC, false, true, false},
+		{"xdp", HookModeXDP, true, false, false},
+		{"xdp+tc", HookModeXDPTC, true, true, false},
+		{"ebpf", "", false, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseHookMode(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.xdp, got.usesXDP())
+			assert.Equal(t, tt.tc, got.usesTC())
+		})
+	}
+}
+
+// TestParseXDPMode tests XDP mode validation
+func TestParseXDPMode(t *testing.T) {
+	for input, want := range map[string]XDPMode{
+		"":        XDPModeAuto,
+		"auto":    XDPModeAuto,
+		"native":  XDPModeNative,
+		"generic": XDPModeGeneric,
+	} {
+		got, err := ParseXDPMode(input)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ParseXDPMode("offload")
+	assert.Error(t, err)
+}
+
+// TestParseDefaultAction tests default action validation
+func TestParseDefaultAction(t *testing.T) {
+	for input, want := range map[string]DefaultAction{
+		"":      DefaultActionAllow,
+		"allow": DefaultActionAllow,
+		"deny":  DefaultActionDeny,
+		"DENY":  DefaultActionDeny,
+	} {
+		got, err := ParseDefaultAction(input)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ParseDefaultAction("log")
+	assert.Error(t, err)
+
+	assert.Equal(t, "deny", DefaultActionDeny.String())
+}
+
+// TestDefaultConfig_FragmentActions tests that unmatched fragments and
+// malformed packets are dropped by default
+func TestDefaultConfig_FragmentActions(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.Equal(t, DefaultActionDeny, cfg.FragmentAction)
+	assert.Equal(t, DefaultActionDeny, cfg.MalformedAction)
+}
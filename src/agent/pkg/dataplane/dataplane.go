@@ -2,30 +2,38 @@
 package dataplane
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/link"
 	"github.com/cilium/ebpf/ringbuf"
 	log "github.com/sirupsen/logrus"
-	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
 
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang -cflags "-O2 -g -Wall" -target amd64 bpf ../../../bpf/tc_microsegment.bpf.c -- -I../../../bpf -I../../../../vmlinux/x86
 
+// ErrObjectNotBuilt is returned when the eBPF object embedded in the
+// bindings is empty, i.e. `make bpf` (bpf2go with clang) has not been run
+var ErrObjectNotBuilt = errors.New("eBPF object not built, run `make bpf` to generate it")
+
 // DataPlane manages the eBPF data plane
 type DataPlane struct {
-	objs      *bpfObjects
-	iface     string
-	ifaceIdx  int
-	tcLink    link.Link
-	tcFilter  *netlink.BpfFilter // For legacy TC cleanup
-	rbReader  *ringbuf.Reader
-	useLegacy bool // Track if using legacy TC attachment
+	objs         *bpfObjects
+	enableEgress bool                        // Attach the egress hook as well
+	hook         HookMode                    // Ingress enforcement hooks
+	xdpMode      XDPMode                     // Native/generic XDP selection
+	pinPath      string                      // bpffs pin directory, empty if not pinning
+	ifaces       map[string]*ifaceAttachment // Attached interfaces by name
+	detached     map[string]bool             // Interfaces detached at runtime, not reattached by the watcher
+	ifacesMu     sync.Mutex                  // Guards ifaces and detached
+	rbReader     *ringbuf.Reader
+	events       *flowEventBroker // Fans decoded flow events out to subscribers
+	gc           *sessionGC       // nil when the session sweeper is disabled
+	watcher      *interfaceWatcher
+	configMu     sync.Mutex // Serializes config_map updates
 }
 
 // Statistics holds packet processing statistics
@@ -38,138 +46,177 @@ type Statistics struct {
 	ActiveSessions uint64
 	PolicyHits     uint64
 	PolicyMisses   uint64
+
+	// Per-hook verdicts
+	IngressAllowed uint64
+	IngressDenied  uint64
+	EgressAllowed  uint64
+	EgressDenied   uint64
+
+	// Packets matched to an existing session in the reply direction
+	ReplyPackets uint64
+
+	// Cached session decisions recomputed after a policy change
+	SessionsReevaluated uint64
+
+	// Packets dropped by the XDP program before reaching TC
+	XDPDropped uint64
+
+	// Policy lookups bypassed by the loopback/API safety exemptions
+	ExemptedFlows uint64
+
+	// Denied packets let through because monitor mode was active
+	WouldDeny uint64
+
+	// Flow events lost in the kernel because the ring buffer was full
+	RingBufferDrops uint64
+
+	// Packets dropped for invalid TCP flag combinations
+	InvalidTCPDrops uint64
+
+	// Non-first fragments dropped because their first fragment was not seen
+	FragmentDrops uint64
+
+	// Packets dropped for malformed IP headers
+	MalformedDrops uint64
+
+	// Packets over the token bucket of a rate_limit rule
+	RateLimited uint64
+
+	// New flows denied because their source reached its session quota
+	SessionLimitDrops uint64
+
+	// TCP RSTs and ICMP unreachables sent for packets of reject rules
+	RejectsSent uint64
+
+	// Userspace session sweeper activity
+	SessionGC SessionGCStats
+
+	// Flow event delivery to subscribers
+	FlowEvents FlowEventStats
 }
 
-// New creates a new data plane instance
+// New creates a new data plane instance attached to the ingress hook of iface
 func New(iface string) (*DataPlane, error) {
-	// Get interface index
-	ifaceObj, err := net.InterfaceByName(iface)
+	cfg := DefaultConfig()
+	cfg.Interface = iface
+	return NewWithConfig(cfg)
+}
+
+// NewWithConfig creates a new data plane instance from the given configuration
+func NewWithConfig(cfg *Config) (*DataPlane, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	hook, err := ParseHookMode(string(cfg.Hook))
+	if err != nil {
+		return nil, err
+	}
+	xdpMode, err := ParseXDPMode(string(cfg.XDPMode))
 	if err != nil {
-		return nil, fmt.Errorf("interface %s not found: %w", iface, err)
+		return nil, err
 	}
 
-	// Load eBPF objects
-	objs := &bpfObjects{}
-	if err := loadBpfObjects(objs, nil); err != nil {
-		return nil, fmt.Errorf("loading eBPF objects: %w", err)
+	if cfg.Takeover && cfg.PinPath == "" {
+		return nil, errors.New("takeover requires a pin path")
 	}
 
-	log.Debugf("eBPF objects loaded successfully")
+	patterns := cfg.Interfaces
+	if len(patterns) == 0 {
+		patterns = []string{cfg.Interface}
+	}
 
-	// Attach TC program to interface
-	// Try TCX first (kernel >= 6.6), fallback to legacy TC hook if not supported
-	var tcLink link.Link
-	tcLink, err = link.AttachTCX(link.TCXOptions{
-		Interface: ifaceObj.Index,
-		Program:   objs.TcMicrosegmentFilter,
-		Attach:    ebpf.AttachTCXIngress,
-	})
+	available, err := systemInterfaces()
 	if err != nil {
-		// TCX not supported (kernel < 6.6), fallback to legacy netlink-based TC hook
-		log.Warnf("TCX attach failed (requires kernel >= 6.6), falling back to legacy TC hook: %v", err)
-
-		// Attach using netlink (compatible with kernel >= 4.18)
-		nlLink, err := netlink.LinkByIndex(ifaceObj.Index)
-		if err != nil {
-			objs.Close()
-			return nil, fmt.Errorf("getting netlink interface: %w", err)
-		}
+		return nil, err
+	}
 
-		// Create clsact qdisc if not exists
-		qdisc := &netlink.GenericQdisc{
-			QdiscAttrs: netlink.QdiscAttrs{
-				LinkIndex: ifaceObj.Index,
-				Handle:    netlink.MakeHandle(0xffff, 0),
-				Parent:    netlink.HANDLE_CLSACT,
-			},
-			QdiscType: "clsact",
-		}
+	ifaces, err := resolveInterfaces(patterns, available)
+	if err != nil {
+		return nil, err
+	}
 
-		// Try to add qdisc, ignore "file exists" error
-		if err := netlink.QdiscAdd(qdisc); err != nil {
-			// Check if it's "file exists" error (qdisc already present)
-			if !isFileExistsError(err) {
-				objs.Close()
-				return nil, fmt.Errorf("adding clsact qdisc: %w", err)
-			}
-			log.Debugf("clsact qdisc already exists on %s", iface)
-		} else {
-			log.Debugf("Added clsact qdisc to %s", iface)
-		}
+	// Load eBPF objects
+	if len(_BpfBytes) == 0 {
+		return nil, ErrObjectNotBuilt
+	}
+	spec, err := loadBpf()
+	if err != nil {
+		return nil, fmt.Errorf("loading eBPF spec: %w", err)
+	}
 
-		// Clean up any existing filters first (from previous runs)
-		existingFilters, err := netlink.FilterList(nlLink, netlink.HANDLE_MIN_INGRESS)
-		if err == nil {
-			for _, f := range existingFilters {
-				if bpfFilter, ok := f.(*netlink.BpfFilter); ok {
-					if bpfFilter.Name == "tc_microsegment_filter" {
-						netlink.FilterDel(bpfFilter)
-						log.Debugf("Removed old BPF filter from %s", iface)
-					}
-				}
-			}
+	// Pinned maps are reused so sessions and policies survive a restart
+	var opts ebpf.CollectionOptions
+	if cfg.PinPath != "" {
+		if err := preparePinnedMaps(spec, cfg.PinPath); err != nil {
+			return nil, fmt.Errorf("preparing pinned maps: %w", err)
 		}
+		opts.Maps.PinPath = cfg.PinPath
+	}
 
-		// Attach BPF filter
-		filter := &netlink.BpfFilter{
-			FilterAttrs: netlink.FilterAttrs{
-				LinkIndex: ifaceObj.Index,
-				Parent:    netlink.HANDLE_MIN_INGRESS,
-				Handle:    1,
-				Protocol:  unix.ETH_P_ALL,
-				Priority:  1,
-			},
-			Fd:           objs.TcMicrosegmentFilter.FD(),
-			Name:         "tc_microsegment_filter",
-			DirectAction: true,
-		}
+	objs := &bpfObjects{}
+	if err := spec.LoadAndAssign(objs, &opts); err != nil {
+		return nil, fmt.Errorf("loading eBPF objects: %w", err)
+	}
 
-		if err := netlink.FilterAdd(filter); err != nil {
-			objs.Close()
-			return nil, fmt.Errorf("attaching TC filter: %w", err)
-		}
+	log.Debugf("eBPF objects loaded successfully")
 
-		log.Infof("✓ TC program attached to %s ingress (legacy netlink mode, kernel < 6.6)", iface)
+	dp := &DataPlane{
+		objs:         objs,
+		enableEgress: cfg.EnableEgress,
+		hook:         hook,
+		xdpMode:      xdpMode,
+		pinPath:      cfg.PinPath,
+		ifaces:       make(map[string]*ifaceAttachment),
+		detached:     make(map[string]bool),
+		events:       newFlowEventBroker(),
+	}
 
-		// Setup ring buffer reader for flow events
-		rbReader, err := ringbuf.NewReader(objs.FlowEvents)
-		if err != nil {
-			netlink.FilterDel(filter)
-			objs.Close()
-			return nil, fmt.Errorf("creating ring buffer reader: %w", err)
-		}
+	// Program the runtime settings before any traffic is enforced
+	err = dp.SetRuntimeConfig(RuntimeConfig{
+		DefaultAction:    cfg.DefaultAction,
+		SafetyExemptions: !cfg.DisableSafetyExemptions,
+		APIPort:          cfg.APIPort,
+		MonitorMode:      cfg.MonitorMode,
+		DropInvalidTCP:   cfg.DropInvalidTCP,
+		DecapVXLAN:       cfg.DecapVXLAN,
+		DecapGeneve:      cfg.DecapGeneve,
+		FragmentAction:   cfg.FragmentAction,
+		MalformedAction:  cfg.MalformedAction,
+
+		SourceSessionLimit: cfg.SourceSessionLimit,
+		SourcePrefixV4:     cfg.SourcePrefixV4,
+		SourcePrefixV6:     cfg.SourcePrefixV6,
+	})
+	if err != nil {
+		dp.Close()
+		return nil, err
+	}
 
-		dp := &DataPlane{
-			objs:      objs,
-			iface:     iface,
-			ifaceIdx:  ifaceObj.Index,
-			tcLink:    nil,
-			tcFilter:  filter,
-			rbReader:  rbReader,
-			useLegacy: true,
+	// Attach TC programs to every interface
+	for _, name := range ifaces {
+		if err := dp.AttachInterface(name); err != nil {
+			dp.Close()
+			return nil, err
 		}
-
-		return dp, nil
-	} else {
-		log.Infof("✓ TC program attached to %s ingress (TCX mode, kernel >= 6.6)", iface)
 	}
 
+	// Follow interfaces matching the configuration as they come and go
+	dp.watcher = newInterfaceWatcher(dp, patterns)
+	dp.watcher.start()
+
 	// Setup ring buffer reader for flow events
 	rbReader, err := ringbuf.NewReader(objs.FlowEvents)
 	if err != nil {
-		tcLink.Close()
-		objs.Close()
+		dp.Close()
 		return nil, fmt.Errorf("creating ring buffer reader: %w", err)
 	}
+	dp.rbReader = rbReader
 
-	dp := &DataPlane{
-		objs:      objs,
-		iface:     iface,
-		ifaceIdx:  ifaceObj.Index,
-		tcLink:    tcLink,
-		tcFilter:  nil,
-		rbReader:  rbReader,
-		useLegacy: false,
+	if cfg.SessionGC.Interval > 0 {
+		dp.gc = newSessionGC(objs.SessionMap, objs.SourceSessionsMap, objs.ConfigMap, objs.StatsMap, cfg.SessionGC)
+		dp.gc.start()
 	}
 
 	return dp, nil
@@ -179,25 +226,31 @@ func New(iface string) (*DataPlane, error) {
 func (dp *DataPlane) Close() error {
 	var errs []error
 
+	if dp.watcher != nil {
+		dp.watcher.close()
+		dp.watcher = nil
+	}
+
+	if dp.gc != nil {
+		dp.gc.close()
+		dp.gc = nil
+	}
+
 	if dp.rbReader != nil {
 		if err := dp.rbReader.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("closing ring buffer reader: %w", err))
 		}
 	}
+	dp.events.close()
 
-	// Clean up TC attachment (TCX or legacy)
-	if dp.useLegacy && dp.tcFilter != nil {
-		// Legacy netlink-based TC cleanup
-		if err := netlink.FilterDel(dp.tcFilter); err != nil {
-			errs = append(errs, fmt.Errorf("removing TC filter: %w", err))
-		} else {
-			log.Debugf("TC filter removed from %s", dp.iface)
-		}
-	} else if dp.tcLink != nil {
-		// TCX cleanup
-		if err := dp.tcLink.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("detaching TC program: %w", err))
-		}
+	// Clean up TC attachments (TCX or legacy) on every interface. With
+	// pinning the programs stay attached so enforcement never stops.
+	detach := dp.detachAll
+	if dp.pinPath != "" {
+		detach = dp.releaseAll
+	}
+	if err := detach(); err != nil {
+		errs = append(errs, err)
 	}
 
 	if dp.objs != nil {
@@ -212,6 +265,11 @@ func (dp *DataPlane) Close() error {
 	return nil
 }
 
+// EgressEnabled reports whether the egress hook is attached to new interfaces
+func (dp *DataPlane) EgressEnabled() bool {
+	return dp.enableEgress
+}
+
 // GetStatistics retrieves current packet processing statistics
 func (dp *DataPlane) GetStatistics() Statistics {
 	stats := Statistics{}
@@ -236,16 +294,44 @@ func (dp *DataPlane) GetStatistics() Statistics {
 	stats.DeniedPackets = readStat(2)
 	stats.NewSessions = readStat(3)
 	stats.ClosedSessions = readStat(4)
-	stats.ActiveSessions = readStat(5)
+	stats.ActiveSessions = readStat(statsActiveSessions)
 	stats.PolicyHits = readStat(6)
 	stats.PolicyMisses = readStat(7)
+	stats.IngressAllowed = readStat(8)
+	stats.IngressDenied = readStat(9)
+	stats.EgressAllowed = readStat(10)
+	stats.EgressDenied = readStat(11)
+	stats.ReplyPackets = readStat(12)
+	stats.SessionsReevaluated = readStat(13)
+	stats.XDPDropped = readStat(14)
+	stats.ExemptedFlows = readStat(15)
+	stats.WouldDeny = readStat(16)
+	stats.RingBufferDrops = readStat(17)
+	stats.InvalidTCPDrops = readStat(18)
+	stats.FragmentDrops = readStat(19)
+	stats.MalformedDrops = readStat(20)
+	stats.RateLimited = readStat(21)
+	stats.SessionLimitDrops = readStat(22)
+	stats.RejectsSent = readStat(23)
+
+	// Sessions removed by the sweeper never pass through the eBPF close
+	// path; the sweeper recounts the active sessions in stats_map itself
+	if dp.gc != nil {
+		stats.SessionGC = dp.gc.getStats()
+		stats.ClosedSessions += stats.SessionGC.ExpiredSessions
+	}
+
+	stats.FlowEvents = dp.events.getStats()
 
 	return stats
 }
 
-// MonitorFlowEvents continuously reads and processes flow events from ring buffer
+// MonitorFlowEvents continuously reads flow events from the ring buffer,
+// decodes them and hands them to subscribers (see Subscribe). It returns
+// when the data plane is closed.
 func (dp *DataPlane) MonitorFlowEvents() {
 	log.Info("Starting flow event monitoring")
+	defer dp.events.close()
 
 	for {
 		record, err := dp.rbReader.Read()
@@ -258,33 +344,43 @@ func (dp *DataPlane) MonitorFlowEvents() {
 			continue
 		}
 
-		// Parse flow event - simple struct parsing
-		if len(record.RawSample) < 32 {
-			log.Warn("Received incomplete flow event")
+		bootTime, err := monotonicBootTime()
+		if err != nil {
+			log.Errorf("Converting flow event timestamp: %v", err)
+			continue
+		}
+
+		ev, err := decodeFlowEvent(record.RawSample, bootTime)
+		if err != nil {
+			dp.events.decodeError()
+			log.Warnf("Received invalid flow event: %v", err)
 			continue
 		}
 
-		// Manual parsing of flow event structure
-		// Parse flow key (5-tuple)
-		srcIP := binary.LittleEndian.Uint32(record.RawSample[0:4])
-		dstIP := binary.LittleEndian.Uint32(record.RawSample[4:8])
-		srcPort := binary.LittleEndian.Uint16(record.RawSample[8:10])
-		dstPort := binary.LittleEndian.Uint16(record.RawSample[10:12])
-		protocol := record.RawSample[12]
-
-		srcIPStr := intToIP(srcIP)
-		dstIPStr := intToIP(dstIP)
-
-		log.Infof("[FLOW EVENT] %s:%d -> %s:%d proto=%d",
-			srcIPStr, srcPort,
-			dstIPStr, dstPort,
-			protocol)
+		dp.events.publish(ev)
+		logFlowEvent(&ev)
 	}
 }
 
-// Helper: Convert uint32 IP to net.IP
-func intToIP(ip uint32) net.IP {
-	return net.IPv4(byte(ip), byte(ip>>8), byte(ip>>16), byte(ip>>24))
+// logFlowEvent writes a one-line summary of an event
+func logFlowEvent(ev *FlowEvent) {
+	src := net.JoinHostPort(ev.SrcIP.String(), fmt.Sprint(ev.SrcPort))
+	dst := net.JoinHostPort(ev.DstIP.String(), fmt.Sprint(ev.DstPort))
+
+	if ev.Type == FlowEventClose {
+		log.Infof("[FLOW CLOSE] %s -> %s proto=%d dir=%s packets=%d bytes=%d",
+			src, dst, ev.Protocol, ev.Direction, ev.Packets, ev.Bytes)
+		return
+	}
+
+	// Denies reported by monitor mode were not enforced
+	simulated := ""
+	if ev.Simulated {
+		simulated = " (simulated)"
+	}
+
+	log.Infof("[FLOW EVENT] %s -> %s proto=%d dir=%s action=%d%s",
+		src, dst, ev.Protocol, ev.Direction, ev.Action, simulated)
 }
 
 // GetSessionMap returns the session map for external access
@@ -292,6 +388,12 @@ func (dp *DataPlane) GetSessionMap() *ebpf.Map {
 	return dp.objs.SessionMap
 }
 
+// IngressHooks reports whether the XDP and the TC ingress programs
+// enforce ingress policy
+func (dp *DataPlane) IngressHooks() (xdp, tc bool) {
+	return dp.hook.usesXDP(), dp.hook.usesTC()
+}
+
 // GetPolicyMap returns the policy map for external access
 func (dp *DataPlane) GetPolicyMap() *ebpf.Map {
 	return dp.objs.PolicyMap
@@ -302,6 +404,41 @@ func (dp *DataPlane) GetWildcardPolicyMap() *ebpf.Map {
 	return dp.objs.WildcardPolicyMap
 }
 
+// GetSrcCIDRMap returns the source prefix trie for external access
+func (dp *DataPlane) GetSrcCIDRMap() *ebpf.Map {
+	return dp.objs.SrcCidrMap
+}
+
+// GetDstCIDRMap returns the destination prefix trie for external access
+func (dp *DataPlane) GetDstCIDRMap() *ebpf.Map {
+	return dp.objs.DstCidrMap
+}
+
+// GetIPCacheMap returns the address to security identity trie for external access
+func (dp *DataPlane) GetIPCacheMap() *ebpf.Map {
+	return dp.objs.IpcacheMap
+}
+
+// GetSrcIdentityMap returns the index of wildcard rules by source identity for external access
+func (dp *DataPlane) GetSrcIdentityMap() *ebpf.Map {
+	return dp.objs.SrcIdentityMap
+}
+
+// GetDstIdentityMap returns the index of wildcard rules by destination identity for external access
+func (dp *DataPlane) GetDstIdentityMap() *ebpf.Map {
+	return dp.objs.DstIdentityMap
+}
+
+// GetRateLimitMap returns the token buckets of rate_limit rules for external access
+func (dp *DataPlane) GetRateLimitMap() *ebpf.Map {
+	return dp.objs.RateLimitMap
+}
+
+// GetMirrorMap returns the mirror targets of rules for external access
+func (dp *DataPlane) GetMirrorMap() *ebpf.Map {
+	return dp.objs.MirrorMap
+}
+
 // isFileExistsError checks if an error is due to "file exists"
 func isFileExistsError(err error) bool {
 	if err == nil {
@@ -3,8 +3,9 @@
 //
 // The data plane manages:
 //   - eBPF program lifecycle (loading, attachment, cleanup)
-//   - TC (Traffic Control) hook integration
-//   - Session tracking and statistics collection
+//   - TC (Traffic Control) hook integration, ingress and optionally egress
+//   - Optional XDP ingress enforcement for early drops
+//   - Bidirectional session tracking and statistics collection
 //   - Flow event monitoring via ring buffer
 //
 // # Architecture
@@ -44,14 +45,253 @@
 //   - Average latency: < 5 microseconds
 //   - Throughput: 100K+ packets/sec per CPU core
 //
+// # Interfaces
+//
+// One data plane can enforce on many interfaces. Config.Interfaces takes
+// names or glob patterns (e.g. "veth*"). They are expanded at startup and
+// again on every netlink link notification, and at least every 30s:
+// interfaces that appear under them are attached, and attachments of
+// interfaces that are gone (or were recreated with a new index) are
+// dropped. AttachInterface/DetachInterface add or remove interfaces at
+// runtime; an interface detached this way is not reattached. All
+// interfaces share the same maps, so one policy set and one session table
+// cover every attachment. ListInterfaces reports whether each hook uses
+// TCX or the legacy netlink TC hook.
+//
+// # XDP
+//
+// Config.Hook selects the ingress hooks: "tc" (default), "xdp" or
+// "xdp+tc". The XDP program shares all maps with the TC programs and drops
+// denied ingress traffic before an skb is allocated. In xdp+tc mode the
+// TC ingress program is attached as well; packets XDP allowed carry a
+// metadata marker and pass TC untouched, leaving TC for traffic XDP hands
+// on. Egress is always enforced at TC. Config.XDPMode picks native or
+// generic XDP; "auto" tries native and falls back to generic.
+//
+// # Default Action
+//
+// Traffic no policy matches gets Config.DefaultAction (allow unless set to
+// deny for zero-trust operation). It lives in config_map together with the
+// safety exemptions and can be changed at runtime with SetRuntimeConfig, or
+// UpdateRuntimeConfig to change some settings and keep the others, both of
+// which also re-evaluate existing sessions. The exemptions keep loopback
+// traffic and the agent's API port (Config.APIPort) reachable whatever the
+// policies say; the API port is only exempt as the local port, i.e. the
+// destination on ingress and the source on egress. ARP and other non-IP
+// traffic is never subject to policy.
+//
+// # Monitor Mode
+//
+// Monitor mode lets a ruleset be evaluated without enforcing it. It can be
+// enabled globally (RuntimeConfig.MonitorMode), per interface
+// (SetInterfaceMonitor, stored in monitor_iface_map by ifindex) or per rule
+// (the policy's monitor flag, cached in the session). Packets a deny would
+// have dropped are passed, counted in Statistics.WouldDeny, and their flow
+// events carry FLOW_EVENT_FLAG_SIMULATED.
+//
+// # Sessions
+//
+// A session is keyed by the 5-tuple of the packet that opened it. Reply
+// packets are matched through the reversed key, inherit the session's
+// verdict, and are counted separately (packets/bytes to client), so a
+// policy only needs to allow the initiating direction. ListSessions
+// exposes the table with timestamps converted to wall-clock time.
+//
+// Each session remembers the policy generation its cached decision was
+// computed at. Policy changes bump the generation in config_map (see
+// BumpPolicyGeneration), so the next packet of every existing session
+// re-runs the policy lookup and picks up added or removed rules.
+//
+// TCP sessions follow SYN/SYN-ACK/FIN/RST through enum tcp_state. A
+// session is removed when the final ACK of the FIN exchange or a RST is
+// seen, which updates the closed/active session counters and emits a
+// close flow event carrying the final packet and byte totals.
+//
+// Sessions that go idle without a clean close (UDP, ICMP, abandoned TCP)
+// are removed by a userspace sweeper. Every SessionGCConfig.Interval it
+// compares last_seen_ts against the TCP established, TCP transitory, UDP
+// and ICMP timeouts; removals are reported in Statistics.SessionGC and
+// folded into the closed session counter. Each sweep also writes a recount
+// of session_map to the active sessions counter in stats_map, which also
+// covers sessions the LRU evicted.
+//
+// # Connection State
+//
+// The slow path classifies every packet that has no session into a
+// connection state (enum conn_state) that wildcard rules can match through
+// their conn_states mask. A bare SYN and non-TCP packets are new. Other TCP
+// packets without a session, including those with invalid flags, are
+// invalid. ICMP replies are established: they belong to a request sent
+// before the agent saw it. ICMP errors quoting a flow with a session are
+// related, other ICMP errors are invalid. The state is cached in the
+// session with its verdict. A bare SYN hitting a TCP session past the
+// handshake closes that session and is evaluated as a new connection.
+//
+// With RuntimeConfig.DropInvalidTCP, TCP packets with invalid flag
+// combinations (NULL, XMAS, SYN+FIN, SYN+RST, FIN+RST, FIN without ACK)
+// are dropped before any lookup and counted in Statistics.InvalidTCPDrops.
+//
+// # Fragments and Malformed Headers
+//
+// Only unfragmented packets and first fragments carry a transport header,
+// so only they are evaluated against policy. The verdict of a first
+// fragment is kept in frag_map, keyed by addresses, protocol and the IPv4
+// identification or IPv6 fragment id, and the datagram's later fragments
+// follow it for up to 30 seconds. Later fragments whose first fragment was
+// not seen get RuntimeConfig.FragmentAction and are counted in
+// Statistics.FragmentDrops when dropped.
+//
+// IPv4 headers with a bad version or header length, first fragments too
+// short for the transport header and TCP fragments at offset 8 (RFC 1858)
+// are malformed. They get RuntimeConfig.MalformedAction and are counted in
+// Statistics.MalformedDrops when dropped.
+//
+// # Rate Limiting
+//
+// A rule with the RATE_LIMIT action has a token bucket in rate_limit_map,
+// keyed by rule ID and shared by all CPUs under a spin lock. Sessions
+// remember the rule that decided them, so every packet of a rate limited
+// session, in either direction, is charged to the rule's bucket; buckets
+// counting connections only charge the packet that opens a session. A
+// packet finding the bucket empty is treated as denied (and so honours
+// monitor mode) and counted in Statistics.RateLimited and per rule in
+// rate_limited_map (RateLimitedPackets). A flow whose first packet is
+// over the limit gets no session. Rules without a bucket are not limited.
+//
+// # Session Quotas
+//
+// source_sessions_map counts the active sessions each source opened, per
+// address or, with RuntimeConfig.SourcePrefixV4/SourcePrefixV6, per
+// prefix. A packet that would open a session from a source already at
+// its limit is denied (honouring monitor mode), gets no session and is
+// counted in Statistics.SessionLimitDrops. The limit is the matching
+// rule's session limit if it has one, else RuntimeConfig.SourceSessionLimit;
+// zero means unlimited, and flows bypassed by the safety exemptions are
+// never limited. Sessions closed by the data plane are subtracted right
+// away; the session sweeper recounts the map on every pass to account for
+// idle and evicted sessions. TopSources lists the busiest sources.
+//
+// # Rejecting
+//
+// Packets of a REJECT rule are dropped like denied ones and answered so
+// the client fails fast instead of timing out. The TC programs rewrite the
+// packet in place into a TCP RST (RFC 9293 reset generation) or, for UDP
+// and other protocols, an ICMP/ICMPv6 destination unreachable (port
+// unreachable for UDP, administratively prohibited otherwise), and
+// redirect it back: out of the interface on ingress, into the local stack
+// on egress. Replies carry a mark, and the program on the hook they are
+// redirected to lets a marked packet pass only while a reply redirected
+// there is pending; marks set by others are neither trusted nor cleared.
+// The XDP program builds the same replies
+// and sends them with XDP_TX. Packets that can't be answered safely are
+// only dropped: TCP RSTs, ICMP errors, multicast and broadcast traffic,
+// IPv4 packets with options, frames with a VLAN tag in the packet data,
+// GSO packets and the inner flows of decapsulated tunnels. Replies are
+// counted in Statistics.RejectsSent.
+//
+// # Identities
+//
+// Addresses can carry a numeric security identity, kept by userspace in
+// ipcache_map (longest prefix wins). Wildcard rules may match a source
+// and destination identity instead of, or besides, addresses; they are
+// indexed by identity in src_identity_map and dst_identity_map. A policy
+// lookup resolves the identities of both addresses and matches rules of
+// either side's identity along with the CIDR candidates. Sessions cache
+// the decision; updating the ipcache bumps the policy generation, so
+// sessions re-resolve their identities. Addresses outside the ipcache
+// have identity 0 and only match rules without one.
+//
+// # Mirroring
+//
+// A rule with a mirror target in mirror_map has a copy of its packets
+// sent out of a monitoring interface with bpf_clone_redirect, while the
+// rule's decision still applies to the original. Sessions remember their
+// rule, so every packet of the flow is mirrored, in both directions. A
+// sample rate of N copies one packet in N, picked at random. Copies are
+// taken on the TC hooks before the verdict, so denied packets are copied
+// too. bpf_clone_redirect runs the target's egress hook before it
+// returns, so a TC program there lets a copy through only while the same
+// CPU is sending a copy out of that target; the copy keeps the original's
+// mark. The XDP program can't copy packets: in xdp+tc mode it hands the
+// target of allowed packets to the TC ingress program, and packets it
+// drops are not mirrored. The policy manager refuses mirrored rules in
+// xdp-only mode. Copies are counted per target in mirror_stats_map
+// (MirrorStats).
+//
+// # VLANs and Tunnels
+//
+// Frames with one or two VLAN tags (802.1Q, 802.1ad) are parsed through
+// to the IP header. The outermost VLAN ID is taken from the packet or, on
+// the TC hooks, from a tag the NIC already stripped; the XDP program only
+// sees tags still present in the packet data, so with an XDP hook policies
+// matching a VLAN ID are only accepted for egress (see IngressHooks).
+//
+// With RuntimeConfig.DecapVXLAN or DecapGeneve, UDP packets to port 4789
+// (VXLAN) or 6081 (Geneve) are evaluated on their outer flow first and,
+// if that is allowed, on the 5-tuple of the inner Ethernet frame; the
+// whole tunnel packet gets the verdict of the last flow evaluated. Both
+// flows get a session and count in the allowed/denied statistics. The VLAN
+// ID and VNI are stored in the session (Session.VlanID, Session.VNI) and
+// matched by wildcard rules. Sessions are still keyed by the 5-tuple, so
+// tenants with overlapping addresses share session entries.
+//
+// # Flow Events
+//
+// The eBPF programs report denied flows, logged flows and session closes
+// through the flow_events ring buffer. MonitorFlowEvents decodes each
+// record into a FlowEvent (host-order ports, wall-clock timestamp) and fans
+// it out to the channels returned by Subscribe, filtered per subscriber.
+// Delivery never blocks the reader: a subscriber more than 1024 events
+// behind misses new events, which are counted in Statistics.FlowEvents.
+//
 // # Maps
 //
 // The data plane uses the following eBPF maps:
 //   - session_map: LRU_HASH for session tracking (100K entries)
 //   - policy_map: HASH for policy storage (10K entries)
-//   - stats_map: PERCPU_ARRAY for lock-free statistics (8 counters)
+//   - wildcard_policy_map: ARRAY of CIDR/wildcard rules (4K entries)
+//   - src_cidr_map, dst_cidr_map: LPM_TRIE indexes of wildcard rules by prefix
+//   - src_identity_map, dst_identity_map: HASH indexes of wildcard rules by security identity
+//   - ipcache_map: LPM_TRIE of security identities by address or prefix (64K entries)
+//   - stats_map: PERCPU_ARRAY for lock-free statistics (per-verdict, per-hook and reply counters)
+//   - rule_hits_map: PERCPU_HASH of matches per policy rule ID
+//   - rate_limit_map: HASH of token buckets of rate limited rules
+//   - rate_limited_map: PERCPU_HASH of rate limited packets per rule ID
+//   - source_sessions_map: LRU_HASH of active sessions per source address or prefix (64K entries)
+//   - mirror_map: HASH of mirror targets per rule ID
+//   - mirror_stats_map: PERCPU_HASH of copies sent per mirror target ifindex
+//   - mirror_inflight_map: PERCPU_ARRAY of the copy each CPU is sending
+//   - packet_scratch_map, session_scratch_map: PERCPU_ARRAY scratch space for
+//     the packet being parsed and the session being created
+//   - config_map: ARRAY holding runtime configuration shared with userspace
+//   - monitor_iface_map: HASH of interfaces in monitor mode
+//   - frag_map: LRU_HASH of first-fragment verdicts (8K entries)
 //   - flow_events: RINGBUF for event delivery (256KB)
 //
+// # Pinning
+//
+// With Config.PinPath set (a directory on bpffs, e.g.
+// /sys/fs/bpf/microsegment) the session, policy, CIDR and identity index,
+// ipcache, rate limit, mirror, config, statistics and rule counter maps are
+// pinned there and reused by the next agent, so restarts and upgrades keep sessions and in-kernel
+// policies. Close leaves the pins in place. On startup a pinned map whose layout
+// matches is reused; one whose only change is its capacity is migrated
+// entry by entry; any other layout change recreates the map empty. The
+// policy generation is bumped on startup, so reused sessions are
+// re-evaluated against the current policies. Remove the directory to
+// start from scratch.
+//
+// # Takeover
+//
+// With pinning, TCX and XDP links are pinned under <PinPath>/links and
+// Close releases the attachments instead of detaching them, so the
+// programs keep enforcing while no agent runs. A new agent adopts each
+// pinned link and swaps in its own program with an atomic link update;
+// legacy TC filters are replaced in place at the same handle and
+// priority. A link is detached and attached again only when the update
+// fails or its XDP mode doesn't match the configuration. DetachInterface
+// always detaches.
+//
 // # Thread Safety
 //
 // The DataPlane type is safe for concurrent use. Statistics queries
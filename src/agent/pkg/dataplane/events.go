@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// flowSubscriberBuffer is the number of events queued per subscriber before
+// new events are dropped for it
+const flowSubscriberBuffer = 1024
+
+// FlowEventType mirrors enum flow_event_type in common_types.h
+type FlowEventType uint8
+
+const (
+	FlowEventNew FlowEventType = iota
+	FlowEventUpdate
+	FlowEventClose
+)
+
+// String returns the lowercase name of the event type
+func (t FlowEventType) String() string {
+	switch t {
+	case FlowEventNew:
+		return "new"
+	case FlowEventUpdate:
+		return "update"
+	case FlowEventClose:
+		return "close"
+	default:
+		return fmt.Sprintf("event(%d)", uint8(t))
+	}
+}
+
+// flowEventFlagSimulated matches FLOW_EVENT_FLAG_SIMULATED in common_types.h
+const flowEventFlagSimulated = 1 << 0
+
+// flowEventRecord mirrors struct flow_event in common_types.h
+type flowEventRecord struct {
+	Key       bpfFlowKey
+	Timestamp uint64
+	Packets   uint64
+	Bytes     uint64
+	Action    uint8
+	EventType uint8
+	Flags     uint8
+	Pad       uint8
+}
+
+// flowEventSize is the size of struct flow_event
+var flowEventSize = binary.Size(flowEventRecord{})
+
+// FlowEvent is a decoded flow_event reported by the eBPF programs.
+// Src/Dst describe the packet that triggered the event; for close events
+// they are the session initiator and Packets/Bytes are the final totals of
+// both directions. ICMP ports are encoded as in Session.
+type FlowEvent struct {
+	Timestamp time.Time
+	Type      FlowEventType
+	SrcIP     net.IP
+	DstIP     net.IP
+	SrcPort   uint16
+	DstPort   uint16
+	Protocol  uint8
+	Direction Direction
+	Action    uint8 // enum policy_action
+	Packets   uint64
+	Bytes     uint64
+
+	// Simulated is set for denies monitor mode did not enforce
+	Simulated bool
+}
+
+// decodeFlowEvent decodes a raw ring buffer record. Timestamps are converted
+// from bpf_ktime_get_ns() to wall-clock time using bootTime.
+func decodeFlowEvent(raw []byte, bootTime time.Time) (FlowEvent, error) {
+	if len(raw) < flowEventSize {
+		return FlowEvent{}, fmt.Errorf("short flow event: %d bytes, want %d", len(raw), flowEventSize)
+	}
+
+	var rec flowEventRecord
+	if err := binary.Read(bytes.NewReader(raw[:flowEventSize]), binary.LittleEndian, &rec); err != nil {
+		return FlowEvent{}, fmt.Errorf("decoding flow event: %w", err)
+	}
+
+	return FlowEvent{
+		Timestamp: bootTime.Add(time.Duration(rec.Timestamp)),
+		Type:      FlowEventType(rec.EventType),
+		SrcIP:     keyAddrToIP(rec.Key.SrcIp),
+		DstIP:     keyAddrToIP(rec.Key.DstIp),
+		SrcPort:   ntohs(rec.Key.SrcPort),
+		DstPort:   ntohs(rec.Key.DstPort),
+		Protocol:  rec.Key.Protocol,
+		Direction: Direction(rec.Key.Direction),
+		Action:    rec.Action,
+		Packets:   rec.Packets,
+		Bytes:     rec.Bytes,
+		Simulated: rec.Flags&flowEventFlagSimulated != 0,
+	}, nil
+}
+
+// ICMPTypeCode splits the destination port of an ICMP or ICMPv6 flow into
+// the message type and code (ICMP_KEY_PORT in common_types.h)
+func ICMPTypeCode(dstPort uint16) (icmpType, icmpCode uint8) {
+	return uint8(dstPort >> 8), uint8(dstPort)
+}
+
+// FlowEventFilter selects the events delivered to a subscriber.
+// Empty fields match everything.
+type FlowEventFilter struct {
+	Types    []FlowEventType
+	Actions  []uint8
+	Protocol uint8 // 0 = any protocol
+}
+
+// Match reports whether the event passes the filter
+func (f *FlowEventFilter) Match(ev *FlowEvent) bool {
+	if f.Protocol != 0 && ev.Protocol != f.Protocol {
+		return false
+	}
+
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			if t == ev.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Actions) > 0 {
+		found := false
+		for _, a := range f.Actions {
+			if a == ev.Action {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FlowEventStats holds flow event delivery counters
+type FlowEventStats struct {
+	Received     uint64 // Records read from the ring buffer
+	DecodeErrors uint64 // Records that could not be decoded
+	Delivered    uint64 // Events queued to subscribers
+	Dropped      uint64 // Events dropped because a subscriber was too slow
+	Subscribers  int
+}
+
+// flowSubscriber is one consumer of flow events
+type flowSubscriber struct {
+	ch     chan FlowEvent
+	filter FlowEventFilter
+}
+
+// flowEventBroker fans decoded events out to subscribers. Delivery never
+// blocks the ring buffer reader: a subscriber whose buffer is full misses
+// the event and the drop is counted.
+type flowEventBroker struct {
+	mu     sync.Mutex
+	subs   map[<-chan FlowEvent]*flowSubscriber
+	stats  FlowEventStats
+	closed bool
+}
+
+func newFlowEventBroker() *flowEventBroker {
+	return &flowEventBroker{
+		subs: make(map[<-chan FlowEvent]*flowSubscriber),
+	}
+}
+
+// subscribe registers a subscriber. The channel is closed when the broker
+// shuts down; subscribing after that returns a closed channel.
+func (b *flowEventBroker) subscribe(filter FlowEventFilter, buffer int) <-chan FlowEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan FlowEvent, buffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+
+	b.subs[ch] = &flowSubscriber{ch: ch, filter: filter}
+	return ch
+}
+
+// unsubscribe removes a subscriber and closes its channel
+func (b *flowEventBroker) unsubscribe(ch <-chan FlowEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if sub, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(sub.ch)
+	}
+}
+
+// publish delivers an event to every matching subscriber without blocking
+func (b *flowEventBroker) publish(ev FlowEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.Received++
+	for _, sub := range b.subs {
+		if !sub.filter.Match(&ev) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+			b.stats.Delivered++
+		default:
+			b.stats.Dropped++
+		}
+	}
+}
+
+// decodeError accounts for a record that could not be decoded
+func (b *flowEventBroker) decodeError() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.Received++
+	b.stats.DecodeErrors++
+}
+
+// close closes every subscriber channel
+func (b *flowEventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch, sub := range b.subs {
+		delete(b.subs, ch)
+		close(sub.ch)
+	}
+}
+
+// getStats returns a snapshot of the delivery counters
+func (b *flowEventBroker) getStats() FlowEventStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.Subscribers = len(b.subs)
+	return stats
+}
+
+// Subscribe returns a channel receiving the flow events that match filter.
+// Events are read by MonitorFlowEvents; a subscriber that falls more than
+// flowSubscriberBuffer events behind loses the excess (see
+// Statistics.FlowEvents). The channel is closed by Unsubscribe or when the
+// data plane shuts down.
+func (dp *DataPlane) Subscribe(filter FlowEventFilter) <-chan FlowEvent {
+	return dp.events.subscribe(filter, flowSubscriberBuffer)
+}
+
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes it
+func (dp *DataPlane) Unsubscribe(ch <-chan FlowEvent) {
+	dp.events.unsubscribe(ch)
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeFlowEvent builds a raw ring buffer record as the eBPF programs emit it
+func encodeFlowEvent(t *testing.T, rec *flowEventRecord) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, rec))
+	return buf.Bytes()
+}
+
+func TestDecodeFlowEvent(t *testing.T) {
+	bootTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rec := flowEventRecord{
+		Key: bpfFlowKey{
+			SrcIp:     ipToKeyAddr(t, "10.0.0.1"),
+			DstIp:     ipToKeyAddr(t, "2001:db8::2"),
+			SrcPort:   ntohs(40000),
+			DstPort:   ntohs(443),
+			Protocol:  protoTCP,
+			Direction: uint8(DirectionEgress),
+		},
+		Timestamp: uint64(90 * time.Second),
+		Packets:   12,
+		Bytes:     3400,
+		Action:    1,
+		EventType: uint8(FlowEventClose),
+		Flags:     flowEventFlagSimulated,
+	}
+
+	ev, err := decodeFlowEvent(encodeFlowEvent(t, &rec), bootTime)
+	require.NoError(t, err)
+
+	assert.Equal(t, bootTime.Add(90*time.Second), ev.Timestamp)
+	assert.Equal(t, FlowEventClose, ev.Type)
+	assert.Equal(t, "10.0.0.1", ev.SrcIP.String())
+	assert.Equal(t, "2001:db8::2", ev.DstIP.String())
+	assert.Equal(t, uint16(40000), ev.SrcPort)
+	assert.Equal(t, uint16(443), ev.DstPort)
+	assert.Equal(t, uint8(protoTCP), ev.Protocol)
+	assert.Equal(t, DirectionEgress, ev.Direction)
+	assert.Equal(t, uint8(1), ev.Action)
+	assert.Equal(t, uint64(12), ev.Packets)
+	assert.Equal(t, uint64(3400), ev.Bytes)
+	assert.True(t, ev.Simulated)
+}
+
+func TestDecodeFlowEvent_Short(t *testing.T) {
+	_, err := decodeFlowEvent(make([]byte, flowEventSize-1), time.Now())
+	assert.Error(t, err)
+}
+
+func TestFlowEventFilter(t *testing.T) {
+	ev := FlowEvent{Type: FlowEventNew, Protocol: protoUDP, Action: 1}
+
+	tests := []struct {
+		name   string
+		filter FlowEventFilter
+		want   bool
+	}{
+		{"empty", FlowEventFilter{}, true},
+		{"type match", FlowEventFilter{Types: []FlowEventType{FlowEventClose, FlowEventNew}}, true},
+		{"type mismatch", FlowEventFilter{Types: []FlowEventType{FlowEventClose}}, false},
+		{"action match", FlowEventFilter{Actions: []uint8{1}}, true},
+		{"action mismatch", FlowEventFilter{Actions: []uint8{0}}, false},
+		{"protocol match", FlowEventFilter{Protocol: protoUDP}, true},
+		{"protocol mismatch", FlowEventFilter{Protocol: protoTCP}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(&ev))
+		})
+	}
+}
+
+func TestFlowEventBroker_FanOut(t *testing.T) {
+	b := newFlowEventBroker()
+	all := b.subscribe(FlowEventFilter{}, 4)
+	closes := b.subscribe(FlowEventFilter{Types: []FlowEventType{FlowEventClose}}, 4)
+
+	b.publish(FlowEvent{Type: FlowEventNew})
+	b.publish(FlowEvent{Type: FlowEventClose})
+
+	assert.Len(t, all, 2)
+	require.Len(t, closes, 1)
+	assert.Equal(t, FlowEventClose, (<-closes).Type)
+
+	stats := b.getStats()
+	assert.Equal(t, uint64(2), stats.Received)
+	assert.Equal(t, uint64(3), stats.Delivered)
+	assert.Zero(t, stats.Dropped)
+	assert.Equal(t, 2, stats.Subscribers)
+}
+
+func TestFlowEventBroker_Backpressure(t *testing.T) {
+	b := newFlowEventBroker()
+	slow := b.subscribe(FlowEventFilter{}, 2)
+
+	for i := 0; i < 5; i++ {
+		b.publish(FlowEvent{Packets: uint64(i)})
+	}
+
+	// The oldest events are kept, the overflow is dropped and counted
+	assert.Equal(t, uint64(0), (<-slow).Packets)
+	assert.Equal(t, uint64(1), (<-slow).Packets)
+
+	stats := b.getStats()
+	assert.Equal(t, uint64(5), stats.Received)
+	assert.Equal(t, uint64(2), stats.Delivered)
+	assert.Equal(t, uint64(3), stats.Dropped)
+}
+
+func TestFlowEventBroker_Unsubscribe(t *testing.T) {
+	b := newFlowEventBroker()
+	ch := b.subscribe(FlowEventFilter{}, 1)
+
+	b.unsubscribe(ch)
+	_, ok := <-ch
+	assert.False(t, ok, "channel is closed")
+
+	// Unknown and repeated unsubscribes are ignored
+	b.unsubscribe(ch)
+	b.publish(FlowEvent{})
+	assert.Zero(t, b.getStats().Delivered)
+}
+
+func TestFlowEventBroker_Close(t *testing.T) {
+	b := newFlowEventBroker()
+	ch := b.subscribe(FlowEventFilter{}, 1)
+
+	b.close()
+	_, ok := <-ch
+	assert.False(t, ok, "channel is closed on shutdown")
+
+	late := b.subscribe(FlowEventFilter{}, 1)
+	_, ok = <-late
+	assert.False(t, ok, "subscribing after shutdown returns a closed channel")
+	assert.Zero(t, b.getStats().Subscribers)
+}
+
+// ipToKeyAddr converts an address to the 128-bit map layout
+func ipToKeyAddr(t *testing.T, s string) [4]uint32 {
+	t.Helper()
+	ip := net.ParseIP(s)
+	require.NotNil(t, ip)
+
+	var addr [4]uint32
+	ip16 := ip.To16()
+	for i := range addr {
+		addr[i] = binary.LittleEndian.Uint32(ip16[i*4:])
+	}
+	return addr
+}
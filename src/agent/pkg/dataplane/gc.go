@@ -0,0 +1,266 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// IP protocol numbers used to pick a session timeout
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+// SessionGCStats reports the activity of the session sweeper
+type SessionGCStats struct {
+	Sweeps            uint64
+	ExpiredSessions   uint64 // Total sessions removed for being idle
+	LastSweepExpired  uint64
+	LastSweepDuration time.Duration
+	LastSweepAt       time.Time
+}
+
+// sessionGC periodically removes idle entries from the session map.
+// The LRU map only evicts under memory pressure, so without it idle
+// UDP/ICMP pseudo-sessions would keep their cached decision forever.
+// Each sweep also recounts the active sessions, in total and per source,
+// which the eBPF programs only decrement for sessions they close
+// themselves.
+type sessionGC struct {
+	sessions *ebpf.Map
+	sources  *ebpf.Map // source_sessions_map
+	config   *ebpf.Map // config_map, for the source prefixes
+	statsMap *ebpf.Map // stats_map, for the active sessions counter
+	cfg      SessionGCConfig
+
+	mu    sync.Mutex
+	stats SessionGCStats
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newSessionGC creates a sweeper for the given session, source count,
+// config and stats maps
+func newSessionGC(sessions, sources, config, stats *ebpf.Map, cfg SessionGCConfig) *sessionGC {
+	return &sessionGC{
+		sessions: sessions,
+		sources:  sources,
+		config:   config,
+		statsMap: stats,
+		cfg:      cfg.withDefaults(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start runs sweeps every cfg.Interval until close is called
+func (g *sessionGC) start() {
+	log.Infof("Session GC started (interval=%s, tcp=%s/%s, udp=%s, icmp=%s)",
+		g.cfg.Interval, g.cfg.TCPEstablishedTimeout, g.cfg.TCPTransitoryTimeout,
+		g.cfg.UDPTimeout, g.cfg.ICMPTimeout)
+
+	go func() {
+		defer close(g.done)
+
+		ticker := time.NewTicker(g.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-ticker.C:
+				if _, err := g.sweep(); err != nil {
+					log.Warnf("Session GC sweep failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// close stops the sweeper and waits for a running sweep to finish
+func (g *sessionGC) close() {
+	close(g.stop)
+	<-g.done
+}
+
+// sweep removes all sessions idle for longer than their timeout and
+// returns how many were removed
+func (g *sessionGC) sweep() (int, error) {
+	started := time.Now()
+
+	now, err := monotonicNow()
+	if err != nil {
+		return 0, err
+	}
+
+	var gcfg bpfGlobalConfig
+	if err := g.config.Lookup(globalConfigKey, &gcfg); err != nil {
+		return 0, fmt.Errorf("reading config map: %w", err)
+	}
+
+	var (
+		key     bpfFlowKey
+		value   bpfSessionValue
+		expired []bpfFlowKey
+		active  uint64
+		sources = make(map[bpfSourceKey]uint64)
+	)
+
+	// Collect first, delete afterwards: deleting while iterating a hash
+	// map can restart the iteration
+	iter := g.sessions.Iterate()
+	for iter.Next(&key, &value) {
+		if sessionExpired(&key, &value, now, &g.cfg) {
+			expired = append(expired, key)
+		}
+		sources[sourceKey(key.SrcIp, gcfg.SourcePrefixV4, gcfg.SourcePrefixV6)]++
+		active++
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("iterating session map: %w", err)
+	}
+
+	removed := 0
+	for i := range expired {
+		// The session may have seen traffic since it was collected
+		if err := g.sessions.Lookup(&expired[i], &value); err != nil {
+			continue
+		}
+		if !sessionExpired(&expired[i], &value, now, &g.cfg) {
+			continue
+		}
+
+		if err := g.sessions.Delete(&expired[i]); err != nil {
+			if !errors.Is(err, ebpf.ErrKeyNotExist) {
+				log.Debugf("Failed to delete expired session: %v", err)
+			}
+			continue
+		}
+		sources[sourceKey(expired[i].SrcIp, gcfg.SourcePrefixV4, gcfg.SourcePrefixV6)]--
+		active--
+		removed++
+	}
+
+	if err := g.writeSourceCounts(sources); err != nil {
+		log.Warnf("Session GC: updating source session counts: %v", err)
+	}
+	if err := g.writeActiveSessions(active); err != nil {
+		log.Warnf("Session GC: updating active sessions: %v", err)
+	}
+
+	duration := time.Since(started)
+
+	g.mu.Lock()
+	g.stats.Sweeps++
+	g.stats.ExpiredSessions += uint64(removed)
+	g.stats.LastSweepExpired = uint64(removed)
+	g.stats.LastSweepDuration = duration
+	g.stats.LastSweepAt = started
+	g.mu.Unlock()
+
+	log.Debugf("Session GC sweep: expired=%d duration=%s", removed, duration)
+	return removed, nil
+}
+
+// writeSourceCounts replaces the per-source session counts with a recount.
+// Sessions opened or closed while the sweep ran may be off by a few until
+// the next sweep.
+func (g *sessionGC) writeSourceCounts(counts map[bpfSourceKey]uint64) error {
+	var (
+		key   bpfSourceKey
+		count uint64
+		stale []bpfSourceKey
+	)
+
+	iter := g.sources.Iterate()
+	for iter.Next(&key, &count) {
+		if counts[key] == 0 {
+			stale = append(stale, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("iterating source sessions: %w", err)
+	}
+
+	for i := range stale {
+		if err := g.sources.Delete(&stale[i]); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return err
+		}
+	}
+	for key, count := range counts {
+		if count == 0 {
+			continue
+		}
+		if err := g.sources.Put(&key, &count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeActiveSessions replaces the per-CPU active sessions counter with a
+// recount, stored on the first CPU. Like the source counts it may be off
+// by the sessions opened or closed during the sweep until the next one.
+func (g *sessionGC) writeActiveSessions(active uint64) error {
+	cpus, err := ebpf.PossibleCPU()
+	if err != nil {
+		return fmt.Errorf("counting CPUs: %w", err)
+	}
+
+	values := make([]uint64, cpus)
+	values[0] = active
+	return g.statsMap.Put(statsActiveSessions, values)
+}
+
+// getStats returns a snapshot of the sweeper statistics
+func (g *sessionGC) getStats() SessionGCStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
+
+// sessionTimeout returns the idle timeout for a session
+func sessionTimeout(protocol uint8, tcpState TCPState, cfg *SessionGCConfig) time.Duration {
+	switch protocol {
+	case protoTCP:
+		if tcpState == TCPStateEstablished {
+			return cfg.TCPEstablishedTimeout
+		}
+		return cfg.TCPTransitoryTimeout
+	case protoICMP, protoICMPv6:
+		return cfg.ICMPTimeout
+	default:
+		return cfg.UDPTimeout
+	}
+}
+
+// sessionExpired reports whether a session has been idle for longer than
+// its timeout. now is a CLOCK_MONOTONIC timestamp in nanoseconds.
+func sessionExpired(key *bpfFlowKey, value *bpfSessionValue, now uint64, cfg *SessionGCConfig) bool {
+	if value.LastSeenTs >= now {
+		return false
+	}
+	idle := time.Duration(now - value.LastSeenTs)
+	return idle > sessionTimeout(key.Protocol, TCPState(value.TcpState), cfg)
+}
+
+// monotonicNow returns the current CLOCK_MONOTONIC time in nanoseconds,
+// the clock used by bpf_ktime_get_ns()
+func monotonicNow() (uint64, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, fmt.Errorf("reading monotonic clock: %w", err)
+	}
+	return uint64(ts.Nano()), nil
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionTimeout(t *testing.T) {
+	cfg := DefaultSessionGCConfig()
+
+	tests := []struct {
+		name     string
+		protocol uint8
+		tcpState TCPState
+		want     time.Duration
+	}{
+		{"tcp established", protoTCP, TCPStateEstablished, cfg.TCPEstablishedTimeout},
+		{"tcp syn sent", protoTCP, TCPStateSynSent, cfg.TCPTransitoryTimeout},
+		{"tcp fin wait", protoTCP, TCPStateFinWait1, cfg.TCPTransitoryTimeout},
+		{"udp", protoUDP, TCPStateClosed, cfg.UDPTimeout},
+		{"icmp", protoICMP, TCPStateClosed, cfg.ICMPTimeout},
+		{"icmpv6", protoICMPv6, TCPStateClosed, cfg.ICMPTimeout},
+		{"other protocol", 47, TCPStateClosed, cfg.UDPTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sessionTimeout(tt.protocol, tt.tcpState, &cfg))
+		})
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	cfg := DefaultSessionGCConfig()
+	now := uint64(time.Hour)
+
+	tests := []struct {
+		name     string
+		protocol uint8
+		tcpState TCPState
+		idle     time.Duration
+		want     bool
+	}{
+		{"udp within timeout", protoUDP, TCPStateClosed, cfg.UDPTimeout - time.Second, false},
+		{"udp past timeout", protoUDP, TCPStateClosed, cfg.UDPTimeout + time.Second, true},
+		{"icmp past timeout", protoICMP, TCPStateClosed, cfg.ICMPTimeout + time.Second, true},
+		{"tcp established idle", protoTCP, TCPStateEstablished, 30 * time.Minute, false},
+		{"tcp half open idle", protoTCP, TCPStateSynSent, 30 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := bpfFlowKey{Protocol: tt.protocol}
+			value := bpfSessionValue{
+				TcpState:   uint8(tt.tcpState),
+				LastSeenTs: now - uint64(tt.idle),
+			}
+			assert.Equal(t, tt.want, sessionExpired(&key, &value, now, &cfg))
+		})
+	}
+
+	// Packets seen after the sweep started never expire
+	key := bpfFlowKey{Protocol: protoUDP}
+	value := bpfSessionValue{LastSeenTs: now + 1}
+	assert.False(t, sessionExpired(&key, &value, now, &cfg))
+}
+
+func TestSessionGCConfigWithDefaults(t *testing.T) {
+	def := DefaultSessionGCConfig()
+
+	cfg := SessionGCConfig{Interval: time.Second, UDPTimeout: 5 * time.Second}.withDefaults()
+
+	assert.Equal(t, time.Second, cfg.Interval)
+	assert.Equal(t, 5*time.Second, cfg.UDPTimeout)
+	assert.Equal(t, def.TCPEstablishedTimeout, cfg.TCPEstablishedTimeout)
+	assert.Equal(t, def.TCPTransitoryTimeout, cfg.TCPTransitoryTimeout)
+	assert.Equal(t, def.ICMPTimeout, cfg.ICMPTimeout)
+}
@@ -0,0 +1,249 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// globalConfigKey is the only index of config_map
+const globalConfigKey uint32 = 0
+
+// TUNNEL_DECAP_* flags in common_types.h
+const (
+	tunnelDecapVXLAN  = 1 << 0
+	tunnelDecapGeneve = 1 << 1
+)
+
+// DefaultAction is the verdict for traffic no policy matches.
+// Values match enum policy_action in common_types.h.
+type DefaultAction uint8
+
+const (
+	DefaultActionAllow DefaultAction = 0
+	DefaultActionDeny  DefaultAction = 1
+)
+
+// String returns the lowercase name of the action
+func (a DefaultAction) String() string {
+	switch a {
+	case DefaultActionAllow:
+		return "allow"
+	case DefaultActionDeny:
+		return "deny"
+	default:
+		return fmt.Sprintf("action(%d)", uint8(a))
+	}
+}
+
+// ParseDefaultAction parses "allow" or "deny"
+func ParseDefaultAction(s string) (DefaultAction, error) {
+	switch strings.ToLower(s) {
+	case "allow", "":
+		return DefaultActionAllow, nil
+	case "deny":
+		return DefaultActionDeny, nil
+	default:
+		return 0, fmt.Errorf("invalid default action %q (expected allow or deny)", s)
+	}
+}
+
+// RuntimeConfig holds the settings the eBPF programs read on every lookup
+type RuntimeConfig struct {
+	// DefaultAction applies when no policy matches
+	DefaultAction DefaultAction
+
+	// SafetyExemptions lets loopback traffic and the API port bypass policy
+	SafetyExemptions bool
+
+	// APIPort is the agent API port covered by the exemptions (0 = none)
+	APIPort uint16
+
+	// MonitorMode reports denied packets instead of dropping them
+	MonitorMode bool
+
+	// DropInvalidTCP drops TCP packets with invalid flag combinations
+	// (NULL, XMAS, SYN+FIN, ...) before policy lookup
+	DropInvalidTCP bool
+
+	// DecapVXLAN and DecapGeneve also evaluate policy on the inner flow of
+	// tunnel packets sent to the standard UDP ports (4789 and 6081) once
+	// their outer flow is allowed
+	DecapVXLAN  bool
+	DecapGeneve bool
+
+	// FragmentAction applies to non-first fragments whose first fragment
+	// was not seen, MalformedAction to packets with malformed IP headers
+	FragmentAction  DefaultAction
+	MalformedAction DefaultAction
+
+	// SourceSessionLimit caps the active sessions a source may open (0 =
+	// unlimited); rules can set their own limit. Sources are client
+	// addresses masked to SourcePrefixV4/SourcePrefixV6 (0 = full address).
+	SourceSessionLimit uint32
+	SourcePrefixV4     uint8
+	SourcePrefixV6     uint8
+}
+
+// readGlobalConfig returns the runtime configuration shared with the eBPF programs
+func (dp *DataPlane) readGlobalConfig() (bpfGlobalConfig, error) {
+	var cfg bpfGlobalConfig
+	key := globalConfigKey
+	if err := dp.objs.ConfigMap.Lookup(&key, &cfg); err != nil {
+		return cfg, fmt.Errorf("reading config map: %w", err)
+	}
+	return cfg, nil
+}
+
+// updateGlobalConfig applies fn to the runtime configuration and writes it back,
+// unless fn fails. Updates are serialized so concurrent writers don't lose each
+// other's changes.
+func (dp *DataPlane) updateGlobalConfig(fn func(cfg *bpfGlobalConfig) error) error {
+	dp.configMu.Lock()
+	defer dp.configMu.Unlock()
+
+	cfg, err := dp.readGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&cfg); err != nil {
+		return err
+	}
+
+	key := globalConfigKey
+	if err := dp.objs.ConfigMap.Put(&key, &cfg); err != nil {
+		return fmt.Errorf("writing config map: %w", err)
+	}
+	return nil
+}
+
+// BumpPolicyGeneration invalidates every cached session decision.
+// Sessions recompute their action from the current policies on their next
+// packet, so policy changes apply to established flows immediately.
+func (dp *DataPlane) BumpPolicyGeneration() error {
+	var generation uint32
+	err := dp.updateGlobalConfig(func(cfg *bpfGlobalConfig) error {
+		cfg.PolicyGeneration++
+		generation = cfg.PolicyGeneration
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("bumping policy generation: %w", err)
+	}
+
+	log.Debugf("Policy generation is now %d", generation)
+	return nil
+}
+
+// RuntimeConfig returns the current runtime settings
+func (dp *DataPlane) RuntimeConfig() (RuntimeConfig, error) {
+	cfg, err := dp.readGlobalConfig()
+	if err != nil {
+		return RuntimeConfig{}, err
+	}
+	return runtimeConfigFrom(&cfg), nil
+}
+
+// SetRuntimeConfig applies new runtime settings. The policy generation is
+// bumped as well so existing sessions pick up a changed default action.
+func (dp *DataPlane) SetRuntimeConfig(rc RuntimeConfig) error {
+	_, err := dp.UpdateRuntimeConfig(func(cur *RuntimeConfig) {
+		*cur = rc
+	})
+	return err
+}
+
+// UpdateRuntimeConfig applies fn to the current runtime settings and writes
+// them back like SetRuntimeConfig. Reading, fn and writing happen under the
+// config lock, so concurrent updates of different settings don't undo each
+// other. It returns the settings written.
+func (dp *DataPlane) UpdateRuntimeConfig(fn func(rc *RuntimeConfig)) (RuntimeConfig, error) {
+	var rc RuntimeConfig
+	err := dp.updateGlobalConfig(func(cfg *bpfGlobalConfig) error {
+		rc = runtimeConfigFrom(cfg)
+		fn(&rc)
+		if err := rc.validate(); err != nil {
+			return err
+		}
+		rc.applyTo(cfg)
+		cfg.PolicyGeneration++
+		return nil
+	})
+	if err != nil {
+		return RuntimeConfig{}, fmt.Errorf("updating runtime config: %w", err)
+	}
+
+	log.Infof("Runtime config: default action %s, safety exemptions %t (API port %d), monitor mode %t, drop invalid TCP %t, decap VXLAN %t, decap Geneve %t, fragment action %s, malformed action %s, source session limit %d (/%d, /%d)",
+		rc.DefaultAction, rc.SafetyExemptions, rc.APIPort, rc.MonitorMode, rc.DropInvalidTCP,
+		rc.DecapVXLAN, rc.DecapGeneve, rc.FragmentAction, rc.MalformedAction,
+		rc.SourceSessionLimit, rc.SourcePrefixV4, rc.SourcePrefixV6)
+	return rc, nil
+}
+
+// runtimeConfigFrom extracts the runtime settings of the shared configuration
+func runtimeConfigFrom(cfg *bpfGlobalConfig) RuntimeConfig {
+	return RuntimeConfig{
+		DefaultAction:    DefaultAction(cfg.DefaultAction),
+		SafetyExemptions: cfg.SafetyExemptions != 0,
+		APIPort:          cfg.ApiPort,
+		MonitorMode:      cfg.MonitorMode != 0,
+		DropInvalidTCP:   cfg.DropInvalidTcp != 0,
+		DecapVXLAN:       cfg.DecapTunnels&tunnelDecapVXLAN != 0,
+		DecapGeneve:      cfg.DecapTunnels&tunnelDecapGeneve != 0,
+		FragmentAction:   DefaultAction(cfg.FragmentAction),
+		MalformedAction:  DefaultAction(cfg.MalformedAction),
+
+		SourceSessionLimit: cfg.SourceSessionLimit,
+		SourcePrefixV4:     cfg.SourcePrefixV4,
+		SourcePrefixV6:     cfg.SourcePrefixV6,
+	}
+}
+
+// validate checks the settings against the values the eBPF programs accept
+func (rc *RuntimeConfig) validate() error {
+	if rc.DefaultAction != DefaultActionAllow && rc.DefaultAction != DefaultActionDeny {
+		return fmt.Errorf("invalid default action %d", rc.DefaultAction)
+	}
+	if rc.FragmentAction != DefaultActionAllow && rc.FragmentAction != DefaultActionDeny {
+		return fmt.Errorf("invalid fragment action %d", rc.FragmentAction)
+	}
+	if rc.MalformedAction != DefaultActionAllow && rc.MalformedAction != DefaultActionDeny {
+		return fmt.Errorf("invalid malformed packet action %d", rc.MalformedAction)
+	}
+	if rc.SourcePrefixV4 > 32 || rc.SourcePrefixV6 > 128 {
+		return fmt.Errorf("invalid source prefix /%d or /%d", rc.SourcePrefixV4, rc.SourcePrefixV6)
+	}
+	return nil
+}
+
+// applyTo writes the settings to the shared configuration
+func (rc *RuntimeConfig) applyTo(cfg *bpfGlobalConfig) {
+	cfg.DefaultAction = uint8(rc.DefaultAction)
+	cfg.SafetyExemptions = boolToUint8(rc.SafetyExemptions)
+	cfg.ApiPort = rc.APIPort
+	cfg.MonitorMode = boolToUint8(rc.MonitorMode)
+	cfg.DropInvalidTcp = boolToUint8(rc.DropInvalidTCP)
+	cfg.DecapTunnels = 0
+	if rc.DecapVXLAN {
+		cfg.DecapTunnels |= tunnelDecapVXLAN
+	}
+	if rc.DecapGeneve {
+		cfg.DecapTunnels |= tunnelDecapGeneve
+	}
+	cfg.FragmentAction = uint8(rc.FragmentAction)
+	cfg.MalformedAction = uint8(rc.MalformedAction)
+	cfg.SourceSessionLimit = rc.SourceSessionLimit
+	cfg.SourcePrefixV4 = rc.SourcePrefixV4
+	cfg.SourcePrefixV6 = rc.SourcePrefixV6
+}
+
+// boolToUint8 converts a flag for the eBPF config
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -7,5 +7,49 @@ type DataPlaneInterface interface {
 	GetStatistics() Statistics
 }
 
-// Ensure DataPlane implements DataPlaneInterface
-var _ DataPlaneInterface = (*DataPlane)(nil)
+// SessionLister exposes the live session table.
+type SessionLister interface {
+	ListSessions(limit int) ([]Session, error)
+	TopSources(n int) ([]SourceSessions, error)
+}
+
+// InterfaceManager attaches and detaches interfaces at runtime.
+type InterfaceManager interface {
+	AttachInterface(name string) error
+	DetachInterface(name string) error
+	ListInterfaces() []InterfaceStatus
+	SetInterfaceMonitor(name string, enabled bool) error
+}
+
+// RuntimeConfigurer reads and updates the runtime settings.
+type RuntimeConfigurer interface {
+	RuntimeConfig() (RuntimeConfig, error)
+	SetRuntimeConfig(rc RuntimeConfig) error
+	UpdateRuntimeConfig(fn func(rc *RuntimeConfig)) (RuntimeConfig, error)
+}
+
+// FlowEventSource delivers decoded flow events to subscribers.
+type FlowEventSource interface {
+	Subscribe(filter FlowEventFilter) <-chan FlowEvent
+	Unsubscribe(ch <-chan FlowEvent)
+}
+
+// MetricsSource exposes the raw counters exported as metrics.
+type MetricsSource interface {
+	DataPlaneInterface
+	PerCPUStats() ([][]uint64, error)
+	RuleHits() (map[uint32]uint64, error)
+	RateLimitedPackets() (map[uint32]uint64, error)
+	MirrorStats() ([]MirrorStats, error)
+	MapUsage() ([]MapUsage, error)
+}
+
+// Ensure DataPlane implements the interfaces above
+var (
+	_ DataPlaneInterface = (*DataPlane)(nil)
+	_ SessionLister      = (*DataPlane)(nil)
+	_ InterfaceManager   = (*DataPlane)(nil)
+	_ RuntimeConfigurer  = (*DataPlane)(nil)
+	_ FlowEventSource    = (*DataPlane)(nil)
+	_ MetricsSource      = (*DataPlane)(nil)
+)
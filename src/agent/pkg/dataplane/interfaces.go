@@ -0,0 +1,493 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInterfaceNotFound is returned when the named interface does not exist
+	ErrInterfaceNotFound = errors.New("interface not found")
+
+	// ErrInterfaceAttached is returned when attaching an already attached interface
+	ErrInterfaceAttached = errors.New("interface already attached")
+
+	// ErrInterfaceNotAttached is returned when detaching an interface that is not attached
+	ErrInterfaceNotAttached = errors.New("interface not attached")
+)
+
+// AttachMode describes how a program is hooked into an interface
+type AttachMode string
+
+const (
+	AttachModeTCX        AttachMode = "tcx"         // TCX link (kernel >= 6.6)
+	AttachModeLegacy     AttachMode = "legacy"      // clsact qdisc + BPF filter
+	AttachModeXDPNative  AttachMode = "xdp-native"  // XDP in the driver
+	AttachModeXDPGeneric AttachMode = "xdp-generic" // XDP emulated by the stack
+)
+
+// HookStatus describes one attached hook of an interface
+type HookStatus struct {
+	Direction Direction
+	Mode      AttachMode
+}
+
+// InterfaceStatus describes an interface the data plane enforces on
+type InterfaceStatus struct {
+	Name       string
+	Index      int
+	Hooks      []HookStatus
+	AttachedAt time.Time
+	Monitor    bool // Denies are reported but not enforced on this interface
+}
+
+// ifaceAttachment holds every hook attached to one interface
+type ifaceAttachment struct {
+	name       string
+	index      int
+	hooks      []*hookAttachment
+	attachedAt time.Time
+	monitor    bool
+}
+
+// close detaches all hooks of the interface
+func (a *ifaceAttachment) close() error {
+	var errs []error
+	for _, h := range a.hooks {
+		if err := h.close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.name, err))
+		} else {
+			log.Debugf("%s %s program detached from %s", h.mode, h.direction, a.name)
+		}
+	}
+	a.hooks = nil
+	return errors.Join(errs...)
+}
+
+// release gives up all hooks of the interface, leaving the programs
+// attached for the next agent
+func (a *ifaceAttachment) release() error {
+	var errs []error
+	for _, h := range a.hooks {
+		if err := h.release(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.name, err))
+		}
+	}
+	a.hooks = nil
+	return errors.Join(errs...)
+}
+
+// status returns the public view of the attachment
+func (a *ifaceAttachment) status() InterfaceStatus {
+	st := InterfaceStatus{
+		Name:       a.name,
+		Index:      a.index,
+		AttachedAt: a.attachedAt,
+		Monitor:    a.monitor,
+	}
+	for _, h := range a.hooks {
+		st.Hooks = append(st.Hooks, HookStatus{Direction: h.direction, Mode: h.mode})
+	}
+	return st
+}
+
+// AttachInterface attaches the filter programs to the named interface.
+// All interfaces share the same maps, so policies and sessions apply to
+// every attached interface.
+func (dp *DataPlane) AttachInterface(name string) error {
+	dp.ifacesMu.Lock()
+	defer dp.ifacesMu.Unlock()
+
+	if _, ok := dp.ifaces[name]; ok {
+		return fmt.Errorf("%s: %w", name, ErrInterfaceAttached)
+	}
+	delete(dp.detached, name)
+	return dp.attachInterface(name)
+}
+
+// attachDiscovered attaches an interface the watcher found, unless it was
+// detached through DetachInterface since the watcher looked
+func (dp *DataPlane) attachDiscovered(name string) error {
+	dp.ifacesMu.Lock()
+	defer dp.ifacesMu.Unlock()
+
+	if _, ok := dp.ifaces[name]; ok {
+		return fmt.Errorf("%s: %w", name, ErrInterfaceAttached)
+	}
+	if dp.detached[name] {
+		return nil
+	}
+	return dp.attachInterface(name)
+}
+
+// attachInterface attaches the filter programs to an interface that is not
+// attached. The caller holds ifacesMu.
+func (dp *DataPlane) attachInterface(name string) error {
+	ifaceObj, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w: %v", name, ErrInterfaceNotFound, err)
+	}
+
+	att := &ifaceAttachment{
+		name:       name,
+		index:      ifaceObj.Index,
+		attachedAt: time.Now(),
+	}
+
+	// XDP enforces ingress before skb allocation
+	if dp.hook.usesXDP() {
+		prog := dp.objs.XdpMicrosegmentFilter
+		err := dp.attachHook(att, hookXDP, prog, DirectionIngress, func(pin string) (*hookAttachment, error) {
+			return attachXDP(name, ifaceObj.Index, prog, dp.xdpMode, pin)
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		dp.removeStaleHook(name, hookXDP)
+	}
+
+	// Try TCX first (kernel >= 6.6), fallback to legacy TC hook if not supported.
+	// Behind XDP, the TC ingress program only sees packets XDP left to it.
+	if dp.hook.usesTC() {
+		prog := dp.objs.TcMicrosegmentFilter
+		err := dp.attachHook(att, hookTCIngress, prog, DirectionIngress, func(pin string) (*hookAttachment, error) {
+			return attachTC(name, ifaceObj.Index, prog, "tc_microsegment_filter", DirectionIngress, pin)
+		})
+		if err != nil {
+			att.close()
+			return err
+		}
+	} else {
+		dp.removeStaleHook(name, hookTCIngress)
+	}
+
+	if dp.enableEgress {
+		prog := dp.objs.TcMicrosegmentEgress
+		err := dp.attachHook(att, hookTCEgress, prog, DirectionEgress, func(pin string) (*hookAttachment, error) {
+			return attachTC(name, ifaceObj.Index, prog, "tc_microsegment_egress", DirectionEgress, pin)
+		})
+		if err != nil {
+			att.close()
+			return err
+		}
+	} else {
+		dp.removeStaleHook(name, hookTCEgress)
+	}
+
+	dp.ifaces[name] = att
+	log.Infof("Interface %s attached (ifindex %d)", name, ifaceObj.Index)
+	return nil
+}
+
+// attachHook adds a hook to the interface, taking over the program a
+// previous agent left attached if possible and calling attach otherwise
+func (dp *DataPlane) attachHook(att *ifaceAttachment, hook string, prog *ebpf.Program, dir Direction,
+	attach func(pin string) (*hookAttachment, error)) error {
+	h := dp.adoptHook(att.name, att.index, hook, prog, dir)
+	if h == nil {
+		var err error
+		if h, err = attach(dp.linkPin(att.name, hook)); err != nil {
+			return err
+		}
+	}
+	att.hooks = append(att.hooks, h)
+	return nil
+}
+
+// DetachInterface removes the filter programs from the named interface.
+// Sessions created through the interface stay in the shared session table
+// until they close or expire. The interface is not attached again when it
+// matches a configured pattern, until AttachInterface is called for it.
+func (dp *DataPlane) DetachInterface(name string) error {
+	dp.ifacesMu.Lock()
+	defer dp.ifacesMu.Unlock()
+
+	att, ok := dp.ifaces[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, ErrInterfaceNotAttached)
+	}
+
+	delete(dp.ifaces, name)
+	dp.detached[name] = true
+	if att.monitor {
+		dp.clearInterfaceMonitor(att)
+	}
+	if err := att.close(); err != nil {
+		return err
+	}
+
+	log.Infof("Interface %s detached", name)
+	return nil
+}
+
+// SetInterfaceMonitor switches monitor mode for one attached interface.
+// In monitor mode denied packets arriving on or leaving through the
+// interface are counted as would-deny and let through.
+func (dp *DataPlane) SetInterfaceMonitor(name string, enabled bool) error {
+	dp.ifacesMu.Lock()
+	defer dp.ifacesMu.Unlock()
+
+	att, ok := dp.ifaces[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, ErrInterfaceNotAttached)
+	}
+
+	ifindex := uint32(att.index)
+	if enabled {
+		value := uint8(1)
+		if err := dp.objs.MonitorIfaceMap.Put(&ifindex, &value); err != nil {
+			return fmt.Errorf("enabling monitor mode on %s: %w", name, err)
+		}
+	} else if err := dp.objs.MonitorIfaceMap.Delete(&ifindex); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("disabling monitor mode on %s: %w", name, err)
+	}
+
+	att.monitor = enabled
+	log.Infof("Monitor mode %s on interface %s", enabledString(enabled), name)
+	return nil
+}
+
+// clearInterfaceMonitor drops the monitor entry of a detached interface so
+// a new interface reusing the index is enforced
+func (dp *DataPlane) clearInterfaceMonitor(att *ifaceAttachment) {
+	ifindex := uint32(att.index)
+	if err := dp.objs.MonitorIfaceMap.Delete(&ifindex); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		log.Warnf("Failed to clear monitor mode of %s: %v", att.name, err)
+	}
+}
+
+// enabledString renders a flag for log messages
+func enabledString(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// ListInterfaces returns the attached interfaces sorted by name
+func (dp *DataPlane) ListInterfaces() []InterfaceStatus {
+	dp.ifacesMu.Lock()
+	defer dp.ifacesMu.Unlock()
+
+	result := make([]InterfaceStatus, 0, len(dp.ifaces))
+	for _, att := range dp.ifaces {
+		result = append(result, att.status())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// detachAll removes the programs from every attached interface
+func (dp *DataPlane) detachAll() error {
+	dp.ifacesMu.Lock()
+	defer dp.ifacesMu.Unlock()
+
+	var errs []error
+	for name, att := range dp.ifaces {
+		if att.monitor {
+			dp.clearInterfaceMonitor(att)
+		}
+		if err := att.close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(dp.ifaces, name)
+	}
+	return errors.Join(errs...)
+}
+
+// releaseAll gives up every attachment without detaching the programs, so
+// enforcement continues on the pinned maps until the next agent takes over
+func (dp *DataPlane) releaseAll() error {
+	dp.ifacesMu.Lock()
+	defer dp.ifacesMu.Unlock()
+
+	var errs []error
+	for name, att := range dp.ifaces {
+		if err := att.release(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(dp.ifaces, name)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	log.Info("Programs left attached for the next agent to take over")
+	return nil
+}
+
+// syncInterfaces attaches the interfaces that appeared under the
+// configured names and patterns and drops the attachments of interfaces
+// that are gone or were recreated with a new index. Interfaces detached
+// through DetachInterface are left alone.
+func (dp *DataPlane) syncInterfaces(patterns []string) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		log.Warnf("Interface sync failed: listing interfaces: %v", err)
+		return
+	}
+	available := make(map[string]int, len(ifaces))
+	names := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		available[iface.Name] = iface.Index
+		names = append(names, iface.Name)
+	}
+
+	wanted, _, err := expandInterfaces(patterns, names)
+	if err != nil {
+		log.Warnf("Interface sync failed: %v", err)
+		return
+	}
+
+	dp.ifacesMu.Lock()
+	attached := make(map[string]int, len(dp.ifaces))
+	for name, att := range dp.ifaces {
+		attached[name] = att.index
+	}
+	detached := make(map[string]bool, len(dp.detached))
+	for name := range dp.detached {
+		detached[name] = true
+	}
+	dp.ifacesMu.Unlock()
+
+	drop, attach := planInterfaceSync(attached, available, wanted, detached)
+	for _, name := range drop {
+		dp.dropInterface(name, attached[name])
+	}
+	for _, name := range attach {
+		if err := dp.attachDiscovered(name); err != nil && !errors.Is(err, ErrInterfaceAttached) {
+			log.Warnf("Failed to attach to new interface %s: %v", name, err)
+		}
+	}
+}
+
+// planInterfaceSync compares the attached interfaces (name -> index) with
+// those on the host and returns the attachments to drop and the wanted
+// interfaces to attach. An interface recreated under its name is in both.
+func planInterfaceSync(attached, available map[string]int, wanted []string, detached map[string]bool) (drop, attach []string) {
+	for name, index := range attached {
+		if current, ok := available[name]; !ok || current != index {
+			drop = append(drop, name)
+		}
+	}
+	sort.Strings(drop)
+
+	for _, name := range wanted {
+		current, ok := available[name]
+		if !ok || detached[name] {
+			continue
+		}
+		if index, ok := attached[name]; ok && index == current {
+			continue
+		}
+		attach = append(attach, name)
+	}
+	return drop, attach
+}
+
+// dropInterface forgets the attachment of an interface that is gone. The
+// kernel detached the programs along with the device, so failures tearing
+// down what is left are only logged.
+func (dp *DataPlane) dropInterface(name string, index int) {
+	dp.ifacesMu.Lock()
+	defer dp.ifacesMu.Unlock()
+
+	att, ok := dp.ifaces[name]
+	if !ok || att.index != index {
+		return
+	}
+
+	delete(dp.ifaces, name)
+	if att.monitor {
+		dp.clearInterfaceMonitor(att)
+	}
+	if err := att.close(); err != nil {
+		log.Debugf("Cleaning up after vanished interface %s: %v", name, err)
+	}
+	log.Infof("Interface %s (index %d) is gone, attachment dropped", name, index)
+}
+
+// systemInterfaces returns the names of all interfaces on the host
+func systemInterfaces() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("listing interfaces: %w", err)
+	}
+
+	names := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		names = append(names, iface.Name)
+	}
+	return names, nil
+}
+
+// resolveInterfaces expands interface names and glob patterns against the
+// available interfaces. Plain names are returned even if they do not exist
+// so attaching reports the error; patterns matching nothing are skipped.
+func resolveInterfaces(patterns []string, available []string) ([]string, error) {
+	names, unmatched, err := expandInterfaces(patterns, available)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range unmatched {
+		log.Warnf("Interface pattern %q matched no interfaces", pattern)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no interfaces match %v", patterns)
+	}
+	return names, nil
+}
+
+// expandInterfaces expands interface names and glob patterns against the
+// available interfaces and also returns the patterns that matched nothing
+func expandInterfaces(patterns []string, available []string) (names, unmatched []string, err error) {
+	seen := make(map[string]bool)
+
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		if !strings.ContainsAny(pattern, "*?[") {
+			add(pattern)
+			continue
+		}
+
+		matched := false
+		for _, name := range available {
+			ok, err := filepath.Match(pattern, name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid interface pattern %q: %w", pattern, err)
+			}
+			if ok {
+				add(name)
+				matched = true
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	return names, unmatched, nil
+}
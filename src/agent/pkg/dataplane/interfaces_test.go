@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+// TestResolveInterfaces tests expanding interface names and glob patterns
+func TestResolveInterfaces(t *testing.T) {
+	available := []string{"lo", "eth0", "eth1", "veth1a2b", "veth3c4d", "docker0"}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{"single name", []string{"eth0"}, []string{"eth0"}, false},
+		{"missing name is kept", []string{"eth9"}, []string{"eth9"}, false},
+		{"glob", []string{"veth*"}, []string{"veth1a2b", "veth3c4d"}, false},
+		{"names and globs deduplicated", []string{"eth0", "eth*", " lo "}, []string{"eth0", "eth1", "lo"}, false},
+		{"unmatched glob skipped", []string{"wlan*", "lo"}, []string{"lo"}, false},
+		{"nothing matches", []string{"wlan*"}, nil, true},
+		{"empty", []string{""}, nil, true},
+		{"bad pattern", []string{"eth["}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveInterfaces(tt.patterns, available)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestPlanInterfaceSync tests which attachments a link change adds and drops
+func TestPlanInterfaceSync(t *testing.T) {
+	tests := []struct {
+		name       string
+		attached   map[string]int
+		available  map[string]int
+		wanted     []string
+		detached   map[string]bool
+		wantDrop   []string
+		wantAttach []string
+	}{
+		{
+			name:       "new interface matching a pattern",
+			attached:   map[string]int{"veth1": 5},
+			available:  map[string]int{"veth1": 5, "veth2": 6},
+			wanted:     []string{"veth1", "veth2"},
+			wantAttach: []string{"veth2"},
+		},
+		{
+			name:      "vanished interface",
+			attached:  map[string]int{"veth1": 5, "veth2": 6},
+			available: map[string]int{"veth1": 5},
+			wanted:    []string{"veth1"},
+			wantDrop:  []string{"veth2"},
+		},
+		{
+			name:       "recreated interface",
+			attached:   map[string]int{"veth1": 5},
+			available:  map[string]int{"veth1": 9},
+			wanted:     []string{"veth1"},
+			wantDrop:   []string{"veth1"},
+			wantAttach: []string{"veth1"},
+		},
+		{
+			name:      "vanished interface attached at runtime",
+			attached:  map[string]int{"tap0": 7},
+			available: map[string]int{"lo": 1},
+			wantDrop:  []string{"tap0"},
+		},
+		{
+			name:      "missing plain name",
+			available: map[string]int{"lo": 1},
+			wanted:    []string{"eth9"},
+		},
+		{
+			name:      "detached at runtime",
+			available: map[string]int{"veth1": 5},
+			wanted:    []string{"veth1"},
+			detached:  map[string]bool{"veth1": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drop, attach := planInterfaceSync(tt.attached, tt.available, tt.wanted, tt.detached)
+			assert.Equal(t, tt.wantDrop, drop)
+			assert.Equal(t, tt.wantAttach, attach)
+		})
+	}
+}
+
+// TestIfaceAttachmentStatus tests reporting the attach mode of each hook
+func TestIfaceAttachmentStatus(t *testing.T) {
+	att := &ifaceAttachment{
+		name:  "veth0",
+		index: 7,
+		hooks: []*hookAttachment{
+			{direction: DirectionIngress, mode: AttachModeXDPGeneric},
+			{direction: DirectionEgress, mode: AttachModeLegacy, filter: &netlink.BpfFilter{}},
+		},
+	}
+
+	st := att.status()
+	assert.Equal(t, "veth0", st.Name)
+	assert.Equal(t, 7, st.Index)
+	assert.Equal(t, []HookStatus{
+		{Direction: DirectionIngress, Mode: AttachModeXDPGeneric},
+		{Direction: DirectionEgress, Mode: AttachModeLegacy},
+	}, st.Hooks)
+}
+
+// TestAttachDiscovered_Detached tests that the watcher leaves an interface
+// alone once it was detached, even if it planned to attach it
+func TestAttachDiscovered_Detached(t *testing.T) {
+	dp := &DataPlane{
+		ifaces:   make(map[string]*ifaceAttachment),
+		detached: map[string]bool{"veth0": true},
+	}
+
+	require.NoError(t, dp.attachDiscovered("veth0"))
+	assert.Empty(t, dp.ifaces)
+	assert.True(t, dp.detached["veth0"], "Interface stays detached")
+}
@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// pinnedMaps lists the maps pinned under Config.PinPath. They hold the
+// state that must survive an agent restart: sessions, per-source session
+// counts, policies and their indexes, the ipcache, rate limit buckets,
+// mirror targets, runtime config and counters. The monitor interface map
+// and the ring buffer are rebuilt on every start.
+var pinnedMaps = []string{
+	"session_map",
+	"policy_map",
+	"wildcard_policy_map",
+	"src_cidr_map",
+	"dst_cidr_map",
+	"src_identity_map",
+	"dst_identity_map",
+	"ipcache_map",
+	"config_map",
+	"stats_map",
+	"rule_hits_map",
+	"rate_limit_map",
+	"rate_limited_map",
+	"source_sessions_map",
+	"mirror_map",
+	"mirror_stats_map",
+}
+
+// checkBPFFS returns an error if path is not on a bpf filesystem
+func checkBPFFS(path string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return fmt.Errorf("statfs %s: %w", path, err)
+	}
+	if uint32(st.Type) != unix.BPF_FS_MAGIC {
+		return fmt.Errorf("%s is not on a bpf filesystem (mount one with 'mount -t bpf bpf /sys/fs/bpf')", path)
+	}
+	return nil
+}
+
+// preparePinnedMaps marks the persistent maps of spec for pinning under
+// pinPath and reconciles existing pins with the new layouts, so that
+// LoadAndAssign reuses every pin left behind.
+func preparePinnedMaps(spec *ebpf.CollectionSpec, pinPath string) error {
+	if err := os.MkdirAll(pinPath, 0o700); err != nil {
+		return fmt.Errorf("creating pin path: %w", err)
+	}
+	if err := checkBPFFS(pinPath); err != nil {
+		return err
+	}
+
+	for _, name := range pinnedMaps {
+		ms, ok := spec.Maps[name]
+		if !ok {
+			return fmt.Errorf("map %s not found in eBPF objects", name)
+		}
+		ms.Pinning = ebpf.PinByName
+
+		if err := reconcilePin(filepath.Join(pinPath, name), ms); err != nil {
+			return fmt.Errorf("reconciling pinned %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// reconcilePin makes the map pinned at path compatible with ms. A compatible
+// pin is kept as is. A pin that differs only in capacity is migrated into a
+// new map; any other layout change is unpinned so the map is recreated empty.
+func reconcilePin(path string, ms *ebpf.MapSpec) error {
+	old, err := ebpf.LoadPinnedMap(path, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("loading pinned map: %w", err)
+	}
+	defer old.Close()
+
+	err = ms.Compatible(old)
+	if err == nil {
+		log.Infof("Reusing pinned map %s", ms.Name)
+		return nil
+	}
+	if !errors.Is(err, ebpf.ErrMapIncompatible) {
+		return err
+	}
+
+	if old.Type() != ms.Type || old.KeySize() != ms.KeySize ||
+		old.ValueSize() != ms.ValueSize || old.Flags() != ms.Flags {
+		log.Warnf("Pinned map %s has an incompatible layout (%v), recreating it empty", ms.Name, err)
+		return old.Unpin()
+	}
+
+	return migrateMap(path, old, ms)
+}
+
+// migrateMap copies the entries of old into a new map created from ms and
+// pins it at path in place of old. Entries that no longer fit are dropped.
+func migrateMap(path string, old *ebpf.Map, ms *ebpf.MapSpec) error {
+	spec := ms.Copy()
+	spec.Pinning = ebpf.PinNone
+
+	m, err := ebpf.NewMap(spec)
+	if err != nil {
+		return fmt.Errorf("creating map: %w", err)
+	}
+	defer m.Close()
+
+	copied, dropped, err := copyEntries(old, m)
+	if err != nil {
+		return err
+	}
+
+	if err := old.Unpin(); err != nil {
+		return fmt.Errorf("unpinning old map: %w", err)
+	}
+	if err := m.Pin(path); err != nil {
+		return fmt.Errorf("pinning migrated map: %w", err)
+	}
+
+	log.Infof("Migrated pinned map %s: max entries %d -> %d, %d entries copied, %d dropped",
+		ms.Name, old.MaxEntries(), ms.MaxEntries, copied, dropped)
+	return nil
+}
+
+// copyEntries copies every entry of src into dst as raw bytes
+func copyEntries(src, dst *ebpf.Map) (copied, dropped int, err error) {
+	var key []byte
+	iter := src.Iterate()
+
+	if isPerCPU(src.Type()) {
+		var value [][]byte
+		for iter.Next(&key, &value) {
+			if dst.Put(key, value) == nil {
+				copied++
+			} else {
+				dropped++
+			}
+		}
+	} else {
+		var value []byte
+		for iter.Next(&key, &value) {
+			if dst.Put(key, value) == nil {
+				copied++
+			} else {
+				dropped++
+			}
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return copied, dropped, fmt.Errorf("iterating entries: %w", err)
+	}
+	return copied, dropped, nil
+}
+
+// isPerCPU reports whether values of maps of type t are per-CPU slices
+func isPerCPU(t ebpf.MapType) bool {
+	switch t {
+	case ebpf.PerCPUHash, ebpf.PerCPUArray, ebpf.LRUCPUHash:
+		return true
+	default:
+		return false
+	}
+}
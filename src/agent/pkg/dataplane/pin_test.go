@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCheckBPFFS tests that pinning outside bpffs is rejected
+func TestCheckBPFFS(t *testing.T) {
+	err := checkBPFFS(t.TempDir())
+	assert.ErrorContains(t, err, "not on a bpf filesystem")
+
+	err = checkBPFFS("/nonexistent/microsegment")
+	assert.Error(t, err)
+}
+
+// TestIsPerCPU tests which map types are copied with per-CPU values
+func TestIsPerCPU(t *testing.T) {
+	assert.True(t, isPerCPU(ebpf.PerCPUArray))
+	assert.True(t, isPerCPU(ebpf.PerCPUHash))
+	assert.False(t, isPerCPU(ebpf.LRUHash))
+	assert.False(t, isPerCPU(ebpf.LPMTrie))
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// SessionState mirrors enum session_state in common_types.h
+type SessionState uint8
+
+const (
+	SessionStateNew SessionState = iota
+	SessionStateEstablished
+	SessionStateClosing
+	SessionStateClosed
+)
+
+// String returns the lowercase name of the session state
+func (s SessionState) String() string {
+	switch s {
+	case SessionStateNew:
+		return "new"
+	case SessionStateEstablished:
+		return "established"
+	case SessionStateClosing:
+		return "closing"
+	case SessionStateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("state(%d)", uint8(s))
+	}
+}
+
+// TCPState mirrors enum tcp_state in common_types.h
+type TCPState uint8
+
+const (
+	TCPStateClosed TCPState = iota
+	TCPStateSynSent
+	TCPStateSynRecv
+	TCPStateEstablished
+	TCPStateFinWait1
+	TCPStateFinWait2
+	TCPStateCloseWait
+	TCPStateClosing
+	TCPStateLastAck
+	TCPStateTimeWait
+)
+
+var tcpStateNames = [...]string{
+	TCPStateClosed:      "closed",
+	TCPStateSynSent:     "syn_sent",
+	TCPStateSynRecv:     "syn_recv",
+	TCPStateEstablished: "established",
+	TCPStateFinWait1:    "fin_wait1",
+	TCPStateFinWait2:    "fin_wait2",
+	TCPStateCloseWait:   "close_wait",
+	TCPStateClosing:     "closing",
+	TCPStateLastAck:     "last_ack",
+	TCPStateTimeWait:    "time_wait",
+}
+
+// String returns the lowercase name of the TCP state
+func (s TCPState) String() string {
+	if int(s) < len(tcpStateNames) {
+		return tcpStateNames[s]
+	}
+	return fmt.Sprintf("tcp_state(%d)", uint8(s))
+}
+
+// Session is a userspace view of one session_map entry.
+// Src/Dst describe the initiator (the packet that created the session);
+// ToServer counters cover the initiator's packets and ToClient counters
+// cover replies matched through the reversed key. For ICMP sessions
+// SrcPort is the echo identifier and DstPort the message type and code
+// (see ICMPTypeCode).
+type Session struct {
+	SrcIP        net.IP
+	DstIP        net.IP
+	SrcPort      uint16
+	DstPort      uint16
+	Protocol     uint8
+	Direction    Direction
+	State        SessionState
+	TCPState     TCPState
+	PolicyAction uint8
+	RuleID       uint32 // Rule that decided the session, 0 = default action
+
+	// Outer VLAN ID and tunnel VNI of the initiating packet, 0 = none
+	VlanID uint16
+	VNI    uint32
+
+	PacketsToServer uint64
+	PacketsToClient uint64
+	BytesToServer   uint64
+	BytesToClient   uint64
+
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+// ListSessions returns up to limit sessions from the session map.
+// A limit <= 0 returns all sessions.
+func (dp *DataPlane) ListSessions(limit int) ([]Session, error) {
+	bootTime, err := monotonicBootTime()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		key      bpfFlowKey
+		value    bpfSessionValue
+		sessions []Session
+	)
+
+	iter := dp.objs.SessionMap.Iterate()
+	for iter.Next(&key, &value) {
+		sessions = append(sessions, sessionFromMap(&key, &value, bootTime))
+		if limit > 0 && len(sessions) >= limit {
+			break
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("iterating session map: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// sessionFromMap converts a raw session map entry
+func sessionFromMap(key *bpfFlowKey, value *bpfSessionValue, bootTime time.Time) Session {
+	return Session{
+		SrcIP:           keyAddrToIP(key.SrcIp),
+		DstIP:           keyAddrToIP(key.DstIp),
+		SrcPort:         ntohs(key.SrcPort),
+		DstPort:         ntohs(key.DstPort),
+		Protocol:        key.Protocol,
+		Direction:       Direction(key.Direction),
+		State:           SessionState(value.State),
+		TCPState:        TCPState(value.TcpState),
+		PolicyAction:    value.PolicyAction,
+		RuleID:          value.RuleId,
+		VlanID:          value.VlanId,
+		VNI:             value.Vni,
+		PacketsToServer: value.PacketsToServer,
+		PacketsToClient: value.PacketsToClient,
+		BytesToServer:   value.BytesToServer,
+		BytesToClient:   value.BytesToClient,
+		CreatedAt:       bootTime.Add(time.Duration(value.CreatedTs)),
+		LastSeen:        bootTime.Add(time.Duration(value.LastSeenTs)),
+	}
+}
+
+// monotonicBootTime returns the wall-clock time corresponding to a
+// CLOCK_MONOTONIC value of zero, which is what bpf_ktime_get_ns() counts from
+func monotonicBootTime() (time.Time, error) {
+	now, err := monotonicNow()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-time.Duration(now)), nil
+}
+
+// keyAddrToIP converts a 128-bit map address back to net.IP.
+// IPv4-mapped addresses are returned in their 4-byte form.
+func keyAddrToIP(addr [4]uint32) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	for i, word := range addr {
+		binary.LittleEndian.PutUint32(ip[i*4:], word)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// ntohs converts a port stored in network byte order to host order
+func ntohs(port uint16) uint16 {
+	return port<<8 | port>>8
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// SourceSessions is the number of active sessions opened by one source
+type SourceSessions struct {
+	Source   *net.IPNet // Client address, or its prefix when sources are grouped
+	Sessions uint64
+}
+
+// TopSources returns the n sources with the most active sessions, most
+// first. n <= 0 returns all sources.
+func (dp *DataPlane) TopSources(n int) ([]SourceSessions, error) {
+	var (
+		key     bpfSourceKey
+		count   uint64
+		sources []SourceSessions
+	)
+
+	iter := dp.objs.SourceSessionsMap.Iterate()
+	for iter.Next(&key, &count) {
+		if count == 0 {
+			continue
+		}
+		sources = append(sources, SourceSessions{Source: sourcePrefix(&key), Sessions: count})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("iterating source sessions: %w", err)
+	}
+
+	sortSources(sources)
+	if n > 0 && len(sources) > n {
+		sources = sources[:n]
+	}
+	return sources, nil
+}
+
+// sortSources orders sources by session count, then by address
+func sortSources(sources []SourceSessions) {
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Sessions != sources[j].Sessions {
+			return sources[i].Sessions > sources[j].Sessions
+		}
+		return bytes.Compare(sources[i].Source.IP.To16(), sources[j].Source.IP.To16()) < 0
+	})
+}
+
+// sourceKey mirrors build_source_key: the session quota key of a client
+// address, masked to the configured IPv4 or IPv6 prefix (0 = full address)
+func sourceKey(addr [4]uint32, prefixV4, prefixV6 uint8) bpfSourceKey {
+	ip := keyAddrToIP(addr)
+
+	var key bpfSourceKey
+	if v4 := ip.To4(); v4 != nil {
+		bits := int(prefixV4)
+		if bits == 0 || bits > 32 {
+			bits = 32
+		}
+		ip = v4.Mask(net.CIDRMask(bits, 32))
+		key.Prefixlen = uint32(96 + bits)
+	} else {
+		bits := int(prefixV6)
+		if bits == 0 || bits > 128 {
+			bits = 128
+		}
+		ip = ip.Mask(net.CIDRMask(bits, 128))
+		key.Prefixlen = uint32(bits)
+	}
+
+	ip16 := ip.To16()
+	for i := range key.Addr {
+		key.Addr[i] = binary.LittleEndian.Uint32(ip16[i*4:])
+	}
+	return key
+}
+
+// sourcePrefix converts a session quota key back to a prefix
+func sourcePrefix(key *bpfSourceKey) *net.IPNet {
+	ip := keyAddrToIP(key.Addr)
+	if v4 := ip.To4(); v4 != nil && key.Prefixlen >= 96 {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(int(key.Prefixlen-96), 32)}
+	}
+	return &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(int(min(key.Prefixlen, 128)), 128)}
+}
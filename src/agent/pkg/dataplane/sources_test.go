@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     string
+		prefixV4 uint8
+		prefixV6 uint8
+		want     string
+		wantLen  uint32
+	}{
+		{"ipv4 per address", "10.1.2.3", 0, 0, "10.1.2.3/32", 128},
+		{"ipv4 per /24", "10.1.2.3", 24, 64, "10.1.2.0/24", 120},
+		{"ipv4 per /0", "10.1.2.3", 0, 64, "10.1.2.3/32", 128},
+		{"ipv6 per address", "2001:db8::1", 24, 0, "2001:db8::1/128", 128},
+		{"ipv6 per /64", "2001:db8:0:1::1", 24, 64, "2001:db8:0:1::/64", 64},
+		{"ipv6 per /52", "2001:db8:0:1fff::1", 0, 52, "2001:db8:0:1000::/52", 52},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := sourceKey(ipToKeyAddr(t, tt.addr), tt.prefixV4, tt.prefixV6)
+			assert.Equal(t, tt.wantLen, key.Prefixlen)
+			assert.Equal(t, tt.want, sourcePrefix(&key).String())
+		})
+	}
+}
+
+func TestSourceKey_GroupsPrefix(t *testing.T) {
+	a := sourceKey(ipToKeyAddr(t, "192.168.7.10"), 24, 0)
+	b := sourceKey(ipToKeyAddr(t, "192.168.7.200"), 24, 0)
+	c := sourceKey(ipToKeyAddr(t, "192.168.8.10"), 24, 0)
+
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
+
+func TestSortSources(t *testing.T) {
+	prefix := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	sources := []SourceSessions{
+		{Source: prefix("10.0.0.2/32"), Sessions: 5},
+		{Source: prefix("2001:db8::/64"), Sessions: 40},
+		{Source: prefix("10.0.0.1/32"), Sessions: 5},
+		{Source: prefix("10.0.1.0/24"), Sessions: 900},
+	}
+	sortSources(sources)
+
+	var got []string
+	for _, s := range sources {
+		got = append(got, s.Source.String())
+	}
+	assert.Equal(t, []string{"10.0.1.0/24", "2001:db8::/64", "10.0.0.1/32", "10.0.0.2/32"}, got)
+}
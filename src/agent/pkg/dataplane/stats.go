@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/cilium/ebpf"
+)
+
+// StatNames lists the stats_map counters in enum stats_key order
+var StatNames = []string{
+	"total_packets",
+	"allowed_packets",
+	"denied_packets",
+	"new_sessions",
+	"closed_sessions",
+	"active_sessions",
+	"policy_hits",
+	"policy_misses",
+	"ingress_allowed",
+	"ingress_denied",
+	"egress_allowed",
+	"egress_denied",
+	"reply_packets",
+	"sessions_reevaluated",
+	"xdp_dropped",
+	"exempted_flows",
+	"would_deny",
+	"ringbuf_drops",
+	"invalid_tcp_drops",
+	"fragment_drops",
+	"malformed_drops",
+	"rate_limited",
+	"session_limit_drops",
+	"rejects_sent",
+}
+
+// statsActiveSessions is the stats_map index of STATS_ACTIVE_SESSIONS
+const statsActiveSessions uint32 = 5
+
+// MapUsage describes how full one eBPF map is
+type MapUsage struct {
+	Name       string
+	Entries    int
+	MaxEntries uint32
+}
+
+// PerCPUStats returns every stats_map counter broken down by CPU,
+// indexed like StatNames
+func (dp *DataPlane) PerCPUStats() ([][]uint64, error) {
+	result := make([][]uint64, len(StatNames))
+	for i := range StatNames {
+		key := uint32(i)
+		if err := dp.objs.StatsMap.Lookup(&key, &result[i]); err != nil {
+			return nil, fmt.Errorf("reading stat %s: %w", StatNames[i], err)
+		}
+	}
+	return result, nil
+}
+
+// RuleHits returns how often each policy rule matched, summed over CPUs
+func (dp *DataPlane) RuleHits() (map[uint32]uint64, error) {
+	hits, err := sumPerCPUCounters(dp.objs.RuleHitsMap)
+	if err != nil {
+		return nil, fmt.Errorf("iterating rule hits: %w", err)
+	}
+	return hits, nil
+}
+
+// sumPerCPUCounters reads a per-CPU hash of counters keyed by rule ID
+func sumPerCPUCounters(m *ebpf.Map) (map[uint32]uint64, error) {
+	var (
+		ruleID  uint32
+		perCPU  []uint64
+		counts  = make(map[uint32]uint64)
+		entries = m.Iterate()
+	)
+
+	for entries.Next(&ruleID, &perCPU) {
+		var total uint64
+		for _, v := range perCPU {
+			total += v
+		}
+		counts[ruleID] = total
+	}
+	if err := entries.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// RateLimitedPackets returns how many packets each rate_limit rule
+// dropped for exceeding its token bucket, summed over CPUs
+func (dp *DataPlane) RateLimitedPackets() (map[uint32]uint64, error) {
+	counts, err := sumPerCPUCounters(dp.objs.RateLimitedMap)
+	if err != nil {
+		return nil, fmt.Errorf("iterating rate limited packets: %w", err)
+	}
+	return counts, nil
+}
+
+// MirrorStats counts the copies sent to one mirror target
+type MirrorStats struct {
+	Ifindex   uint32
+	Interface string // Empty if the interface no longer exists
+	Packets   uint64
+	Bytes     uint64
+	Errors    uint64 // Copies the kernel failed to send
+}
+
+// MirrorStats returns the counters of every mirror target that was sent
+// a copy, summed over CPUs and sorted by ifindex
+func (dp *DataPlane) MirrorStats() ([]MirrorStats, error) {
+	var (
+		ifindex uint32
+		perCPU  []bpfMirrorStats
+		result  []MirrorStats
+		entries = dp.objs.MirrorStatsMap.Iterate()
+	)
+
+	for entries.Next(&ifindex, &perCPU) {
+		s := MirrorStats{Ifindex: ifindex}
+		if iface, err := net.InterfaceByIndex(int(ifindex)); err == nil {
+			s.Interface = iface.Name
+		}
+		for _, v := range perCPU {
+			s.Packets += v.Packets
+			s.Bytes += v.Bytes
+			s.Errors += v.Errors
+		}
+		result = append(result, s)
+	}
+	if err := entries.Err(); err != nil {
+		return nil, fmt.Errorf("iterating mirror stats: %w", err)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Ifindex < result[j].Ifindex })
+	return result, nil
+}
+
+// ResetRuleHits removes the hit and rate limited counters of a rule, e.g.
+// after it was deleted
+func (dp *DataPlane) ResetRuleHits(ruleID uint32) error {
+	if err := dp.objs.RuleHitsMap.Delete(&ruleID); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("resetting hits of rule %d: %w", ruleID, err)
+	}
+	if err := dp.objs.RateLimitedMap.Delete(&ruleID); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("resetting rate limited packets of rule %d: %w", ruleID, err)
+	}
+	return nil
+}
+
+// MapUsage returns the occupancy of the session, policy, index, ipcache,
+// rate limit, session quota and mirror maps
+func (dp *DataPlane) MapUsage() ([]MapUsage, error) {
+	type counter struct {
+		name  string
+		m     *ebpf.Map
+		count func(m *ebpf.Map) (int, error)
+	}
+
+	counters := []counter{
+		{"session_map", dp.objs.SessionMap, countEntries[bpfFlowKey, bpfSessionValue](nil)},
+		{"policy_map", dp.objs.PolicyMap, countEntries[bpfPolicyKey, bpfPolicyValue](nil)},
+		{"wildcard_policy_map", dp.objs.WildcardPolicyMap, countEntries[uint32](func(w *bpfWildcardPolicy) bool {
+			return w.RuleId != 0 // Array slots always exist
+		})},
+		{"src_cidr_map", dp.objs.SrcCidrMap, countEntries[bpfLpmKey, bpfCidrRuleSet](nil)},
+		{"dst_cidr_map", dp.objs.DstCidrMap, countEntries[bpfLpmKey, bpfCidrRuleSet](nil)},
+		{"src_identity_map", dp.objs.SrcIdentityMap, countEntries[uint32, bpfCidrRuleSet](nil)},
+		{"dst_identity_map", dp.objs.DstIdentityMap, countEntries[uint32, bpfCidrRuleSet](nil)},
+		{"ipcache_map", dp.objs.IpcacheMap, countEntries[bpfLpmKey, uint32](nil)},
+		{"monitor_iface_map", dp.objs.MonitorIfaceMap, countEntries[uint32, uint8](nil)},
+		{"rate_limit_map", dp.objs.RateLimitMap, countEntries[uint32, bpfRateLimit](nil)},
+		{"source_sessions_map", dp.objs.SourceSessionsMap, countEntries[bpfSourceKey, uint64](nil)},
+		{"mirror_map", dp.objs.MirrorMap, countEntries[uint32, bpfMirrorTarget](nil)},
+	}
+
+	usage := make([]MapUsage, 0, len(counters))
+	for _, c := range counters {
+		n, err := c.count(c.m)
+		if err != nil {
+			return nil, fmt.Errorf("counting %s entries: %w", c.name, err)
+		}
+		usage = append(usage, MapUsage{Name: c.name, Entries: n, MaxEntries: c.m.MaxEntries()})
+	}
+	return usage, nil
+}
+
+// countEntries returns a function counting the entries of a map with key
+// type K and value type V; keep (if set) selects which values count
+func countEntries[K, V any](keep func(*V) bool) func(m *ebpf.Map) (int, error) {
+	return func(m *ebpf.Map) (int, error) {
+		var (
+			key   K
+			value V
+			n     int
+		)
+
+		iter := m.Iterate()
+		for iter.Next(&key, &value) {
+			if keep == nil || keep(&value) {
+				n++
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// linksDir is the subdirectory of the pin path holding pinned links
+const linksDir = "links"
+
+// Hooks whose links are pinned, used in the pin file names
+const (
+	hookXDP       = "xdp"
+	hookTCIngress = "tc_ingress"
+	hookTCEgress  = "tc_egress"
+)
+
+// linkPin returns the bpffs path of the link of a hook on iface, or ""
+// if links are not pinned
+func (dp *DataPlane) linkPin(iface, hook string) string {
+	if dp.pinPath == "" {
+		return ""
+	}
+	return filepath.Join(dp.pinPath, linksDir, iface+"_"+hook)
+}
+
+// adoptHook looks for the link a previous agent pinned for a hook of the
+// interface. The link's program is atomically replaced by prog and the link
+// adopted, so the hook is never without a program. Only a link that can't
+// be updated is detached. It returns nil if the hook has to be attached
+// fresh.
+func (dp *DataPlane) adoptHook(iface string, ifaceIdx int, hook string, prog *ebpf.Program, dir Direction) *hookAttachment {
+	pin := dp.linkPin(iface, hook)
+	if pin == "" {
+		return nil
+	}
+
+	l, err := link.LoadPinnedLink(pin, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		log.Warnf("Failed to load pinned %s link of %s, removing it: %v", hook, iface, err)
+		os.Remove(pin)
+		return nil
+	}
+
+	if err := l.Update(prog); err != nil {
+		log.Warnf("Failed to take over %s program on %s, reattaching: %v", hook, iface, err)
+		removePinnedLink(l, iface, hook)
+		return nil
+	}
+
+	mode := AttachModeTCX
+	if hook == hookXDP {
+		mode = xdpAttachMode(ifaceIdx)
+		if (dp.xdpMode == XDPModeNative && mode != AttachModeXDPNative) ||
+			(dp.xdpMode == XDPModeGeneric && mode != AttachModeXDPGeneric) {
+			log.Warnf("Adopted XDP program on %s runs in %s mode, reattaching for XDP mode %s", iface, mode, dp.xdpMode)
+			removePinnedLink(l, iface, hook)
+			return nil
+		}
+	}
+
+	log.Infof("✓ Took over %s program on %s (%s mode)", hook, iface, mode)
+	return &hookAttachment{direction: dir, mode: mode, link: l, pin: pin}
+}
+
+// removeStaleHook detaches the pinned link of a hook the current
+// configuration no longer uses, e.g. XDP after switching to TC only
+func (dp *DataPlane) removeStaleHook(iface, hook string) {
+	pin := dp.linkPin(iface, hook)
+	if pin == "" {
+		return
+	}
+
+	l, err := link.LoadPinnedLink(pin, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Warnf("Failed to load pinned %s link of %s, removing it: %v", hook, iface, err)
+		os.Remove(pin)
+		return
+	}
+
+	log.Infof("Detaching %s program on %s, hook no longer configured", hook, iface)
+	removePinnedLink(l, iface, hook)
+}
+
+// removePinnedLink unpins and closes l, which detaches its program
+func removePinnedLink(l link.Link, iface, hook string) {
+	if err := l.Unpin(); err != nil {
+		log.Warnf("Failed to unpin %s link of %s: %v", hook, iface, err)
+	}
+	l.Close()
+}
+
+// xdpAttachMode reports whether the XDP program on the interface runs in
+// the driver or in generic mode
+func xdpAttachMode(ifaceIdx int) AttachMode {
+	nlLink, err := netlink.LinkByIndex(ifaceIdx)
+	if err == nil && nlLink.Attrs().Xdp != nil && nlLink.Attrs().Xdp.AttachMode == nl.XDP_ATTACHED_SKB {
+		return AttachModeXDPGeneric
+	}
+	return AttachModeXDPNative
+}
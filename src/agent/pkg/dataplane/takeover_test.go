@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLinkPin tests where hook links are pinned
+func TestLinkPin(t *testing.T) {
+	dp := &DataPlane{}
+	assert.Empty(t, dp.linkPin("eth0", hookTCIngress))
+
+	dp.pinPath = "/sys/fs/bpf/microsegment"
+	assert.Equal(t, "/sys/fs/bpf/microsegment/links/eth0_tc_ingress", dp.linkPin("eth0", hookTCIngress))
+	assert.Equal(t, "/sys/fs/bpf/microsegment/links/eth0_xdp", dp.linkPin("eth0", hookXDP))
+}
+
+// TestNewWithConfig_TakeoverRequiresPinPath tests that takeover is
+// rejected when nothing is pinned to take over
+func TestNewWithConfig_TakeoverRequiresPinPath(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Takeover = true
+
+	_, err := NewWithConfig(cfg)
+	assert.ErrorContains(t, err, "takeover requires a pin path")
+}
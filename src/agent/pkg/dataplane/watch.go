@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package dataplane
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// interfaceResyncInterval bounds how long a link change goes unnoticed
+// when netlink notifications are lost or unavailable
+const interfaceResyncInterval = 30 * time.Second
+
+// interfaceWatcher keeps the attached interfaces in line with the
+// configured names and patterns as links come and go
+type interfaceWatcher struct {
+	dp       *DataPlane
+	patterns []string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newInterfaceWatcher creates a watcher for the given interface names and
+// glob patterns
+func newInterfaceWatcher(dp *DataPlane, patterns []string) *interfaceWatcher {
+	return &interfaceWatcher{
+		dp:       dp,
+		patterns: patterns,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start syncs the interfaces on every link notification and on a timer
+func (w *interfaceWatcher) start() {
+	updates := make(chan netlink.LinkUpdate, 64)
+	err := netlink.LinkSubscribeWithOptions(updates, w.stop, netlink.LinkSubscribeOptions{
+		ErrorCallback: func(err error) {
+			select {
+			case <-w.stop:
+			default:
+				log.Warnf("Link notifications failed, resyncing interfaces every %s: %v", interfaceResyncInterval, err)
+			}
+		},
+	})
+	if err != nil {
+		log.Warnf("Subscribing to link notifications failed, resyncing interfaces every %s: %v", interfaceResyncInterval, err)
+		updates = nil
+	}
+
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(interfaceResyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case _, ok := <-updates:
+				if !ok {
+					updates = nil
+					continue
+				}
+				// One sync covers a burst of notifications
+				w.drain(updates)
+				w.dp.syncInterfaces(w.patterns)
+			case <-ticker.C:
+				w.dp.syncInterfaces(w.patterns)
+			}
+		}
+	}()
+}
+
+// drain discards the notifications already queued
+func (w *interfaceWatcher) drain(updates chan netlink.LinkUpdate) {
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// close stops the watcher and waits for a running sync to finish
+func (w *interfaceWatcher) close() {
+	close(w.stop)
+	<-w.done
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// APIMetrics records REST API request metrics
+type APIMetrics struct {
+	requestDuration *prometheus.HistogramVec
+}
+
+// NewAPIMetrics creates the API metrics and registers them with reg
+func NewAPIMetrics(reg prometheus.Registerer) *APIMetrics {
+	m := &APIMetrics{
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "api",
+			Name:      "request_duration_seconds",
+			Help:      "REST API request latency.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "code"}),
+	}
+	reg.MustRegister(m.requestDuration)
+	return m
+}
+
+// ObserveRequest records one handled request. route is the matched route
+// pattern (e.g. /api/v1/policies/:id) so label cardinality stays bounded.
+func (m *APIMetrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.requestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
@@ -0,0 +1,332 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/ebpf-microsegment/src/agent/pkg/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// namespace prefixes every metric exported by the agent
+const namespace = "microsegment"
+
+// statMetric describes how one stats_map counter is exported
+type statMetric struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+}
+
+// statMetrics maps stats_map counter names (dataplane.StatNames) to metrics
+var statMetrics = map[string]statMetric{
+	"total_packets":        {"packets_total", "Packets processed by the eBPF programs.", prometheus.CounterValue},
+	"allowed_packets":      {"allowed_packets_total", "Packets allowed by policy.", prometheus.CounterValue},
+	"denied_packets":       {"denied_packets_total", "Packets dropped by policy.", prometheus.CounterValue},
+	"new_sessions":         {"sessions_created_total", "Sessions created in the session map.", prometheus.CounterValue},
+	"closed_sessions":      {"sessions_closed_total", "Sessions closed by TCP teardown.", prometheus.CounterValue},
+	"active_sessions":      {"active_sessions", "Sessions in the session map, recounted by every session GC sweep.", prometheus.GaugeValue},
+	"policy_hits":          {"policy_hits_total", "Policy lookups that matched a rule.", prometheus.CounterValue},
+	"policy_misses":        {"policy_misses_total", "Policy lookups that fell back to the default action.", prometheus.CounterValue},
+	"ingress_allowed":      {"ingress_allowed_packets_total", "Packets allowed on the ingress hooks.", prometheus.CounterValue},
+	"ingress_denied":       {"ingress_denied_packets_total", "Packets dropped on the ingress hooks.", prometheus.CounterValue},
+	"egress_allowed":       {"egress_allowed_packets_total", "Packets allowed on the egress hook.", prometheus.CounterValue},
+	"egress_denied":        {"egress_denied_packets_total", "Packets dropped on the egress hook.", prometheus.CounterValue},
+	"reply_packets":        {"reply_packets_total", "Packets matched to a session in the reply direction.", prometheus.CounterValue},
+	"sessions_reevaluated": {"sessions_reevaluated_total", "Cached session decisions recomputed after a policy change.", prometheus.CounterValue},
+	"xdp_dropped":          {"xdp_dropped_packets_total", "Packets dropped by the XDP program.", prometheus.CounterValue},
+	"exempted_flows":       {"exempted_flows_total", "Policy lookups bypassed by the safety exemptions.", prometheus.CounterValue},
+	"would_deny":           {"would_deny_packets_total", "Denied packets let through by monitor mode.", prometheus.CounterValue},
+	"ringbuf_drops":        {"ringbuf_dropped_events_total", "Flow events lost because the ring buffer was full.", prometheus.CounterValue},
+	"invalid_tcp_drops":    {"invalid_tcp_dropped_packets_total", "Packets dropped for invalid TCP flag combinations.", prometheus.CounterValue},
+	"fragment_drops":       {"fragment_dropped_packets_total", "Non-first fragments dropped because their first fragment was not seen.", prometheus.CounterValue},
+	"malformed_drops":      {"malformed_dropped_packets_total", "Packets dropped for malformed IP headers.", prometheus.CounterValue},
+	"rate_limited":         {"rate_limited_packets_total", "Packets dropped for exceeding the rate of a rate_limit rule.", prometheus.CounterValue},
+	"session_limit_drops":  {"session_limit_dropped_flows_total", "New sessions denied because their source reached its session limit.", prometheus.CounterValue},
+	"rejects_sent":         {"rejects_sent_total", "TCP resets and ICMP unreachables sent for packets of reject rules.", prometheus.CounterValue},
+}
+
+// statDesc pairs a stats_map counter with its descriptor
+type statDesc struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+// Collector exports data plane and policy statistics. Values are read from
+// the eBPF maps on every scrape.
+type Collector struct {
+	source   dataplane.MetricsSource
+	policies policy.Manager // nil skips policy metrics
+	perCPU   bool
+
+	stats []statDesc
+
+	mapEntries    *prometheus.Desc
+	mapMaxEntries *prometheus.Desc
+	policyRules   *prometheus.Desc
+	ruleHits      *prometheus.Desc
+	ruleLimited   *prometheus.Desc
+
+	mirrorPackets *prometheus.Desc
+	mirrorBytes   *prometheus.Desc
+	mirrorErrors  *prometheus.Desc
+
+	flowEventsReceived     *prometheus.Desc
+	flowEventsDelivered    *prometheus.Desc
+	flowEventsDropped      *prometheus.Desc
+	flowEventDecodeErrors  *prometheus.Desc
+	flowEventSubscribers   *prometheus.Desc
+	sessionGCSweeps        *prometheus.Desc
+	sessionGCExpired       *prometheus.Desc
+	sessionGCSweepDuration *prometheus.Desc
+}
+
+// NewCollector creates a collector for source and policies. With perCPU
+// the stats_map counters are exported per CPU with a "cpu" label instead
+// of summed.
+func NewCollector(source dataplane.MetricsSource, policies policy.Manager, perCPU bool) *Collector {
+	var statLabels []string
+	if perCPU {
+		statLabels = []string{"cpu"}
+	}
+
+	c := &Collector{
+		source:   source,
+		policies: policies,
+		perCPU:   perCPU,
+
+		mapEntries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "map", "entries"),
+			"Entries in use in an eBPF map.", []string{"map"}, nil),
+		mapMaxEntries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "map", "max_entries"),
+			"Capacity of an eBPF map.", []string{"map"}, nil),
+		policyRules: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "policy", "rules"),
+			"Installed policy rules.", []string{"action"}, nil),
+		ruleHits: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "policy", "rule_hits_total"),
+			"Policy lookups matched by a rule.", []string{"rule_id", "action"}, nil),
+		ruleLimited: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "policy", "rate_limited_packets_total"),
+			"Packets dropped for exceeding the rate of a rate_limit rule.", []string{"rule_id"}, nil),
+
+		mirrorPackets: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "mirror", "packets_total"),
+			"Packet copies sent to a mirror target.", []string{"ifindex", "interface"}, nil),
+		mirrorBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "mirror", "bytes_total"),
+			"Bytes of packet copies sent to a mirror target.", []string{"ifindex", "interface"}, nil),
+		mirrorErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "mirror", "errors_total"),
+			"Packet copies the kernel failed to send to a mirror target.", []string{"ifindex", "interface"}, nil),
+
+		flowEventsReceived: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "flow_events", "received_total"),
+			"Flow events read from the ring buffer.", nil, nil),
+		flowEventsDelivered: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "flow_events", "delivered_total"),
+			"Flow events queued to subscribers.", nil, nil),
+		flowEventsDropped: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "flow_events", "dropped_total"),
+			"Flow events dropped because a subscriber fell behind.", nil, nil),
+		flowEventDecodeErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "flow_events", "decode_errors_total"),
+			"Ring buffer records that could not be decoded.", nil, nil),
+		flowEventSubscribers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "flow_events", "subscribers"),
+			"Active flow event subscribers.", nil, nil),
+		sessionGCSweeps: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "session_gc", "sweeps_total"),
+			"Idle session sweeps run.", nil, nil),
+		sessionGCExpired: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "session_gc", "expired_sessions_total"),
+			"Sessions removed for being idle.", nil, nil),
+		sessionGCSweepDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "session_gc", "last_sweep_duration_seconds"),
+			"Duration of the last idle session sweep.", nil, nil),
+	}
+
+	for _, name := range dataplane.StatNames {
+		m, ok := statMetrics[name]
+		if !ok {
+			m = statMetric{name + "_total", "Data plane counter " + name + ".", prometheus.CounterValue}
+		}
+		c.stats = append(c.stats, statDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "dataplane", m.name),
+				m.help, statLabels, nil),
+			valueType: m.valueType,
+		})
+	}
+
+	return c
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, s := range c.stats {
+		ch <- s.desc
+	}
+	ch <- c.mapEntries
+	ch <- c.mapMaxEntries
+	ch <- c.mirrorPackets
+	ch <- c.mirrorBytes
+	ch <- c.mirrorErrors
+	ch <- c.flowEventsReceived
+	ch <- c.flowEventsDelivered
+	ch <- c.flowEventsDropped
+	ch <- c.flowEventDecodeErrors
+	ch <- c.flowEventSubscribers
+	ch <- c.sessionGCSweeps
+	ch <- c.sessionGCExpired
+	ch <- c.sessionGCSweepDuration
+	if c.policies != nil {
+		ch <- c.policyRules
+		ch <- c.ruleHits
+		ch <- c.ruleLimited
+	}
+}
+
+// Collect implements prometheus.Collector. Metrics whose source can't be
+// read are skipped for this scrape.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.collectStats(ch)
+	c.collectMapUsage(ch)
+	c.collectMirrors(ch)
+	c.collectAgentStats(ch)
+	if c.policies != nil {
+		c.collectPolicies(ch)
+	}
+}
+
+// collectStats exports the stats_map counters
+func (c *Collector) collectStats(ch chan<- prometheus.Metric) {
+	perCPU, err := c.source.PerCPUStats()
+	if err != nil {
+		log.Warnf("Metrics: reading data plane statistics: %v", err)
+		return
+	}
+
+	for i, values := range perCPU {
+		if i >= len(c.stats) {
+			break
+		}
+		s := c.stats[i]
+
+		if c.perCPU {
+			for cpu, v := range values {
+				ch <- prometheus.MustNewConstMetric(s.desc, s.valueType, statValue(v, s.valueType), strconv.Itoa(cpu))
+			}
+			continue
+		}
+
+		var total uint64
+		for _, v := range values {
+			total += v
+		}
+		ch <- prometheus.MustNewConstMetric(s.desc, s.valueType, statValue(total, s.valueType))
+	}
+}
+
+// statValue converts a counter value. Gauge slots are decremented on
+// whichever CPU closes the session, so a single CPU may wrap below zero.
+func statValue(v uint64, valueType prometheus.ValueType) float64 {
+	if valueType == prometheus.GaugeValue {
+		return float64(int64(v))
+	}
+	return float64(v)
+}
+
+// collectMapUsage exports eBPF map occupancy
+func (c *Collector) collectMapUsage(ch chan<- prometheus.Metric) {
+	usage, err := c.source.MapUsage()
+	if err != nil {
+		log.Warnf("Metrics: reading map usage: %v", err)
+		return
+	}
+
+	for _, u := range usage {
+		ch <- prometheus.MustNewConstMetric(c.mapEntries, prometheus.GaugeValue, float64(u.Entries), u.Name)
+		ch <- prometheus.MustNewConstMetric(c.mapMaxEntries, prometheus.GaugeValue, float64(u.MaxEntries), u.Name)
+	}
+}
+
+// collectMirrors exports the copies sent to each mirror target
+func (c *Collector) collectMirrors(ch chan<- prometheus.Metric) {
+	mirrors, err := c.source.MirrorStats()
+	if err != nil {
+		log.Warnf("Metrics: reading mirror statistics: %v", err)
+		return
+	}
+
+	for _, m := range mirrors {
+		ifindex := strconv.FormatUint(uint64(m.Ifindex), 10)
+		ch <- prometheus.MustNewConstMetric(c.mirrorPackets, prometheus.CounterValue, float64(m.Packets), ifindex, m.Interface)
+		ch <- prometheus.MustNewConstMetric(c.mirrorBytes, prometheus.CounterValue, float64(m.Bytes), ifindex, m.Interface)
+		ch <- prometheus.MustNewConstMetric(c.mirrorErrors, prometheus.CounterValue, float64(m.Errors), ifindex, m.Interface)
+	}
+}
+
+// collectAgentStats exports counters kept in userspace
+func (c *Collector) collectAgentStats(ch chan<- prometheus.Metric) {
+	stats := c.source.GetStatistics()
+
+	ev := stats.FlowEvents
+	ch <- prometheus.MustNewConstMetric(c.flowEventsReceived, prometheus.CounterValue, float64(ev.Received))
+	ch <- prometheus.MustNewConstMetric(c.flowEventsDelivered, prometheus.CounterValue, float64(ev.Delivered))
+	ch <- prometheus.MustNewConstMetric(c.flowEventsDropped, prometheus.CounterValue, float64(ev.Dropped))
+	ch <- prometheus.MustNewConstMetric(c.flowEventDecodeErrors, prometheus.CounterValue, float64(ev.DecodeErrors))
+	ch <- prometheus.MustNewConstMetric(c.flowEventSubscribers, prometheus.GaugeValue, float64(ev.Subscribers))
+
+	gc := stats.SessionGC
+	ch <- prometheus.MustNewConstMetric(c.sessionGCSweeps, prometheus.CounterValue, float64(gc.Sweeps))
+	ch <- prometheus.MustNewConstMetric(c.sessionGCExpired, prometheus.CounterValue, float64(gc.ExpiredSessions))
+	ch <- prometheus.MustNewConstMetric(c.sessionGCSweepDuration, prometheus.GaugeValue, gc.LastSweepDuration.Seconds())
+}
+
+// collectPolicies exports rule counts, per-rule hit counters and the
+// drops of rate_limit rules
+func (c *Collector) collectPolicies(ch chan<- prometheus.Metric) {
+	policies, err := c.policies.ListPolicies()
+	if err != nil {
+		log.Warnf("Metrics: listing policies: %v", err)
+		return
+	}
+
+	rules := make(map[string]int)
+	for _, p := range policies {
+		rules[p.Action]++
+	}
+	for action, n := range rules {
+		ch <- prometheus.MustNewConstMetric(c.policyRules, prometheus.GaugeValue, float64(n), action)
+	}
+
+	hits, err := c.source.RuleHits()
+	if err != nil {
+		log.Warnf("Metrics: reading rule hits: %v", err)
+		return
+	}
+
+	// Only export installed rules; counters of deleted rules may linger
+	for _, p := range policies {
+		ch <- prometheus.MustNewConstMetric(c.ruleHits, prometheus.CounterValue,
+			float64(hits[p.RuleID]), strconv.FormatUint(uint64(p.RuleID), 10), p.Action)
+	}
+
+	limited, err := c.source.RateLimitedPackets()
+	if err != nil {
+		log.Warnf("Metrics: reading rate limited packets: %v", err)
+		return
+	}
+
+	for _, p := range policies {
+		if p.Action != "rate_limit" {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.ruleLimited, prometheus.CounterValue,
+			float64(limited[p.RuleID]), strconv.FormatUint(uint64(p.RuleID), 10))
+	}
+}
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/ebpf-microsegment/src/agent/pkg/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource is an in-memory MetricsSource
+type fakeSource struct {
+	perCPU   [][]uint64
+	hits     map[uint32]uint64
+	limited  map[uint32]uint64
+	mirrors  []dataplane.MirrorStats
+	usage    []dataplane.MapUsage
+	stats    dataplane.Statistics
+	statsErr error
+}
+
+func (f *fakeSource) GetStatistics() dataplane.Statistics { return f.stats }
+
+func (f *fakeSource) PerCPUStats() ([][]uint64, error) { return f.perCPU, f.statsErr }
+
+func (f *fakeSource) RuleHits() (map[uint32]uint64, error) { return f.hits, nil }
+
+func (f *fakeSource) RateLimitedPackets() (map[uint32]uint64, error) { return f.limited, nil }
+
+func (f *fakeSource) MirrorStats() ([]dataplane.MirrorStats, error) { return f.mirrors, nil }
+
+func (f *fakeSource) MapUsage() ([]dataplane.MapUsage, error) { return f.usage, nil }
+
+// fakePolicies is an in-memory policy.Manager
+type fakePolicies struct {
+	policies []policy.Policy
+}
+
+func (f *fakePolicies) AddPolicy(p *policy.Policy) error    { return nil }
+func (f *fakePolicies) UpdatePolicy(p *policy.Policy) error { return nil }
+func (f *fakePolicies) DeletePolicy(p *policy.Policy) error { return nil }
+func (f *fakePolicies) ListPolicies() ([]policy.Policy, error) {
+	return f.policies, nil
+}
+
+func newFakeSource() *fakeSource {
+	perCPU := make([][]uint64, len(dataplane.StatNames))
+	for i := range perCPU {
+		perCPU[i] = []uint64{0, 0}
+	}
+	perCPU[0] = []uint64{10, 5}         // total_packets
+	perCPU[5] = []uint64{3, ^uint64(0)} // active_sessions, one CPU wrapped below zero
+
+	return &fakeSource{
+		perCPU:  perCPU,
+		hits:    map[uint32]uint64{1: 7, 99: 4},
+		limited: map[uint32]uint64{4: 12},
+		mirrors: []dataplane.MirrorStats{
+			{Ifindex: 7, Interface: "ids0", Packets: 20, Bytes: 3000, Errors: 1},
+		},
+		usage: []dataplane.MapUsage{
+			{Name: "session_map", Entries: 2, MaxEntries: 100000},
+		},
+		stats: dataplane.Statistics{
+			FlowEvents: dataplane.FlowEventStats{Received: 8, Dropped: 2, Subscribers: 1},
+			SessionGC:  dataplane.SessionGCStats{Sweeps: 3, LastSweepDuration: 500 * time.Millisecond},
+		},
+	}
+}
+
+func TestCollector_Stats(t *testing.T) {
+	c := NewCollector(newFakeSource(), nil, false)
+
+	expected := `
+# HELP microsegment_dataplane_packets_total Packets processed by the eBPF programs.
+# TYPE microsegment_dataplane_packets_total counter
+microsegment_dataplane_packets_total 15
+# HELP microsegment_dataplane_active_sessions Sessions in the session map, recounted by every session GC sweep.
+# TYPE microsegment_dataplane_active_sessions gauge
+microsegment_dataplane_active_sessions 2
+# HELP microsegment_map_entries Entries in use in an eBPF map.
+# TYPE microsegment_map_entries gauge
+microsegment_map_entries{map="session_map"} 2
+# HELP microsegment_flow_events_dropped_total Flow events dropped because a subscriber fell behind.
+# TYPE microsegment_flow_events_dropped_total counter
+microsegment_flow_events_dropped_total 2
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"microsegment_dataplane_packets_total",
+		"microsegment_dataplane_active_sessions",
+		"microsegment_map_entries",
+		"microsegment_flow_events_dropped_total")
+	assert.NoError(t, err)
+}
+
+func TestCollector_PerCPU(t *testing.T) {
+	c := NewCollector(newFakeSource(), nil, true)
+
+	expected := `
+# HELP microsegment_dataplane_packets_total Packets processed by the eBPF programs.
+# TYPE microsegment_dataplane_packets_total counter
+microsegment_dataplane_packets_total{cpu="0"} 10
+microsegment_dataplane_packets_total{cpu="1"} 5
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected), "microsegment_dataplane_packets_total")
+	assert.NoError(t, err)
+}
+
+func TestCollector_Policies(t *testing.T) {
+	pm := &fakePolicies{policies: []policy.Policy{
+		{RuleID: 1, Action: "allow"},
+		{RuleID: 2, Action: "deny"},
+		{RuleID: 3, Action: "deny"},
+	}}
+	c := NewCollector(newFakeSource(), pm, false)
+
+	// Hits of rule 99 (no longer installed) are not exported
+	expected := `
+# HELP microsegment_policy_rule_hits_total Policy lookups matched by a rule.
+# TYPE microsegment_policy_rule_hits_total counter
+microsegment_policy_rule_hits_total{action="allow",rule_id="1"} 7
+microsegment_policy_rule_hits_total{action="deny",rule_id="2"} 0
+microsegment_policy_rule_hits_total{action="deny",rule_id="3"} 0
+# HELP microsegment_policy_rules Installed policy rules.
+# TYPE microsegment_policy_rules gauge
+microsegment_policy_rules{action="allow"} 1
+microsegment_policy_rules{action="deny"} 2
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"microsegment_policy_rule_hits_total", "microsegment_policy_rules")
+	assert.NoError(t, err)
+}
+
+func TestCollector_RateLimited(t *testing.T) {
+	pm := &fakePolicies{policies: []policy.Policy{
+		{RuleID: 1, Action: "allow"},
+		{RuleID: 4, Action: "rate_limit", Rate: 100},
+		{RuleID: 5, Action: "rate_limit", Rate: 10},
+	}}
+	c := NewCollector(newFakeSource(), pm, false)
+
+	// Only rate_limit rules are exported
+	expected := `
+# HELP microsegment_policy_rate_limited_packets_total Packets dropped for exceeding the rate of a rate_limit rule.
+# TYPE microsegment_policy_rate_limited_packets_total counter
+microsegment_policy_rate_limited_packets_total{rule_id="4"} 12
+microsegment_policy_rate_limited_packets_total{rule_id="5"} 0
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"microsegment_policy_rate_limited_packets_total")
+	assert.NoError(t, err)
+}
+
+func TestCollector_Mirrors(t *testing.T) {
+	c := NewCollector(newFakeSource(), nil, false)
+
+	expected := `
+# HELP microsegment_mirror_bytes_total Bytes of packet copies sent to a mirror target.
+# TYPE microsegment_mirror_bytes_total counter
+microsegment_mirror_bytes_total{ifindex="7",interface="ids0"} 3000
+# HELP microsegment_mirror_errors_total Packet copies the kernel failed to send to a mirror target.
+# TYPE microsegment_mirror_errors_total counter
+microsegment_mirror_errors_total{ifindex="7",interface="ids0"} 1
+# HELP microsegment_mirror_packets_total Packet copies sent to a mirror target.
+# TYPE microsegment_mirror_packets_total counter
+microsegment_mirror_packets_total{ifindex="7",interface="ids0"} 20
+`
+	err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"microsegment_mirror_packets_total", "microsegment_mirror_bytes_total", "microsegment_mirror_errors_total")
+	assert.NoError(t, err)
+}
+
+func TestCollector_SourceError(t *testing.T) {
+	src := newFakeSource()
+	src.statsErr = errors.New("map unavailable")
+	c := NewCollector(src, nil, false)
+
+	// Unreadable counters are skipped, the rest is still exported
+	n := testutil.CollectAndCount(c, "microsegment_dataplane_packets_total")
+	assert.Zero(t, n)
+	assert.Equal(t, 1, testutil.CollectAndCount(c, "microsegment_map_entries"))
+}
+
+func TestCollector_Lint(t *testing.T) {
+	problems, err := testutil.CollectAndLint(NewCollector(newFakeSource(), &fakePolicies{}, false))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestAPIMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewAPIMetrics(reg)
+
+	m.ObserveRequest("GET", "/api/v1/policies/:id", 200, 20*time.Millisecond)
+	m.ObserveRequest("GET", "/api/v1/policies/:id", 200, 40*time.Millisecond)
+	m.ObserveRequest("GET", "", 404, time.Millisecond)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(reg, "microsegment_api_request_duration_seconds"))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+
+	var routes []string
+	for _, metric := range families[0].GetMetric() {
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "route" {
+				routes = append(routes, label.GetValue())
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"/api/v1/policies/:id", "unmatched"}, routes)
+}
@@ -0,0 +1,21 @@
+// Package metrics exports agent statistics in the Prometheus format.
+//
+// Collector reads the eBPF maps on every scrape:
+//   - microsegment_dataplane_*: one metric per stats_map counter, summed
+//     over CPUs or per CPU (label "cpu")
+//   - microsegment_map_entries, microsegment_map_max_entries: occupancy of
+//     the session, policy and CIDR index maps (label "map")
+//   - microsegment_policy_rules: installed rules by action
+//   - microsegment_policy_rule_hits_total: matches per rule (labels
+//     "rule_id", "action")
+//   - microsegment_policy_rate_limited_packets_total: drops per rate_limit
+//     rule (label "rule_id")
+//   - microsegment_mirror_packets_total, microsegment_mirror_bytes_total,
+//     microsegment_mirror_errors_total: copies sent per mirror target
+//     (labels "ifindex", "interface")
+//   - microsegment_flow_events_*: ring buffer reader and subscriber delivery
+//   - microsegment_session_gc_*: idle session sweeper activity
+//
+// APIMetrics records microsegment_api_request_duration_seconds, a latency
+// histogram labelled by method, route pattern and status code.
+package metrics
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	// maxWildcardPolicies mirrors MAX_ENTRIES_WILDCARD_POLICY in common_types.h
+	maxWildcardPolicies = 4096
+
+	// maxRulesPerPrefix mirrors MAX_CIDR_RULES_PER_PREFIX in common_types.h
+	maxRulesPerPrefix = 64
+
+	// maxCIDRCandidates mirrors MAX_CIDR_CANDIDATES in common_types.h
+	maxCIDRCandidates = 128
+)
+
+// lpmKey mirrors struct lpm_key in common_types.h
+type lpmKey struct {
+	PrefixLen uint32
+	Addr      [4]uint32
+}
+
+// cidrRuleSet mirrors struct cidr_rule_set in common_types.h
+type cidrRuleSet struct {
+	Count     uint32
+	PrefixLen uint32 // Prefix length of the trie key, 0 for identity sets
+	Slots     [maxRulesPerPrefix]uint32
+}
+
+// prefixStore is the subset of LPM trie operations the CIDR index needs
+type prefixStore interface {
+	entries() (map[lpmKey]cidrRuleSet, error)
+	put(key lpmKey, set *cidrRuleSet) error
+	delete(key lpmKey) error
+}
+
+// mapPrefixStore is a prefixStore backed by an eBPF LPM trie
+type mapPrefixStore struct {
+	m *ebpf.Map
+}
+
+func (s mapPrefixStore) entries() (map[lpmKey]cidrRuleSet, error) {
+	var (
+		key lpmKey
+		set cidrRuleSet
+	)
+
+	result := make(map[lpmKey]cidrRuleSet)
+	iter := s.m.Iterate()
+	for iter.Next(&key, &set) {
+		result[key] = set
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("iterating CIDR trie: %w", err)
+	}
+	return result, nil
+}
+
+func (s mapPrefixStore) put(key lpmKey, set *cidrRuleSet) error {
+	return s.m.Put(&key, set)
+}
+
+func (s mapPrefixStore) delete(key lpmKey) error {
+	if err := s.m.Delete(&key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return err
+	}
+	return nil
+}
+
+// cidrIndex locates wildcard rules by source or destination prefix.
+//
+// Every rule is indexed under exactly one prefix: its destination prefix,
+// or its source prefix when that one is longer. Entries only hold their
+// own rules; the data plane walks from the longest matching prefix up
+// through every shorter covering prefix, within a fixed step budget per
+// trie (see chainCost). Rules matching
+// a security identity are indexed by identity instead: the destination
+// identity, or the source identity if the rule has none.
+type cidrIndex struct {
+	src prefixStore
+	dst prefixStore
+
+	srcIdentity identityStore
+	dstIdentity identityStore
+}
+
+// indexFor returns the trie and prefix a wildcard rule is indexed under
+func (ci *cidrIndex) indexFor(w *wildcardPolicy) (prefixStore, lpmKey) {
+	srcLen := maskPrefixLen(w.SrcIPMask)
+	dstLen := maskPrefixLen(w.DstIPMask)
+
+	if srcLen > dstLen {
+		return ci.src, lpmKey{PrefixLen: srcLen, Addr: maskAddr(w.SrcIP, srcLen)}
+	}
+	return ci.dst, lpmKey{PrefixLen: dstLen, Addr: maskAddr(w.DstIP, dstLen)}
+}
+
+// identityIndexFor returns the store and identity a wildcard rule is
+// indexed under, if it matches an identity
+func (ci *cidrIndex) identityIndexFor(w *wildcardPolicy) (identityStore, uint32, bool) {
+	switch {
+	case w.DstIdentity != 0:
+		return ci.dstIdentity, w.DstIdentity, true
+	case w.SrcIdentity != 0:
+		return ci.srcIdentity, w.SrcIdentity, true
+	}
+	return nil, 0, false
+}
+
+// add indexes the wildcard rule stored at slot
+func (ci *cidrIndex) add(w *wildcardPolicy, slot uint32) error {
+	if store, identity, ok := ci.identityIndexFor(w); ok {
+		return addToIdentityStore(store, identity, slot)
+	}
+	store, key := ci.indexFor(w)
+	return addToPrefixStore(store, key, slot)
+}
+
+// remove drops the wildcard rule stored at slot from the index
+func (ci *cidrIndex) remove(w *wildcardPolicy, slot uint32) error {
+	if store, identity, ok := ci.identityIndexFor(w); ok {
+		return removeFromIdentityStore(store, identity, slot)
+	}
+	store, key := ci.indexFor(w)
+	return removeFromPrefixStore(store, key, slot)
+}
+
+// addToPrefixStore adds slot to the entry for key. Nothing is written if
+// the entry is full or the data plane could no longer reach every rule
+// covering an address within key.
+func addToPrefixStore(store prefixStore, key lpmKey, slot uint32) error {
+	entries, err := store.entries()
+	if err != nil {
+		return err
+	}
+
+	set := entries[key]
+	if set.contains(slot) {
+		return nil
+	}
+	if set.Count >= maxRulesPerPrefix {
+		return fmt.Errorf("too many rules at prefix %s (max %d)", formatPrefix(key), maxRulesPerPrefix)
+	}
+	set.Slots[set.Count] = slot
+	set.Count++
+	set.PrefixLen = key.PrefixLen
+	entries[key] = set
+
+	// Only prefixes within key walk through its entry
+	for k := range entries {
+		if prefixContains(key, k) && chainCost(entries, k) > maxCIDRCandidates {
+			return fmt.Errorf("too many rules overlap prefix %s (max %d lookup steps)",
+				formatPrefix(k), maxCIDRCandidates)
+		}
+	}
+
+	if err := store.put(key, &set); err != nil {
+		return fmt.Errorf("updating CIDR prefix %s: %w", formatPrefix(key), err)
+	}
+	return nil
+}
+
+// removeFromPrefixStore removes slot from the entry for key and deletes
+// the entry once no rule is indexed there
+func removeFromPrefixStore(store prefixStore, key lpmKey, slot uint32) error {
+	entries, err := store.entries()
+	if err != nil {
+		return err
+	}
+
+	set, ok := entries[key]
+	if !ok || !set.contains(slot) {
+		return nil
+	}
+
+	set.remove(slot)
+	if set.Count == 0 {
+		err = store.delete(key)
+	} else {
+		err = store.put(key, &set)
+	}
+	if err != nil {
+		return fmt.Errorf("updating CIDR prefix %s: %w", formatPrefix(key), err)
+	}
+	return nil
+}
+
+// chainCost returns the data plane loop steps for an address whose longest
+// matching prefix is key: one per rule and one per prefix on the way up
+func chainCost(entries map[lpmKey]cidrRuleSet, key lpmKey) uint32 {
+	var cost uint32
+	for k, set := range entries {
+		if prefixContains(k, key) {
+			cost += set.Count + 1
+		}
+	}
+	return cost
+}
+
+func (s *cidrRuleSet) contains(slot uint32) bool {
+	for i := uint32(0); i < s.Count; i++ {
+		if s.Slots[i] == slot {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *cidrRuleSet) remove(slot uint32) {
+	for i := uint32(0); i < s.Count; i++ {
+		if s.Slots[i] == slot {
+			// Order does not matter; move the last slot into the gap
+			s.Count--
+			s.Slots[i] = s.Slots[s.Count]
+			s.Slots[s.Count] = 0
+			return
+		}
+	}
+}
+
+// prefixContains reports whether outer covers inner
+func prefixContains(outer, inner lpmKey) bool {
+	return outer.PrefixLen <= inner.PrefixLen && maskAddr(inner.Addr, outer.PrefixLen) == outer.Addr
+}
+
+// maskPrefixLen returns the number of leading one bits of a 128-bit map mask
+func maskPrefixLen(mask [4]uint32) uint32 {
+	var n uint32
+	for _, word := range mask {
+		n += uint32(bits.OnesCount32(word))
+	}
+	return n
+}
+
+// maskAddr clears all but the first prefixLen bits of a 128-bit map address
+func maskAddr(addr [4]uint32, prefixLen uint32) [4]uint32 {
+	mask := net.CIDRMask(int(prefixLen), 128)
+
+	var out [4]uint32
+	for i, word := range addr {
+		out[i] = word & binary.LittleEndian.Uint32(mask[i*4:])
+	}
+	return out
+}
+
+// formatPrefix returns a trie prefix in CIDR notation
+func formatPrefix(key lpmKey) string {
+	mask := net.CIDRMask(int(key.PrefixLen), 128)
+	return formatCIDR(key.Addr, maskToKeyAddr(&mask))
+}
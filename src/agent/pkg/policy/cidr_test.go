@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memPrefixStore is an in-memory prefixStore with LPM trie lookup semantics
+type memPrefixStore struct {
+	m map[lpmKey]cidrRuleSet
+}
+
+func newMemPrefixStore() *memPrefixStore {
+	return &memPrefixStore{m: make(map[lpmKey]cidrRuleSet)}
+}
+
+func (s *memPrefixStore) entries() (map[lpmKey]cidrRuleSet, error) {
+	out := make(map[lpmKey]cidrRuleSet, len(s.m))
+	for k, v := range s.m {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *memPrefixStore) put(key lpmKey, set *cidrRuleSet) error {
+	s.m[key] = *set
+	return nil
+}
+
+func (s *memPrefixStore) delete(key lpmKey) error {
+	delete(s.m, key)
+	return nil
+}
+
+// lookup returns the candidate slots for addr, walking the covering
+// prefixes like the data plane does
+func (s *memPrefixStore) lookup(addr string) []uint32 {
+	full := lpmKey{PrefixLen: 128, Addr: ipToKeyAddr(net.ParseIP(addr))}
+
+	var slots []uint32
+	for maxLen := 128; maxLen >= 0; {
+		var (
+			best    cidrRuleSet
+			bestLen = -1
+		)
+		for k, set := range s.m {
+			if int(k.PrefixLen) <= maxLen && prefixContains(k, full) && int(k.PrefixLen) > bestLen {
+				best, bestLen = set, int(k.PrefixLen)
+			}
+		}
+		if bestLen < 0 {
+			break
+		}
+		slots = append(slots, best.Slots[:best.Count]...)
+		maxLen = int(best.PrefixLen) - 1
+	}
+	return slots
+}
+
+// testWildcard builds a wildcard rule from CIDR strings
+func testWildcard(t *testing.T, src, dst string) *wildcardPolicy {
+	t.Helper()
+	srcIP, srcMask, err := parseCIDR(src)
+	require.NoError(t, err)
+	dstIP, dstMask, err := parseCIDR(dst)
+	require.NoError(t, err)
+
+	return &wildcardPolicy{
+		SrcIP:     ipToKeyAddr(srcIP),
+		SrcIPMask: maskToKeyAddr(srcMask),
+		DstIP:     ipToKeyAddr(dstIP),
+		DstIPMask: maskToKeyAddr(dstMask),
+	}
+}
+
+func newTestIndex() (*cidrIndex, *memPrefixStore, *memPrefixStore) {
+	src, dst := newMemPrefixStore(), newMemPrefixStore()
+	return &cidrIndex{src: src, dst: dst}, src, dst
+}
+
+func TestMaskPrefixLen(t *testing.T) {
+	_, v4, _ := parseCIDR("10.0.0.0/8")
+	_, v6, _ := parseCIDR("2001:db8::/32")
+	_, host, _ := parseCIDR("10.0.0.1")
+
+	assert.Equal(t, uint32(104), maskPrefixLen(maskToKeyAddr(v4)))
+	assert.Equal(t, uint32(32), maskPrefixLen(maskToKeyAddr(v6)))
+	assert.Equal(t, uint32(128), maskPrefixLen(maskToKeyAddr(host)))
+}
+
+func TestPrefixContains(t *testing.T) {
+	key := func(cidr string) lpmKey {
+		ip, mask, err := parseCIDR(cidr)
+		require.NoError(t, err)
+		n := maskPrefixLen(maskToKeyAddr(mask))
+		return lpmKey{PrefixLen: n, Addr: maskAddr(ipToKeyAddr(ip), n)}
+	}
+
+	assert.True(t, prefixContains(key("10.0.0.0/8"), key("10.1.0.0/16")))
+	assert.True(t, prefixContains(key("10.0.0.0/8"), key("10.0.0.0/8")))
+	assert.False(t, prefixContains(key("10.1.0.0/16"), key("10.0.0.0/8")))
+	assert.False(t, prefixContains(key("10.0.0.0/8"), key("11.0.0.0/16")))
+	assert.True(t, prefixContains(key("0.0.0.0/0"), key("192.168.1.1")))
+	assert.False(t, prefixContains(key("0.0.0.0/0"), key("2001:db8::1")))
+	assert.True(t, prefixContains(key("::/0"), key("10.0.0.1")))
+}
+
+func TestCIDRIndex_PicksMostSpecificSide(t *testing.T) {
+	ci, src, dst := newTestIndex()
+
+	require.NoError(t, ci.add(testWildcard(t, "10.0.0.0/8", "192.168.1.0/24"), 1))
+	require.NoError(t, ci.add(testWildcard(t, "10.1.2.0/24", "0.0.0.0/0"), 2))
+
+	assert.Equal(t, []uint32{1}, dst.lookup("192.168.1.10"))
+	assert.Empty(t, dst.lookup("192.168.2.10"))
+	assert.Equal(t, []uint32{2}, src.lookup("10.1.2.3"))
+	assert.Empty(t, src.lookup("10.1.3.3"))
+}
+
+func TestCIDRIndex_CoveringPrefixesAreInherited(t *testing.T) {
+	ci, _, dst := newTestIndex()
+
+	// Broad rule first, specific rule later sees it through the chain
+	require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", "10.0.0.0/8"), 1))
+	require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", "10.1.0.0/16"), 2))
+	// Broader rule added last is reached from existing specific prefixes
+	require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", "0.0.0.0/0"), 3))
+
+	assert.ElementsMatch(t, []uint32{1, 2, 3}, dst.lookup("10.1.2.3"))
+	assert.ElementsMatch(t, []uint32{1, 3}, dst.lookup("10.2.0.1"))
+	assert.ElementsMatch(t, []uint32{3}, dst.lookup("172.16.0.1"))
+	assert.Empty(t, dst.lookup("2001:db8::1"), "IPv4 any must not match IPv6")
+}
+
+func TestCIDRIndex_Remove(t *testing.T) {
+	ci, _, dst := newTestIndex()
+
+	broad := testWildcard(t, "0.0.0.0/0", "10.0.0.0/8")
+	specific := testWildcard(t, "0.0.0.0/0", "10.1.0.0/16")
+	require.NoError(t, ci.add(broad, 1))
+	require.NoError(t, ci.add(specific, 2))
+
+	// Removing the broad rule leaves the more specific entry alone
+	require.NoError(t, ci.remove(broad, 1))
+	assert.ElementsMatch(t, []uint32{2}, dst.lookup("10.1.2.3"))
+	assert.Empty(t, dst.lookup("10.2.0.1"))
+	assert.Len(t, dst.m, 1)
+
+	require.NoError(t, ci.remove(specific, 2))
+	assert.Empty(t, dst.m)
+}
+
+func TestCIDRIndex_SharedPrefix(t *testing.T) {
+	ci, _, dst := newTestIndex()
+
+	a := testWildcard(t, "0.0.0.0/0", "10.0.0.0/8")
+	b := testWildcard(t, "0.0.0.0/0", "10.0.0.0/8")
+	require.NoError(t, ci.add(a, 1))
+	require.NoError(t, ci.add(b, 2))
+
+	require.NoError(t, ci.remove(a, 1))
+	assert.Equal(t, []uint32{2}, dst.lookup("10.0.0.1"), "entry kept while another rule owns it")
+}
+
+func TestCIDRIndex_ManyRules(t *testing.T) {
+	ci, _, dst := newTestIndex()
+
+	// Thousands of disjoint prefixes all stay reachable
+	for i := 0; i < 2000; i++ {
+		cidr := net.IPv4(10, byte(i>>8), byte(i), 0).String() + "/24"
+		require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", cidr), uint32(i)))
+	}
+
+	assert.Equal(t, []uint32{1500}, dst.lookup("10.5.220.7"))
+	assert.Equal(t, []uint32{999}, dst.lookup("10.3.231.1"))
+}
+
+func TestCIDRIndex_Overflow(t *testing.T) {
+	ci, _, dst := newTestIndex()
+
+	for i := 0; i < maxRulesPerPrefix; i++ {
+		require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", "10.0.0.0/8"), uint32(i)))
+	}
+
+	err := ci.add(testWildcard(t, "0.0.0.0/0", "10.0.0.0/8"), maxRulesPerPrefix)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "10.0.0.0/8")
+	assert.Len(t, dst.lookup("10.0.0.1"), maxRulesPerPrefix)
+}
+
+func TestCIDRIndex_CoveringRulesAreNotCopied(t *testing.T) {
+	ci, _, dst := newTestIndex()
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", "0.0.0.0/0"), uint32(i)))
+	}
+	for i := 0; i < 2000; i++ {
+		cidr := net.IPv4(10, byte(i>>8), byte(i), 0).String() + "/24"
+		require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", cidr), uint32(100+i)))
+	}
+
+	// Each entry only holds its own rules
+	anyKey := lpmKey{PrefixLen: 96, Addr: ipToKeyAddr(net.ParseIP("0.0.0.0"))}
+	assert.Equal(t, uint32(50), dst.m[anyKey].Count)
+	for k, set := range dst.m {
+		if k != anyKey {
+			assert.Equal(t, uint32(1), set.Count)
+		}
+	}
+
+	slots := dst.lookup("10.5.220.7")
+	assert.Len(t, slots, 51)
+	assert.Contains(t, slots, uint32(1600))
+	assert.Len(t, dst.lookup("172.16.0.1"), 50)
+}
+
+func TestCIDRIndex_ChainBudget(t *testing.T) {
+	ci, _, dst := newTestIndex()
+
+	for i := 0; i < maxRulesPerPrefix; i++ {
+		require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", "0.0.0.0/0"), uint32(i)))
+	}
+
+	// An address in 10.0.0.0/8 walks 65 steps for the any prefix, leaving
+	// room for 62 more rules and the step into 10.0.0.0/8 itself
+	room := maxCIDRCandidates - (maxRulesPerPrefix + 1) - 1
+	for i := 0; i < room; i++ {
+		require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", "10.0.0.0/8"), uint32(100+i)))
+	}
+
+	err := ci.add(testWildcard(t, "0.0.0.0/0", "10.0.0.0/8"), 1000)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "10.0.0.0/8")
+	assert.Len(t, dst.lookup("10.0.0.1"), maxRulesPerPrefix+room)
+
+	// Disjoint prefixes are unaffected
+	require.NoError(t, ci.add(testWildcard(t, "0.0.0.0/0", "192.168.0.0/16"), 1001))
+}
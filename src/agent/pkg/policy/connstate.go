@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Connection states in the order of enum conn_state in common_types.h
+var connStateNames = []string{"new", "established", "related", "invalid"}
+
+// ValidateConnStates checks the connection states a policy matches
+func ValidateConnStates(p *Policy) error {
+	_, err := connStateMask(p.ConnStates)
+	return err
+}
+
+// connStateMask converts state names to the wildcard conn_states mask
+// (bit 1<<state, 0 = any state)
+func connStateMask(states []string) (uint8, error) {
+	var mask uint8
+	for _, s := range states {
+		bit := -1
+		for i, name := range connStateNames {
+			if strings.EqualFold(strings.TrimSpace(s), name) {
+				bit = i
+				break
+			}
+		}
+		if bit < 0 {
+			return 0, fmt.Errorf("unknown connection state %q (expected new, established, related or invalid)", s)
+		}
+		mask |= 1 << bit
+	}
+	return mask, nil
+}
+
+// connStateNamesFromMask is the inverse of connStateMask
+func connStateNamesFromMask(mask uint8) []string {
+	var states []string
+	for i, name := range connStateNames {
+		if mask&(1<<i) != 0 {
+			states = append(states, name)
+		}
+	}
+	return states
+}
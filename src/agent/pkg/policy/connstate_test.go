@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConnStateMask tests encoding connection states for the wildcard map
+// and reading them back
+func TestConnStateMask(t *testing.T) {
+	testCases := []struct {
+		name     string
+		states   []string
+		wantMask uint8
+		wantBack []string
+		wantErr  bool
+	}{
+		{name: "any", wantMask: 0},
+		{name: "new", states: []string{"new"}, wantMask: 1 << 0, wantBack: []string{"new"}},
+		{name: "established and related", states: []string{"Established", " related"},
+			wantMask: 1<<1 | 1<<2, wantBack: []string{"established", "related"}},
+		{name: "invalid", states: []string{"invalid"}, wantMask: 1 << 3, wantBack: []string{"invalid"}},
+		{name: "duplicate", states: []string{"new", "new"}, wantMask: 1 << 0, wantBack: []string{"new"}},
+		{name: "unknown", states: []string{"syn_sent"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mask, err := connStateMask(tc.states)
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Error(t, ValidateConnStates(&Policy{ConnStates: tc.states}))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantMask, mask)
+			assert.Equal(t, tc.wantBack, connStateNamesFromMask(mask))
+		})
+	}
+}
+
+// TestHasWildcard_ConnStates tests that connection state policies use the
+// wildcard map
+func TestHasWildcard_ConnStates(t *testing.T) {
+	p := &Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 1234, DstPort: 80, Protocol: "tcp"}
+	assert.False(t, hasWildcard(p))
+
+	p.ConnStates = []string{"established"}
+	assert.True(t, hasWildcard(p))
+}
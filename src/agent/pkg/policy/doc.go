@@ -9,16 +9,70 @@
 // # Policy Model
 //
 // A policy is defined by a 5-tuple:
-//   - Source IP (CIDR notation)
-//   - Destination IP (CIDR notation)
-//   - Source port (0 for any)
-//   - Destination port (0 for any)
-//   - Protocol (tcp, udp, icmp, any)
+//   - Source IP (IPv4 or IPv6, CIDR notation)
+//   - Destination IP (IPv4 or IPv6, CIDR notation)
+//   - Source ports (single port, list and/or ranges; none for any)
+//   - Destination ports (single port, list and/or ranges; none for any)
+//   - Protocol (tcp, udp, icmp, icmpv6, any)
 //
 // And an action:
 //   - allow: Permit the traffic
 //   - deny: Drop the traffic
 //   - log: Permit but generate audit logs
+//   - rate_limit: Permit up to a rate, drop the excess
+//   - reject: Drop the traffic and answer TCP with a reset, anything else
+//     with an ICMP unreachable
+//
+// ICMP and ICMPv6 policies take no ports; they may instead match an
+// ICMP type (IcmpType) and code (IcmpCode), e.g. type 8 for echo
+// requests or type 3 code 4 for "fragmentation needed". A policy for any
+// protocol that sets ports never matches ICMP traffic.
+//
+// A policy may also be limited to connection states (ConnStates): new,
+// established, related (ICMP errors about a known flow) or invalid. For
+// example, allowing established and related traffic from 0.0.0.0/0 and
+// denying new inbound connections admits only replies. TCP segments other
+// than a bare SYN that belong to no tracked connection are invalid. A TCP
+// connection is new until its handshake completes and established after
+// it; seeing the handshake of inbound connections needs the egress hook.
+//
+// For multi-tenant segmentation a policy can be scoped to an outer VLAN ID
+// (VlanID) and a VXLAN/Geneve VNI (VNI); zero matches any. The XDP hook
+// may not see VLAN tags, so with it a VlanID policy must be limited to
+// egress; AddPolicy returns ErrUnsupportedRule otherwise.
+//
+// A rate_limit policy carries a token bucket: Rate tokens per second, up
+// to Burst tokens (Rate if zero), shared by every flow the rule matches.
+// By default each packet of those sessions costs a token, replies
+// included; with RateUnit "bytes" each byte does. With "connections" only
+// the packet opening a session is charged, so a rule on a database port
+// with Rate 100 admits 100 new connections per second and leaves admitted
+// connections alone. A flow whose first packet is over the limit gets no
+// session and is charged again on its next attempt.
+//
+// SessionLimit caps the active sessions each source may hold through a
+// policy, overriding the agent-wide source session limit; zero keeps the
+// global limit. New flows from a source at its limit are denied.
+//
+// Mirror sends a copy of the packets of a policy's flows out of a
+// monitoring interface, e.g. to an IDS, whatever the policy's action.
+// MirrorSample copies one packet in N to limit the load; zero copies
+// every packet. The interface must exist when the policy is installed.
+// Mirroring needs the TC ingress program: in xdp-only hook mode, policies
+// with a mirror target are refused with ErrUnsupportedRule.
+//
+// # Identities
+//
+// An Identity gives the workloads carrying a label set (e.g. "app=web",
+// "env=prod") a numeric security identity and lists their addresses or
+// prefixes. SetIdentity writes them to the data plane's ipcache; a label
+// set and an address belong to at most one identity. Policies match
+// identities with SrcIdentity and DstIdentity, leaving SrcIP or DstIP
+// empty to accept any address of that identity, so a workload changing
+// address only needs its identity updated, not its rules. Identities are
+// persisted with the policies and restored by LoadPersisted, which also
+// removes ipcache entries storage doesn't know of. A new manager recovers
+// the identities of a pinned ipcache, without their labels.
 //
 // # Example Usage
 //
@@ -59,16 +113,41 @@
 //
 // Currently supported:
 //   - Exact 5-tuple matching
-//   - IPv4 addresses
-//
-// Future enhancements:
-//   - CIDR range matching (LPM trie)
-//   - IPv6 support
-//   - Priority-based rule ordering
+//   - IPv4 and IPv6 addresses (IPv4 is stored IPv4-mapped in 128-bit keys);
+//     source and destination must be of the same family
+//   - CIDR prefixes via the wildcard policy map
+//   - Priority-based selection among matching wildcard rules
+//   - Port lists and inclusive port ranges
+//
+// A policy expands to one map entry per source/destination port
+// combination (at most 64). Port lists stay in the exact HASH map; ranges
+// go to wildcard slots that share the rule ID and are listed, updated and
+// deleted together.
+//
+// Wildcard rules live in an array map and are indexed by source and
+// destination LPM tries (src_cidr_map, dst_cidr_map). Each rule is indexed
+// under its more specific prefix, at most 64 per prefix. A trie entry only
+// holds its own rules; the data plane starts at the longest matching
+// prefix and steps up through the shorter covering ones, refining ports,
+// protocol and direction on the way. Rules are rejected once an address
+// would need more than 128 steps (one per candidate and one per prefix)
+// on either side. Rules matching an
+// identity are indexed by identity instead (src_identity_map,
+// dst_identity_map), at most 64 per identity.
+//
+// The token bucket of a rate_limit rule is kept in rate_limit_map, keyed by
+// rule ID; rewriting a rule refills its bucket.
+//
+// ICMP policies and policies with connection states, a VLAN ID, a VNI or
+// an identity always use wildcard slots, which carry the extra fields to match. The data
+// plane keys ICMP flows by message type and code plus the echo
+// identifier, so replies pair with the request that opened the session
+// while other ICMP messages are evaluated on their own.
 //
 // # Thread Safety
 //
 // The PolicyManager is NOT thread-safe. Concurrent access should
-// be protected by the caller (e.g., using sync.RWMutex).
+// be protected by the caller (e.g., using sync.RWMutex). The identity
+// methods are the exception and may be called concurrently.
 package policy
 
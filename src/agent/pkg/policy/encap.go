@@ -0,0 +1,21 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import "fmt"
+
+// Largest VLAN ID (4095 is reserved) and VXLAN/Geneve VNI
+const (
+	maxVlanID = 4094
+	maxVNI    = 1<<24 - 1
+)
+
+// ValidateEncap checks the VLAN ID and VNI a policy matches
+func ValidateEncap(p *Policy) error {
+	if p.VlanID > maxVlanID {
+		return fmt.Errorf("vlan_id %d out of range (1-%d)", p.VlanID, maxVlanID)
+	}
+	if p.VNI > maxVNI {
+		return fmt.Errorf("vni %d out of range (1-%d)", p.VNI, maxVNI)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateEncap tests the accepted VLAN ID and VNI ranges
+func TestValidateEncap(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "any", policy: Policy{}},
+		{name: "vlan", policy: Policy{VlanID: 100}},
+		{name: "highest vlan", policy: Policy{VlanID: 4094}},
+		{name: "reserved vlan", policy: Policy{VlanID: 4095}, wantErr: true},
+		{name: "vni", policy: Policy{VNI: 5001}},
+		{name: "highest vni", policy: Policy{VNI: 1<<24 - 1}},
+		{name: "vni too large", policy: Policy{VNI: 1 << 24}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateEncap(&tc.policy)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestHasWildcard_Encap tests that VLAN and VNI policies use the wildcard map
+func TestHasWildcard_Encap(t *testing.T) {
+	exact := Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 1234, DstPort: 80, Protocol: "tcp"}
+	assert.False(t, hasWildcard(&exact))
+
+	vlan := exact
+	vlan.VlanID = 100
+	assert.True(t, hasWildcard(&vlan))
+
+	vni := exact
+	vni.VNI = 5001
+	assert.True(t, hasWildcard(&vni))
+}
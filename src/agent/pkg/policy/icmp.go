@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ICMP_MATCH_* flags in common_types.h
+const (
+	icmpMatchType = 1 << 0
+	icmpMatchCode = 1 << 1
+)
+
+// isICMP reports whether the policy protocol is ICMP or ICMPv6
+func isICMP(protocol string) bool {
+	switch strings.ToLower(protocol) {
+	case "icmp", "icmpv6":
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidateICMP checks the ICMP fields of a policy. Type and code only apply
+// to icmp/icmpv6 policies, and those match on type and code, not ports.
+func ValidateICMP(p *Policy) error {
+	if p.IcmpCode != nil && p.IcmpType == nil {
+		return errors.New("icmp_code requires icmp_type")
+	}
+
+	if !isICMP(p.Protocol) {
+		if p.IcmpType != nil {
+			return fmt.Errorf("icmp_type requires protocol icmp or icmpv6, got %q", p.Protocol)
+		}
+		return nil
+	}
+
+	if p.SrcPort != 0 || p.DstPort != 0 || len(p.SrcPorts) > 0 || len(p.DstPorts) > 0 ||
+		p.SrcPortRange != "" || p.DstPortRange != "" {
+		return fmt.Errorf("ports do not apply to protocol %s, use icmp_type/icmp_code", p.Protocol)
+	}
+	return nil
+}
+
+// icmpMatch returns the ICMP match flags, type and code of a policy
+func icmpMatch(p *Policy) (match, icmpType, icmpCode uint8) {
+	if p.IcmpType != nil {
+		match |= icmpMatchType
+		icmpType = *p.IcmpType
+	}
+	if p.IcmpCode != nil {
+		match |= icmpMatchCode
+		icmpCode = *p.IcmpCode
+	}
+	return match, icmpType, icmpCode
+}
+
+// setICMPFields stores ICMP match flags back into a policy
+func setICMPFields(p *Policy, match, icmpType, icmpCode uint8) {
+	if match&icmpMatchType != 0 {
+		t := icmpType
+		p.IcmpType = &t
+	}
+	if match&icmpMatchCode != 0 {
+		c := icmpCode
+		p.IcmpCode = &c
+	}
+}
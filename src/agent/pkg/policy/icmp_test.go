@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func u8(v uint8) *uint8 { return &v }
+
+// TestValidateICMP tests which combinations of protocol, ports and ICMP
+// fields are accepted
+func TestValidateICMP(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "icmp any type", policy: Policy{Protocol: "icmp"}},
+		{name: "icmp echo request", policy: Policy{Protocol: "icmp", IcmpType: u8(8)}},
+		{name: "icmp echo reply", policy: Policy{Protocol: "icmp", IcmpType: u8(0)}},
+		{name: "icmp frag needed", policy: Policy{Protocol: "icmp", IcmpType: u8(3), IcmpCode: u8(4)}},
+		{name: "icmpv6 echo request", policy: Policy{Protocol: "ICMPv6", IcmpType: u8(128)}},
+		{name: "tcp without icmp fields", policy: Policy{Protocol: "tcp", DstPort: 80}},
+		{name: "code without type", policy: Policy{Protocol: "icmp", IcmpCode: u8(4)}, wantErr: true},
+		{name: "type on tcp", policy: Policy{Protocol: "tcp", IcmpType: u8(8)}, wantErr: true},
+		{name: "type on any protocol", policy: Policy{Protocol: "any", IcmpType: u8(8)}, wantErr: true},
+		{name: "icmp with port", policy: Policy{Protocol: "icmp", DstPort: 80}, wantErr: true},
+		{name: "icmp with port range", policy: Policy{Protocol: "icmp", SrcPortRange: "1-100"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateICMP(&tc.policy)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestICMPMatchRoundTrip tests encoding ICMP fields for the wildcard map
+// and reading them back
+func TestICMPMatchRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name      string
+		icmpType  *uint8
+		icmpCode  *uint8
+		wantMatch uint8
+	}{
+		{name: "any", wantMatch: 0},
+		{name: "type zero", icmpType: u8(0), wantMatch: icmpMatchType},
+		{name: "type and code", icmpType: u8(3), icmpCode: u8(4), wantMatch: icmpMatchType | icmpMatchCode},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			match, icmpType, icmpCode := icmpMatch(&Policy{IcmpType: tc.icmpType, IcmpCode: tc.icmpCode})
+			assert.Equal(t, tc.wantMatch, match)
+
+			var p Policy
+			setICMPFields(&p, match, icmpType, icmpCode)
+			assert.Equal(t, tc.icmpType, p.IcmpType)
+			assert.Equal(t, tc.icmpCode, p.IcmpCode)
+		})
+	}
+}
+
+// TestHasWildcardICMP tests that ICMP policies always use the wildcard map
+func TestHasWildcardICMP(t *testing.T) {
+	p := &Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "icmp"}
+	require.True(t, hasWildcard(p))
+
+	p.IcmpType = u8(8)
+	assert.True(t, hasWildcard(p))
+}
@@ -0,0 +1,416 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+
+	"github.com/cilium/ebpf"
+	log "github.com/sirupsen/logrus"
+)
+
+// Identity is a numeric security identity: the workloads carrying a label
+// set, addressed by the CIDRs the ipcache maps to it. Policies match
+// identities, so workloads changing address only need their CIDRs updated.
+type Identity struct {
+	ID     uint32
+	Labels []string // "key=value", sorted
+	CIDRs  []string // Addresses or prefixes of the workloads
+}
+
+var (
+	// ErrIdentityNotFound is returned for an identity that does not exist
+	ErrIdentityNotFound = errors.New("identity not found")
+
+	// ErrIdentityConflict is returned when an identity's labels or CIDRs
+	// are already assigned to another identity
+	ErrIdentityConflict = errors.New("identity conflict")
+)
+
+// labelPattern matches a "key=value" label. Commas are excluded since
+// labels are stored comma separated.
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*=[A-Za-z0-9._/-]*$`)
+
+// ValidateIdentity checks the ID, labels and CIDRs of an identity
+func ValidateIdentity(id *Identity) error {
+	if id.ID == 0 {
+		return fmt.Errorf("identity 0 is reserved for addresses without an identity")
+	}
+	if len(id.Labels) == 0 {
+		return fmt.Errorf("identity %d has no labels", id.ID)
+	}
+
+	seen := make(map[string]bool)
+	for _, l := range id.Labels {
+		if !labelPattern.MatchString(l) {
+			return fmt.Errorf("invalid label %q (expected key=value)", l)
+		}
+		if seen[l] {
+			return fmt.Errorf("duplicate label %q", l)
+		}
+		seen[l] = true
+	}
+
+	_, err := ipcacheKeys(id.CIDRs)
+	return err
+}
+
+// ValidateIdentityMatch checks the identities a policy matches. An
+// address may be omitted on a side that matches an identity.
+func ValidateIdentityMatch(p *Policy) error {
+	if p.SrcIP == "" && p.SrcIdentity == 0 {
+		return fmt.Errorf("src_ip or src_identity is required")
+	}
+	if p.DstIP == "" && p.DstIdentity == 0 {
+		return fmt.Errorf("dst_ip or dst_identity is required")
+	}
+	return nil
+}
+
+// policyAddr returns the address a policy matches on one side, any
+// address of either family if it only matches an identity
+func policyAddr(cidr string) string {
+	if cidr == "" {
+		return "::/0"
+	}
+	return cidr
+}
+
+// listedAddr returns the address of a listed wildcard rule side, empty if
+// the side only matches an identity
+func listedAddr(addr, mask [4]uint32, identity uint32) string {
+	if identity != 0 && maskPrefixLen(mask) == 0 {
+		return ""
+	}
+	return formatCIDR(addr, mask)
+}
+
+// normalizeLabels returns a sorted copy of labels
+func normalizeLabels(labels []string) []string {
+	sorted := append([]string(nil), labels...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// ipcacheKey converts an address or CIDR to its ipcache trie key
+func ipcacheKey(cidr string) (lpmKey, error) {
+	ip, mask, err := parseCIDR(cidr)
+	if err != nil {
+		return lpmKey{}, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+	}
+
+	ones, bits := mask.Size()
+	prefixLen := uint32(ones)
+	if bits == 8*net.IPv4len {
+		prefixLen += 96 // IPv4-mapped
+	}
+	return lpmKey{PrefixLen: prefixLen, Addr: maskAddr(ipToKeyAddr(ip), prefixLen)}, nil
+}
+
+// ipcacheKeys converts the CIDRs of an identity to ipcache trie keys
+func ipcacheKeys(cidrs []string) (map[lpmKey]string, error) {
+	keys := make(map[lpmKey]string, len(cidrs))
+	for _, cidr := range cidrs {
+		key, err := ipcacheKey(cidr)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := keys[key]; ok {
+			return nil, fmt.Errorf("CIDR %q duplicates %q", cidr, prev)
+		}
+		keys[key] = cidr
+	}
+	return keys, nil
+}
+
+// identityConflict checks that no other identity has the same label set
+// or any of the same CIDRs
+func identityConflict(identities map[uint32]Identity, id *Identity, keys map[lpmKey]string) error {
+	labels := fmt.Sprint(normalizeLabels(id.Labels))
+
+	for _, other := range identities {
+		if other.ID == id.ID {
+			continue
+		}
+		if fmt.Sprint(other.Labels) == labels {
+			return fmt.Errorf("%w: labels %v belong to identity %d", ErrIdentityConflict, other.Labels, other.ID)
+		}
+
+		otherKeys, err := ipcacheKeys(other.CIDRs)
+		if err != nil {
+			return err
+		}
+		for key, cidr := range keys {
+			if _, ok := otherKeys[key]; ok {
+				return fmt.Errorf("%w: %s belongs to identity %d", ErrIdentityConflict, cidr, other.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// SetIdentity creates or replaces an identity and points its CIDRs at it
+// in the ipcache. Sessions are re-evaluated against the new addresses.
+func (pm *PolicyManager) SetIdentity(id *Identity) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if err := pm.setIdentity(id); err != nil {
+		return err
+	}
+	pm.revalidateSessions()
+
+	log.Infof("Identity set: %d labels=%v cidrs=%v", id.ID, id.Labels, id.CIDRs)
+
+	if pm.storage != nil {
+		if err := pm.storage.SaveIdentity(id); err != nil {
+			log.Warnf("Failed to persist identity %d: %v", id.ID, err)
+		}
+	}
+	return nil
+}
+
+// setIdentity validates an identity and writes it to the ipcache and the
+// registry. The caller holds pm.mu.
+func (pm *PolicyManager) setIdentity(id *Identity) error {
+	if err := ValidateIdentity(id); err != nil {
+		return err
+	}
+	if pm.ipcacheMap == nil {
+		return fmt.Errorf("data plane does not support identities")
+	}
+
+	keys, err := ipcacheKeys(id.CIDRs)
+	if err != nil {
+		return err
+	}
+
+	if err := identityConflict(pm.identities, id, keys); err != nil {
+		return err
+	}
+
+	// Point the new addresses at the identity before dropping the old ones,
+	// so addresses kept across the update never lose it
+	for key := range keys {
+		if err := pm.ipcacheMap.Put(&key, id.ID); err != nil {
+			return fmt.Errorf("failed to add %s to ipcache: %w", keys[key], err)
+		}
+	}
+	if old, ok := pm.identities[id.ID]; ok {
+		oldKeys, err := ipcacheKeys(old.CIDRs)
+		if err != nil {
+			return err
+		}
+		for key, cidr := range oldKeys {
+			if _, kept := keys[key]; kept {
+				continue
+			}
+			if err := pm.deleteIPCacheKey(key); err != nil {
+				return fmt.Errorf("failed to remove %s from ipcache: %w", cidr, err)
+			}
+		}
+	}
+
+	id.Labels = normalizeLabels(id.Labels)
+	pm.identities[id.ID] = Identity{
+		ID:     id.ID,
+		Labels: id.Labels,
+		CIDRs:  append([]string(nil), id.CIDRs...),
+	}
+	return nil
+}
+
+// DeleteIdentity removes an identity and its ipcache entries. Rules
+// matching it stay installed but no longer match any address.
+func (pm *PolicyManager) DeleteIdentity(idNum uint32) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	id, ok := pm.identities[idNum]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrIdentityNotFound, idNum)
+	}
+
+	if err := pm.deleteIdentity(&id); err != nil {
+		return err
+	}
+	pm.revalidateSessions()
+
+	log.Infof("Identity deleted: %d labels=%v", id.ID, id.Labels)
+
+	if pm.storage != nil {
+		if err := pm.storage.DeleteIdentity(idNum); err != nil {
+			log.Warnf("Failed to delete identity %d from storage: %v", idNum, err)
+		}
+	}
+	return nil
+}
+
+// deleteIdentity removes an identity's ipcache entries and drops it from
+// the registry. The caller holds pm.mu.
+func (pm *PolicyManager) deleteIdentity(id *Identity) error {
+	keys, err := ipcacheKeys(id.CIDRs)
+	if err != nil {
+		return err
+	}
+	for key, cidr := range keys {
+		if err := pm.deleteIPCacheKey(key); err != nil {
+			return fmt.Errorf("failed to remove %s from ipcache: %w", cidr, err)
+		}
+	}
+	delete(pm.identities, id.ID)
+	return nil
+}
+
+// recoverIdentities rebuilds the registry from the ipcache, which a
+// pinned map carries over from the previous agent. The ipcache holds no
+// labels: recovered identities have none until they are set again or
+// restored from storage.
+func (pm *PolicyManager) recoverIdentities() {
+	if pm.ipcacheMap == nil {
+		return
+	}
+
+	var (
+		key lpmKey
+		id  uint32
+	)
+	iter := pm.ipcacheMap.Iterate()
+	for iter.Next(&key, &id) {
+		entry := pm.identities[id]
+		entry.ID = id
+		entry.CIDRs = append(entry.CIDRs, formatPrefix(key))
+		pm.identities[id] = entry
+	}
+	if err := iter.Err(); err != nil {
+		log.Warnf("Failed to recover identities from the ipcache: %v", err)
+	}
+
+	for id, entry := range pm.identities {
+		sort.Strings(entry.CIDRs)
+		pm.identities[id] = entry
+	}
+	if len(pm.identities) > 0 {
+		log.Infof("Recovered %d identities from the ipcache", len(pm.identities))
+	}
+}
+
+// deleteIPCacheKey removes one ipcache entry, if present
+func (pm *PolicyManager) deleteIPCacheKey(key lpmKey) error {
+	if err := pm.ipcacheMap.Delete(&key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return err
+	}
+	return nil
+}
+
+// GetIdentity returns one identity
+func (pm *PolicyManager) GetIdentity(idNum uint32) (Identity, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	id, ok := pm.identities[idNum]
+	if !ok {
+		return Identity{}, fmt.Errorf("%w: %d", ErrIdentityNotFound, idNum)
+	}
+	return id, nil
+}
+
+// ListIdentities returns every identity, sorted by ID
+func (pm *PolicyManager) ListIdentities() []Identity {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	result := make([]Identity, 0, len(pm.identities))
+	for _, id := range pm.identities {
+		result = append(result, id)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// identityStore is the subset of hash map operations the identity index
+// needs
+type identityStore interface {
+	lookup(identity uint32) (cidrRuleSet, bool, error)
+	put(identity uint32, set *cidrRuleSet) error
+	delete(identity uint32) error
+}
+
+// mapIdentityStore is an identityStore backed by an eBPF hash map
+type mapIdentityStore struct {
+	m *ebpf.Map
+}
+
+func (s mapIdentityStore) lookup(identity uint32) (cidrRuleSet, bool, error) {
+	var set cidrRuleSet
+	if err := s.m.Lookup(&identity, &set); err != nil {
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			return set, false, nil
+		}
+		return set, false, err
+	}
+	return set, true, nil
+}
+
+func (s mapIdentityStore) put(identity uint32, set *cidrRuleSet) error {
+	return s.m.Put(&identity, set)
+}
+
+func (s mapIdentityStore) delete(identity uint32) error {
+	if err := s.m.Delete(&identity); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return err
+	}
+	return nil
+}
+
+// addToIdentityStore adds slot to the rule set of an identity
+func addToIdentityStore(store identityStore, identity, slot uint32) error {
+	if store == nil {
+		return fmt.Errorf("data plane does not support identities")
+	}
+
+	set, _, err := store.lookup(identity)
+	if err != nil {
+		return err
+	}
+	if set.contains(slot) {
+		return nil
+	}
+	if set.Count >= maxRulesPerPrefix {
+		return fmt.Errorf("too many rules match identity %d (max %d)", identity, maxRulesPerPrefix)
+	}
+
+	set.Slots[set.Count] = slot
+	set.Count++
+	if err := store.put(identity, &set); err != nil {
+		return fmt.Errorf("updating rules of identity %d: %w", identity, err)
+	}
+	return nil
+}
+
+// removeFromIdentityStore removes slot from the rule set of an identity
+// and deletes the set once it is empty
+func removeFromIdentityStore(store identityStore, identity, slot uint32) error {
+	if store == nil {
+		return nil
+	}
+
+	set, ok, err := store.lookup(identity)
+	if err != nil || !ok {
+		return err
+	}
+
+	set.remove(slot)
+	if set.Count == 0 {
+		err = store.delete(identity)
+	} else {
+		err = store.put(identity, &set)
+	}
+	if err != nil {
+		return fmt.Errorf("updating rules of identity %d: %w", identity, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memIdentityStore is an in-memory identityStore
+type memIdentityStore struct {
+	m map[uint32]cidrRuleSet
+}
+
+func newMemIdentityStore() *memIdentityStore {
+	return &memIdentityStore{m: make(map[uint32]cidrRuleSet)}
+}
+
+func (s *memIdentityStore) lookup(identity uint32) (cidrRuleSet, bool, error) {
+	set, ok := s.m[identity]
+	return set, ok, nil
+}
+
+func (s *memIdentityStore) put(identity uint32, set *cidrRuleSet) error {
+	s.m[identity] = *set
+	return nil
+}
+
+func (s *memIdentityStore) delete(identity uint32) error {
+	delete(s.m, identity)
+	return nil
+}
+
+// slots returns the rules indexed under identity
+func (s *memIdentityStore) slots(identity uint32) []uint32 {
+	set := s.m[identity]
+	return append([]uint32(nil), set.Slots[:set.Count]...)
+}
+
+// TestValidateIdentity tests the identities SetIdentity accepts
+func TestValidateIdentity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		identity Identity
+		wantErr  bool
+	}{
+		{name: "labels and cidrs", identity: Identity{ID: 100, Labels: []string{"app=web", "env=prod"}, CIDRs: []string{"10.0.1.0/24", "2001:db8::5"}}},
+		{name: "no cidrs", identity: Identity{ID: 100, Labels: []string{"app=web"}}},
+		{name: "empty value", identity: Identity{ID: 100, Labels: []string{"k8s.io/role="}}},
+		{name: "reserved id", identity: Identity{ID: 0, Labels: []string{"app=web"}}, wantErr: true},
+		{name: "no labels", identity: Identity{ID: 100, CIDRs: []string{"10.0.1.5"}}, wantErr: true},
+		{name: "label without value", identity: Identity{ID: 100, Labels: []string{"web"}}, wantErr: true},
+		{name: "label with comma", identity: Identity{ID: 100, Labels: []string{"app=web,db"}}, wantErr: true},
+		{name: "duplicate label", identity: Identity{ID: 100, Labels: []string{"app=web", "app=web"}}, wantErr: true},
+		{name: "invalid cidr", identity: Identity{ID: 100, Labels: []string{"app=web"}, CIDRs: []string{"10.0.0.0/33"}}, wantErr: true},
+		{name: "duplicate cidr", identity: Identity{ID: 100, Labels: []string{"app=web"}, CIDRs: []string{"10.0.1.5", "10.0.1.5/32"}}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateIdentity(&tc.identity)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestValidateIdentityMatch tests that an identity replaces the address of its side
+func TestValidateIdentityMatch(t *testing.T) {
+	assert.NoError(t, ValidateIdentityMatch(&Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2"}))
+	assert.NoError(t, ValidateIdentityMatch(&Policy{SrcIdentity: 100, DstIdentity: 200}))
+	assert.NoError(t, ValidateIdentityMatch(&Policy{SrcIdentity: 100, DstIP: "10.0.0.2"}))
+	assert.Error(t, ValidateIdentityMatch(&Policy{DstIdentity: 200}))
+	assert.Error(t, ValidateIdentityMatch(&Policy{SrcIP: "10.0.0.1", SrcIdentity: 100}))
+}
+
+// TestIPCacheKey tests the trie keys written for identity CIDRs
+func TestIPCacheKey(t *testing.T) {
+	key, err := ipcacheKey("10.0.1.77/24")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(120), key.PrefixLen)
+	assert.Equal(t, ipToKeyAddr(net.ParseIP("10.0.1.0")), key.Addr)
+
+	key, err = ipcacheKey("10.0.1.5")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(128), key.PrefixLen)
+
+	key, err = ipcacheKey("2001:db8:1::/48")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(48), key.PrefixLen)
+	assert.Equal(t, "2001:db8:1::/48", formatPrefix(key))
+}
+
+// TestIdentityConflict tests that labels and CIDRs belong to one identity
+func TestIdentityConflict(t *testing.T) {
+	identities := map[uint32]Identity{
+		100: {ID: 100, Labels: []string{"app=web", "env=prod"}, CIDRs: []string{"10.0.1.0/24"}},
+	}
+	check := func(id Identity) error {
+		keys, err := ipcacheKeys(id.CIDRs)
+		require.NoError(t, err)
+		return identityConflict(identities, &id, keys)
+	}
+
+	assert.NoError(t, check(Identity{ID: 100, Labels: []string{"env=prod", "app=web"}, CIDRs: []string{"10.0.1.0/24"}}),
+		"an identity does not conflict with itself")
+	assert.NoError(t, check(Identity{ID: 200, Labels: []string{"app=db"}, CIDRs: []string{"10.0.1.5"}}),
+		"a more specific prefix may belong to another identity")
+
+	err := check(Identity{ID: 200, Labels: []string{"env=prod", "app=web"}})
+	assert.True(t, errors.Is(err, ErrIdentityConflict))
+
+	err = check(Identity{ID: 200, Labels: []string{"app=db"}, CIDRs: []string{"10.0.1.9/24"}})
+	assert.True(t, errors.Is(err, ErrIdentityConflict))
+}
+
+// TestCIDRIndex_Identities tests that identity rules are indexed by identity
+func TestCIDRIndex_Identities(t *testing.T) {
+	ci, src, dst := newTestIndex()
+	srcIdentity, dstIdentity := newMemIdentityStore(), newMemIdentityStore()
+	ci.srcIdentity, ci.dstIdentity = srcIdentity, dstIdentity
+
+	both := testWildcard(t, "::/0", "::/0")
+	both.SrcIdentity, both.DstIdentity = 100, 200
+	fromWeb := testWildcard(t, "::/0", "10.0.0.0/8")
+	fromWeb.SrcIdentity = 100
+
+	require.NoError(t, ci.add(both, 1))
+	require.NoError(t, ci.add(fromWeb, 2))
+
+	assert.Equal(t, []uint32{1}, dstIdentity.slots(200))
+	assert.Equal(t, []uint32{2}, srcIdentity.slots(100))
+	assert.Empty(t, dst.m, "identity rules must not be indexed by prefix")
+	assert.Empty(t, src.m)
+
+	require.NoError(t, ci.remove(both, 1))
+	require.NoError(t, ci.remove(fromWeb, 2))
+	assert.Empty(t, dstIdentity.m)
+	assert.Empty(t, srcIdentity.m)
+}
+
+// TestListedAddr tests that identity-only sides list without an address
+func TestListedAddr(t *testing.T) {
+	rule := testWildcard(t, policyAddr(""), "10.0.0.0/8")
+
+	assert.Equal(t, "", listedAddr(rule.SrcIP, rule.SrcIPMask, 100))
+	assert.Equal(t, "::/0", listedAddr(rule.SrcIP, rule.SrcIPMask, 0))
+	assert.Equal(t, "10.0.0.0/8", listedAddr(rule.DstIP, rule.DstIPMask, 200))
+}
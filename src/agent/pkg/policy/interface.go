@@ -5,9 +5,21 @@ package policy
 // This interface is useful for testing and dependency injection.
 type Manager interface {
 	AddPolicy(p *Policy) error
+	UpdatePolicy(p *Policy) error
 	DeletePolicy(p *Policy) error
 	ListPolicies() ([]Policy, error)
 }
 
-// Ensure PolicyManager implements Manager interface
-var _ Manager = (*PolicyManager)(nil)
+// IdentityManager manages security identities and their addresses.
+type IdentityManager interface {
+	SetIdentity(id *Identity) error
+	DeleteIdentity(id uint32) error
+	GetIdentity(id uint32) (Identity, error)
+	ListIdentities() []Identity
+}
+
+// Ensure PolicyManager implements the interfaces above
+var (
+	_ Manager         = (*PolicyManager)(nil)
+	_ IdentityManager = (*PolicyManager)(nil)
+)
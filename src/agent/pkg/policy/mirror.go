@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cilium/ebpf"
+)
+
+// mirrorTarget mirrors struct mirror_target in common_types.h
+type mirrorTarget struct {
+	Ifindex    uint32
+	SampleRate uint32 // One in SampleRate packets, 0 or 1 = every packet
+}
+
+// ValidateMirror checks the mirror target of a policy. The interface must
+// exist when the policy is installed.
+func ValidateMirror(p *Policy) error {
+	if p.Mirror == "" {
+		if p.MirrorSample != 0 {
+			return fmt.Errorf("mirror_sample requires a mirror interface")
+		}
+		return nil
+	}
+
+	if _, err := net.InterfaceByName(p.Mirror); err != nil {
+		return fmt.Errorf("mirror interface %q: %w", p.Mirror, err)
+	}
+	return nil
+}
+
+// buildMirrorTarget resolves the mirror interface of a policy
+func buildMirrorTarget(p *Policy) (*mirrorTarget, error) {
+	iface, err := net.InterfaceByName(p.Mirror)
+	if err != nil {
+		return nil, fmt.Errorf("mirror interface %q: %w", p.Mirror, err)
+	}
+	return &mirrorTarget{Ifindex: uint32(iface.Index), SampleRate: p.MirrorSample}, nil
+}
+
+// setMirror installs or removes the mirror target of a rule. Like the
+// token bucket it is written before the rule's policy entries.
+func (pm *PolicyManager) setMirror(p *Policy) error {
+	if p.Mirror == "" {
+		return pm.deleteMirror(p.RuleID)
+	}
+	if pm.mirrorMap == nil {
+		return fmt.Errorf("data plane does not support mirroring")
+	}
+
+	target, err := buildMirrorTarget(p)
+	if err != nil {
+		return err
+	}
+	if err := pm.mirrorMap.Put(p.RuleID, target); err != nil {
+		return fmt.Errorf("failed to add mirror target to map: %w", err)
+	}
+	return nil
+}
+
+// deleteMirror removes the mirror target of a rule, if it has one
+func (pm *PolicyManager) deleteMirror(ruleID uint32) error {
+	if pm.mirrorMap == nil {
+		return nil
+	}
+	if err := pm.mirrorMap.Delete(ruleID); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("failed to delete mirror target from map: %w", err)
+	}
+	return nil
+}
+
+// setMirrorFields fills the mirror fields of a listed policy from its
+// installed target. A target whose interface was removed is left out.
+func (pm *PolicyManager) setMirrorFields(p *Policy) {
+	if pm.mirrorMap == nil {
+		return
+	}
+
+	var target mirrorTarget
+	if err := pm.mirrorMap.Lookup(p.RuleID, &target); err != nil {
+		return
+	}
+	iface, err := net.InterfaceByIndex(int(target.Ifindex))
+	if err != nil {
+		return
+	}
+	p.Mirror = iface.Name
+	p.MirrorSample = target.SampleRate
+}
+
+// installedMirror returns the mirror target of a rule, nil if it has none
+func (pm *PolicyManager) installedMirror(ruleID uint32) *mirrorTarget {
+	if pm.mirrorMap == nil {
+		return nil
+	}
+
+	var target mirrorTarget
+	if err := pm.mirrorMap.Lookup(ruleID, &target); err != nil {
+		return nil
+	}
+	return &target
+}
+
+// restoreMirror writes back the mirror target a rule had before a failed
+// update, or removes it if it had none
+func (pm *PolicyManager) restoreMirror(ruleID uint32, target *mirrorTarget) error {
+	if target == nil {
+		return pm.deleteMirror(ruleID)
+	}
+	if err := pm.mirrorMap.Put(ruleID, target); err != nil {
+		return fmt.Errorf("failed to restore mirror target: %w", err)
+	}
+	return nil
+}
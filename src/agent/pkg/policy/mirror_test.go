@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateMirror tests the mirror targets a policy accepts
+func TestValidateMirror(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "no mirror", policy: Policy{Action: "allow"}},
+		{name: "every packet", policy: Policy{Action: "allow", Mirror: "lo"}},
+		{name: "sampled", policy: Policy{Action: "deny", Mirror: "lo", MirrorSample: 100}},
+		{name: "unknown interface", policy: Policy{Action: "allow", Mirror: "nonexistent0"}, wantErr: true},
+		{name: "sample without mirror", policy: Policy{Action: "allow", MirrorSample: 10}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateMirror(&tc.policy)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestBuildMirrorTarget tests the target written for a mirrored policy
+func TestBuildMirrorTarget(t *testing.T) {
+	target, err := buildMirrorTarget(&Policy{Mirror: "lo", MirrorSample: 20})
+	require.NoError(t, err)
+	assert.NotZero(t, target.Ifindex)
+	assert.Equal(t, uint32(20), target.SampleRate)
+
+	_, err = buildMirrorTarget(&Policy{Mirror: "nonexistent0"})
+	assert.Error(t, err)
+}
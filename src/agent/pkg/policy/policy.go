@@ -3,9 +3,11 @@ package policy
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 
 	"github.com/cilium/ebpf"
 	log "github.com/sirupsen/logrus"
@@ -13,53 +15,249 @@ import (
 
 // Policy represents a network policy rule
 type Policy struct {
-	RuleID   uint32
-	SrcIP    string // CIDR notation
-	DstIP    string // CIDR notation
-	SrcPort  uint16
-	DstPort  uint16
-	Protocol string // "tcp", "udp", "icmp", "any"
-	Action   string // "allow", "deny", "log"
-	Priority uint16
+	RuleID    uint32
+	SrcIP     string // CIDR notation
+	DstIP     string // CIDR notation
+	SrcPort   uint16 // Single port, 0 = any
+	DstPort   uint16
+	Protocol  string // "tcp", "udp", "icmp", "icmpv6", "any"
+	Action    string // "allow", "deny", "log", "rate_limit", "reject"
+	Priority  uint16
+	Direction string // "ingress", "egress", "both" (empty = both)
+
+	// Additional ports, matched together with SrcPort/DstPort
+	SrcPorts     []uint16 // Port list
+	DstPorts     []uint16
+	SrcPortRange string // Inclusive ranges, e.g. "30000-32767" or "8000-8080,9000-9100"
+	DstPortRange string
+
+	// Monitor reports packets denied by this rule without dropping them
+	Monitor bool
+
+	// ICMP message type and code of icmp/icmpv6 policies, nil = any
+	IcmpType *uint8
+	IcmpCode *uint8 // Requires IcmpType
+
+	// Connection states to match ("new", "established", "related",
+	// "invalid"), empty = any
+	ConnStates []string
+
+	// Outer VLAN ID and VXLAN/Geneve VNI to match, 0 = any
+	VlanID uint16
+	VNI    uint32
+
+	// Token bucket of "rate_limit" policies: Rate tokens per second up to
+	// Burst (0 = Rate). Traffic beyond it is dropped.
+	Rate     uint64
+	Burst    uint64
+	RateUnit string // "packets" (default), "bytes" or "connections"
+
+	// SessionLimit caps the active sessions each source may open through
+	// this rule, 0 = the global source session limit
+	SessionLimit uint32
+
+	// Mirror sends a copy of the rule's packets out of this interface
+	// while the action still applies; MirrorSample copies one packet in N
+	// (0 = every packet)
+	Mirror       string
+	MirrorSample uint32
+
+	// Security identities to match, 0 = any. SrcIP/DstIP may be left
+	// empty on a side that matches an identity.
+	SrcIdentity uint32
+	DstIdentity uint32
+}
+
+// policyKey mirrors struct policy_key in common_types.h
+type policyKey struct {
+	SrcIP     [4]uint32
+	DstIP     [4]uint32
+	SrcPort   uint16
+	DstPort   uint16
+	Protocol  uint8
+	Direction uint8 // Traffic direction (0 = ingress, 1 = egress)
+	Pad       [2]uint8
+}
+
+// policyValue mirrors struct policy_value in common_types.h
+type policyValue struct {
+	Action       uint8
+	LogEnabled   uint8
+	Priority     uint16
+	RuleID       uint32
+	HitCount     uint64
+	Monitor      uint8 // Non-zero: report denies instead of dropping
+	Pad          [3]uint8
+	SessionLimit uint32 // Active sessions per source, 0 = global limit
+}
+
+// wildcardPolicy mirrors struct wildcard_policy in common_types.h
+type wildcardPolicy struct {
+	SrcIP        [4]uint32
+	SrcIPMask    [4]uint32
+	DstIP        [4]uint32
+	DstIPMask    [4]uint32
+	SrcPortLo    uint16 // Port ranges in host byte order, hi = 0 means any
+	SrcPortHi    uint16
+	DstPortLo    uint16
+	DstPortHi    uint16
+	Protocol     uint8
+	Action       uint8
+	LogEnabled   uint8
+	Direction    uint8 // Direction mask (0 = both)
+	Priority     uint16
+	Monitor      uint8
+	IcmpMatch    uint8 // ICMP_MATCH_* flags
+	RuleID       uint32
+	IcmpType     uint8
+	IcmpCode     uint8
+	ConnStates   uint8 // Bit 1<<conn_state, 0 = any
+	Pad2         uint8
+	VlanID       uint16 // 0 = any
+	Pad3         uint16
+	VNI          uint32 // 0 = any
+	SessionLimit uint32 // 0 = global limit
+	SrcIdentity  uint32 // 0 = any
+	DstIdentity  uint32
 }
 
 // PolicyManager manages network policies
 type PolicyManager struct {
+	dataPlane         DataPlaneInterface
 	policyMap         *ebpf.Map
 	wildcardPolicyMap *ebpf.Map
+	rateLimitMap      *ebpf.Map
+	mirrorMap         *ebpf.Map
+	ipcacheMap        *ebpf.Map
+	cidr              *cidrIndex
 	storage           Storage
+
+	// mu serializes every change to the maps and the identity registry;
+	// the CIDR index and rule updates read, modify and write several
+	// entries at once
+	mu         sync.Mutex
+	identities map[uint32]Identity
 }
 
 // DataPlaneInterface defines the interface for data plane operations
 type DataPlaneInterface interface {
 	GetPolicyMap() *ebpf.Map
 	GetWildcardPolicyMap() *ebpf.Map
+	GetSrcCIDRMap() *ebpf.Map
+	GetDstCIDRMap() *ebpf.Map
+	GetIPCacheMap() *ebpf.Map
+	GetSrcIdentityMap() *ebpf.Map
+	GetDstIdentityMap() *ebpf.Map
+	GetRateLimitMap() *ebpf.Map
+	GetMirrorMap() *ebpf.Map
+
+	// BumpPolicyGeneration makes existing sessions re-evaluate their
+	// cached decision against the current policies
+	BumpPolicyGeneration() error
 }
 
+// ruleHitsResetter is implemented by data planes that count hits per rule
+type ruleHitsResetter interface {
+	ResetRuleHits(ruleID uint32) error
+}
+
+// ingressHookReporter is implemented by data planes that report which
+// programs enforce ingress policy
+type ingressHookReporter interface {
+	IngressHooks() (xdp, tc bool)
+}
+
+// ErrUnsupportedRule is returned for a policy the attached hooks can't
+// enforce
+var ErrUnsupportedRule = errors.New("policy not supported by the attached hooks")
+
+// ErrPolicyExists is returned when adding a policy whose rule ID is
+// already installed
+var ErrPolicyExists = errors.New("policy already exists")
+
 // NewManager creates a new policy manager without persistence
 func NewManager(dp DataPlaneInterface) *PolicyManager {
-	return &PolicyManager{
-		policyMap:         dp.GetPolicyMap(),
-		wildcardPolicyMap: dp.GetWildcardPolicyMap(),
-		storage:           nil,
-	}
+	return NewManagerWithStorage(dp, nil)
 }
 
 // NewManagerWithStorage creates a new policy manager with persistence
 func NewManagerWithStorage(dp DataPlaneInterface, storage Storage) *PolicyManager {
-	return &PolicyManager{
+	pm := &PolicyManager{
+		dataPlane:         dp,
 		policyMap:         dp.GetPolicyMap(),
 		wildcardPolicyMap: dp.GetWildcardPolicyMap(),
-		storage:           storage,
+		rateLimitMap:      dp.GetRateLimitMap(),
+		mirrorMap:         dp.GetMirrorMap(),
+		ipcacheMap:        dp.GetIPCacheMap(),
+		cidr: &cidrIndex{
+			src:         mapPrefixStore{dp.GetSrcCIDRMap()},
+			dst:         mapPrefixStore{dp.GetDstCIDRMap()},
+			srcIdentity: mapIdentityStore{dp.GetSrcIdentityMap()},
+			dstIdentity: mapIdentityStore{dp.GetDstIdentityMap()},
+		},
+		storage:    storage,
+		identities: make(map[uint32]Identity),
+	}
+
+	// Identities survive a restart in a pinned ipcache
+	pm.recoverIdentities()
+	return pm
+}
+
+// revalidateSessions asks the data plane to re-evaluate cached session
+// decisions after the policy set changed
+func (pm *PolicyManager) revalidateSessions() {
+	if err := pm.dataPlane.BumpPolicyGeneration(); err != nil {
+		log.Warnf("Failed to revalidate sessions after policy change: %v", err)
 	}
 }
 
-// LoadPersisted loads policies from persistent storage and applies them to eBPF map
+// LoadPersisted loads identities and policies from persistent storage and
+// applies them to the eBPF maps
 func (pm *PolicyManager) LoadPersisted() error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
 	if pm.storage == nil {
 		return fmt.Errorf("no storage configured")
 	}
 
+	identities, err := pm.storage.LoadIdentities()
+	if err != nil {
+		return fmt.Errorf("failed to load identities from storage: %w", err)
+	}
+
+	// Fill the ipcache first, so identity rules match as soon as they are
+	// installed; a pinned ipcache already holds the same entries
+	restored := 0
+	for i := range identities {
+		if err := pm.setIdentity(&identities[i]); err != nil {
+			log.Warnf("Failed to restore identity %d: %v", identities[i].ID, err)
+			continue
+		}
+		restored++
+	}
+	log.Infof("Restored %d/%d identities from storage", restored, len(identities))
+
+	// Storage is authoritative: identities recovered from the ipcache that
+	// it does not hold are stale
+	removed := 0
+	stored := make(map[uint32]bool, len(identities))
+	for i := range identities {
+		stored[identities[i].ID] = true
+	}
+	for idNum, id := range pm.identities {
+		if stored[idNum] {
+			continue
+		}
+		if err := pm.deleteIdentity(&id); err != nil {
+			log.Warnf("Failed to remove stale identity %d: %v", idNum, err)
+			continue
+		}
+		log.Infof("Removed stale identity %d from the ipcache", idNum)
+		removed++
+	}
+
 	policies, err := pm.storage.LoadPolicies()
 	if err != nil {
 		return fmt.Errorf("failed to load policies from storage: %w", err)
@@ -74,17 +272,47 @@ func (pm *PolicyManager) LoadPersisted() error {
 		}
 		successCount++
 	}
+	if successCount > 0 || restored > 0 || removed > 0 {
+		pm.revalidateSessions()
+	}
 
 	log.Infof("Restored %d/%d policies from storage", successCount, len(policies))
 	return nil
 }
 
-// AddPolicy adds a new policy rule
+// AddPolicy adds a new policy rule. A rule ID that is already installed
+// returns ErrPolicyExists; UpdatePolicy replaces it.
 func (pm *PolicyManager) AddPolicy(p *Policy) error {
+	return pm.savePolicy(p, false)
+}
+
+// UpdatePolicy installs a policy in place of the rule with the same ID,
+// or adds it if there is none
+func (pm *PolicyManager) UpdatePolicy(p *Policy) error {
+	return pm.savePolicy(p, true)
+}
+
+// savePolicy installs and persists a policy, replacing an installed rule
+// with the same ID only if replace is set
+func (pm *PolicyManager) savePolicy(p *Policy, replace bool) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if !replace {
+		installed, err := pm.installedEntries(p.RuleID)
+		if err != nil {
+			return err
+		}
+		if !installed.empty() {
+			return fmt.Errorf("%w: rule_id=%d", ErrPolicyExists, p.RuleID)
+		}
+	}
+
 	// Add to eBPF map
 	if err := pm.addPolicyToMap(p); err != nil {
 		return err
 	}
+	pm.revalidateSessions()
 
 	// Save to persistent storage if configured
 	if pm.storage != nil {
@@ -99,144 +327,279 @@ func (pm *PolicyManager) AddPolicy(p *Policy) error {
 
 // hasWildcard checks if a policy contains wildcard fields (0 = any)
 func hasWildcard(p *Policy) bool {
-	// Check for wildcard source port (0 = any)
-	if p.SrcPort == 0 {
+	// Check for CIDR prefixes (including 0.0.0.0/0 and ::/0)
+	if isCIDRPrefix(p.SrcIP) || isCIDRPrefix(p.DstIP) {
 		return true
 	}
-	// Check for wildcard CIDR (0.0.0.0/0 or ::/0)
-	if p.SrcIP == "0.0.0.0/0" || p.SrcIP == "::/0" {
+	// Check for wildcard protocol
+	if strings.ToLower(p.Protocol) == "any" {
 		return true
 	}
-	if p.DstIP == "0.0.0.0/0" || p.DstIP == "::/0" {
+	// ICMP type and code are only matched by wildcard rules (the exact
+	// map can't express "any type")
+	if isICMP(p.Protocol) {
 		return true
 	}
-	// Check for wildcard protocol
-	if strings.ToLower(p.Protocol) == "any" {
+	// So are connection states, VLAN IDs, VNIs and identities
+	if len(p.ConnStates) > 0 || p.VlanID != 0 || p.VNI != 0 {
 		return true
 	}
-	return false
+	if p.SrcIdentity != 0 || p.DstIdentity != 0 {
+		return true
+	}
+	// Check for wildcard source port (0 = any) and port ranges; port
+	// lists alone can still be expanded into exact entries
+	src, dst, err := policyPorts(p)
+	if err != nil {
+		return true
+	}
+	return !exactPorts(src, false) || !exactPorts(dst, true)
 }
 
-// addPolicyToMap adds a policy to the eBPF map (internal method)
-// Routes to exact match map or wildcard map based on policy content
-func (pm *PolicyManager) addPolicyToMap(p *Policy) error {
-	// Check if this policy has wildcards
-	if hasWildcard(p) {
-		return pm.addWildcardPolicy(p)
+// Validate checks the fields of a policy that the API request binding
+// can't: ports, ICMP match, connection states, VLAN ID and VNI, rate limit,
+// mirror target, addresses versus identities, and address families
+func Validate(p *Policy) error {
+	validators := []func(*Policy) error{
+		ValidatePorts,
+		ValidateICMP,
+		ValidateConnStates,
+		ValidateEncap,
+		ValidateRateLimit,
+		ValidateMirror,
+		ValidateIdentityMatch,
+		ValidateAddressFamily,
 	}
-	return pm.addExactPolicy(p)
+	for _, validate := range validators {
+		if err := validate(p); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// addExactPolicy adds an exact-match policy to the hash map
-func (pm *PolicyManager) addExactPolicy(p *Policy) error {
-	// Parse source IP
-	srcIP, srcMask, err := parseCIDR(p.SrcIP)
+// ValidateAddressFamily checks that the source and destination of a policy
+// are of the same address family; a packet can never match both an IPv4
+// and an IPv6 address. ::/0 and an empty side match either family.
+func ValidateAddressFamily(p *Policy) error {
+	src, dst := addrFamily(p.SrcIP), addrFamily(p.DstIP)
+	if src != 0 && dst != 0 && src != dst {
+		return fmt.Errorf("src_ip %s and dst_ip %s are of different address families",
+			p.SrcIP, p.DstIP)
+	}
+	return nil
+}
+
+// checkIngressHooks rejects policies the ingress hooks can't enforce. XDP
+// only sees VLAN tags left in the packet data, not those the NIC stripped,
+// and can't copy packets: without the TC ingress program, the ingress
+// packets of mirrored flows would not be copied. Flows of either direction
+// have ingress packets, the replies of egress flows included.
+func checkIngressHooks(p *Policy, xdp, tc bool) error {
+	if !xdp {
+		return nil
+	}
+	if p.Mirror != "" && !tc {
+		return fmt.Errorf("%w: mirror needs the tc ingress hook, use the xdp+tc or tc hook mode",
+			ErrUnsupportedRule)
+	}
+
+	dirMask, err := parseDirection(p.Direction)
 	if err != nil {
-		return fmt.Errorf("invalid source IP: %w", err)
+		return err
+	}
+	if dirMask&dirIngress == 0 {
+		return nil
 	}
 
-	// Parse destination IP
-	dstIP, dstMask, err := parseCIDR(p.DstIP)
+	if p.VlanID != 0 {
+		return fmt.Errorf("%w: vlan_id can't be matched on ingress with the XDP hook, limit the policy to egress or use the tc hook",
+			ErrUnsupportedRule)
+	}
+	return nil
+}
+
+// addrFamily returns 4 or 6 for the addresses a policy side matches
+// (IPv4-mapped IPv6 addresses count as IPv4), or 0 for any family or an
+// address that does not parse
+func addrFamily(cidr string) int {
+	if cidr == "" {
+		return 0
+	}
+	ip, mask, err := parseCIDR(cidr)
 	if err != nil {
-		return fmt.Errorf("invalid destination IP: %w", err)
+		return 0
+	}
+	if ones, bits := mask.Size(); ones == 0 && bits == 8*net.IPv6len {
+		return 0
+	}
+	if ip.To4() != nil {
+		return 4
 	}
+	return 6
+}
 
-	// Parse protocol
-	proto, err := parseProtocol(p.Protocol)
+// addPolicyToMap adds a policy to the eBPF map (internal method)
+// Routes to exact match map or wildcard map based on policy content.
+// The caller holds pm.mu.
+func (pm *PolicyManager) addPolicyToMap(p *Policy) error {
+	if err := Validate(p); err != nil {
+		return err
+	}
+	if hooks, ok := pm.dataPlane.(ingressHookReporter); ok {
+		xdp, tc := hooks.IngressHooks()
+		if err := checkIngressHooks(p, xdp, tc); err != nil {
+			return err
+		}
+	}
+
+	// Replace whatever is currently installed for this rule ID, which may
+	// live in the other map if the policy switched between exact and
+	// wildcard. The old entries keep enforcing until the new ones are in,
+	// so a failed update leaves the previous rule in place.
+	old, err := pm.installedEntries(p.RuleID)
 	if err != nil {
-		return fmt.Errorf("invalid protocol: %w", err)
+		return err
 	}
 
+	added, err := pm.installPolicy(p)
+	if err != nil {
+		if rerr := pm.restoreEntries(old, added); rerr != nil {
+			log.Warnf("Failed to restore rule_id=%d after a failed update: %v", p.RuleID, rerr)
+		}
+		return err
+	}
+	return pm.removeStaleEntries(old, added)
+}
+
+// installPolicy writes the rate limit, mirror target and map entries of a
+// policy. It returns the entries added, even on error, so they can be
+// rolled back.
+func (pm *PolicyManager) installPolicy(p *Policy) (*ruleEntries, error) {
+	added := &ruleEntries{ruleID: p.RuleID, exact: make(map[policyKey]policyValue)}
+
+	if err := pm.setRateLimit(p); err != nil {
+		return added, err
+	}
+	if err := pm.setMirror(p); err != nil {
+		return added, err
+	}
+
+	// Check if this policy has wildcards
+	if hasWildcard(p) {
+		return added, pm.addWildcardPolicy(p, added)
+	}
+	return added, pm.addExactPolicy(p, added)
+}
+
+// addExactPolicy adds an exact-match policy to the hash map, one entry per
+// direction and port combination, recording the keys written in added
+func (pm *PolicyManager) addExactPolicy(p *Policy, added *ruleEntries) error {
 	// Parse action
 	action, err := parseAction(p.Action)
 	if err != nil {
 		return fmt.Errorf("invalid action: %w", err)
 	}
 
+	// Parse direction
+	dirMask, err := parseDirection(p.Direction)
+	if err != nil {
+		return fmt.Errorf("invalid direction: %w", err)
+	}
+
+	srcPorts, dstPorts, err := policyPorts(p)
+	if err != nil {
+		return err
+	}
+
 	// Build policy key
-	key := struct {
-		SrcIp    uint32
-		DstIp    uint32
-		SrcPort  uint16
-		DstPort  uint16
-		Protocol uint8
-		Pad      [3]uint8
-	}{
-		SrcIp:    ipToUint32(srcIP),
-		DstIp:    ipToUint32(dstIP),
-		SrcPort:  htons(p.SrcPort),
-		DstPort:  htons(p.DstPort),
-		Protocol: proto,
+	key, err := buildPolicyKey(p)
+	if err != nil {
+		return err
 	}
 
 	// Build policy value
-	value := struct {
-		Action     uint8
-		LogEnabled uint8
-		Priority   uint16
-		RuleID     uint32
-		HitCount   uint64
-	}{
-		Action:     action,
-		LogEnabled: boolToUint8(p.Action == "log"),
-		Priority:   p.Priority,
-		RuleID:     p.RuleID,
-		HitCount:   0,
+	value := policyValue{
+		Action:       action,
+		LogEnabled:   boolToUint8(p.Action == "log"),
+		Priority:     p.Priority,
+		RuleID:       p.RuleID,
+		HitCount:     0,
+		Monitor:      boolToUint8(p.Monitor),
+		SessionLimit: p.SessionLimit,
 	}
 
-	// Insert into eBPF map
-	if err := pm.policyMap.Put(&key, &value); err != nil {
-		return fmt.Errorf("failed to add policy to map: %w", err)
+	// Insert into eBPF map, once per direction and port combination
+	for _, dir := range maskDirections(dirMask) {
+		for _, sp := range srcPorts {
+			for _, dp := range dstPorts {
+				key.Direction = dir
+				key.SrcPort = htons(sp.Lo)
+				key.DstPort = htons(dp.Lo)
+				if err := pm.policyMap.Put(key, &value); err != nil {
+					return fmt.Errorf("failed to add policy to map: %w", err)
+				}
+				added.exact[*key] = value
+			}
+		}
 	}
 
-	log.Infof("Policy added: rule_id=%d %s:%d -> %s:%d proto=%s action=%s",
-		p.RuleID, p.SrcIP, p.SrcPort, p.DstIP, p.DstPort, p.Protocol, p.Action)
-
-	// Note: For CIDR matching, we need to implement LPM trie
-	// For now, we only support exact IP matching
-	_ = srcMask
-	_ = dstMask
+	log.Infof("Policy added: rule_id=%d %s:%s -> %s:%s proto=%s action=%s direction=%s",
+		p.RuleID, p.SrcIP, formatPortRanges(srcPorts), p.DstIP, formatPortRanges(dstPorts),
+		p.Protocol, p.Action, directionToString(dirMask))
 
 	return nil
 }
 
-// DeletePolicy removes a policy rule based on its 5-tuple
-func (pm *PolicyManager) DeletePolicy(p *Policy) error {
-	// Parse IPs and protocol
+// buildPolicyKey converts a policy's 5-tuple into an exact-match map key
+func buildPolicyKey(p *Policy) (*policyKey, error) {
+	// Parse source IP
 	srcIP, _, err := parseCIDR(p.SrcIP)
 	if err != nil {
-		return fmt.Errorf("invalid source IP: %w", err)
+		return nil, fmt.Errorf("invalid source IP: %w", err)
 	}
 
+	// Parse destination IP
 	dstIP, _, err := parseCIDR(p.DstIP)
 	if err != nil {
-		return fmt.Errorf("invalid destination IP: %w", err)
+		return nil, fmt.Errorf("invalid destination IP: %w", err)
 	}
 
+	// Parse protocol
 	proto, err := parseProtocol(p.Protocol)
 	if err != nil {
-		return fmt.Errorf("invalid protocol: %w", err)
+		return nil, fmt.Errorf("invalid protocol: %w", err)
 	}
 
-	// Build policy key
-	key := struct {
-		SrcIp    uint32
-		DstIp    uint32
-		SrcPort  uint16
-		DstPort  uint16
-		Protocol uint8
-		Pad      [3]uint8
-	}{
-		SrcIp:    ipToUint32(srcIP),
-		DstIp:    ipToUint32(dstIP),
+	return &policyKey{
+		SrcIP:    ipToKeyAddr(srcIP),
+		DstIP:    ipToKeyAddr(dstIP),
 		SrcPort:  htons(p.SrcPort),
 		DstPort:  htons(p.DstPort),
 		Protocol: proto,
+	}, nil
+}
+
+// DeletePolicy removes a policy rule and every map entry installed for it
+func (pm *PolicyManager) DeletePolicy(p *Policy) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	removed, err := pm.removeRuleEntries(p.RuleID)
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("policy not found: rule_id=%d", p.RuleID)
 	}
 
-	// Delete from eBPF map
-	if err := pm.policyMap.Delete(&key); err != nil {
-		return fmt.Errorf("failed to delete policy from map: %w", err)
+	pm.revalidateSessions()
+
+	// Drop the rule's hit counter so a reused rule ID starts from zero
+	if rh, ok := pm.dataPlane.(ruleHitsResetter); ok {
+		if err := rh.ResetRuleHits(p.RuleID); err != nil {
+			log.Warnf("Failed to reset hit counter of rule_id=%d: %v", p.RuleID, err)
+		}
 	}
 
 	log.Infof("Policy deleted: rule_id=%d %s:%d -> %s:%d proto=%s",
@@ -253,56 +616,268 @@ func (pm *PolicyManager) DeletePolicy(p *Policy) error {
 	return nil
 }
 
-// ListPolicies lists all active policies
-func (pm *PolicyManager) ListPolicies() ([]Policy, error) {
-	var policies []Policy
+// removeRuleEntries deletes all exact and wildcard entries of a rule ID
+// and returns how many were removed
+func (pm *PolicyManager) removeRuleEntries(ruleID uint32) (int, error) {
+	exact, err := pm.deleteExactEntries(ruleID)
+	if err != nil {
+		return 0, err
+	}
 
-	// Iterate through eBPF policy map
-	var key struct {
-		SrcIp    uint32
-		DstIp    uint32
-		SrcPort  uint16
-		DstPort  uint16
-		Protocol uint8
-		Pad      [3]uint8
+	wildcard, err := pm.deleteWildcardSlots(ruleID)
+	if err != nil {
+		return exact, err
 	}
 
-	var value struct {
-		Action     uint8
-		LogEnabled uint8
-		Priority   uint16
-		RuleID     uint32
-		HitCount   uint64
+	if err := pm.deleteRateLimit(ruleID); err != nil {
+		return exact + wildcard, err
 	}
+	if err := pm.deleteMirror(ruleID); err != nil {
+		return exact + wildcard, err
+	}
+
+	return exact + wildcard, nil
+}
 
+// ruleEntries are the map entries installed for one rule ID
+type ruleEntries struct {
+	ruleID    uint32
+	exact     map[policyKey]policyValue
+	slots     []uint32      // Wildcard slots
+	rateLimit *rateLimit    // nil = no token bucket
+	mirror    *mirrorTarget // nil = not mirrored
+}
+
+// empty reports whether a rule has no policy map entries
+func (e *ruleEntries) empty() bool {
+	return len(e.exact) == 0 && len(e.slots) == 0
+}
+
+// installedEntries collects the map entries currently installed for a rule ID
+func (pm *PolicyManager) installedEntries(ruleID uint32) (*ruleEntries, error) {
+	entries := &ruleEntries{ruleID: ruleID, exact: make(map[policyKey]policyValue)}
+
+	var (
+		key   policyKey
+		value policyValue
+	)
+	iter := pm.policyMap.Iterate()
+	for iter.Next(&key, &value) {
+		if value.RuleID == ruleID {
+			entries.exact[key] = value
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate policies: %w", err)
+	}
+
+	for i := uint32(0); i < maxWildcardPolicies; i++ {
+		var existing wildcardPolicy
+		if err := pm.wildcardPolicyMap.Lookup(&i, &existing); err == nil && existing.RuleID == ruleID {
+			entries.slots = append(entries.slots, i)
+		}
+	}
+
+	entries.rateLimit = pm.installedRateLimit(ruleID)
+	entries.mirror = pm.installedMirror(ruleID)
+	return entries, nil
+}
+
+// restoreEntries undoes a partially installed update: the entries added
+// are removed and the old entries they overwrote are written back
+func (pm *PolicyManager) restoreEntries(old, added *ruleEntries) error {
+	var errs []error
+
+	for key := range added.exact {
+		if value, ok := old.exact[key]; ok {
+			errs = append(errs, pm.policyMap.Put(&key, &value))
+		} else if err := pm.policyMap.Delete(&key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	for _, slot := range added.slots {
+		errs = append(errs, pm.clearWildcardSlot(slot))
+	}
+	errs = append(errs,
+		pm.restoreRateLimit(old.ruleID, old.rateLimit),
+		pm.restoreMirror(old.ruleID, old.mirror))
+
+	return errors.Join(errs...)
+}
+
+// removeStaleEntries removes the old entries of a rule that the update
+// did not overwrite
+func (pm *PolicyManager) removeStaleEntries(old, added *ruleEntries) error {
+	for key := range old.exact {
+		if _, kept := added.exact[key]; kept {
+			continue
+		}
+		if err := pm.policyMap.Delete(&key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("failed to delete policy from map: %w", err)
+		}
+	}
+	for _, slot := range old.slots {
+		if err := pm.clearWildcardSlot(slot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteExactEntries deletes the exact-match entries of a rule ID
+func (pm *PolicyManager) deleteExactEntries(ruleID uint32) (int, error) {
+	var (
+		key   policyKey
+		value policyValue
+		keys  []policyKey
+	)
+
+	// Collect first; deleting while iterating a hash map can restart the walk
 	iter := pm.policyMap.Iterate()
 	for iter.Next(&key, &value) {
-		// Convert back to Policy struct
-		policy := Policy{
-			RuleID:   value.RuleID,
-			SrcIP:    uint32ToIP(key.SrcIp),
-			DstIP:    uint32ToIP(key.DstIp),
-			SrcPort:  ntohs(key.SrcPort),
-			DstPort:  ntohs(key.DstPort),
-			Protocol: protoToString(key.Protocol),
-			Action:   actionToString(value.Action),
-			Priority: value.Priority,
+		if value.RuleID == ruleID {
+			keys = append(keys, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate policies: %w", err)
+	}
+
+	for i := range keys {
+		if err := pm.policyMap.Delete(&keys[i]); err != nil {
+			return i, fmt.Errorf("failed to delete policy from map: %w", err)
+		}
+	}
+
+	return len(keys), nil
+}
+
+// ListPolicies lists all active policies
+func (pm *PolicyManager) ListPolicies() ([]Policy, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var policies []*policyEntries
+	byRule := make(map[uint32]*policyEntries)
+
+	// entriesFor returns the aggregate for a rule, creating it on first use
+	entriesFor := func(ruleID uint32, base Policy) *policyEntries {
+		if e, ok := byRule[ruleID]; ok {
+			return e
 		}
-		policies = append(policies, policy)
+		e := &policyEntries{policy: base}
+		byRule[ruleID] = e
+		policies = append(policies, e)
+		return e
+	}
+
+	// Iterate through eBPF policy map
+	var key policyKey
+	var value policyValue
+
+	// Policies have one entry per direction and port combination
+	iter := pm.policyMap.Iterate()
+	for iter.Next(&key, &value) {
+		e := entriesFor(value.RuleID, Policy{
+			RuleID:       value.RuleID,
+			SrcIP:        keyAddrToIP(key.SrcIP).String(),
+			DstIP:        keyAddrToIP(key.DstIP).String(),
+			Protocol:     protoToString(key.Protocol),
+			Action:       actionToString(value.Action),
+			Priority:     value.Priority,
+			Monitor:      value.Monitor != 0,
+			SessionLimit: value.SessionLimit,
+		})
+		e.dirs |= 1 << key.Direction
+		e.addPorts(portRange{Lo: ntohs(key.SrcPort), Hi: ntohs(key.SrcPort)},
+			portRange{Lo: ntohs(key.DstPort), Hi: ntohs(key.DstPort)})
 	}
 
 	if err := iter.Err(); err != nil {
 		return nil, fmt.Errorf("failed to iterate policies: %w", err)
 	}
 
-	return policies, nil
+	// Iterate through occupied wildcard slots
+	var slot uint32
+	var wildcard wildcardPolicy
+
+	witer := pm.wildcardPolicyMap.Iterate()
+	for witer.Next(&slot, &wildcard) {
+		if wildcard.RuleID == 0 {
+			continue
+		}
+
+		e := entriesFor(wildcard.RuleID, Policy{
+			RuleID:       wildcard.RuleID,
+			SrcIP:        listedAddr(wildcard.SrcIP, wildcard.SrcIPMask, wildcard.SrcIdentity),
+			DstIP:        listedAddr(wildcard.DstIP, wildcard.DstIPMask, wildcard.DstIdentity),
+			Protocol:     protoToString(wildcard.Protocol),
+			Action:       actionToString(wildcard.Action),
+			Priority:     wildcard.Priority,
+			Monitor:      wildcard.Monitor != 0,
+			VlanID:       wildcard.VlanID,
+			VNI:          wildcard.VNI,
+			SessionLimit: wildcard.SessionLimit,
+			SrcIdentity:  wildcard.SrcIdentity,
+			DstIdentity:  wildcard.DstIdentity,
+		})
+		setICMPFields(&e.policy, wildcard.IcmpMatch, wildcard.IcmpType, wildcard.IcmpCode)
+		e.policy.ConnStates = connStateNamesFromMask(wildcard.ConnStates)
+		e.dirs |= wildcard.Direction
+		if wildcard.Direction == 0 {
+			e.dirs |= dirBoth
+		}
+		e.addPorts(portRange{Lo: wildcard.SrcPortLo, Hi: wildcard.SrcPortHi},
+			portRange{Lo: wildcard.DstPortLo, Hi: wildcard.DstPortHi})
+	}
+
+	if err := witer.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate wildcard policies: %w", err)
+	}
+
+	result := make([]Policy, 0, len(policies))
+	for _, e := range policies {
+		p := e.build()
+		pm.setRateLimitFields(&p)
+		pm.setMirrorFields(&p)
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// policyEntries aggregates the map entries installed for one rule ID
+type policyEntries struct {
+	policy   Policy
+	dirs     uint8
+	src, dst []portRange
+}
+
+// addPorts records the port ranges of one entry
+func (e *policyEntries) addPorts(src, dst portRange) {
+	e.src = appendUniqueRange(e.src, src)
+	e.dst = appendUniqueRange(e.dst, dst)
+}
+
+// build returns the policy described by the collected entries
+func (e *policyEntries) build() Policy {
+	p := e.policy
+	p.Direction = directionToString(e.dirs)
+	setPortFields(sortRanges(e.src), &p.SrcPort, &p.SrcPorts, &p.SrcPortRange)
+	setPortFields(sortRanges(e.dst), &p.DstPort, &p.DstPorts, &p.DstPortRange)
+	return p
 }
 
 // Helper functions
 
+// parseCIDR parses an IPv4 or IPv6 address with optional prefix length.
+// A bare address is treated as a host route (/32 or /128).
 func parseCIDR(cidr string) (net.IP, *net.IPMask, error) {
 	if !strings.Contains(cidr, "/") {
-		cidr = cidr + "/32"
+		if strings.Contains(cidr, ":") {
+			cidr = cidr + "/128"
+		} else {
+			cidr = cidr + "/32"
+		}
 	}
 
 	ip, ipnet, err := net.ParseCIDR(cidr)
@@ -321,6 +896,8 @@ func parseProtocol(proto string) (uint8, error) {
 		return 17, nil
 	case "icmp":
 		return 1, nil
+	case "icmpv6":
+		return 58, nil
 	case "any", "":
 		return 0, nil
 	default:
@@ -336,11 +913,59 @@ func parseAction(action string) (uint8, error) {
 		return 1, nil
 	case "log":
 		return 2, nil
+	case "rate_limit":
+		return 3, nil
+	case "reject":
+		return 4, nil
 	default:
 		return 0, fmt.Errorf("unknown action: %s", action)
 	}
 }
 
+// Direction mask bits, matching POLICY_DIR_* in common_types.h
+const (
+	dirIngress uint8 = 1 << 0
+	dirEgress  uint8 = 1 << 1
+	dirBoth          = dirIngress | dirEgress
+)
+
+func parseDirection(dir string) (uint8, error) {
+	switch strings.ToLower(dir) {
+	case "ingress":
+		return dirIngress, nil
+	case "egress":
+		return dirEgress, nil
+	case "both", "":
+		return dirBoth, nil
+	default:
+		return 0, fmt.Errorf("unknown direction: %s", dir)
+	}
+}
+
+// maskDirections expands a direction mask into traffic directions
+// (0 = ingress, 1 = egress) as used in exact-match policy keys
+func maskDirections(mask uint8) []uint8 {
+	var dirs []uint8
+	if mask&dirIngress != 0 {
+		dirs = append(dirs, 0)
+	}
+	if mask&dirEgress != 0 {
+		dirs = append(dirs, 1)
+	}
+	return dirs
+}
+
+func directionToString(mask uint8) string {
+	switch mask {
+	case dirIngress:
+		return "ingress"
+	case dirEgress:
+		return "egress"
+	default:
+		return "both" // 0 is treated as both by the data plane
+	}
+}
+
 func ipToUint32(ip net.IP) uint32 {
 	ip = ip.To4()
 	if ip == nil {
@@ -360,26 +985,84 @@ func boolToUint8(b bool) uint8 {
 	return 0
 }
 
-func maskToUint32(mask *net.IPMask) uint32 {
+// isCIDRPrefix reports whether addr names a network prefix rather than a single host
+func isCIDRPrefix(addr string) bool {
+	_, mask, err := parseCIDR(addr)
+	if err != nil {
+		return false
+	}
+	ones, bits := mask.Size()
+	return ones < bits
+}
+
+// ipToKeyAddr converts an IP to the 128-bit map representation.
+// IPv4 addresses are stored in IPv4-mapped IPv6 form (::ffff:a.b.c.d).
+func ipToKeyAddr(ip net.IP) [4]uint32 {
+	var addr [4]uint32
+	ip = ip.To16()
+	if ip == nil {
+		return addr
+	}
+	for i := range addr {
+		// LittleEndian keeps the in-memory byte order identical to the packet
+		addr[i] = binary.LittleEndian.Uint32(ip[i*4:])
+	}
+	return addr
+}
+
+// keyAddrToIP converts a 128-bit map address back to net.IP
+func keyAddrToIP(addr [4]uint32) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	for i, word := range addr {
+		binary.LittleEndian.PutUint32(ip[i*4:], word)
+	}
+	return ip
+}
+
+// maskToKeyAddr converts a mask to the 128-bit map representation.
+// IPv4 masks are extended with 96 leading one bits so they only match
+// IPv4-mapped addresses.
+func maskToKeyAddr(mask *net.IPMask) [4]uint32 {
+	full := net.CIDRMask(128, 128)
 	if mask == nil {
-		return 0xFFFFFFFF // Exact match if no mask
+		return ipToKeyAddr(net.IP(full)) // Exact match if no mask
+	}
+	switch len(*mask) {
+	case net.IPv4len:
+		copy(full[12:], *mask)
+	case net.IPv6len:
+		copy(full, *mask)
+	}
+	return ipToKeyAddr(net.IP(full))
+}
+
+// formatCIDR renders a 128-bit address/mask pair in the notation a user
+// would have written: a bare address for host routes, CIDR otherwise.
+func formatCIDR(addr, mask [4]uint32) string {
+	ip := keyAddrToIP(addr)
+	ones, bits := net.IPMask(keyAddrToIP(mask)).Size()
+
+	if ip4 := ip.To4(); ip4 != nil && ones >= 96 {
+		ip, ones, bits = ip4, ones-96, 32
 	}
-	if len(*mask) != 4 {
-		return 0xFFFFFFFF
+	if ones == bits {
+		return ip.String()
 	}
-	return binary.BigEndian.Uint32(*mask)
+	return fmt.Sprintf("%s/%d", ip, ones)
 }
 
-// addWildcardPolicy adds a wildcard policy to the array map
-func (pm *PolicyManager) addWildcardPolicy(p *Policy) error {
+// addWildcardPolicy adds a wildcard policy to the array map, one slot per
+// source/destination port range combination. Slots already holding the
+// rule are left alone; the slots written are recorded in added.
+func (pm *PolicyManager) addWildcardPolicy(p *Policy, added *ruleEntries) error {
 	// Parse source IP
-	srcIP, srcMask, err := parseCIDR(p.SrcIP)
+	srcIP, srcMask, err := parseCIDR(policyAddr(p.SrcIP))
 	if err != nil {
 		return fmt.Errorf("invalid source IP: %w", err)
 	}
 
 	// Parse destination IP
-	dstIP, dstMask, err := parseCIDR(p.DstIP)
+	dstIP, dstMask, err := parseCIDR(policyAddr(p.DstIP))
 	if err != nil {
 		return fmt.Errorf("invalid destination IP: %w", err)
 	}
@@ -396,83 +1079,138 @@ func (pm *PolicyManager) addWildcardPolicy(p *Policy) error {
 		return fmt.Errorf("invalid action: %w", err)
 	}
 
-	// Build wildcard policy entry
-	wildcard := struct {
-		SrcIP      uint32
-		SrcIPMask  uint32
-		DstIP      uint32
-		DstIPMask  uint32
-		SrcPort    uint16
-		DstPort    uint16
-		Protocol   uint8
-		Action     uint8
-		LogEnabled uint8
-		Pad1       uint8
-		Priority   uint16
-		Pad2       uint16
-		RuleID     uint32
-	}{
-		SrcIP:      ipToUint32(srcIP),
-		SrcIPMask:  maskToUint32(srcMask),
-		DstIP:      ipToUint32(dstIP),
-		DstIPMask:  maskToUint32(dstMask),
-		SrcPort:    htons(p.SrcPort), // 0 = wildcard
-		DstPort:    htons(p.DstPort), // 0 = wildcard
-		Protocol:   proto,             // 0 = wildcard
-		Action:     action,
-		LogEnabled: boolToUint8(p.Action == "log"),
-		Priority:   p.Priority,
-		RuleID:     p.RuleID,
-	}
-
-	// Find empty slot in wildcard array map
-	// Try up to MAX_ENTRIES_WILDCARD_POLICY (1000)
-	for i := uint32(0); i < 1000; i++ {
-		// Try to read existing entry - must match the exact struct layout in eBPF
-		var existing struct {
-			SrcIP      uint32
-			SrcIPMask  uint32
-			DstIP      uint32
-			DstIPMask  uint32
-			SrcPort    uint16
-			DstPort    uint16
-			Protocol   uint8
-			Action     uint8
-			LogEnabled uint8
-			Pad1       uint8
-			Priority   uint16
-			Pad2       uint16
-			RuleID     uint32
-		}
+	// Parse direction
+	dirMask, err := parseDirection(p.Direction)
+	if err != nil {
+		return fmt.Errorf("invalid direction: %w", err)
+	}
 
-		// Read the existing entry
-		err := pm.wildcardPolicyMap.Lookup(&i, &existing)
+	srcPorts, dstPorts, err := policyPorts(p)
+	if err != nil {
+		return err
+	}
 
-		// If lookup fails or RuleID is 0, slot is empty
-		if err != nil || existing.RuleID == 0 {
-			// Found empty slot, insert here
-			if err := pm.wildcardPolicyMap.Put(&i, &wildcard); err != nil {
-				return fmt.Errorf("failed to add wildcard policy to map slot %d: %w", i, err)
+	icmpFlags, icmpType, icmpCode := icmpMatch(p)
+
+	connStates, err := connStateMask(p.ConnStates)
+	if err != nil {
+		return err
+	}
+
+	// Find empty slots in wildcard array map
+	slots, err := pm.freeWildcardSlots(len(srcPorts) * len(dstPorts))
+	if err != nil {
+		return err
+	}
+
+	next := 0
+	for _, sp := range srcPorts {
+		for _, dp := range dstPorts {
+			// Build wildcard policy entry
+			wildcard := wildcardPolicy{
+				SrcIP:        ipToKeyAddr(srcIP),
+				SrcIPMask:    maskToKeyAddr(srcMask),
+				DstIP:        ipToKeyAddr(dstIP),
+				DstIPMask:    maskToKeyAddr(dstMask),
+				SrcPortLo:    sp.Lo, // hi = 0 = wildcard
+				SrcPortHi:    sp.Hi,
+				DstPortLo:    dp.Lo,
+				DstPortHi:    dp.Hi,
+				Protocol:     proto, // 0 = wildcard
+				Action:       action,
+				LogEnabled:   boolToUint8(p.Action == "log"),
+				Direction:    dirMask,
+				Priority:     p.Priority,
+				Monitor:      boolToUint8(p.Monitor),
+				IcmpMatch:    icmpFlags,
+				RuleID:       p.RuleID,
+				IcmpType:     icmpType,
+				IcmpCode:     icmpCode,
+				ConnStates:   connStates,
+				VlanID:       p.VlanID,
+				VNI:          p.VNI,
+				SessionLimit: p.SessionLimit,
+				SrcIdentity:  p.SrcIdentity,
+				DstIdentity:  p.DstIdentity,
 			}
 
-			log.Infof("Wildcard policy added to slot %d: rule_id=%d %s:%d -> %s:%d proto=%s action=%s (priority=%d)",
-				i, p.RuleID, p.SrcIP, p.SrcPort, p.DstIP, p.DstPort, p.Protocol, p.Action, p.Priority)
-			return nil
+			// Store the rule before indexing it so the data plane never
+			// sees a prefix pointing at an empty slot
+			slot := slots[next]
+			next++
+			if err := pm.wildcardPolicyMap.Put(&slot, &wildcard); err != nil {
+				return fmt.Errorf("failed to add wildcard policy to map slot %d: %w", slot, err)
+			}
+			added.slots = append(added.slots, slot)
+			if err := pm.cidr.add(&wildcard, slot); err != nil {
+				return fmt.Errorf("failed to index wildcard policy: %w", err)
+			}
 		}
+	}
 
-		// Check if this slot already has our rule_id (update case)
-		if existing.RuleID == p.RuleID {
-			// Update existing entry
-			if err := pm.wildcardPolicyMap.Put(&i, &wildcard); err != nil {
-				return fmt.Errorf("failed to update wildcard policy at slot %d: %w", i, err)
-			}
+	log.Infof("Wildcard policy added to %d slot(s): rule_id=%d %s:%s -> %s:%s proto=%s action=%s (priority=%d)",
+		len(slots), p.RuleID, p.SrcIP, formatPortRanges(srcPorts), p.DstIP, formatPortRanges(dstPorts),
+		p.Protocol, p.Action, p.Priority)
+	return nil
+}
+
+// freeWildcardSlots returns n unused wildcard slot indices
+func (pm *PolicyManager) freeWildcardSlots(n int) ([]uint32, error) {
+	slots := make([]uint32, 0, n)
+	for i := uint32(0); i < maxWildcardPolicies && len(slots) < n; i++ {
+		// Try to read existing entry - must match the exact struct layout in eBPF
+		var existing wildcardPolicy
 
-			log.Infof("Wildcard policy updated at slot %d: rule_id=%d", i, p.RuleID)
-			return nil
+		// If lookup fails or RuleID is 0, slot is empty
+		if err := pm.wildcardPolicyMap.Lookup(&i, &existing); err != nil || existing.RuleID == 0 {
+			slots = append(slots, i)
 		}
 	}
 
-	return fmt.Errorf("wildcard policy map is full (max 1000 entries)")
+	if len(slots) < n {
+		return nil, fmt.Errorf("wildcard policy map is full (max %d entries)", maxWildcardPolicies)
+	}
+	return slots, nil
+}
+
+// deleteWildcardSlots clears every wildcard slot holding the rule ID and
+// returns how many were cleared
+func (pm *PolicyManager) deleteWildcardSlots(ruleID uint32) (int, error) {
+	removed := 0
+	for i := uint32(0); i < maxWildcardPolicies; i++ {
+		var existing wildcardPolicy
+		if err := pm.wildcardPolicyMap.Lookup(&i, &existing); err != nil {
+			continue
+		}
+		if existing.RuleID != ruleID {
+			continue
+		}
+
+		if err := pm.clearWildcardSlot(i); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// clearWildcardSlot unindexes and empties one wildcard slot
+func (pm *PolicyManager) clearWildcardSlot(slot uint32) error {
+	var existing wildcardPolicy
+	if err := pm.wildcardPolicyMap.Lookup(&slot, &existing); err != nil {
+		return fmt.Errorf("failed to read wildcard policy at slot %d: %w", slot, err)
+	}
+
+	if err := pm.cidr.remove(&existing, slot); err != nil {
+		return fmt.Errorf("failed to unindex wildcard policy at slot %d: %w", slot, err)
+	}
+
+	// Array maps cannot delete entries; an all-zero slot is empty
+	if err := pm.wildcardPolicyMap.Put(&slot, &wildcardPolicy{}); err != nil {
+		return fmt.Errorf("failed to clear wildcard policy at slot %d: %w", slot, err)
+	}
+	return nil
 }
 
 func uint32ToIP(ip uint32) string {
@@ -493,6 +1231,8 @@ func protoToString(proto uint8) string {
 		return "udp"
 	case 1:
 		return "icmp"
+	case 58:
+		return "icmpv6"
 	case 0:
 		return "any"
 	default:
@@ -508,7 +1248,21 @@ func actionToString(action uint8) string {
 		return "deny"
 	case 2:
 		return "log"
+	case 3:
+		return "rate_limit"
+	case 4:
+		return "reject"
 	default:
 		return fmt.Sprintf("%d", action)
 	}
 }
+
+// ProtocolName returns the policy name of an IP protocol number
+func ProtocolName(proto uint8) string {
+	return protoToString(proto)
+}
+
+// ActionName returns the policy name of a data plane action
+func ActionName(action uint8) string {
+	return actionToString(action)
+}
@@ -151,11 +151,37 @@ func TestParseCIDR(t *testing.T) {
 			expectMask:  "255.255.255.255",
 			expectError: false,
 		},
+		{
+			name:        "valid IPv6 without CIDR",
+			input:       "2001:db8::1",
+			expectIP:    "2001:db8::1",
+			expectMask:  "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+			expectError: false,
+		},
+		{
+			name:        "valid IPv6 with /64 CIDR",
+			input:       "2001:db8:1::/64",
+			expectIP:    "2001:db8:1::",
+			expectMask:  "ffff:ffff:ffff:ffff::",
+			expectError: false,
+		},
+		{
+			name:        "IPv6 wildcard ::/0",
+			input:       "::/0",
+			expectIP:    "::",
+			expectMask:  "::",
+			expectError: false,
+		},
 		{
 			name:        "invalid IP",
 			input:       "999.999.999.999",
 			expectError: true,
 		},
+		{
+			name:        "invalid IPv6 CIDR range",
+			input:       "2001:db8::/129",
+			expectError: true,
+		},
 		{
 			name:        "invalid CIDR format",
 			input:       "192.168.1.1/",
@@ -201,6 +227,7 @@ func TestParseProtocol(t *testing.T) {
 		{name: "udp uppercase", input: "UDP", expected: 17},
 		{name: "icmp lowercase", input: "icmp", expected: 1},
 		{name: "icmp uppercase", input: "ICMP", expected: 1},
+		{name: "icmpv6 lowercase", input: "icmpv6", expected: 58},
 		{name: "any lowercase", input: "any", expected: 0},
 		{name: "any uppercase", input: "ANY", expected: 0},
 		{name: "empty string", input: "", expected: 0},
@@ -238,6 +265,8 @@ func TestParseAction(t *testing.T) {
 		{name: "deny uppercase", input: "DENY", expected: 1},
 		{name: "log lowercase", input: "log", expected: 2},
 		{name: "log uppercase", input: "LOG", expected: 2},
+		{name: "reject lowercase", input: "reject", expected: 4},
+		{name: "reject uppercase", input: "REJECT", expected: 4},
 		{name: "invalid action", input: "block", expectError: true},
 		{name: "invalid action2", input: "drop", expectError: true},
 		{name: "empty string", input: "", expectError: true},
@@ -259,6 +288,49 @@ func TestParseAction(t *testing.T) {
 	}
 }
 
+// TestParseDirection tests direction parsing
+func TestParseDirection(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expected    uint8
+		expectError bool
+	}{
+		{name: "ingress", input: "ingress", expected: dirIngress},
+		{name: "egress uppercase", input: "EGRESS", expected: dirEgress},
+		{name: "both", input: "both", expected: dirBoth},
+		{name: "empty defaults to both", input: "", expected: dirBoth},
+		{name: "invalid direction", input: "inbound", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseDirection(tc.input)
+
+			if tc.expectError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "unknown direction")
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+// TestDirectionMask tests expansion and rendering of direction masks
+func TestDirectionMask(t *testing.T) {
+	assert.Equal(t, []uint8{0}, maskDirections(dirIngress))
+	assert.Equal(t, []uint8{1}, maskDirections(dirEgress))
+	assert.Equal(t, []uint8{0, 1}, maskDirections(dirBoth))
+
+	assert.Equal(t, "ingress", directionToString(dirIngress))
+	assert.Equal(t, "egress", directionToString(dirEgress))
+	assert.Equal(t, "both", directionToString(dirBoth))
+	assert.Equal(t, "both", directionToString(0))
+}
+
 // TestIPToUint32 tests IP to uint32 conversion
 func TestIPToUint32(t *testing.T) {
 	testCases := []struct {
@@ -362,6 +434,83 @@ func TestIPConversionRoundTrip(t *testing.T) {
 	}
 }
 
+// TestKeyAddrRoundTrip tests IP <-> 128-bit map address conversion
+func TestKeyAddrRoundTrip(t *testing.T) {
+	testIPs := []string{
+		"0.0.0.0",
+		"192.168.1.1",
+		"255.255.255.255",
+		"::",
+		"::1",
+		"2001:db8::1",
+		"fe80::1234:5678:9abc:def0",
+	}
+
+	for _, ipStr := range testIPs {
+		t.Run(ipStr, func(t *testing.T) {
+			addr := ipToKeyAddr(net.ParseIP(ipStr))
+			assert.Equal(t, ipStr, keyAddrToIP(addr).String())
+		})
+	}
+}
+
+// TestIPToKeyAddrIPv4Mapped tests that IPv4 uses the IPv4-mapped IPv6 layout
+func TestIPToKeyAddrIPv4Mapped(t *testing.T) {
+	addr := ipToKeyAddr(net.ParseIP("192.168.1.1"))
+
+	// ::ffff:192.168.1.1, each word in packet byte order on a little-endian host
+	assert.Equal(t, [4]uint32{0, 0, 0xffff0000, 0x0101a8c0}, addr)
+}
+
+// TestFormatCIDR tests rendering of 128-bit address/mask pairs
+func TestFormatCIDR(t *testing.T) {
+	testCases := []string{
+		"10.0.0.5",
+		"192.168.1.0/24",
+		"0.0.0.0/0",
+		"2001:db8::1",
+		"2001:db8:1::/64",
+		"::/0",
+	}
+
+	for _, input := range testCases {
+		t.Run(input, func(t *testing.T) {
+			ip, mask, err := parseCIDR(input)
+			assert.NoError(t, err)
+			assert.Equal(t, input, formatCIDR(ipToKeyAddr(ip), maskToKeyAddr(mask)))
+		})
+	}
+}
+
+// TestHasWildcardCIDR tests that network prefixes route to the wildcard map
+func TestHasWildcardCIDR(t *testing.T) {
+	testCases := []struct {
+		name     string
+		srcIP    string
+		dstIP    string
+		expected bool
+	}{
+		{name: "IPv4 hosts", srcIP: "192.168.1.1", dstIP: "10.0.0.1", expected: false},
+		{name: "IPv6 hosts", srcIP: "2001:db8::1", dstIP: "2001:db8::2", expected: false},
+		{name: "IPv4 prefix", srcIP: "192.168.1.0/24", dstIP: "10.0.0.1", expected: true},
+		{name: "IPv6 prefix", srcIP: "2001:db8::1", dstIP: "2001:db8:1::/64", expected: true},
+		{name: "IPv6 any", srcIP: "::/0", dstIP: "2001:db8::2", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &Policy{
+				SrcIP:    tc.srcIP,
+				DstIP:    tc.dstIP,
+				SrcPort:  1234,
+				DstPort:  80,
+				Protocol: "tcp",
+			}
+			assert.Equal(t, tc.expected, hasWildcard(p))
+		})
+	}
+}
+
 // TestHtons tests host to network short conversion
 func TestHtons(t *testing.T) {
 	testCases := []struct {
@@ -429,6 +578,7 @@ func TestProtoToString(t *testing.T) {
 		{input: 1, expected: "icmp"},
 		{input: 6, expected: "tcp"},
 		{input: 17, expected: "udp"},
+		{input: 58, expected: "icmpv6"},
 		{input: 255, expected: "255"}, // Unknown protocol
 		{input: 50, expected: "50"},   // Unknown protocol
 	}
@@ -450,6 +600,7 @@ func TestActionToString(t *testing.T) {
 		{input: 0, expected: "allow"},
 		{input: 1, expected: "deny"},
 		{input: 2, expected: "log"},
+		{input: 4, expected: "reject"},
 		{input: 255, expected: "255"}, // Unknown action
 		{input: 10, expected: "10"},   // Unknown action
 	}
@@ -686,3 +837,93 @@ func TestPolicyKeyConstruction(t *testing.T) {
 		})
 	}
 }
+
+// TestValidate tests that Validate runs every field validator
+func TestValidate(t *testing.T) {
+	icmpType := uint8(8)
+
+	testCases := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "plain policy", policy: Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "tcp", Action: "allow"}},
+		{name: "invalid port range", policy: Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "tcp", Action: "allow", DstPortRange: "90-80"}, wantErr: true},
+		{name: "icmp type on tcp", policy: Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "tcp", Action: "allow", IcmpType: &icmpType}, wantErr: true},
+		{name: "unknown conn state", policy: Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "tcp", Action: "allow", ConnStates: []string{"open"}}, wantErr: true},
+		{name: "rate without rate_limit", policy: Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "tcp", Action: "allow", Rate: 10}, wantErr: true},
+		{name: "missing destination", policy: Policy{SrcIP: "10.0.0.1", Protocol: "tcp", Action: "allow"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(&tc.policy)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestValidateAddressFamily tests that a policy can't mix IPv4 and IPv6
+func TestValidateAddressFamily(t *testing.T) {
+	testCases := []struct {
+		name    string
+		src     string
+		dst     string
+		wantErr bool
+	}{
+		{name: "ipv4", src: "10.0.0.0/8", dst: "192.168.1.1"},
+		{name: "ipv6", src: "2001:db8::/32", dst: "2001:db8::1"},
+		{name: "any ipv6 prefix", src: "::/0", dst: "10.0.0.1"},
+		{name: "identity only side", src: "", dst: "2001:db8::1"},
+		{name: "ipv4-mapped", src: "::ffff:10.0.0.1", dst: "10.0.0.2"},
+		{name: "ipv4 to ipv6", src: "10.0.0.1", dst: "2001:db8::1", wantErr: true},
+		{name: "ipv6 to ipv4", src: "2001:db8::/64", dst: "10.0.0.0/8", wantErr: true},
+		{name: "any ipv4 to ipv6", src: "0.0.0.0/0", dst: "2001:db8::1", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAddressFamily(&Policy{SrcIP: tc.src, DstIP: tc.dst})
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckIngressHooks(t *testing.T) {
+	testCases := []struct {
+		name      string
+		policy    Policy
+		xdp, tc   bool
+		wantError bool
+	}{
+		{name: "vlan on tc", policy: Policy{VlanID: 10}, tc: true},
+		{name: "vlan on xdp", policy: Policy{VlanID: 10}, xdp: true, wantError: true},
+		{name: "vlan on xdp+tc", policy: Policy{VlanID: 10}, xdp: true, tc: true, wantError: true},
+		{name: "vlan on ingress with xdp", policy: Policy{VlanID: 10, Direction: "ingress"}, xdp: true, wantError: true},
+		{name: "vlan on egress with xdp", policy: Policy{VlanID: 10, Direction: "egress"}, xdp: true},
+		{name: "no vlan on xdp", policy: Policy{}, xdp: true},
+		{name: "mirror on tc", policy: Policy{Mirror: "lo"}, tc: true},
+		{name: "mirror on xdp+tc", policy: Policy{Mirror: "lo"}, xdp: true, tc: true},
+		{name: "mirror on xdp", policy: Policy{Mirror: "lo"}, xdp: true, wantError: true},
+		{name: "egress mirror on xdp", policy: Policy{Mirror: "lo", Direction: "egress"}, xdp: true, wantError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkIngressHooks(&tc.policy, tc.xdp, tc.tc)
+			if tc.wantError {
+				assert.ErrorIs(t, err, ErrUnsupportedRule)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
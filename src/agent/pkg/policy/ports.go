@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPortCombinations limits how many map entries one policy may expand to
+// (source port ranges x destination port ranges)
+const maxPortCombinations = 64
+
+// portRange is an inclusive port range in host byte order.
+// The zero value matches any port.
+type portRange struct {
+	Lo uint16
+	Hi uint16
+}
+
+// any reports whether the range matches every port
+func (r portRange) any() bool {
+	return r.Hi == 0
+}
+
+// single reports whether the range holds exactly one port
+func (r portRange) single() bool {
+	return r.Lo == r.Hi
+}
+
+func (r portRange) String() string {
+	if r.single() {
+		return strconv.Itoa(int(r.Lo))
+	}
+	return fmt.Sprintf("%d-%d", r.Lo, r.Hi)
+}
+
+// parsePortRanges parses a comma-separated list of "lo-hi" ranges or ports
+func parsePortRanges(spec string) ([]portRange, error) {
+	var ranges []portRange
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		loStr, hiStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			hiStr = loStr
+		}
+
+		lo, err := parsePort(loStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port range %q: %w", part, err)
+		}
+		hi, err := parsePort(hiStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port range %q: %w", part, err)
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("invalid port range %q: start is after end", part)
+		}
+
+		ranges = append(ranges, portRange{Lo: lo, Hi: hi})
+	}
+
+	return ranges, nil
+}
+
+// parsePort parses a non-zero port number
+func parsePort(s string) (uint16, error) {
+	port, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	if port == 0 {
+		return 0, fmt.Errorf("port 0 is not allowed")
+	}
+	return uint16(port), nil
+}
+
+// portSpec returns the ranges matched by one side of a policy: the union of
+// the single port, the port list and the range specification. No ports at
+// all means any port.
+func portSpec(port uint16, ports []uint16, rangeSpec string) ([]portRange, error) {
+	var ranges []portRange
+
+	if port != 0 {
+		ranges = append(ranges, portRange{Lo: port, Hi: port})
+	}
+	for _, p := range ports {
+		if p == 0 {
+			return nil, fmt.Errorf("port 0 is not allowed in a port list")
+		}
+		ranges = append(ranges, portRange{Lo: p, Hi: p})
+	}
+
+	parsed, err := parsePortRanges(rangeSpec)
+	if err != nil {
+		return nil, err
+	}
+	ranges = append(ranges, parsed...)
+
+	if len(ranges) == 0 {
+		return []portRange{{}}, nil
+	}
+
+	// Sort and drop duplicates so equivalent policies expand identically
+	ranges = sortRanges(ranges)
+	unique := ranges[:1]
+	for _, r := range ranges[1:] {
+		if r != unique[len(unique)-1] {
+			unique = append(unique, r)
+		}
+	}
+
+	return unique, nil
+}
+
+// policyPorts returns the source and destination port ranges of a policy
+func policyPorts(p *Policy) (src, dst []portRange, err error) {
+	src, err = portSpec(p.SrcPort, p.SrcPorts, p.SrcPortRange)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid source ports: %w", err)
+	}
+
+	dst, err = portSpec(p.DstPort, p.DstPorts, p.DstPortRange)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid destination ports: %w", err)
+	}
+
+	if len(src)*len(dst) > maxPortCombinations {
+		return nil, nil, fmt.Errorf("too many port combinations: %d source x %d destination (max %d)",
+			len(src), len(dst), maxPortCombinations)
+	}
+
+	return src, dst, nil
+}
+
+// ValidatePorts checks the port fields of a policy
+func ValidatePorts(p *Policy) error {
+	_, _, err := policyPorts(p)
+	return err
+}
+
+// exactPorts reports whether every range is a single port.
+// Source ports must also be specific since the exact map has no wildcard.
+func exactPorts(ranges []portRange, allowAny bool) bool {
+	for _, r := range ranges {
+		if !r.single() || (r.any() && !allowAny) {
+			return false
+		}
+	}
+	return true
+}
+
+// setPortFields stores ranges back into one side of a policy, using the
+// single port field when possible, the list for other single ports and the
+// range specification for the rest
+func setPortFields(ranges []portRange, port *uint16, ports *[]uint16, rangeSpec *string) {
+	var singles []uint16
+	var spans []string
+
+	for _, r := range ranges {
+		switch {
+		case r.any():
+			continue
+		case r.single():
+			singles = append(singles, r.Lo)
+		default:
+			spans = append(spans, r.String())
+		}
+	}
+
+	*port, *ports, *rangeSpec = 0, nil, strings.Join(spans, ",")
+	if len(singles) == 1 && len(spans) == 0 {
+		*port = singles[0]
+	} else if len(singles) > 0 {
+		*ports = singles
+	}
+}
+
+// formatPortRanges renders ranges for log messages
+func formatPortRanges(ranges []portRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r.any() {
+			parts = append(parts, "*")
+			continue
+		}
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// appendUniqueRange appends r unless it is already present
+func appendUniqueRange(ranges []portRange, r portRange) []portRange {
+	for _, existing := range ranges {
+		if existing == r {
+			return ranges
+		}
+	}
+	return append(ranges, r)
+}
+
+// sortRanges orders ranges by start then end port
+func sortRanges(ranges []portRange) []portRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].Lo != ranges[j].Lo {
+			return ranges[i].Lo < ranges[j].Lo
+		}
+		return ranges[i].Hi < ranges[j].Hi
+	})
+	return ranges
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParsePortRanges tests parsing range specifications
+func TestParsePortRanges(t *testing.T) {
+	testCases := []struct {
+		name    string
+		spec    string
+		want    []portRange
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: nil},
+		{name: "single range", spec: "8000-8080", want: []portRange{{8000, 8080}}},
+		{name: "range list", spec: "8000-8080, 9000-9100", want: []portRange{{8000, 8080}, {9000, 9100}}},
+		{name: "single port", spec: "443", want: []portRange{{443, 443}}},
+		{name: "full range", spec: "1-65535", want: []portRange{{1, 65535}}},
+		{name: "reversed", spec: "9000-8000", wantErr: true},
+		{name: "zero port", spec: "0-80", wantErr: true},
+		{name: "out of range", spec: "80-70000", wantErr: true},
+		{name: "garbage", spec: "http", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parsePortRanges(tc.spec)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+// TestPortSpec tests merging the single port, list and ranges of one side
+func TestPortSpec(t *testing.T) {
+	// No ports means any port
+	ranges, err := portSpec(0, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, []portRange{{}}, ranges)
+
+	// Union is sorted and deduplicated
+	ranges, err = portSpec(443, []uint16{80, 443}, "8000-8080")
+	require.NoError(t, err)
+	assert.Equal(t, []portRange{{80, 80}, {443, 443}, {8000, 8080}}, ranges)
+
+	_, err = portSpec(0, []uint16{0}, "")
+	assert.Error(t, err)
+}
+
+// TestPolicyPorts_CombinationLimit tests rejecting policies that expand to too many entries
+func TestPolicyPorts_CombinationLimit(t *testing.T) {
+	ports := make([]uint16, 0, 9)
+	for i := uint16(1); i <= 9; i++ {
+		ports = append(ports, i)
+	}
+
+	p := &Policy{SrcPorts: ports[:8], DstPorts: ports[:8]}
+	assert.NoError(t, ValidatePorts(p))
+
+	p.DstPorts = ports
+	assert.Error(t, ValidatePorts(p))
+}
+
+// TestHasWildcard_Ports tests routing port lists and ranges to the right map
+func TestHasWildcard_Ports(t *testing.T) {
+	base := Policy{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 1234, Protocol: "tcp"}
+
+	testCases := []struct {
+		name     string
+		modify   func(p *Policy)
+		wildcard bool
+	}{
+		{name: "single ports", modify: func(p *Policy) { p.DstPort = 80 }, wildcard: false},
+		{name: "port list", modify: func(p *Policy) { p.DstPorts = []uint16{80, 443} }, wildcard: false},
+		{name: "any destination port", modify: func(p *Policy) {}, wildcard: false},
+		{name: "any source port", modify: func(p *Policy) { p.SrcPort = 0 }, wildcard: true},
+		{name: "destination range", modify: func(p *Policy) { p.DstPortRange = "8000-8080" }, wildcard: true},
+		{name: "source range", modify: func(p *Policy) { p.SrcPort, p.SrcPortRange = 0, "1024-65535" }, wildcard: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := base
+			tc.modify(&p)
+			assert.Equal(t, tc.wildcard, hasWildcard(&p))
+		})
+	}
+}
+
+// TestSetPortFields tests converting ranges back into policy fields
+func TestSetPortFields(t *testing.T) {
+	var (
+		port      uint16
+		ports     []uint16
+		rangeSpec string
+	)
+
+	setPortFields([]portRange{{}}, &port, &ports, &rangeSpec)
+	assert.Equal(t, uint16(0), port)
+	assert.Nil(t, ports)
+	assert.Empty(t, rangeSpec)
+
+	setPortFields([]portRange{{80, 80}}, &port, &ports, &rangeSpec)
+	assert.Equal(t, uint16(80), port)
+	assert.Nil(t, ports)
+
+	setPortFields([]portRange{{80, 80}, {443, 443}, {8000, 8080}}, &port, &ports, &rangeSpec)
+	assert.Equal(t, uint16(0), port)
+	assert.Equal(t, []uint16{80, 443}, ports)
+	assert.Equal(t, "8000-8080", rangeSpec)
+
+	// Round trip through portSpec
+	ranges, err := portSpec(port, ports, rangeSpec)
+	require.NoError(t, err)
+	assert.Equal(t, []portRange{{80, 80}, {443, 443}, {8000, 8080}}, ranges)
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// Rate limit units, matching enum rate_limit_unit in common_types.h
+const (
+	rateUnitPackets uint8 = iota
+	rateUnitBytes
+	rateUnitConnections
+)
+
+// maxRateTokens bounds Rate and Burst so the kernel's nanosecond-scaled
+// token count (burst * 1e9) cannot overflow 64 bits
+const maxRateTokens = 1 << 34
+
+// rateLimit mirrors struct rate_limit in common_types.h
+type rateLimit struct {
+	Rate   uint64
+	Burst  uint64
+	Tokens uint64 // Scaled by 1e9, zero = refill on the first packet
+	LastTS uint64
+	Unit   uint8
+	Pad    [3]uint8
+	Lock   uint32 // struct bpf_spin_lock, owned by the kernel
+}
+
+// ValidateRateLimit checks the token bucket of a policy. Rate is required
+// for the "rate_limit" action and rejected for every other action.
+func ValidateRateLimit(p *Policy) error {
+	if !strings.EqualFold(p.Action, "rate_limit") {
+		if p.Rate != 0 || p.Burst != 0 || p.RateUnit != "" {
+			return fmt.Errorf("rate, burst and rate_unit require the rate_limit action")
+		}
+		return nil
+	}
+
+	if p.Rate == 0 {
+		return fmt.Errorf("rate_limit action requires a rate")
+	}
+	if p.Rate > maxRateTokens || p.Burst > maxRateTokens {
+		return fmt.Errorf("rate and burst must be at most %d", uint64(maxRateTokens))
+	}
+	_, err := parseRateUnit(p.RateUnit)
+	return err
+}
+
+// parseRateUnit converts a rate unit name ("packets" by default, "bytes"
+// or "connections")
+func parseRateUnit(unit string) (uint8, error) {
+	switch strings.ToLower(unit) {
+	case "packets", "":
+		return rateUnitPackets, nil
+	case "bytes":
+		return rateUnitBytes, nil
+	case "connections":
+		return rateUnitConnections, nil
+	default:
+		return 0, fmt.Errorf("unknown rate unit %q (expected packets, bytes or connections)", unit)
+	}
+}
+
+func rateUnitToString(unit uint8) string {
+	switch unit {
+	case rateUnitBytes:
+		return "bytes"
+	case rateUnitConnections:
+		return "connections"
+	default:
+		return "packets"
+	}
+}
+
+// buildRateLimit returns the token bucket of a rate_limit policy. A zero
+// burst allows one second worth of tokens.
+func buildRateLimit(p *Policy) (*rateLimit, error) {
+	unit, err := parseRateUnit(p.RateUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	burst := p.Burst
+	if burst == 0 {
+		burst = p.Rate
+	}
+	return &rateLimit{Rate: p.Rate, Burst: burst, Unit: unit}, nil
+}
+
+// setRateLimit installs or removes the token bucket of a rule. The bucket
+// is written before the rule's policy entries so the data plane never sees
+// a rate_limit rule without one; rewriting it refills the bucket.
+func (pm *PolicyManager) setRateLimit(p *Policy) error {
+	if !strings.EqualFold(p.Action, "rate_limit") {
+		return pm.deleteRateLimit(p.RuleID)
+	}
+	if pm.rateLimitMap == nil {
+		return fmt.Errorf("data plane does not support rate limiting")
+	}
+
+	rl, err := buildRateLimit(p)
+	if err != nil {
+		return err
+	}
+	if err := pm.rateLimitMap.Put(p.RuleID, rl); err != nil {
+		return fmt.Errorf("failed to add rate limit to map: %w", err)
+	}
+	return nil
+}
+
+// deleteRateLimit removes the token bucket of a rule, if it has one
+func (pm *PolicyManager) deleteRateLimit(ruleID uint32) error {
+	if pm.rateLimitMap == nil {
+		return nil
+	}
+	if err := pm.rateLimitMap.Delete(ruleID); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return fmt.Errorf("failed to delete rate limit from map: %w", err)
+	}
+	return nil
+}
+
+// setRateLimitFields fills the rate limit fields of a listed policy from
+// its installed token bucket
+func (pm *PolicyManager) setRateLimitFields(p *Policy) {
+	if pm.rateLimitMap == nil || p.Action != "rate_limit" {
+		return
+	}
+
+	var rl rateLimit
+	if err := pm.rateLimitMap.Lookup(p.RuleID, &rl); err != nil {
+		return
+	}
+	p.Rate = rl.Rate
+	p.Burst = rl.Burst
+	p.RateUnit = rateUnitToString(rl.Unit)
+}
+
+// installedRateLimit returns the token bucket of a rule, nil if it has none
+func (pm *PolicyManager) installedRateLimit(ruleID uint32) *rateLimit {
+	if pm.rateLimitMap == nil {
+		return nil
+	}
+
+	var rl rateLimit
+	if err := pm.rateLimitMap.Lookup(ruleID, &rl); err != nil {
+		return nil
+	}
+	return &rl
+}
+
+// restoreRateLimit writes back the token bucket a rule had before a failed
+// update, or removes it if it had none
+func (pm *PolicyManager) restoreRateLimit(ruleID uint32, rl *rateLimit) error {
+	if rl == nil {
+		return pm.deleteRateLimit(ruleID)
+	}
+	if err := pm.rateLimitMap.Put(ruleID, rl); err != nil {
+		return fmt.Errorf("failed to restore rate limit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateRateLimit tests the token bucket parameters a policy accepts
+func TestValidateRateLimit(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "allow", policy: Policy{Action: "allow"}},
+		{name: "packets", policy: Policy{Action: "rate_limit", Rate: 100, Burst: 200}},
+		{name: "default burst", policy: Policy{Action: "rate_limit", Rate: 100}},
+		{name: "bytes", policy: Policy{Action: "rate_limit", Rate: 1 << 20, RateUnit: "bytes"}},
+		{name: "connections", policy: Policy{Action: "rate_limit", Rate: 50, RateUnit: "connections"}},
+		{name: "highest rate", policy: Policy{Action: "rate_limit", Rate: maxRateTokens}},
+		{name: "missing rate", policy: Policy{Action: "rate_limit", Burst: 10}, wantErr: true},
+		{name: "rate too large", policy: Policy{Action: "rate_limit", Rate: maxRateTokens + 1}, wantErr: true},
+		{name: "burst too large", policy: Policy{Action: "rate_limit", Rate: 1, Burst: maxRateTokens + 1}, wantErr: true},
+		{name: "unknown unit", policy: Policy{Action: "rate_limit", Rate: 10, RateUnit: "bits"}, wantErr: true},
+		{name: "rate without action", policy: Policy{Action: "allow", Rate: 10}, wantErr: true},
+		{name: "unit without action", policy: Policy{Action: "deny", RateUnit: "bytes"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRateLimit(&tc.policy)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestBuildRateLimit tests the bucket written for a rate_limit policy
+func TestBuildRateLimit(t *testing.T) {
+	rl, err := buildRateLimit(&Policy{Action: "rate_limit", Rate: 50})
+	require.NoError(t, err)
+	assert.Equal(t, rateLimit{Rate: 50, Burst: 50, Unit: rateUnitPackets}, *rl)
+
+	rl, err = buildRateLimit(&Policy{Action: "rate_limit", Rate: 1000, Burst: 1500, RateUnit: "bytes"})
+	require.NoError(t, err)
+	assert.Equal(t, rateLimit{Rate: 1000, Burst: 1500, Unit: rateUnitBytes}, *rl)
+	assert.Equal(t, "bytes", rateUnitToString(rl.Unit))
+
+	rl, err = buildRateLimit(&Policy{Action: "rate_limit", Rate: 20, RateUnit: "connections"})
+	require.NoError(t, err)
+	assert.Equal(t, rateUnitConnections, rl.Unit)
+	assert.Equal(t, "connections", rateUnitToString(rl.Unit))
+}
+
+// TestParseAction_RateLimit tests the rate_limit action round trip
+func TestParseAction_RateLimit(t *testing.T) {
+	action, err := parseAction("rate_limit")
+	require.NoError(t, err)
+	assert.Equal(t, uint8(3), action)
+	assert.Equal(t, "rate_limit", ActionName(action))
+}
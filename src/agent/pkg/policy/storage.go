@@ -4,6 +4,8 @@ package policy
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
@@ -20,6 +22,15 @@ type Storage interface {
 	// LoadPolicies loads all policies from persistent storage
 	LoadPolicies() ([]Policy, error)
 
+	// SaveIdentity saves a security identity to persistent storage
+	SaveIdentity(id *Identity) error
+
+	// DeleteIdentity removes a security identity from persistent storage
+	DeleteIdentity(id uint32) error
+
+	// LoadIdentities loads all security identities from persistent storage
+	LoadIdentities() ([]Identity, error)
+
 	// Close closes the storage connection
 	Close() error
 }
@@ -48,7 +59,7 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 	return storage, nil
 }
 
-// initSchema creates the policies table if it doesn't exist
+// initSchema creates the policies and identities tables if they don't exist
 func (s *SQLiteStorage) initSchema() error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS policies (
@@ -60,6 +71,25 @@ func (s *SQLiteStorage) initSchema() error {
 		protocol TEXT NOT NULL,
 		action TEXT NOT NULL,
 		priority INTEGER NOT NULL,
+		direction TEXT NOT NULL DEFAULT 'both',
+		src_ports TEXT NOT NULL DEFAULT '',
+		dst_ports TEXT NOT NULL DEFAULT '',
+		src_port_range TEXT NOT NULL DEFAULT '',
+		dst_port_range TEXT NOT NULL DEFAULT '',
+		monitor INTEGER NOT NULL DEFAULT 0,
+		icmp_type INTEGER,
+		icmp_code INTEGER,
+		conn_states TEXT NOT NULL DEFAULT '',
+		vlan_id INTEGER NOT NULL DEFAULT 0,
+		vni INTEGER NOT NULL DEFAULT 0,
+		rate INTEGER NOT NULL DEFAULT 0,
+		burst INTEGER NOT NULL DEFAULT 0,
+		rate_unit TEXT NOT NULL DEFAULT '',
+		session_limit INTEGER NOT NULL DEFAULT 0,
+		mirror TEXT NOT NULL DEFAULT '',
+		mirror_sample INTEGER NOT NULL DEFAULT 0,
+		src_identity INTEGER NOT NULL DEFAULT 0,
+		dst_identity INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -68,6 +98,14 @@ func (s *SQLiteStorage) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_dst_ip ON policies(dst_ip);
 	CREATE INDEX IF NOT EXISTS idx_protocol ON policies(protocol);
 	CREATE INDEX IF NOT EXISTS idx_action ON policies(action);
+
+	CREATE TABLE IF NOT EXISTS identities (
+		identity INTEGER PRIMARY KEY,
+		labels TEXT NOT NULL,
+		cidrs TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 
 	_, err := s.db.Exec(schema)
@@ -75,14 +113,82 @@ func (s *SQLiteStorage) initSchema() error {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
+	return s.migrateSchema()
+}
+
+// schemaColumns lists columns added after the initial schema, so databases
+// created by older agents can be upgraded in place
+var schemaColumns = []struct {
+	name       string
+	definition string
+}{
+	{"direction", "TEXT NOT NULL DEFAULT 'both'"},
+	{"src_ports", "TEXT NOT NULL DEFAULT ''"},
+	{"dst_ports", "TEXT NOT NULL DEFAULT ''"},
+	{"src_port_range", "TEXT NOT NULL DEFAULT ''"},
+	{"dst_port_range", "TEXT NOT NULL DEFAULT ''"},
+	{"monitor", "INTEGER NOT NULL DEFAULT 0"},
+	{"icmp_type", "INTEGER"},
+	{"icmp_code", "INTEGER"},
+	{"conn_states", "TEXT NOT NULL DEFAULT ''"},
+	{"vlan_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"vni", "INTEGER NOT NULL DEFAULT 0"},
+	{"rate", "INTEGER NOT NULL DEFAULT 0"},
+	{"burst", "INTEGER NOT NULL DEFAULT 0"},
+	{"rate_unit", "TEXT NOT NULL DEFAULT ''"},
+	{"session_limit", "INTEGER NOT NULL DEFAULT 0"},
+	{"mirror", "TEXT NOT NULL DEFAULT ''"},
+	{"mirror_sample", "INTEGER NOT NULL DEFAULT 0"},
+	{"src_identity", "INTEGER NOT NULL DEFAULT 0"},
+	{"dst_identity", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// migrateSchema adds any columns missing from an existing policies table
+func (s *SQLiteStorage) migrateSchema() error {
+	rows, err := s.db.Query(`PRAGMA table_info(policies)`)
+	if err != nil {
+		return fmt.Errorf("failed to read table info: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, col := range schemaColumns {
+		if existing[col.name] {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE policies ADD COLUMN %s %s", col.name, col.definition)
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", col.name, err)
+		}
+		log.Infof("Policy storage migrated: added column %s", col.name)
+	}
+
 	return nil
 }
 
 // SavePolicy saves a policy to the database
 func (s *SQLiteStorage) SavePolicy(p *Policy) error {
 	query := `
-	INSERT INTO policies (rule_id, src_ip, dst_ip, src_port, dst_port, protocol, action, priority)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO policies (rule_id, src_ip, dst_ip, src_port, dst_port, protocol, action, priority, direction,
+		src_ports, dst_ports, src_port_range, dst_port_range, monitor, icmp_type, icmp_code, conn_states,
+		vlan_id, vni, rate, burst, rate_unit, session_limit, mirror, mirror_sample, src_identity, dst_identity)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(rule_id) DO UPDATE SET
 		src_ip = excluded.src_ip,
 		dst_ip = excluded.dst_ip,
@@ -91,6 +197,25 @@ func (s *SQLiteStorage) SavePolicy(p *Policy) error {
 		protocol = excluded.protocol,
 		action = excluded.action,
 		priority = excluded.priority,
+		direction = excluded.direction,
+		src_ports = excluded.src_ports,
+		dst_ports = excluded.dst_ports,
+		src_port_range = excluded.src_port_range,
+		dst_port_range = excluded.dst_port_range,
+		monitor = excluded.monitor,
+		icmp_type = excluded.icmp_type,
+		icmp_code = excluded.icmp_code,
+		conn_states = excluded.conn_states,
+		vlan_id = excluded.vlan_id,
+		vni = excluded.vni,
+		rate = excluded.rate,
+		burst = excluded.burst,
+		rate_unit = excluded.rate_unit,
+		session_limit = excluded.session_limit,
+		mirror = excluded.mirror,
+		mirror_sample = excluded.mirror_sample,
+		src_identity = excluded.src_identity,
+		dst_identity = excluded.dst_identity,
 		updated_at = CURRENT_TIMESTAMP
 	`
 
@@ -103,6 +228,25 @@ func (s *SQLiteStorage) SavePolicy(p *Policy) error {
 		p.Protocol,
 		p.Action,
 		p.Priority,
+		directionOrDefault(p.Direction),
+		joinPorts(p.SrcPorts),
+		joinPorts(p.DstPorts),
+		p.SrcPortRange,
+		p.DstPortRange,
+		p.Monitor,
+		p.IcmpType,
+		p.IcmpCode,
+		strings.Join(p.ConnStates, ","),
+		p.VlanID,
+		p.VNI,
+		p.Rate,
+		p.Burst,
+		p.RateUnit,
+		p.SessionLimit,
+		p.Mirror,
+		p.MirrorSample,
+		p.SrcIdentity,
+		p.DstIdentity,
 	)
 
 	if err != nil {
@@ -138,7 +282,9 @@ func (s *SQLiteStorage) DeletePolicy(ruleID uint32) error {
 // LoadPolicies loads all policies from the database
 func (s *SQLiteStorage) LoadPolicies() ([]Policy, error) {
 	query := `
-	SELECT rule_id, src_ip, dst_ip, src_port, dst_port, protocol, action, priority
+	SELECT rule_id, src_ip, dst_ip, src_port, dst_port, protocol, action, priority, direction,
+		src_ports, dst_ports, src_port_range, dst_port_range, monitor, icmp_type, icmp_code, conn_states,
+		vlan_id, vni, rate, burst, rate_unit, session_limit, mirror, mirror_sample, src_identity, dst_identity
 	FROM policies
 	ORDER BY priority DESC, rule_id ASC
 	`
@@ -152,6 +298,7 @@ func (s *SQLiteStorage) LoadPolicies() ([]Policy, error) {
 	var policies []Policy
 	for rows.Next() {
 		var p Policy
+		var srcPorts, dstPorts, connStates string
 		err := rows.Scan(
 			&p.RuleID,
 			&p.SrcIP,
@@ -161,10 +308,38 @@ func (s *SQLiteStorage) LoadPolicies() ([]Policy, error) {
 			&p.Protocol,
 			&p.Action,
 			&p.Priority,
+			&p.Direction,
+			&srcPorts,
+			&dstPorts,
+			&p.SrcPortRange,
+			&p.DstPortRange,
+			&p.Monitor,
+			&p.IcmpType,
+			&p.IcmpCode,
+			&connStates,
+			&p.VlanID,
+			&p.VNI,
+			&p.Rate,
+			&p.Burst,
+			&p.RateUnit,
+			&p.SessionLimit,
+			&p.Mirror,
+			&p.MirrorSample,
+			&p.SrcIdentity,
+			&p.DstIdentity,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan policy: %w", err)
 		}
+		if p.SrcPorts, err = splitPorts(srcPorts); err != nil {
+			return nil, fmt.Errorf("invalid src_ports for rule_id=%d: %w", p.RuleID, err)
+		}
+		if p.DstPorts, err = splitPorts(dstPorts); err != nil {
+			return nil, fmt.Errorf("invalid dst_ports for rule_id=%d: %w", p.RuleID, err)
+		}
+		if connStates != "" {
+			p.ConnStates = strings.Split(connStates, ",")
+		}
 		policies = append(policies, p)
 	}
 
@@ -176,6 +351,80 @@ func (s *SQLiteStorage) LoadPolicies() ([]Policy, error) {
 	return policies, nil
 }
 
+// SaveIdentity saves a security identity to the database
+func (s *SQLiteStorage) SaveIdentity(id *Identity) error {
+	query := `
+	INSERT INTO identities (identity, labels, cidrs)
+	VALUES (?, ?, ?)
+	ON CONFLICT(identity) DO UPDATE SET
+		labels = excluded.labels,
+		cidrs = excluded.cidrs,
+		updated_at = CURRENT_TIMESTAMP
+	`
+
+	_, err := s.db.Exec(query, id.ID, strings.Join(id.Labels, ","), strings.Join(id.CIDRs, ","))
+	if err != nil {
+		return fmt.Errorf("failed to save identity: %w", err)
+	}
+
+	log.Debugf("Identity saved to storage: %d", id.ID)
+	return nil
+}
+
+// DeleteIdentity removes a security identity from the database
+func (s *SQLiteStorage) DeleteIdentity(id uint32) error {
+	result, err := s.db.Exec(`DELETE FROM identities WHERE identity = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("identity not found: %d", id)
+	}
+
+	log.Debugf("Identity deleted from storage: %d", id)
+	return nil
+}
+
+// LoadIdentities loads all security identities from the database
+func (s *SQLiteStorage) LoadIdentities() ([]Identity, error) {
+	rows, err := s.db.Query(`SELECT identity, labels, cidrs FROM identities ORDER BY identity ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []Identity
+	for rows.Next() {
+		var (
+			id            Identity
+			labels, cidrs string
+		)
+		if err := rows.Scan(&id.ID, &labels, &cidrs); err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		if labels != "" {
+			id.Labels = strings.Split(labels, ",")
+		}
+		if cidrs != "" {
+			id.CIDRs = strings.Split(cidrs, ",")
+		}
+		identities = append(identities, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating identities: %w", err)
+	}
+
+	log.Infof("Loaded %d identities from storage", len(identities))
+	return identities, nil
+}
+
 // Close closes the database connection
 func (s *SQLiteStorage) Close() error {
 	if s.db != nil {
@@ -184,6 +433,40 @@ func (s *SQLiteStorage) Close() error {
 	return nil
 }
 
+// directionOrDefault normalizes an empty direction to "both"
+func directionOrDefault(dir string) string {
+	if dir == "" {
+		return "both"
+	}
+	return dir
+}
+
+// joinPorts encodes a port list as a comma-separated string
+func joinPorts(ports []uint16) string {
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = strconv.Itoa(int(port))
+	}
+	return strings.Join(parts, ",")
+}
+
+// splitPorts decodes a port list written by joinPorts
+func splitPorts(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var ports []uint16
+	for _, part := range strings.Split(s, ",") {
+		port, err := parsePort(part)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
 // GetPolicyCount returns the total number of policies in storage
 func (s *SQLiteStorage) GetPolicyCount() (int, error) {
 	query := `SELECT COUNT(*) FROM policies`
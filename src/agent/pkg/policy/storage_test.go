@@ -2,6 +2,7 @@
 package policy
 
 import (
+	"database/sql"
 	"os"
 	"testing"
 
@@ -338,3 +339,317 @@ func TestSQLiteStorage_ConcurrentOperations(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 3, count)
 }
+
+// TestSQLiteStorage_Direction tests persisting the policy direction
+func TestSQLiteStorage_Direction(t *testing.T) {
+	dbPath := "/tmp/test_policy_direction.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "tcp", Action: "allow",
+		Direction: "egress",
+	}))
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 2, SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "tcp", Action: "deny",
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+
+	byID := map[uint32]Policy{}
+	for _, p := range policies {
+		byID[p.RuleID] = p
+	}
+	assert.Equal(t, "egress", byID[1].Direction)
+	assert.Equal(t, "both", byID[2].Direction) // Empty direction defaults to both
+}
+
+// TestSQLiteStorage_Ports tests persisting port lists and ranges
+func TestSQLiteStorage_Ports(t *testing.T) {
+	dbPath := "/tmp/test_policy_ports.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "10.0.0.0/24", DstIP: "10.0.1.1", Protocol: "tcp", Action: "allow",
+		DstPorts: []uint16{80, 443}, SrcPortRange: "1024-65535", DstPortRange: "8000-8080,9000-9100",
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Nil(t, policies[0].SrcPorts)
+	assert.Equal(t, []uint16{80, 443}, policies[0].DstPorts)
+	assert.Equal(t, "1024-65535", policies[0].SrcPortRange)
+	assert.Equal(t, "8000-8080,9000-9100", policies[0].DstPortRange)
+}
+
+// TestSQLiteStorage_Monitor tests that the monitor flag round-trips
+func TestSQLiteStorage_Monitor(t *testing.T) {
+	dbPath := "/tmp/test_policy_monitor.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Protocol: "tcp", Action: "deny", Monitor: true,
+	}))
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 2, SrcIP: "10.0.0.1", DstIP: "10.0.0.3", Protocol: "tcp", Action: "deny",
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.True(t, policies[0].Monitor)
+	assert.False(t, policies[1].Monitor)
+}
+
+// TestSQLiteStorage_ICMP tests that ICMP type and code round-trip, with
+// unset fields loaded as nil
+func TestSQLiteStorage_ICMP(t *testing.T) {
+	dbPath := "/tmp/test_policy_icmp.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	echoReply, fragNeeded, unreachable := uint8(0), uint8(4), uint8(3)
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.2", Protocol: "icmp", Action: "allow", IcmpType: &echoReply,
+	}))
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 2, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.2", Protocol: "icmp", Action: "allow",
+		IcmpType: &unreachable, IcmpCode: &fragNeeded,
+	}))
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 3, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.2", Protocol: "icmp", Action: "deny",
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+
+	require.NotNil(t, policies[0].IcmpType)
+	assert.Equal(t, uint8(0), *policies[0].IcmpType)
+	assert.Nil(t, policies[0].IcmpCode)
+
+	require.NotNil(t, policies[1].IcmpType)
+	require.NotNil(t, policies[1].IcmpCode)
+	assert.Equal(t, uint8(3), *policies[1].IcmpType)
+	assert.Equal(t, uint8(4), *policies[1].IcmpCode)
+
+	assert.Nil(t, policies[2].IcmpType)
+	assert.Nil(t, policies[2].IcmpCode)
+}
+
+// TestSQLiteStorage_ConnStates tests persisting connection state matches
+func TestSQLiteStorage_ConnStates(t *testing.T) {
+	dbPath := "/tmp/test_policy_connstates.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.2", Protocol: "tcp", Action: "allow",
+		ConnStates: []string{"established", "related"},
+	}))
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 2, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.2", Protocol: "tcp", Action: "deny",
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+
+	assert.Equal(t, []string{"established", "related"}, policies[0].ConnStates)
+	assert.Nil(t, policies[1].ConnStates)
+}
+
+// TestSQLiteStorage_Encap tests persisting VLAN ID and VNI matches
+func TestSQLiteStorage_Encap(t *testing.T) {
+	dbPath := "/tmp/test_policy_encap.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.0/24", Protocol: "any", Action: "deny",
+		VlanID: 100, VNI: 5001,
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, uint16(100), policies[0].VlanID)
+	assert.Equal(t, uint32(5001), policies[0].VNI)
+}
+
+// TestSQLiteStorage_RateLimit tests persisting the token bucket of a rate_limit policy
+func TestSQLiteStorage_RateLimit(t *testing.T) {
+	dbPath := "/tmp/test_policy_ratelimit.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.5", DstPort: 5432, Protocol: "tcp",
+		Action: "rate_limit", Rate: 100, Burst: 200, RateUnit: "packets",
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, "rate_limit", policies[0].Action)
+	assert.Equal(t, uint64(100), policies[0].Rate)
+	assert.Equal(t, uint64(200), policies[0].Burst)
+	assert.Equal(t, "packets", policies[0].RateUnit)
+}
+
+// TestSQLiteStorage_SessionLimit tests persisting per-policy session limits
+func TestSQLiteStorage_SessionLimit(t *testing.T) {
+	dbPath := "/tmp/test_policy_session_limit.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.5", DstPort: 443, Protocol: "tcp",
+		Action: "allow", SessionLimit: 50,
+	}))
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 2, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.6", DstPort: 443, Protocol: "tcp",
+		Action: "allow",
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.Equal(t, uint32(50), policies[0].SessionLimit)
+	assert.Zero(t, policies[1].SessionLimit)
+}
+
+// TestSQLiteStorage_Mirror tests persisting mirror targets
+func TestSQLiteStorage_Mirror(t *testing.T) {
+	dbPath := "/tmp/test_policy_mirror.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.5", DstPort: 443, Protocol: "tcp",
+		Action: "allow", Mirror: "ids0", MirrorSample: 10,
+	}))
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 2, SrcIP: "0.0.0.0/0", DstIP: "10.0.0.6", DstPort: 443, Protocol: "tcp",
+		Action: "deny",
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.Equal(t, "ids0", policies[0].Mirror)
+	assert.Equal(t, uint32(10), policies[0].MirrorSample)
+	assert.Empty(t, policies[1].Mirror)
+	assert.Zero(t, policies[1].MirrorSample)
+}
+
+// TestSQLiteStorage_Identities tests persisting identities and the
+// identities policies match
+func TestSQLiteStorage_Identities(t *testing.T) {
+	dbPath := "/tmp/test_policy_identities.db"
+	defer os.Remove(dbPath)
+
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	require.NoError(t, storage.SaveIdentity(&Identity{ID: 200, Labels: []string{"app=db"}}))
+	require.NoError(t, storage.SaveIdentity(&Identity{
+		ID: 100, Labels: []string{"app=web", "env=prod"}, CIDRs: []string{"10.0.1.0/24", "2001:db8::5"},
+	}))
+	require.NoError(t, storage.SaveIdentity(&Identity{ID: 200, Labels: []string{"app=db"}, CIDRs: []string{"10.0.2.7"}}))
+
+	identities, err := storage.LoadIdentities()
+	require.NoError(t, err)
+	assert.Equal(t, []Identity{
+		{ID: 100, Labels: []string{"app=web", "env=prod"}, CIDRs: []string{"10.0.1.0/24", "2001:db8::5"}},
+		{ID: 200, Labels: []string{"app=db"}, CIDRs: []string{"10.0.2.7"}},
+	}, identities)
+
+	require.NoError(t, storage.DeleteIdentity(200))
+	assert.Error(t, storage.DeleteIdentity(200))
+
+	require.NoError(t, storage.SavePolicy(&Policy{
+		RuleID: 1, DstPort: 5432, Protocol: "tcp", Action: "allow", SrcIdentity: 100, DstIdentity: 200,
+	}))
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, uint32(100), policies[0].SrcIdentity)
+	assert.Equal(t, uint32(200), policies[0].DstIdentity)
+	assert.Empty(t, policies[0].SrcIP)
+}
+
+// TestSQLiteStorage_MigrateSchema tests upgrading a database created by an older agent
+func TestSQLiteStorage_MigrateSchema(t *testing.T) {
+	dbPath := "/tmp/test_policy_migrate.db"
+	defer os.Remove(dbPath)
+
+	// Create a database with the original schema
+	db, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+	CREATE TABLE policies (
+		rule_id INTEGER PRIMARY KEY,
+		src_ip TEXT NOT NULL,
+		dst_ip TEXT NOT NULL,
+		src_port INTEGER NOT NULL,
+		dst_port INTEGER NOT NULL,
+		protocol TEXT NOT NULL,
+		action TEXT NOT NULL,
+		priority INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO policies (rule_id, src_ip, dst_ip, src_port, dst_port, protocol, action, priority)
+	VALUES (7, '10.0.0.1', '10.0.0.2', 0, 80, 'tcp', 'allow', 10);
+	`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// Opening with the current agent adds the missing columns
+	storage, err := NewSQLiteStorage(dbPath)
+	require.NoError(t, err)
+	defer storage.Close()
+
+	policies, err := storage.LoadPolicies()
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, uint32(7), policies[0].RuleID)
+	assert.Equal(t, "both", policies[0].Direction)
+	assert.Nil(t, policies[0].DstPorts)
+	assert.Empty(t, policies[0].DstPortRange)
+}
@@ -11,28 +11,32 @@ import (
 )
 
 // FlowKey represents a 5-tuple flow key for eBPF maps.
-// This must match the kernel-side struct exactly.
+// This must match the kernel-side struct exactly. Addresses are 128-bit,
+// with IPv4 stored in IPv4-mapped IPv6 form.
 type FlowKey struct {
-	SrcIP    uint32
-	DstIP    uint32
-	SrcPort  uint16
-	DstPort  uint16
-	Protocol uint8
-	Pad      [3]uint8
+	SrcIP     [4]uint32
+	DstIP     [4]uint32
+	SrcPort   uint16
+	DstPort   uint16
+	Protocol  uint8
+	Direction uint8 // 0 = ingress, 1 = egress
+	Pad       [2]uint8
 }
 
 // SessionValue represents session tracking data in eBPF map.
 type SessionValue struct {
-	CreatedAt           uint64
-	LastSeen            uint64
-	PacketsToServer     uint64
-	PacketsToClient     uint64
-	BytesToServer       uint64
-	BytesToClient       uint64
-	State               uint8
-	TCPState            uint8
-	Action              uint8
-	Pad                 [5]uint8
+	CreatedAt       uint64
+	LastSeen        uint64
+	PacketsToServer uint64
+	PacketsToClient uint64
+	BytesToServer   uint64
+	BytesToClient   uint64
+	State           uint8
+	TCPState        uint8
+	Action          uint8
+	Flags           uint8
+	Direction       uint8
+	Pad             [3]uint8
 }
 
 // PolicyValue represents policy data in eBPF map.
@@ -42,35 +46,25 @@ type PolicyValue struct {
 	Priority   uint16
 	RuleID     uint32
 	HitCount   uint64
+	Monitor    uint8
+	Pad        [7]uint8
 }
 
 // NewFlowKey creates a FlowKey from network parameters.
 // IP addresses can be in CIDR format (e.g., "192.168.1.0/24") or plain IP.
 // This function matches the exact behavior of PolicyManager's parseCIDR.
 func NewFlowKey(srcIP, dstIP string, srcPort, dstPort uint16, protocol string) (*FlowKey, error) {
-	// Parse source IP - add /32 if no CIDR notation (matches PolicyManager)
-	if !strings.Contains(srcIP, "/") {
-		srcIP = srcIP + "/32"
-	}
-	srcIPParsed, _, err := net.ParseCIDR(srcIP)
+	// Parse source IP - add host prefix if no CIDR notation (matches PolicyManager)
+	srcIPParsed, err := parseHostCIDR(srcIP)
 	if err != nil {
 		return nil, fmt.Errorf("invalid source IP: %s", srcIP)
 	}
-	srcIP4 := srcIPParsed.To4()
 
-	// Parse destination IP - add /32 if no CIDR notation (matches PolicyManager)
-	if !strings.Contains(dstIP, "/") {
-		dstIP = dstIP + "/32"
-	}
-	dstIPParsed, _, err := net.ParseCIDR(dstIP)
+	// Parse destination IP - add host prefix if no CIDR notation (matches PolicyManager)
+	dstIPParsed, err := parseHostCIDR(dstIP)
 	if err != nil {
 		return nil, fmt.Errorf("invalid destination IP: %s", dstIP)
 	}
-	dstIP4 := dstIPParsed.To4()
-
-	if srcIP4 == nil || dstIP4 == nil {
-		return nil, fmt.Errorf("only IPv4 is supported")
-	}
 
 	// Convert protocol string to number
 	proto, err := protocolToNumber(protocol)
@@ -79,8 +73,8 @@ func NewFlowKey(srcIP, dstIP string, srcPort, dstPort uint16, protocol string) (
 	}
 
 	key := &FlowKey{
-		SrcIP:    ipToUint32(srcIP4),
-		DstIP:    ipToUint32(dstIP4),
+		SrcIP:    ipToKeyAddr(srcIPParsed),
+		DstIP:    ipToKeyAddr(dstIPParsed),
 		SrcPort:  htons(srcPort),
 		DstPort:  htons(dstPort),
 		Protocol: proto,
@@ -170,14 +164,30 @@ func GetAllStatistics(statsMap *ebpf.Map) (map[string]uint64, error) {
 
 	// Statistic types (must match kernel definitions)
 	statTypes := map[string]uint32{
-		"total_packets":   0,
-		"allowed_packets": 1,
-		"denied_packets":  2,
-		"new_sessions":    3,
-		"closed_sessions": 4,
-		"active_sessions": 5,
-		"policy_hits":     6,
-		"policy_misses":   7,
+		"total_packets":        0,
+		"allowed_packets":      1,
+		"denied_packets":       2,
+		"new_sessions":         3,
+		"closed_sessions":      4,
+		"active_sessions":      5,
+		"policy_hits":          6,
+		"policy_misses":        7,
+		"ingress_allowed":      8,
+		"ingress_denied":       9,
+		"egress_allowed":       10,
+		"egress_denied":        11,
+		"reply_packets":        12,
+		"sessions_reevaluated": 13,
+		"xdp_dropped":          14,
+		"exempted_flows":       15,
+		"would_deny":           16,
+		"ringbuf_drops":        17,
+		"invalid_tcp_drops":    18,
+		"fragment_drops":       19,
+		"malformed_drops":      20,
+		"rate_limited":         21,
+		"session_limit_drops":  22,
+		"rejects_sent":         23,
 	}
 
 	for name, typ := range statTypes {
@@ -231,13 +241,29 @@ func VerifySessionExists(sessionMap *ebpf.Map, srcIP, dstIP string, srcPort, dst
 
 // Helper functions
 
-func ipToUint32(ip net.IP) uint32 {
+func parseHostCIDR(addr string) (net.IP, error) {
+	if !strings.Contains(addr, "/") {
+		if strings.Contains(addr, ":") {
+			addr = addr + "/128"
+		} else {
+			addr = addr + "/32"
+		}
+	}
+	ip, _, err := net.ParseCIDR(addr)
+	return ip, err
+}
+
+func ipToKeyAddr(ip net.IP) [4]uint32 {
 	// Must match the byte order used by PolicyManager (LittleEndian)
-	ip = ip.To4()
+	var addr [4]uint32
+	ip = ip.To16()
 	if ip == nil {
-		return 0
+		return addr
+	}
+	for i := range addr {
+		addr[i] = binary.LittleEndian.Uint32(ip[i*4:])
 	}
-	return binary.LittleEndian.Uint32(ip)
+	return addr
 }
 
 func htons(port uint16) uint16 {
@@ -252,6 +278,8 @@ func protocolToNumber(proto string) (uint8, error) {
 		return 17, nil
 	case "icmp":
 		return 1, nil
+	case "icmpv6":
+		return 58, nil
 	case "any":
 		return 0, nil
 	default:
@@ -198,6 +198,11 @@ func (tn *TestNetwork) configureNamespace(ns netns.NsHandle, vethName, ipAddr st
 		return fmt.Errorf("failed to parse IP %s: %w", ipAddr, err)
 	}
 
+	// Skip duplicate address detection so IPv6 addresses are usable at once
+	if addr.IP.To4() == nil {
+		addr.Flags |= unix.IFA_F_NODAD
+	}
+
 	// Add IP address to interface
 	if err := netlink.AddrAdd(link, addr); err != nil {
 		return fmt.Errorf("failed to add IP address: %w", err)
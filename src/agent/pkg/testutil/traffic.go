@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -181,7 +182,7 @@ func (ts *TestServer) Stop() {
 func SendTCPPacket(ns netns.NsHandle, dst string, port int, data []byte) error {
 	return RunInNamespace(ns, func() error {
 		// Connect to server
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", dst, port), 2*time.Second)
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(dst, strconv.Itoa(port)), 2*time.Second)
 		if err != nil {
 			return fmt.Errorf("failed to connect: %w", err)
 		}
@@ -214,7 +215,7 @@ func SendTCPPacket(ns netns.NsHandle, dst string, port int, data []byte) error {
 func SendUDPPacket(ns netns.NsHandle, dst string, port int, data []byte) error {
 	return RunInNamespace(ns, func() error {
 		// Connect to server
-		conn, err := net.Dial("udp", fmt.Sprintf("%s:%d", dst, port))
+		conn, err := net.Dial("udp", net.JoinHostPort(dst, strconv.Itoa(port)))
 		if err != nil {
 			return fmt.Errorf("failed to create UDP connection: %w", err)
 		}
@@ -279,7 +280,7 @@ func TryConnect(ns netns.NsHandle, host string, port int) bool {
 	var connected bool
 
 	err := RunInNamespace(ns, func() error {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", host, port), 1*time.Second)
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), 1*time.Second)
 		if err != nil {
 			connected = false
 			return err
@@ -293,13 +294,49 @@ func TryConnect(ns netns.NsHandle, host string, port int) bool {
 	return err == nil && connected
 }
 
+// TryConnectFrom attempts a TCP connection like TryConnect, bound to a
+// fixed local port.
+func TryConnectFrom(ns netns.NsHandle, host string, port, localPort int) bool {
+	var connected bool
+
+	err := RunInNamespace(ns, func() error {
+		dialer := net.Dialer{
+			Timeout:   1 * time.Second,
+			LocalAddr: &net.TCPAddr{Port: localPort},
+		}
+		conn, err := dialer.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			connected = false
+			return err
+		}
+		defer conn.Close()
+
+		connected = true
+		return nil
+	})
+
+	return err == nil && connected
+}
+
+// DialTCP attempts a TCP connection like TryConnect and returns the dial
+// error, which tells a refused connection from a timed out one.
+func DialTCP(ns netns.NsHandle, host string, port int, timeout time.Duration) error {
+	return RunInNamespace(ns, func() error {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
 // TryConnectUDP attempts to send a UDP packet to test reachability.
 // Returns true if packet can be sent, false otherwise.
 func TryConnectUDP(ns netns.NsHandle, host string, port int) bool {
 	var connected bool
 
 	err := RunInNamespace(ns, func() error {
-		conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:%d", host, port), 1*time.Second)
+		conn, err := net.DialTimeout("udp", net.JoinHostPort(host, strconv.Itoa(port)), 1*time.Second)
 		if err != nil {
 			connected = false
 			return err
@@ -0,0 +1,318 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package e2e
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/dataplane"
+	"github.com/ebpf-microsegment/src/agent/pkg/policy"
+	"github.com/ebpf-microsegment/src/agent/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestE2E_IPv6DenyPolicy tests that policies are enforced on IPv6 traffic.
+func TestE2E_IPv6DenyPolicy(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	netCfg := testutil.DefaultNetworkConfig()
+	netCfg.ClientIP = "fd00:100::1/64"
+	netCfg.ServerIP = "fd00:100::2/64"
+	netCfg.Subnet = "fd00:100::/64"
+
+	env, err := NewE2ETestEnvWithConfig(t, netCfg, dataplane.DefaultConfig())
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	_, err = env.StartTCPServer(8080)
+	require.NoError(t, err, "Failed to start TCP server")
+	_, err = env.StartTCPServer(8081)
+	require.NoError(t, err, "Failed to start TCP server")
+
+	// Baseline: no policy, traffic is allowed
+	env.AssertTrafficAllowed(8080)
+
+	err = env.CreatePolicy(&policy.Policy{
+		RuleID:   600,
+		SrcIP:    netCfg.ClientIP,
+		DstIP:    env.Network.GetServerIP() + "/128",
+		DstPort:  8080,
+		Protocol: "tcp",
+		Action:   "deny",
+		Priority: 10,
+	})
+	require.NoError(t, err, "Failed to create policy")
+
+	env.AssertTrafficBlocked(8080)
+	env.AssertTrafficAllowed(8081)
+
+	stats := env.GetStatistics()
+	assert.Greater(t, stats.DeniedPackets, uint64(0), "Should have denied packets")
+}
+
+// TestE2E_EgressPolicy tests that egress policies block connections opened
+// from the protected side, while replies of allowed ingress connections
+// still leave through the egress hook.
+func TestE2E_EgressPolicy(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	dpCfg := dataplane.DefaultConfig()
+	dpCfg.EnableEgress = true
+
+	env, err := NewE2ETestEnvWithConfig(t, testutil.DefaultNetworkConfig(), dpCfg)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	// Servers on the client side, reached from the server namespace
+	for _, port := range []int{9090, 9091} {
+		server, err := testutil.StartTCPServer(env.Network.ClientNS, port)
+		require.NoError(t, err, "Failed to start TCP server")
+		defer server.Stop()
+	}
+	_, err = env.StartTCPServer(8080)
+	require.NoError(t, err, "Failed to start TCP server")
+
+	clientIP := env.Network.GetClientIP()
+
+	err = env.CreatePolicy(&policy.Policy{
+		RuleID:    601,
+		SrcIP:     env.Network.GetServerIP() + "/32",
+		DstIP:     clientIP + "/32",
+		DstPort:   9090,
+		Protocol:  "tcp",
+		Action:    "deny",
+		Priority:  10,
+		Direction: "egress",
+	})
+	require.NoError(t, err, "Failed to create policy")
+
+	assert.False(t, testutil.TryConnect(env.Network.ServerNS, clientIP, 9090),
+		"Egress traffic to port 9090 should be blocked")
+	assert.True(t, testutil.TryConnect(env.Network.ServerNS, clientIP, 9091),
+		"Egress traffic to port 9091 should be allowed")
+
+	// The egress rule doesn't apply to ingress connections and their replies
+	env.AssertTrafficAllowed(8080)
+
+	stats := env.GetStatistics()
+	assert.Greater(t, stats.EgressDenied, uint64(0), "Should have denied egress packets")
+	assert.Greater(t, stats.EgressAllowed, uint64(0), "Should have allowed egress packets")
+}
+
+// TestE2E_ConnStatePolicy tests that policies only match packets of the
+// configured connection states.
+func TestE2E_ConnStatePolicy(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	env, err := NewE2ETestEnv(t)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	_, err = env.StartTCPServer(8080)
+	require.NoError(t, err, "Failed to start TCP server")
+	_, err = env.StartTCPServer(8081)
+	require.NoError(t, err, "Failed to start TCP server")
+
+	clientIP := env.Network.GetClientIP()
+	serverIP := env.Network.GetServerIP()
+
+	// New connections to 8080 are denied
+	err = env.CreatePolicy(&policy.Policy{
+		RuleID:     602,
+		SrcIP:      clientIP + "/32",
+		DstIP:      serverIP + "/32",
+		DstPort:    8080,
+		Protocol:   "tcp",
+		Action:     "deny",
+		Priority:   10,
+		ConnStates: []string{"new"},
+	})
+	require.NoError(t, err, "Failed to create policy")
+
+	// Only invalid packets to 8081 are denied, a regular handshake isn't
+	err = env.CreatePolicy(&policy.Policy{
+		RuleID:     603,
+		SrcIP:      clientIP + "/32",
+		DstIP:      serverIP + "/32",
+		DstPort:    8081,
+		Protocol:   "tcp",
+		Action:     "deny",
+		Priority:   10,
+		ConnStates: []string{"invalid"},
+	})
+	require.NoError(t, err, "Failed to create policy")
+
+	env.AssertTrafficBlocked(8080)
+	env.AssertTrafficAllowed(8081)
+}
+
+// TestE2E_EstablishedPolicy tests that a TCP session is evaluated again as
+// established once its handshake completes, so "established" rules apply to
+// the rest of the connection.
+func TestE2E_EstablishedPolicy(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	// The egress hook sees the SYN-ACK that moves the handshake forward
+	dpCfg := dataplane.DefaultConfig()
+	dpCfg.EnableEgress = true
+
+	env, err := NewE2ETestEnvWithConfig(t, testutil.DefaultNetworkConfig(), dpCfg)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	_, err = env.StartTCPServer(8080)
+	require.NoError(t, err, "Failed to start TCP server")
+
+	// Baseline: the echo round trip works
+	require.NoError(t, env.SendTCPTraffic(8080, []byte("before")))
+
+	err = env.CreatePolicy(&policy.Policy{
+		RuleID:     606,
+		SrcIP:      env.Network.GetClientIP() + "/32",
+		DstIP:      env.Network.GetServerIP() + "/32",
+		DstPort:    8080,
+		Protocol:   "tcp",
+		Action:     "deny",
+		Priority:   10,
+		Direction:  "ingress",
+		ConnStates: []string{"established"},
+	})
+	require.NoError(t, err, "Failed to create policy")
+
+	// The handshake is new and allowed; the data after it is established
+	// and denied
+	env.AssertTrafficAllowed(8080)
+	assert.Error(t, env.SendTCPTraffic(8080, []byte("after")),
+		"Data of an established connection should be denied")
+
+	stats := env.GetStatistics()
+	assert.Greater(t, stats.DeniedPackets, uint64(0), "Should have denied packets")
+}
+
+// TestE2E_RejectPolicy tests that a "reject" policy answers connection
+// attempts with a TCP reset instead of silently dropping them.
+func TestE2E_RejectPolicy(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	env, err := NewE2ETestEnv(t)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	_, err = env.StartTCPServer(8080)
+	require.NoError(t, err, "Failed to start TCP server")
+
+	err = env.CreatePolicy(&policy.Policy{
+		RuleID:   604,
+		SrcIP:    env.Network.GetClientIP() + "/32",
+		DstIP:    env.Network.GetServerIP() + "/32",
+		DstPort:  8080,
+		Protocol: "tcp",
+		Action:   "reject",
+		Priority: 10,
+	})
+	require.NoError(t, err, "Failed to create policy")
+
+	start := time.Now()
+	err = testutil.DialTCP(env.Network.ClientNS, env.Network.GetServerIP(), 8080, 3*time.Second)
+	elapsed := time.Since(start)
+
+	require.Error(t, err, "Connection should be rejected")
+	assert.True(t, errors.Is(err, syscall.ECONNREFUSED), "Expected connection refused, got %v", err)
+	assert.Less(t, elapsed, time.Second, "Rejection should not wait for the dial timeout")
+
+	stats := env.GetStatistics()
+	assert.Greater(t, stats.DeniedPackets, uint64(0), "Should have denied packets")
+}
+
+// TestE2E_XDPDenyPolicy tests policy enforcement with the XDP ingress hook.
+func TestE2E_XDPDenyPolicy(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	dpCfg := dataplane.DefaultConfig()
+	dpCfg.Hook = dataplane.HookModeXDP
+
+	env, err := NewE2ETestEnvWithConfig(t, testutil.DefaultNetworkConfig(), dpCfg)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	xdp, tc := env.DataPlane.IngressHooks()
+	require.True(t, xdp, "XDP program should be attached")
+	require.False(t, tc, "TC ingress program should not be attached")
+
+	_, err = env.StartTCPServer(8080)
+	require.NoError(t, err, "Failed to start TCP server")
+	_, err = env.StartTCPServer(8081)
+	require.NoError(t, err, "Failed to start TCP server")
+
+	err = env.CreatePolicy(&policy.Policy{
+		RuleID:   605,
+		SrcIP:    env.Network.GetClientIP() + "/32",
+		DstIP:    env.Network.GetServerIP() + "/32",
+		DstPort:  8080,
+		Protocol: "tcp",
+		Action:   "deny",
+		Priority: 10,
+	})
+	require.NoError(t, err, "Failed to create policy")
+
+	env.AssertTrafficBlocked(8080)
+	env.AssertTrafficAllowed(8081)
+
+	stats := env.GetStatistics()
+	assert.Greater(t, stats.XDPDropped, uint64(0), "Should have packets dropped by XDP")
+}
+
+// TestE2E_ConcurrentConfigUpdates tests that concurrent updates of
+// different runtime settings all take effect.
+func TestE2E_ConcurrentConfigUpdates(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	env, err := NewE2ETestEnv(t)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	patches := []func(rc *dataplane.RuntimeConfig){
+		func(rc *dataplane.RuntimeConfig) { rc.MonitorMode = true },
+		func(rc *dataplane.RuntimeConfig) { rc.DropInvalidTCP = true },
+		func(rc *dataplane.RuntimeConfig) { rc.DecapVXLAN = true },
+		func(rc *dataplane.RuntimeConfig) { rc.SourceSessionLimit = 100 },
+	}
+
+	var wg sync.WaitGroup
+	for _, patch := range patches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				_, err := env.DataPlane.UpdateRuntimeConfig(patch)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	rc, err := env.DataPlane.RuntimeConfig()
+	require.NoError(t, err)
+	assert.True(t, rc.MonitorMode)
+	assert.True(t, rc.DropInvalidTCP)
+	assert.True(t, rc.DecapVXLAN)
+	assert.Equal(t, uint32(100), rc.SourceSessionLimit)
+}
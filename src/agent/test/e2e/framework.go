@@ -49,6 +49,13 @@ type E2ETestEnv struct {
 //   - *E2ETestEnv: The test environment
 //   - error: Error if setup fails
 func NewE2ETestEnv(t *testing.T) (*E2ETestEnv, error) {
+	return NewE2ETestEnvWithConfig(t, testutil.DefaultNetworkConfig(), dataplane.DefaultConfig())
+}
+
+// NewE2ETestEnvWithConfig creates an end-to-end test environment with a
+// custom network (e.g. IPv6 addresses) and data plane configuration (e.g.
+// egress or XDP hooks). The data plane is always attached to the server veth.
+func NewE2ETestEnvWithConfig(t *testing.T, netCfg *testutil.NetworkConfig, dpCfg *dataplane.Config) (*E2ETestEnv, error) {
 	env := &E2ETestEnv{
 		T:            t,
 		HTTPClient:   &http.Client{Timeout: 5 * time.Second},
@@ -61,7 +68,7 @@ func NewE2ETestEnv(t *testing.T) (*E2ETestEnv, error) {
 	}
 
 	// Create network environment
-	network, err := testutil.NewTestNetwork()
+	network, err := testutil.NewTestNetworkWithConfig(netCfg)
 	if err != nil {
 		env.Cleanup()
 		return nil, fmt.Errorf("failed to create test network: %w", err)
@@ -88,7 +95,10 @@ func NewE2ETestEnv(t *testing.T) (*E2ETestEnv, error) {
 	var dp *dataplane.DataPlane
 	err = network.RunInServerNS(func() error {
 		var loadErr error
-		dp, loadErr = dataplane.New(network.ServerVeth)
+		cfg := *dpCfg
+		cfg.Interface = network.ServerVeth
+		cfg.Interfaces = nil
+		dp, loadErr = dataplane.NewWithConfig(&cfg)
 		return loadErr
 	})
 	if err != nil {
@@ -125,6 +135,11 @@ func (env *E2ETestEnv) CreatePolicy(p *policy.Policy) error {
 	return env.PolicyManager.AddPolicy(p)
 }
 
+// UpdatePolicy replaces a policy via the PolicyManager.
+func (env *E2ETestEnv) UpdatePolicy(p *policy.Policy) error {
+	return env.PolicyManager.UpdatePolicy(p)
+}
+
 // DeletePolicy deletes a policy via the PolicyManager.
 func (env *E2ETestEnv) DeletePolicy(p *policy.Policy) error {
 	return env.PolicyManager.DeletePolicy(p)
@@ -222,6 +237,13 @@ func (env *E2ETestEnv) TryConnect(port int) bool {
 	return testutil.TryConnect(env.Network.ClientNS, serverIP, port)
 }
 
+// TryConnectFrom attempts to connect from client to server using a fixed
+// client port.
+func (env *E2ETestEnv) TryConnectFrom(port, localPort int) bool {
+	serverIP := env.Network.GetServerIP()
+	return testutil.TryConnectFrom(env.Network.ClientNS, serverIP, port, localPort)
+}
+
 // TryConnectUDP attempts UDP communication from client to server.
 func (env *E2ETestEnv) TryConnectUDP(port int) bool {
 	serverIP := env.Network.GetServerIP()
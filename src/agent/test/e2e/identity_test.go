@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
+package e2e
+
+import (
+	"testing"
+
+	"github.com/ebpf-microsegment/src/agent/pkg/policy"
+	"github.com/ebpf-microsegment/src/agent/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestE2E_IdentityRecovery tests that a new policy manager on the same
+// maps, as after an agent restart with pinned maps, recovers identities
+// from the ipcache and can delete them.
+func TestE2E_IdentityRecovery(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	env, err := NewE2ETestEnv(t)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	clientIP := env.Network.GetClientIP()
+	require.NoError(t, env.PolicyManager.SetIdentity(&policy.Identity{
+		ID:     42,
+		Labels: []string{"app=client"},
+		CIDRs:  []string{clientIP},
+	}))
+
+	restarted := policy.NewManager(env.DataPlane)
+	id, err := restarted.GetIdentity(42)
+	require.NoError(t, err, "Identity should be recovered from the ipcache")
+	assert.Equal(t, []string{clientIP}, id.CIDRs)
+	assert.Empty(t, id.Labels, "The ipcache holds no labels")
+
+	require.NoError(t, restarted.DeleteIdentity(42))
+	assert.Empty(t, policy.NewManager(env.DataPlane).ListIdentities(),
+		"Deleted identity should be gone from the ipcache")
+}
+
+// TestE2E_IdentityRestoreDropsStale tests that LoadPersisted restores the
+// stored identities with their labels and removes ipcache entries storage
+// doesn't know of.
+func TestE2E_IdentityRestoreDropsStale(t *testing.T) {
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	env, err := NewE2ETestEnv(t)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	// Persisted identity
+	require.NoError(t, env.PolicyManager.SetIdentity(&policy.Identity{
+		ID:     43,
+		Labels: []string{"app=client"},
+		CIDRs:  []string{env.Network.GetClientIP()},
+	}))
+	// Identity only in the ipcache
+	require.NoError(t, policy.NewManager(env.DataPlane).SetIdentity(&policy.Identity{
+		ID:     44,
+		Labels: []string{"app=server"},
+		CIDRs:  []string{env.Network.GetServerIP()},
+	}))
+
+	restarted := policy.NewManagerWithStorage(env.DataPlane, env.Storage)
+	require.NoError(t, restarted.LoadPersisted())
+
+	identities := restarted.ListIdentities()
+	require.Len(t, identities, 1)
+	assert.Equal(t, uint32(43), identities[0].ID)
+	assert.Equal(t, []string{"app=client"}, identities[0].Labels)
+
+	assert.Len(t, policy.NewManager(env.DataPlane).ListIdentities(), 1,
+		"Stale identity should be removed from the ipcache")
+}
@@ -204,3 +204,91 @@ func TestE2E_PolicyPriority(t *testing.T) {
 	stats := env.GetStatistics()
 	assert.Greater(t, stats.AllowedPackets, uint64(0), "Should have allowed packets")
 }
+
+// TestE2E_APIPortExemption tests that the API port exemption only covers
+// the local end of a flow.
+func TestE2E_APIPortExemption(t *testing.T) {
+	// Skip if not root
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	// Create test environment
+	env, err := NewE2ETestEnv(t)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	const apiPort = 9090
+
+	rc, err := env.DataPlane.RuntimeConfig()
+	require.NoError(t, err)
+	rc.SafetyExemptions = true
+	rc.APIPort = apiPort
+	require.NoError(t, env.DataPlane.SetRuntimeConfig(rc))
+
+	apiServer, err := env.StartTCPServer(apiPort)
+	require.NoError(t, err, "Failed to start API port server")
+	defer apiServer.Stop()
+
+	server, err := env.StartTCPServer(8080)
+	require.NoError(t, err, "Failed to start TCP server")
+	defer server.Stop()
+
+	// Deny all TCP from the client
+	denyPolicy := &policy.Policy{
+		RuleID:   400,
+		SrcIP:    env.Network.GetClientIP(),
+		DstIP:    env.Network.GetServerIP(),
+		Protocol: "tcp",
+		Action:   "deny",
+		Priority: 10,
+	}
+	require.NoError(t, env.CreatePolicy(denyPolicy))
+
+	// The local API port stays reachable
+	assert.True(t, env.TryConnect(apiPort), "API port should be exempt")
+
+	// A remote source port equal to the API port is still denied
+	assert.False(t, env.TryConnectFrom(8080, apiPort),
+		"Remote source port %d should not be exempt", apiPort)
+}
+
+// TestE2E_UpdatePolicy tests that adding a policy with an installed rule
+// ID fails and leaves the rule enforcing, while updating replaces it.
+func TestE2E_UpdatePolicy(t *testing.T) {
+	// Skip if not root
+	if msg := testutil.CheckE2ERequirements(); msg != "" {
+		t.Skip(msg)
+	}
+
+	// Create test environment
+	env, err := NewE2ETestEnv(t)
+	require.NoError(t, err, "Failed to create test environment")
+	defer env.Cleanup()
+
+	server, err := env.StartTCPServer(8080)
+	require.NoError(t, err, "Failed to start TCP server")
+	defer server.Stop()
+
+	p := &policy.Policy{
+		RuleID:   500,
+		SrcIP:    env.Network.GetClientIP(),
+		DstIP:    env.Network.GetServerIP(),
+		DstPort:  8080,
+		Protocol: "tcp",
+		Action:   "deny",
+		Priority: 10,
+	}
+	require.NoError(t, env.CreatePolicy(p))
+	env.AssertTrafficBlocked(8080)
+
+	// Adding the rule ID again is refused and keeps the deny rule
+	allow := *p
+	allow.Action = "allow"
+	assert.ErrorIs(t, env.CreatePolicy(&allow), policy.ErrPolicyExists)
+	env.AssertTrafficBlocked(8080)
+
+	// Updating replaces it
+	require.NoError(t, env.UpdatePolicy(&allow))
+	env.AssertTrafficAllowed(8080)
+}
@@ -6,17 +6,71 @@
 
 #define MAX_ENTRIES_SESSION 100000
 #define MAX_ENTRIES_POLICY 10000
-#define MAX_ENTRIES_WILDCARD_POLICY 1000
+#define MAX_ENTRIES_WILDCARD_POLICY 4096
+#define MAX_ENTRIES_CIDR_PREFIX 16384
+#define MAX_ENTRIES_MONITOR_IFACES 1024
+#define MAX_ENTRIES_FRAGMENT 8192
+#define MAX_ENTRIES_SOURCE 65536
+#define MAX_ENTRIES_MIRROR_TARGETS 256
+#define MAX_ENTRIES_IPCACHE 65536
+#define MAX_ENTRIES_IDENTITY 4096
+#define MAX_ENTRIES_REJECT_PENDING 2048
+
+// Maximum wildcard rules indexed under one CIDR prefix
+#define MAX_CIDR_RULES_PER_PREFIX 64
+
+// Maximum loop steps for one CIDR trie lookup: every rule indexed under a
+// prefix covering the address, plus one step per covering prefix
+#define MAX_CIDR_CANDIDATES 128
+
+// Traffic direction (which TC hook saw the packet)
+enum traffic_direction {
+    DIRECTION_INGRESS = 0,
+    DIRECTION_EGRESS,
+};
+
+// Direction mask for wildcard policies (0 = both, for zeroed entries)
+#define POLICY_DIR_INGRESS (1 << DIRECTION_INGRESS)
+#define POLICY_DIR_EGRESS  (1 << DIRECTION_EGRESS)
+#define POLICY_DIR_BOTH    (POLICY_DIR_INGRESS | POLICY_DIR_EGRESS)
+
+// ICMP message type and code as stored in flow_key.dst_port (host order)
+#define ICMP_KEY_PORT(type, code) (((type) << 8) | (code))
+
+// ICMP fields a wildcard policy matches on (wildcard_policy.icmp_match)
+#define ICMP_MATCH_TYPE (1 << 0)
+#define ICMP_MATCH_CODE (1 << 1)
+
+// Connection state of a packet, matched by wildcard policies
+enum conn_state {
+    CONN_STATE_NEW = 0,       // Opens a connection (TCP SYN, first UDP/ICMP packet)
+    CONN_STATE_ESTABLISHED,   // Belongs to a connection opened earlier
+    CONN_STATE_RELATED,       // ICMP error about a tracked session
+    CONN_STATE_INVALID,       // Bad TCP flags, stray RST or unrelated ICMP error
+};
+
+// Tunnels decapsulated before policy evaluation (global_config.decap_tunnels)
+#define TUNNEL_DECAP_VXLAN  (1 << 0)
+#define TUNNEL_DECAP_GENEVE (1 << 1)
 
 // 5-tuple flow key for session tracking
+// Addresses are 128-bit in network byte order. IPv4 addresses are stored
+// in IPv4-mapped IPv6 form (::ffff:a.b.c.d) so both families share one key.
+// The direction is part of the key so ingress and egress sessions for the
+// same 5-tuple (e.g. on loopback) are tracked independently.
+// For ICMP and ICMPv6, src_port holds the echo identifier (0 for messages
+// without one) and dst_port holds (type << 8 | code), see ICMP_KEY_PORT.
+// The fields are laid out without holes, so the struct needs no packing;
+// a packed key would be read one byte at a time.
 struct flow_key {
-    __u32 src_ip;
-    __u32 dst_ip;
+    __u32 src_ip[4];
+    __u32 dst_ip[4];
     __u16 src_port;
     __u16 dst_port;
     __u8  protocol;
-    __u8  pad[3];  // Padding for alignment
-} __attribute__((packed));
+    __u8  direction;  // enum traffic_direction
+    __u8  pad[2];     // Padding for alignment
+};
 
 // Session state tracking
 enum session_state {
@@ -40,36 +94,60 @@ enum tcp_state {
     TCP_STATE_TIME_WAIT,
 };
 
+// Session flags
+#define SESSION_FLAG_FIN_CLIENT (1 << 0)  // Initiator sent FIN
+#define SESSION_FLAG_FIN_SERVER (1 << 1)  // Responder sent FIN
+#define SESSION_FLAG_MONITOR    (1 << 2)  // Matched rule is in monitor mode
+
 // Policy action
 enum policy_action {
     POLICY_ACTION_ALLOW = 0,
     POLICY_ACTION_DENY,
     POLICY_ACTION_LOG,
+    POLICY_ACTION_RATE_LIMIT,  // Allow within the rule's token bucket, drop beyond it
+    POLICY_ACTION_REJECT,      // Drop and answer with a TCP RST or ICMP unreachable
+};
+
+// Units charged against a RATE_LIMIT rule's token bucket
+enum rate_limit_unit {
+    RATE_LIMIT_PACKETS = 0,
+    RATE_LIMIT_BYTES,
+    RATE_LIMIT_CONNECTIONS,   // Only packets opening a session are charged
 };
 
 // Session value stored in LRU_HASH map
+// Sessions are keyed by the initiator's 5-tuple; reply packets are matched
+// via the reversed key and update the *_to_client counters.
 struct session_value {
     __u64 created_ts;         // Session creation timestamp (nanoseconds)
     __u64 last_seen_ts;       // Last packet timestamp
-    __u64 packets_to_server;  // Packets from client to server
-    __u64 packets_to_client;  // Packets from server to client
+    __u64 packets_to_server;  // Packets from client (key source) to server
+    __u64 packets_to_client;  // Reply packets from server to client
     __u64 bytes_to_server;    // Bytes from client to server
     __u64 bytes_to_client;    // Bytes from server to client
     __u8  state;              // Session state
     __u8  tcp_state;          // TCP state machine
     __u8  policy_action;      // Matched policy action
     __u8  flags;              // Session flags
-    __u32 pad;                // Padding
+    __u8  direction;          // Hook that created the session
+    __u8  conn_state;         // Connection state policy is evaluated for (TCP: new until the handshake completes)
+    __u16 vlan_id;            // Outer VLAN ID (0 = untagged)
+    __u32 policy_generation;  // Policy generation the cached action was computed at
+    __u32 vni;                // VXLAN/Geneve VNI (0 = not tunneled)
+    __u32 rule_id;            // Matched rule ID (0 = no rule matched)
+    __u32 pad;
 };
 
-// Policy key for exact matching
+// Policy key for exact matching (same layout as flow_key)
+// Policies applying to both directions are stored once per direction.
 struct policy_key {
-    __u32 src_ip;
-    __u32 dst_ip;
+    __u32 src_ip[4];
+    __u32 dst_ip[4];
     __u16 src_port;
     __u16 dst_port;
     __u8  protocol;
-    __u8  pad[3];
+    __u8  direction;  // enum traffic_direction
+    __u8  pad[2];
 } __attribute__((packed));
 
 // Policy value
@@ -79,25 +157,154 @@ struct policy_value {
     __u16 priority;           // Policy priority
     __u32 rule_id;            // Rule ID for tracking
     __u64 hit_count;          // Number of times this policy was matched
+    __u8  monitor;            // Report denies instead of dropping
+    __u8  pad[3];
+    __u32 session_limit;      // Max active sessions per source (0 = global limit)
 };
 
 // Wildcard policy for matching with wildcards (0 = match any)
-// Used in array map for linear searching
+// Used in array map for linear searching. Laid out without holes like
+// struct flow_key.
 struct wildcard_policy {
-    __u32 src_ip;
-    __u32 src_ip_mask;        // 0xFFFFFFFF = exact, 0x00000000 = any
-    __u32 dst_ip;
-    __u32 dst_ip_mask;        // 0xFFFFFFFF = exact, 0x00000000 = any
-    __u16 src_port;           // 0 = any port
-    __u16 dst_port;           // 0 = any port
+    __u32 src_ip[4];
+    __u32 src_ip_mask[4];     // all ones = exact, all zeros = any
+    __u32 dst_ip[4];
+    __u32 dst_ip_mask[4];     // all ones = exact, all zeros = any
+    __u16 src_port_lo;        // Inclusive port range in host byte order,
+    __u16 src_port_hi;        // hi = 0 means any port
+    __u16 dst_port_lo;
+    __u16 dst_port_hi;
     __u8  protocol;           // 0 = any protocol
     __u8  action;             // Policy action
     __u8  log_enabled;        // Enable logging
-    __u8  pad1;               // Padding
+    __u8  direction;          // POLICY_DIR_* mask (0 = both)
     __u16 priority;           // Policy priority (higher = more important)
-    __u16 pad2;               // Padding
+    __u8  monitor;            // Report denies instead of dropping
+    __u8  icmp_match;         // ICMP_MATCH_* flags (0 = any type and code)
     __u32 rule_id;            // Rule ID (0 = empty slot)
-} __attribute__((packed));
+    __u8  icmp_type;          // ICMP type, if ICMP_MATCH_TYPE
+    __u8  icmp_code;          // ICMP code, if ICMP_MATCH_CODE
+    __u8  conn_states;        // Mask of 1 << enum conn_state (0 = any state)
+    __u8  pad2;               // Padding
+    __u16 vlan_id;            // Outer VLAN ID (0 = any)
+    __u16 pad3;               // Padding
+    __u32 vni;                // VXLAN/Geneve VNI (0 = any)
+    __u32 session_limit;      // Max active sessions per source (0 = global limit)
+    __u32 src_identity;       // Source security identity (0 = any)
+    __u32 dst_identity;       // Destination security identity (0 = any)
+};
+
+// Runtime configuration written by userspace (single entry in config_map)
+struct global_config {
+    __u32 policy_generation;  // Bumped on every policy or default action change
+    __u16 api_port;           // Agent API port in host byte order (0 = none)
+    __u8  default_action;     // Action when no policy matches (enum policy_action)
+    __u8  safety_exemptions;  // Non-zero: loopback and api_port traffic bypass policy
+    __u8  monitor_mode;       // Non-zero: denies are reported but not enforced
+    __u8  drop_invalid_tcp;   // Non-zero: drop invalid TCP flag combinations
+    __u8  decap_tunnels;      // TUNNEL_DECAP_* flags
+    __u8  fragment_action;    // Action for fragments whose first fragment was not seen
+    __u8  malformed_action;   // Action for packets with malformed IP headers
+    __u8  source_prefix_v4;   // Prefix grouping IPv4 sources for session quotas (0 = /32)
+    __u8  source_prefix_v6;   // Prefix grouping IPv6 sources for session quotas (0 = /128)
+    __u8  pad;
+    __u32 source_session_limit; // Max active sessions per source (0 = unlimited)
+};
+
+// Fragmented datagram, identified by addresses, protocol and the IPv4
+// identification or IPv6 fragment header id
+struct frag_key {
+    __u32 src_ip[4];
+    __u32 dst_ip[4];
+    __u32 id;
+    __u8  protocol;
+    __u8  direction;  // enum traffic_direction
+    __u8  pad[2];
+};
+
+// Verdict of a first fragment, applied to the fragments that follow it
+struct frag_value {
+    __u64 created_ts;         // First fragment timestamp (nanoseconds)
+    __u8  drop;               // Non-zero: the first fragment was dropped
+    __u8  pad[7];
+};
+
+// Token bucket of a RATE_LIMIT rule (rate_limit_map, keyed by rule ID).
+// Userspace writes rate, burst and unit with tokens and last_ts zeroed;
+// the first packet fills the bucket. Tokens are kept in units of 1e-9 so
+// refills need no division.
+struct rate_limit {
+    __u64 rate;               // Tokens per second
+    __u64 burst;              // Bucket capacity in tokens
+    __u64 tokens;             // Available tokens scaled by 1e9
+    __u64 last_ts;            // Last refill timestamp (nanoseconds)
+    __u8  unit;               // enum rate_limit_unit
+    __u8  pad[3];
+    struct bpf_spin_lock lock;
+};
+
+// Mirror target of a rule: a copy of the rule's packets is sent to the
+// interface, one in sample_rate packets (0 or 1 = every packet)
+struct mirror_target {
+    __u32 ifindex;
+    __u32 sample_rate;
+};
+
+// Packets copied to one mirror target
+struct mirror_stats {
+    __u64 packets;
+    __u64 bytes;
+    __u64 errors;             // Copies the kernel failed to send
+};
+
+// Hook a reject reply was redirected to: the interface and the direction
+// of the TC hook that sees the reply next
+struct reject_key {
+    __u32 ifindex;
+    __u32 direction;          // enum traffic_direction
+};
+
+// Reject replies redirected to one hook and not seen there yet
+struct reject_pending {
+    __s64 count;
+    __u64 expires_ts;         // Replies not seen by then are forgotten (nanoseconds)
+};
+
+// Mirrored copy a CPU is sending, while bpf_clone_redirect runs
+struct mirror_inflight {
+    __u32 ifindex;            // Mirror target, 0 = none
+    __u32 mark;               // Mark of the original packet
+};
+
+// Source of sessions for quotas: the client address masked to the
+// configured prefix (addresses as in struct flow_key)
+struct source_key {
+    __u32 prefixlen;          // 0-128, IPv4 prefixes are offset by 96
+    __u32 addr[4];
+};
+
+// LPM trie key for CIDR rule lookup (addresses as in struct flow_key)
+struct lpm_key {
+    __u32 prefixlen;          // 0-128, IPv4 prefixes are offset by 96
+    __u32 addr[4];
+};
+
+// Candidate wildcard rules for one CIDR prefix.
+// Each wildcard rule is indexed under its most specific side: the
+// destination prefix in dst_cidr_map, or the source prefix in
+// src_cidr_map when that is longer. A prefix entry only holds the rules
+// indexed at that prefix; the rules of shorter covering prefixes are
+// found by repeating the lookup with prefixlen - 1 until no entry is left.
+struct cidr_rule_set {
+    __u32 count;              // Valid entries in slots
+    __u32 prefixlen;          // Prefix length of the trie key holding this set
+    __u32 slots[MAX_CIDR_RULES_PER_PREFIX];  // wildcard_policy_map indices
+};
+
+// Wildcard rules matching a security identity are indexed by identity
+// instead of prefix: the destination identity in dst_identity_map, or the
+// source identity in src_identity_map when the rule has none. The value
+// is a struct cidr_rule_set with prefixlen 0.
 
 // Statistics counters
 enum stats_key {
@@ -109,9 +316,35 @@ enum stats_key {
     STATS_ACTIVE_SESSIONS,
     STATS_POLICY_HITS,
     STATS_POLICY_MISSES,
+    STATS_INGRESS_ALLOWED,
+    STATS_INGRESS_DENIED,
+    STATS_EGRESS_ALLOWED,
+    STATS_EGRESS_DENIED,
+    STATS_REPLY_PACKETS,      // Packets matched to a session in the reply direction
+    STATS_SESSIONS_REEVALUATED, // Cached decisions recomputed after a policy change
+    STATS_XDP_DROPPED,        // Packets dropped by the XDP program
+    STATS_EXEMPTED_FLOWS,     // Policy lookups short-circuited by a safety exemption
+    STATS_WOULD_DENY,         // Denied packets let through by monitor mode
+    STATS_RINGBUF_DROPS,      // Flow events lost because the ring buffer was full
+    STATS_INVALID_TCP_DROPS,  // Packets dropped for invalid TCP flag combinations
+    STATS_FRAGMENT_DROPS,     // Fragments dropped without a tracked first fragment
+    STATS_MALFORMED_DROPS,    // Packets dropped for malformed IP headers
+    STATS_RATE_LIMITED,       // Packets over a RATE_LIMIT rule's token bucket
+    STATS_SESSION_LIMIT_DROPS, // New flows denied because their source hit its session quota
+    STATS_REJECTS_SENT,       // TCP RSTs and ICMP unreachables sent for rejected packets
     STATS_MAX,
 };
 
+// Flow event types
+enum flow_event_type {
+    FLOW_EVENT_NEW = 0,
+    FLOW_EVENT_UPDATE,
+    FLOW_EVENT_CLOSE,   // packets/bytes carry final totals for both directions
+};
+
+// Flow event flags
+#define FLOW_EVENT_FLAG_SIMULATED (1 << 0)  // Deny was not enforced (monitor mode)
+
 // Flow event for reporting to control plane
 struct flow_event {
     struct flow_key key;
@@ -119,8 +352,9 @@ struct flow_event {
     __u64 packets;
     __u64 bytes;
     __u8  action;
-    __u8  event_type;  // new/update/close
-    __u16 pad;
+    __u8  event_type;  // enum flow_event_type
+    __u8  flags;       // FLOW_EVENT_FLAG_*
+    __u8  pad;
 } __attribute__((packed));
 
 #endif /* __COMMON_TYPES_H__ */
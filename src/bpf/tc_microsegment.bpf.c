@@ -1,5 +1,5 @@
 // SPDX-License-Identifier: GPL-2.0 OR BSD-3-Clause
-/* TC eBPF program for microsegmentation with session tracking */
+/* TC and XDP eBPF programs for microsegmentation with session tracking */
 
 #include "vmlinux.h"
 #include <bpf/bpf_helpers.h>
@@ -10,8 +10,123 @@
 #define TC_ACT_OK 0
 #define TC_ACT_SHOT 2
 
+// XDP metadata marker: the XDP program already accounted and allowed the
+// packet, so the TC ingress program lets it through untouched
+#define XDP_META_HANDLED 0x4d534547  // "MSEG"
+
+// Metadata the XDP program leaves in front of a packet it allowed. The
+// marker is last, next to the packet data.
+struct xdp_meta {
+    __u32 mirror_ifindex;  // Mirror target TC sends a copy to, 0 = none
+    __u32 marker;          // XDP_META_HANDLED
+};
+
+// skb mark of the replies sent for rejected packets. The TC program on the
+// hook they are redirected to lets a marked packet through only while a
+// reply redirected to that hook is pending, so a mark set by anyone else
+// buys nothing.
+#define REJECT_MARK 0x4d53524a  // "MSRJ"
+
+// skb mark of mirrored copies. The TC program on the mirror target lets a
+// marked packet through only while the same CPU is sending a copy out of
+// that interface.
+#define MIRROR_MARK 0x4d534d52  // "MSMR"
+
+// Hook-independent verdict of handle_packet
+enum packet_verdict {
+    VERDICT_PASS = 0,
+    VERDICT_DROP,
+    VERDICT_REJECT,  // Drop and answer the sender
+};
+
 // Ethernet protocol types
 #define ETH_P_IP 0x0800
+#define ETH_P_IPV6 0x86DD
+#define ETH_P_8021Q 0x8100
+#define ETH_P_8021AD 0x88A8
+#define ETH_P_TEB 0x6558  // Transparent Ethernet bridging (Geneve payload)
+
+// VLAN tags parsed per frame (802.1ad S-tag plus 802.1Q C-tag)
+#define MAX_VLAN_TAGS 2
+#define VLAN_VID_MASK 0x0fff
+
+// Tunnel UDP ports (IANA) and header flags
+#define VXLAN_PORT 4789
+#define GENEVE_PORT 6081
+#define VXLAN_FLAG_VNI 0x08000000  // "I" flag: the VNI is valid
+
+// Inner frames of tunnel packets starting further into the packet are
+// evaluated on the outer flow only
+#define MAX_INNER_FRAME_OFFSET 512
+
+// IPv6 extension header types
+#define NEXTHDR_HOP 0
+#define NEXTHDR_ROUTING 43
+#define NEXTHDR_FRAGMENT 44
+#define NEXTHDR_AUTH 51
+#define NEXTHDR_DEST 60
+
+// Fragment offset bits in the IPv6 fragment header
+#define IPV6_FRAG_OFFSET_MASK 0xFFF8
+#define IPV6_FRAG_MF 0x0001
+
+// IPv4 fragment flags and offset (host order)
+#define IP_MF 0x2000
+#define IP_OFFSET 0x1FFF
+
+#define NSEC_PER_SEC 1000000000ULL
+
+// How long a first fragment's verdict applies (the kernel's ipfrag_time)
+#define FRAG_TIMEOUT_NS (30ULL * NSEC_PER_SEC)
+
+// How long a redirected reject reply is awaited by the hook it was sent to
+#define REJECT_PENDING_TIMEOUT_NS (NSEC_PER_SEC / 10)
+
+// Position of a packet within a fragmented datagram
+enum frag_kind {
+    FRAG_NONE = 0,  // Not fragmented
+    FRAG_FIRST,     // Offset 0 with more fragments: carries the transport header
+    FRAG_LATER,     // Non-zero offset: no transport header
+};
+
+// Maximum IPv6 extension headers walked per packet
+#define MAX_IPV6_EXT_HEADERS 6
+
+// ICMP and ICMPv6 message types carrying an identifier
+#define ICMP_ECHO_REPLY 0
+#define ICMP_ECHO_REQUEST 8
+#define ICMP_TIMESTAMP_REQUEST 13
+#define ICMP_TIMESTAMP_REPLY 14
+#define ICMPV6_ECHO_REQUEST 128
+#define ICMPV6_ECHO_REPLY 129
+
+// ICMP and ICMPv6 error messages quoting the packet they refer to
+#define ICMP_DEST_UNREACHABLE 3
+#define ICMP_SOURCE_QUENCH 4
+#define ICMP_TIME_EXCEEDED 11
+#define ICMP_PARAMETER_PROBLEM 12
+#define ICMPV6_DEST_UNREACHABLE 1
+#define ICMPV6_PARAMETER_PROBLEM 4   // Types 1-4 are all errors
+
+// Destination unreachable codes sent for rejected packets
+#define ICMP_PORT_UNREACH 3
+#define ICMP_PKT_FILTERED 13          // Communication administratively prohibited
+#define ICMPV6_ADM_PROHIBITED 1
+#define ICMPV6_PORT_UNREACH 4
+
+// TTL / hop limit of the replies sent for rejected packets
+#define REJECT_TTL 64
+
+// Not part of the IPPROTO enum in vmlinux.h
+#define IPPROTO_ICMPV6 58
+
+// TCP header flag bits (byte 13 of the TCP header)
+#define TCP_FLAG_FIN 0x01
+#define TCP_FLAG_SYN 0x02
+#define TCP_FLAG_RST 0x04
+#define TCP_FLAG_PSH 0x08
+#define TCP_FLAG_ACK 0x10
+#define TCP_FLAG_URG 0x20
 
 // Debug mode - disable for production to reduce latency
 #define DEBUG_MODE 0
@@ -20,6 +135,49 @@
 
 char LICENSE[] SEC("license") = "GPL";
 
+// Per-packet metadata collected while parsing that is not part of the flow key
+struct packet_meta {
+    __u8  tcp_flags;     // TCP_FLAG_* bits, 0 for non-TCP packets
+    __u8  has_l4;        // Transport header was parsed
+    __u8  icmp_error;    // ICMP error; related holds the flow it quotes
+    __u16 vlan_id;       // Outermost VLAN ID, 0 = untagged
+    __u32 vni;           // VNI of a decapsulated tunnel, 0 = none
+    __u8  frag;          // enum frag_kind
+    __u8  malformed;     // Malformed IP header, not evaluated against policy
+    __u8  decapsulated;  // Evaluated on the inner frame of a tunnel packet
+    __u16 udp_payload;   // Offset of the UDP payload in the frame, 0 = none
+    __u32 frag_id;       // IPv4 identification or IPv6 fragment id
+    __u32 rule_id;       // Rule that decided the packet, 0 = none
+    struct flow_key related;
+};
+
+// Flow key and metadata of the packet being processed, and of the inner
+// frame if it is a tunnel packet to decapsulate
+struct packet_scratch {
+    struct flow_key key;
+    struct packet_meta meta;
+    struct flow_key inner_key;
+    struct packet_meta inner_meta;
+};
+
+// Packet attributes besides the flow key that wildcard rules match on.
+// Sessions cache them so a re-evaluation sees the original packet's values.
+struct match_attrs {
+    __u8  conn_state;  // enum conn_state
+    __u16 vlan_id;
+    __u32 vni;
+    __u32 src_identity;  // Resolved by the policy lookup from ipcache_map
+    __u32 dst_identity;
+};
+
+// Result details of a policy lookup besides the action
+struct policy_match {
+    __u32 rule_id;   // Matched rule (0 = default action or exemption)
+    __u32 session_limit;  // Matched rule's per-source session limit (0 = global)
+    __u8  monitor;   // Matched rule is in monitor mode
+    __u8  exempt;    // Allowed by a safety exemption
+};
+
 // Session tracking map - LRU_HASH for automatic eviction
 struct {
     __uint(type, BPF_MAP_TYPE_LRU_HASH);
@@ -37,7 +195,7 @@ struct {
 } policy_map SEC(".maps");
 
 // Wildcard policy map for policies with wildcards (0 = any)
-// Uses ARRAY for linear search (slower but supports wildcards)
+// Rules are stored by slot and located through the CIDR tries below
 struct {
     __uint(type, BPF_MAP_TYPE_ARRAY);
     __uint(max_entries, MAX_ENTRIES_WILDCARD_POLICY);
@@ -45,6 +203,149 @@ struct {
     __type(value, struct wildcard_policy);
 } wildcard_policy_map SEC(".maps");
 
+// Wildcard rules indexed by source prefix
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, MAX_ENTRIES_CIDR_PREFIX);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct lpm_key);
+    __type(value, struct cidr_rule_set);
+} src_cidr_map SEC(".maps");
+
+// Wildcard rules indexed by destination prefix
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, MAX_ENTRIES_CIDR_PREFIX);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct lpm_key);
+    __type(value, struct cidr_rule_set);
+} dst_cidr_map SEC(".maps");
+
+// Security identity of addresses and prefixes, maintained by userspace
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, MAX_ENTRIES_IPCACHE);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct lpm_key);
+    __type(value, __u32);  // Identity
+} ipcache_map SEC(".maps");
+
+// Wildcard rules indexed by source identity
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ENTRIES_IDENTITY);
+    __type(key, __u32);
+    __type(value, struct cidr_rule_set);
+} src_identity_map SEC(".maps");
+
+// Wildcard rules indexed by destination identity
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ENTRIES_IDENTITY);
+    __type(key, __u32);
+    __type(value, struct cidr_rule_set);
+} dst_identity_map SEC(".maps");
+
+// Runtime configuration (index 0), see struct global_config
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct global_config);
+} config_map SEC(".maps");
+
+// Interfaces in monitor mode (ifindex -> non-zero)
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ENTRIES_MONITOR_IFACES);
+    __type(key, __u32);
+    __type(value, __u8);
+} monitor_iface_map SEC(".maps");
+
+// Per-rule hit counters (rule_id -> matches), per-CPU for lock-free updates
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_HASH);
+    __uint(max_entries, MAX_ENTRIES_POLICY);
+    __type(key, __u32);
+    __type(value, __u64);
+} rule_hits_map SEC(".maps");
+
+// Token buckets of RATE_LIMIT rules (rule_id -> bucket), shared by all CPUs
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ENTRIES_POLICY);
+    __type(key, __u32);
+    __type(value, struct rate_limit);
+} rate_limit_map SEC(".maps");
+
+// Per-rule rate limited packet counters (rule_id -> packets over the limit)
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_HASH);
+    __uint(max_entries, MAX_ENTRIES_POLICY);
+    __type(key, __u32);
+    __type(value, __u64);
+} rate_limited_map SEC(".maps");
+
+// Active sessions per source (masked client address -> sessions)
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, MAX_ENTRIES_SOURCE);
+    __type(key, struct source_key);
+    __type(value, __u64);
+} source_sessions_map SEC(".maps");
+
+// Mirror targets of rules that copy their packets (rule_id -> target)
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ENTRIES_POLICY);
+    __type(key, __u32);
+    __type(value, struct mirror_target);
+} mirror_map SEC(".maps");
+
+// Per-target mirror counters (ifindex -> copies sent)
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_HASH);
+    __uint(max_entries, MAX_ENTRIES_MIRROR_TARGETS);
+    __type(key, __u32);
+    __type(value, struct mirror_stats);
+} mirror_stats_map SEC(".maps");
+
+// Copy each CPU is sending out of a mirror target
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct mirror_inflight);
+} mirror_inflight_map SEC(".maps");
+
+// Parse results of the packet each CPU is processing. They live in a map
+// instead of on the stack: the verifier doesn't track map values field by
+// field, so the many parse paths reach the flow handling as one state, and
+// the stack is left to the lookups. handle_packet never nests on a CPU.
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct packet_scratch);
+} packet_scratch_map SEC(".maps");
+
+// Session each CPU is creating. It is built here rather than on the stack,
+// which the policy lookup below the session handling needs.
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct session_value);
+} session_scratch_map SEC(".maps");
+
+// Reject replies redirected to a hook and not seen there yet
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_ENTRIES_REJECT_PENDING);
+    __type(key, struct reject_key);
+    __type(value, struct reject_pending);
+} reject_pending_map SEC(".maps");
+
 // Statistics map (Per-CPU for lock-free updates)
 struct {
     __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
@@ -53,6 +354,14 @@ struct {
     __type(value, __u64);
 } stats_map SEC(".maps");
 
+// Verdicts of first fragments, followed by the rest of the datagram
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, MAX_ENTRIES_FRAGMENT);
+    __type(key, struct frag_key);
+    __type(value, struct frag_value);
+} frag_map SEC(".maps");
+
 // Ring buffer for flow events to user-space
 struct {
     __uint(type, BPF_MAP_TYPE_RINGBUF);
@@ -68,253 +377,1978 @@ static __always_inline void update_stats(__u32 key) {
     }
 }
 
+// Helper: Count a match of a policy rule
+static __always_inline void count_rule_hit(__u32 rule_id) {
+    __u64 *hits = bpf_map_lookup_elem(&rule_hits_map, &rule_id);
+    if (hits) {
+        *hits += 1;
+        return;
+    }
+
+    __u64 first = 1;
+    bpf_map_update_elem(&rule_hits_map, &rule_id, &first, BPF_NOEXIST);
+}
+
+// Helper: Decrement a gauge-style statistics counter. Per-CPU slots may
+// wrap below zero individually; the sum across CPUs stays correct.
+static __always_inline void decrement_stats(__u32 key) {
+    __u64 *count = bpf_map_lookup_elem(&stats_map, &key);
+    if (count) {
+        *count -= 1;
+    }
+}
+
+// Helper: Update verdict counters, globally and for the hook that saw the packet
+static __always_inline void update_verdict_stats(__u8 direction, bool denied) {
+    if (denied) {
+        update_stats(STATS_DENIED_PACKETS);
+        update_stats(direction == DIRECTION_EGRESS ?
+                     STATS_EGRESS_DENIED : STATS_INGRESS_DENIED);
+    } else {
+        update_stats(STATS_ALLOWED_PACKETS);
+        update_stats(direction == DIRECTION_EGRESS ?
+                     STATS_EGRESS_ALLOWED : STATS_INGRESS_ALLOWED);
+    }
+}
+
 // Helper: Get current timestamp in nanoseconds
 static __always_inline __u64 get_timestamp_ns() {
     return bpf_ktime_get_ns();
 }
 
-// Helper: Extract flow key from packet
-static __always_inline int extract_flow_key(struct __sk_buff *skb, struct flow_key *key) {
-    void *data = (void *)(long)skb->data;
-    void *data_end = (void *)(long)skb->data_end;
-    
-    // Parse Ethernet header
-    struct ethhdr *eth = data;
-    if ((void *)(eth + 1) > data_end)
-        return -1;
-    
-    // Only handle IPv4 for now
-    if (eth->h_proto != bpf_htons(ETH_P_IP))
-        return -1;
-    
-    // Parse IP header
-    struct iphdr *iph = (void *)(eth + 1);
-    if ((void *)(iph + 1) > data_end)
-        return -1;
-    
-    key->src_ip = iph->saddr;
-    key->dst_ip = iph->daddr;
-    key->protocol = iph->protocol;
-    
-    // Parse transport layer
-    void *l4 = (void *)iph + (iph->ihl * 4);
-    
-    if (iph->protocol == IPPROTO_TCP) {
+// Helper: Check whether an ICMP message type is a query or answer carrying
+// an identifier, which pairs requests with their replies
+static __always_inline bool icmp_has_id(__u8 protocol, __u8 type) {
+    if (protocol == IPPROTO_ICMPV6)
+        return type == ICMPV6_ECHO_REQUEST || type == ICMPV6_ECHO_REPLY;
+
+    return type == ICMP_ECHO_REQUEST || type == ICMP_ECHO_REPLY ||
+           type == ICMP_TIMESTAMP_REQUEST || type == ICMP_TIMESTAMP_REPLY;
+}
+
+// Helper: Request type answered by an ICMP reply type, or -1 if the
+// message is not a reply
+static __always_inline int icmp_request_type(__u8 protocol, __u8 type) {
+    if (protocol == IPPROTO_ICMPV6)
+        return type == ICMPV6_ECHO_REPLY ? ICMPV6_ECHO_REQUEST : -1;
+
+    if (type == ICMP_ECHO_REPLY)
+        return ICMP_ECHO_REQUEST;
+    if (type == ICMP_TIMESTAMP_REPLY)
+        return ICMP_TIMESTAMP_REQUEST;
+    return -1;
+}
+
+// Helper: Check whether an ICMP message reports an error about another packet
+static __always_inline bool icmp_is_error(__u8 protocol, __u8 type) {
+    if (protocol == IPPROTO_ICMPV6)
+        return type >= ICMPV6_DEST_UNREACHABLE && type <= ICMPV6_PARAMETER_PROBLEM;
+
+    return type == ICMP_DEST_UNREACHABLE || type == ICMP_SOURCE_QUENCH ||
+           type == ICMP_TIME_EXCEEDED || type == ICMP_PARAMETER_PROBLEM;
+}
+
+// Helper: Parse the packet quoted by an ICMP error into the key of the flow
+// it belonged to (direction is left to the caller)
+static __always_inline void parse_icmp_error(void *inner, void *data_end, __u8 protocol,
+                                             struct packet_meta *meta) {
+    struct flow_key *rel = &meta->related;
+    __u8 inner_proto;
+    void *l4;
+
+    if (protocol == IPPROTO_ICMP) {
+        struct iphdr *iph = inner;
+        if ((void *)(iph + 1) > data_end)
+            return;
+        rel->src_ip[2] = bpf_htonl(0x0000ffff);
+        rel->src_ip[3] = iph->saddr;
+        rel->dst_ip[2] = bpf_htonl(0x0000ffff);
+        rel->dst_ip[3] = iph->daddr;
+        inner_proto = iph->protocol;
+        l4 = inner + (iph->ihl * 4);
+    } else {
+        struct ipv6hdr *ip6h = inner;
+        if ((void *)(ip6h + 1) > data_end)
+            return;
+        __builtin_memcpy(rel->src_ip, &ip6h->saddr, sizeof(rel->src_ip));
+        __builtin_memcpy(rel->dst_ip, &ip6h->daddr, sizeof(rel->dst_ip));
+        inner_proto = ip6h->nexthdr;
+        l4 = (void *)(ip6h + 1);
+    }
+
+    // Errors quote at least the first 8 bytes of the transport header
+    if (l4 + 8 > data_end)
+        return;
+
+    rel->protocol = inner_proto;
+    if (inner_proto == IPPROTO_TCP || inner_proto == IPPROTO_UDP) {
+        struct udphdr *udph = l4;  // Ports are at the same offsets in TCP
+        rel->src_port = udph->source;
+        rel->dst_port = udph->dest;
+    } else if (inner_proto == protocol) {
+        struct icmphdr *icmph = l4;
+        rel->src_port = icmp_has_id(protocol, icmph->type) ? icmph->un.echo.id : 0;
+        rel->dst_port = bpf_htons(ICMP_KEY_PORT(icmph->type, icmph->code));
+    }
+    meta->icmp_error = 1;
+}
+
+// Helper: Parse transport layer ports. The offset of the payload of a UDP
+// datagram from the start of the frame is kept in meta.
+static __always_inline int parse_l4_ports(void *frame, void *l4, void *data_end, __u8 protocol,
+                                          struct flow_key *key, struct packet_meta *meta) {
+    if (protocol == IPPROTO_TCP) {
         struct tcphdr *tcph = l4;
         if ((void *)(tcph + 1) > data_end)
             return -1;
         key->src_port = tcph->source;
         key->dst_port = tcph->dest;
-    } else if (iph->protocol == IPPROTO_UDP) {
+        meta->tcp_flags = ((__u8 *)tcph)[13];
+        meta->has_l4 = 1;
+    } else if (protocol == IPPROTO_UDP) {
         struct udphdr *udph = l4;
         if ((void *)(udph + 1) > data_end)
             return -1;
         key->src_port = udph->source;
         key->dst_port = udph->dest;
+        meta->has_l4 = 1;
+        meta->udp_payload = (void *)(udph + 1) - frame;
+    } else if (protocol == IPPROTO_ICMP || protocol == IPPROTO_ICMPV6) {
+        // Both header layouts start with type, code, checksum and the
+        // identifier of query messages
+        struct icmphdr *icmph = l4;
+        if ((void *)(icmph + 1) > data_end)
+            return -1;
+        key->src_port = icmp_has_id(protocol, icmph->type) ? icmph->un.echo.id : 0;
+        key->dst_port = bpf_htons(ICMP_KEY_PORT(icmph->type, icmph->code));
+        meta->has_l4 = 1;
+
+        if (icmp_is_error(protocol, icmph->type))
+            parse_icmp_error((void *)(icmph + 1), data_end, protocol, meta);
     } else {
-        // ICMP or other protocols
+        // Other protocols
         key->src_port = 0;
         key->dst_port = 0;
     }
-    
+
     return 0;
 }
 
-// Helper: Check if flow matches wildcard policy
-static __always_inline bool matches_wildcard(
-    struct flow_key *key,
-    struct wildcard_policy *wildcard)
-{
-    // IP matching with masks
-    if ((key->src_ip & wildcard->src_ip_mask) !=
-        (wildcard->src_ip & wildcard->src_ip_mask))
-        return false;
+// Helper: Parse IPv4 header into flow key (IPv4-mapped IPv6 addresses).
+// Malformed headers and fragments are flagged in meta; only unfragmented
+// packets and first fragments have their transport header parsed.
+static __always_inline int parse_ipv4(void *frame, void *l3, void *data_end, struct flow_key *key,
+                                      struct packet_meta *meta) {
+    struct iphdr *iph = l3;
+    if ((void *)(iph + 1) > data_end)
+        return -1;
 
-    if ((key->dst_ip & wildcard->dst_ip_mask) !=
-        (wildcard->dst_ip & wildcard->dst_ip_mask))
-        return false;
+    key->src_ip[2] = bpf_htonl(0x0000ffff);
+    key->src_ip[3] = iph->saddr;
+    key->dst_ip[2] = bpf_htonl(0x0000ffff);
+    key->dst_ip[3] = iph->daddr;
+    key->protocol = iph->protocol;
 
-    // Port matching (0 = wildcard, matches any)
-    if (wildcard->src_port != 0 && key->src_port != wildcard->src_port)
-        return false;
+    // The header must hold at least the fixed part and fit the datagram
+    // (tot_len is 0 on BIG TCP GSO packets)
+    __u32 hdr_len = iph->ihl * 4;
+    __u16 tot_len = bpf_ntohs(iph->tot_len);
+    if (iph->version != 4 || hdr_len < sizeof(*iph) || (tot_len != 0 && tot_len < hdr_len)) {
+        meta->malformed = 1;
+        return 0;
+    }
 
-    if (wildcard->dst_port != 0 && key->dst_port != wildcard->dst_port)
-        return false;
+    __u16 frag_off = bpf_ntohs(iph->frag_off);
+    if (frag_off & (IP_MF | IP_OFFSET)) {
+        meta->frag_id = bpf_ntohs(iph->id);
 
-    // Protocol matching (0 = wildcard, matches any)
-    if (wildcard->protocol != 0 && key->protocol != wildcard->protocol)
-        return false;
+        if (frag_off & IP_OFFSET) {
+            // Non-first fragments carry no transport header. A TCP fragment
+            // at offset 1 (8 bytes) would overwrite the first fragment's
+            // flags (RFC 1858)
+            meta->frag = FRAG_LATER;
+            if ((frag_off & IP_OFFSET) == 1 && iph->protocol == IPPROTO_TCP)
+                meta->malformed = 1;
+            return 0;
+        }
+        meta->frag = FRAG_FIRST;
+    }
 
-    return true;
+    void *l4 = (void *)iph + hdr_len;
+    if (parse_l4_ports(frame, l4, data_end, iph->protocol, key, meta) < 0) {
+        // A first fragment too short for the transport header would let
+        // the ports arrive in a later fragment (tiny fragment attack)
+        if (meta->frag == FRAG_FIRST) {
+            meta->malformed = 1;
+            return 0;
+        }
+        return -1;
+    }
+    return 0;
 }
 
-// Helper: Lookup policy with wildcard support
-// Fast path: Try exact match first (most common)
-// Slow path: Linear search wildcard policies (only for first packet)
-static __always_inline __u8 lookup_policy_action(struct flow_key *key, __u32 *rule_id) {
-    // FAST PATH: Try exact match first (O(1) hash lookup)
-    struct policy_value *policy = bpf_map_lookup_elem(&policy_map, key);
-    if (policy) {
-        // Increment hit count (simple increment, not atomic for speed)
-        policy->hit_count += 1;
-        update_stats(STATS_POLICY_HITS);
-        *rule_id = policy->rule_id;
-        return policy->action;
-    }
+// Helper: Check if an IPv6 next header value is an extension header we walk
+static __always_inline bool ipv6_is_ext_header(__u8 nexthdr) {
+    return nexthdr == NEXTHDR_HOP ||
+           nexthdr == NEXTHDR_ROUTING ||
+           nexthdr == NEXTHDR_FRAGMENT ||
+           nexthdr == NEXTHDR_AUTH ||
+           nexthdr == NEXTHDR_DEST;
+}
 
-    // SLOW PATH: Linear search wildcard policies
-    // Use #pragma unroll to help verifier, limit iterations
-    struct wildcard_policy *wildcard = NULL;
-    struct wildcard_policy *best_match = NULL;
-    __u16 best_priority = 0;
+// Helper: Parse IPv6 header and walk the extension header chain
+static __always_inline int parse_ipv6(void *frame, void *l3, void *data_end, struct flow_key *key,
+                                      struct packet_meta *meta) {
+    struct ipv6hdr *ip6h = l3;
+    if ((void *)(ip6h + 1) > data_end)
+        return -1;
 
-    // Search for matching wildcard policies
-    // Limit to reasonable number to pass verifier
+    __builtin_memcpy(key->src_ip, &ip6h->saddr, sizeof(key->src_ip));
+    __builtin_memcpy(key->dst_ip, &ip6h->daddr, sizeof(key->dst_ip));
+
+    __u8 nexthdr = ip6h->nexthdr;
+    void *cursor = (void *)(ip6h + 1);
+
+    // Bounded walk to keep the verifier happy
     #pragma unroll
-    for (__u32 i = 0; i < 100; i++) {
-        __u32 idx = i;
-        if (idx >= MAX_ENTRIES_WILDCARD_POLICY)
+    for (int i = 0; i < MAX_IPV6_EXT_HEADERS; i++) {
+        if (!ipv6_is_ext_header(nexthdr))
             break;
 
-        wildcard = bpf_map_lookup_elem(&wildcard_policy_map, &idx);
-        if (!wildcard)
-            continue;
+        if (nexthdr == NEXTHDR_FRAGMENT) {
+            struct frag_hdr *frag = cursor;
+            if ((void *)(frag + 1) > data_end)
+                return -1;
 
-        // Skip empty slots (rule_id == 0)
-        if (wildcard->rule_id == 0)
-            continue;
+            nexthdr = frag->nexthdr;
+            meta->frag_id = bpf_ntohl(frag->identification);
 
-        // Check if this policy matches
-        if (matches_wildcard(key, wildcard)) {
-            // Select highest priority match
-            if (!best_match || wildcard->priority > best_priority) {
-                best_match = wildcard;
-                best_priority = wildcard->priority;
+            // Non-first fragments carry no transport header
+            if (frag->frag_off & bpf_htons(IPV6_FRAG_OFFSET_MASK)) {
+                meta->frag = FRAG_LATER;
+                key->protocol = nexthdr;
+                return 0;
             }
+            if (frag->frag_off & bpf_htons(IPV6_FRAG_MF))
+                meta->frag = FRAG_FIRST;
+
+            cursor = (void *)(frag + 1);
+            continue;
         }
-    }
 
-    if (best_match) {
-        update_stats(STATS_POLICY_HITS);
-        *rule_id = best_match->rule_id;
-        return best_match->action;
+        // Hop-by-hop, routing, destination options and AH share the
+        // nexthdr/hdrlen prefix; only the length unit differs
+        struct ipv6_opt_hdr *opt = cursor;
+        if ((void *)(opt + 1) > data_end)
+            return -1;
+
+        if (nexthdr == NEXTHDR_AUTH)
+            cursor += (opt->hdrlen + 2) * 4;
+        else
+            cursor += (opt->hdrlen + 1) * 8;
+
+        nexthdr = opt->nexthdr;
     }
 
-    update_stats(STATS_POLICY_MISSES);
-    *rule_id = 0;
-    return POLICY_ACTION_ALLOW;  // Default allow if no policy matches
-}
+    key->protocol = nexthdr;
 
-// Helper: Create new session (optimized - minimal initialization)
-static __always_inline int create_session(struct flow_key *key, __u8 action, __u64 ts, __u32 packet_len) {
-    struct session_value new_session = {
-        .created_ts = ts,
-        .last_seen_ts = ts,
-        .packets_to_server = 1,       // First packet
-        .packets_to_client = 0,
-        .bytes_to_server = packet_len, // First packet bytes
-        .bytes_to_client = 0,
-        .state = SESSION_STATE_NEW,
-        .tcp_state = TCP_STATE_CLOSED,
-        .policy_action = action,
-        .flags = 0,
-    };
-    
-    int ret = bpf_map_update_elem(&session_map, key, &new_session, BPF_NOEXIST);
-    if (ret == 0) {
-        update_stats(STATS_NEW_SESSIONS);
-        
-        // Only send events for DENY or if explicitly logging
-        if (action == POLICY_ACTION_DENY || action == POLICY_ACTION_LOG) {
-            struct flow_event *event = bpf_ringbuf_reserve(&flow_events, sizeof(*event), 0);
-            if (event) {
-                event->key = *key;
-                event->timestamp = ts;
-                event->packets = 1;
-                event->bytes = packet_len;
-                event->action = action;
-                event->event_type = 0;  // new session
-                bpf_ringbuf_submit(event, 0);
-            }
+    // Chain longer than we are willing to walk: match on addresses only
+    if (ipv6_is_ext_header(nexthdr))
+        return 0;
+
+    if (parse_l4_ports(frame, cursor, data_end, nexthdr, key, meta) < 0) {
+        // Tiny first fragment, see parse_ipv4
+        if (meta->frag == FRAG_FIRST) {
+            meta->malformed = 1;
+            return 0;
         }
+        return -1;
     }
-    
-    return ret;
+    return 0;
 }
 
-// Main TC program (optimized for minimal latency)
-SEC("tc")
-int tc_microsegment_filter(struct __sk_buff *skb) {
-    struct flow_key key = {0};
-    
-    // Extract flow key from packet (fast path)
-    if (extract_flow_key(skb, &key) < 0) {
-        return TC_ACT_OK;  // Pass non-IP packets
-    }
-    
-    // Update total packets counter
-    update_stats(STATS_TOTAL_PACKETS);
-    
-    // Fast path: Lookup existing session (most common case)
-    struct session_value *session = bpf_map_lookup_elem(&session_map, &key);
-    
-    if (session) {
-        // HOT PATH: Existing session - use cached policy decision
-        // This is the most performance-critical path (>99% of packets)
-        
-        __u8 action = session->policy_action;
-        
-        // Update session stats (inline for speed)
-        session->last_seen_ts = get_timestamp_ns();
-        session->packets_to_server += 1;
-        session->bytes_to_server += skb->len;
-        
-        // Fast enforcement check
-        if (action == POLICY_ACTION_DENY) {
-            update_stats(STATS_DENIED_PACKETS);
-#if DEBUG_MODE
-            bpf_printk("DENY: %pI4:%d -> %pI4:%d (cached)\n",
-                       &key.src_ip, bpf_ntohs(key.src_port),
-                       &key.dst_ip, bpf_ntohs(key.dst_port));
-#endif
-            return TC_ACT_SHOT;  // Drop packet
-        }
-        
-        update_stats(STATS_ALLOWED_PACKETS);
-        return TC_ACT_OK;  // Allow packet
-    }
-    
-    // SLOW PATH: New session - lookup policy with wildcard support
-    // This happens less frequently, so more overhead is acceptable
+// Helper: Parse an Ethernet frame, skipping up to two VLAN tags, into the
+// flow key. The first VLAN ID seen is kept in meta. Everything parsed goes
+// to the key and meta, so the verifier sees each parse path return in the
+// same state.
+static __noinline int parse_frame(void *frame, void *data_end, struct flow_key *key,
+                                  struct packet_meta *meta) {
+    // Parse Ethernet header
+    struct ethhdr *eth = frame;
+    if ((void *)(eth + 1) > data_end)
+        return -1;
 
-    __u64 now = get_timestamp_ns();
-    __u32 matched_rule_id = 0;
-    __u8 action = lookup_policy_action(&key, &matched_rule_id);
+    __be16 proto = eth->h_proto;
+    void *l3 = (void *)(eth + 1);
 
-#if DEBUG_MODE
-    if (matched_rule_id != 0) {
-        bpf_printk("Policy %d matched: %pI4:%d -> %pI4:%d action=%d\n",
-                   matched_rule_id,
-                   &key.src_ip, bpf_ntohs(key.src_port),
-                   &key.dst_ip, bpf_ntohs(key.dst_port),
+    #pragma unroll
+    for (int i = 0; i < MAX_VLAN_TAGS; i++) {
+        if (proto != bpf_htons(ETH_P_8021Q) && proto != bpf_htons(ETH_P_8021AD))
+            break;
+
+        struct vlan_hdr *vlh = l3;
+        if ((void *)(vlh + 1) > data_end)
+            return -1;
+
+        if (meta->vlan_id == 0)
+            meta->vlan_id = bpf_ntohs(vlh->h_vlan_TCI) & VLAN_VID_MASK;
+        proto = vlh->h_vlan_encapsulated_proto;
+        l3 = (void *)(vlh + 1);
+    }
+
+    if (proto == bpf_htons(ETH_P_IP))
+        return parse_ipv4(frame, l3, data_end, key, meta);
+
+    if (proto == bpf_htons(ETH_P_IPV6))
+        return parse_ipv6(frame, l3, data_end, key, meta);
+
+    // Non-IP traffic is not subject to policy
+    return -1;
+}
+
+// Helper: Locate the inner Ethernet frame of a VXLAN or Geneve packet sent
+// to the standard port and record its VNI in inner_meta. Returns the offset
+// of the frame in the packet, or 0 if the packet is not a tunnel packet to
+// decapsulate or its inner frame starts too deep into it.
+static __always_inline __u32 tunnel_inner_frame(void *data, void *data_end,
+                                                struct flow_key *key, struct packet_meta *meta,
+                                                struct packet_meta *inner_meta, __u8 decap) {
+    __u32 off = meta->udp_payload;
+
+    // Fragmented tunnel packets are evaluated on the outer flow
+    if (key->protocol != IPPROTO_UDP || off == 0 || meta->frag != FRAG_NONE)
+        return 0;
+    if (off > MAX_INNER_FRAME_OFFSET)
+        return 0;
+
+    if ((decap & TUNNEL_DECAP_VXLAN) && key->dst_port == bpf_htons(VXLAN_PORT)) {
+        struct vxlanhdr *vxh = data + off;
+        if ((void *)(vxh + 1) > data_end)
+            return 0;
+        if (!(vxh->vx_flags & bpf_htonl(VXLAN_FLAG_VNI)))
+            return 0;
+
+        inner_meta->vni = bpf_ntohl(vxh->vx_vni) >> 8;
+        off += sizeof(*vxh);
+    } else if ((decap & TUNNEL_DECAP_GENEVE) && key->dst_port == bpf_htons(GENEVE_PORT)) {
+        struct genevehdr *gnv = data + off;
+        if ((void *)(gnv + 1) > data_end)
+            return 0;
+        if (gnv->ver != 0 || gnv->proto_type != bpf_htons(ETH_P_TEB))
+            return 0;
+
+        inner_meta->vni = (gnv->vni[0] << 16) | (gnv->vni[1] << 8) | gnv->vni[2];
+        off += sizeof(*gnv) + gnv->opt_len * 4;
+    } else {
+        return 0;
+    }
+
+    return off <= MAX_INNER_FRAME_OFFSET ? off : 0;
+}
+
+// Helper: Extract flow key from packet. vlan_id is a tag the NIC already
+// stripped (0 if none).
+static __always_inline int extract_flow_key(void *data, void *data_end, struct flow_key *key,
+                                            struct packet_meta *meta, __u16 vlan_id) {
+    meta->vlan_id = vlan_id;
+    return parse_frame(data, data_end, key, meta);
+}
+
+// Helper: Extract the flow key of the inner frame of a tunnel packet into
+// key and meta, keeping the VLAN ID of the outer frame
+static __always_inline int extract_inner_flow_key(void *inner, void *data_end,
+                                                  struct packet_meta *outer,
+                                                  struct flow_key *key,
+                                                  struct packet_meta *meta) {
+    meta->vlan_id = outer->vlan_id;
+    meta->decapsulated = 1;
+    return parse_frame(inner, data_end, key, meta);
+}
+
+// Helper: Build the key of the session a reply packet would belong to.
+// ICMP replies map to the request with the same identifier; other ICMP
+// messages are never replies. Returns false if there is no such session.
+static __always_inline bool reverse_flow_key(struct flow_key *key, struct flow_key *rev,
+                                             __u8 direction) {
+    __builtin_memcpy(rev->src_ip, key->dst_ip, sizeof(rev->src_ip));
+    __builtin_memcpy(rev->dst_ip, key->src_ip, sizeof(rev->dst_ip));
+    rev->protocol = key->protocol;
+    rev->direction = direction;
+
+    if (key->protocol == IPPROTO_ICMP || key->protocol == IPPROTO_ICMPV6) {
+        int request = icmp_request_type(key->protocol, bpf_ntohs(key->dst_port) >> 8);
+        if (request < 0)
+            return false;
+        rev->src_port = key->src_port;  // Echo identifier
+        rev->dst_port = bpf_htons(ICMP_KEY_PORT(request, 0));
+        return true;
+    }
+
+    rev->src_port = key->dst_port;
+    rev->dst_port = key->src_port;
+    return true;
+}
+
+// Helper: Check if flow matches wildcard policy. Mismatches are collected
+// instead of returned early, so the verifier follows a handful of paths per
+// candidate rule rather than one per field.
+static __always_inline bool matches_wildcard(
+    struct flow_key *key,
+    struct match_attrs *attrs,
+    struct wildcard_policy *wildcard)
+{
+    __u32 miss = 0;
+
+    // IP matching with masks (128-bit, one word at a time)
+    #pragma unroll
+    for (int i = 0; i < 4; i++) {
+        miss |= (key->src_ip[i] ^ wildcard->src_ip[i]) & wildcard->src_ip_mask[i];
+        miss |= (key->dst_ip[i] ^ wildcard->dst_ip[i]) & wildcard->dst_ip_mask[i];
+    }
+
+    // ICMP flows carry type/code and echo ID in the port fields. These are
+    // only compared through the icmp fields below, never against a port
+    // range: a rule with ports does not match ICMP.
+    bool is_icmp = key->protocol == IPPROTO_ICMP || key->protocol == IPPROTO_ICMPV6;
+    if (is_icmp)
+        miss |= wildcard->src_port_hi | wildcard->dst_port_hi;
+
+    // Port range matching (hi = 0 is a wildcard, matches any)
+    if (wildcard->src_port_hi != 0) {
+        __u16 sport = bpf_ntohs(key->src_port);
+        miss |= (sport < wildcard->src_port_lo) | (sport > wildcard->src_port_hi);
+    }
+
+    if (wildcard->dst_port_hi != 0) {
+        __u16 dport = bpf_ntohs(key->dst_port);
+        miss |= (dport < wildcard->dst_port_lo) | (dport > wildcard->dst_port_hi);
+    }
+
+    // Protocol matching (0 = wildcard, matches any)
+    if (wildcard->protocol != 0)
+        miss |= key->protocol ^ wildcard->protocol;
+
+    // ICMP type/code matching, encoded in the destination port
+    if (wildcard->icmp_match) {
+        __u16 icmp = bpf_ntohs(key->dst_port);
+
+        miss |= !is_icmp;
+        if (wildcard->icmp_match & ICMP_MATCH_TYPE)
+            miss |= (icmp >> 8) ^ wildcard->icmp_type;
+        if (wildcard->icmp_match & ICMP_MATCH_CODE)
+            miss |= (icmp & 0xff) ^ wildcard->icmp_code;
+    }
+
+    // Direction matching (0 = both directions)
+    if (wildcard->direction != 0)
+        miss |= !(wildcard->direction & (1 << key->direction));
+
+    // Connection state matching (0 = any state)
+    if (wildcard->conn_states != 0)
+        miss |= !(wildcard->conn_states & (1 << attrs->conn_state));
+
+    // VLAN and VNI matching (0 = any)
+    if (wildcard->vlan_id != 0)
+        miss |= attrs->vlan_id ^ wildcard->vlan_id;
+    if (wildcard->vni != 0)
+        miss |= attrs->vni ^ wildcard->vni;
+
+    // Security identity matching (0 = any)
+    if (wildcard->src_identity != 0)
+        miss |= attrs->src_identity ^ wildcard->src_identity;
+    if (wildcard->dst_identity != 0)
+        miss |= attrs->dst_identity ^ wildcard->dst_identity;
+
+    return miss == 0;
+}
+
+// Highest priority wildcard rule matched so far. It is kept as a slot and
+// a priority rather than a map value pointer, so loop iterations that only
+// differ in which rule won look the same to the verifier.
+struct rule_match {
+    __u32 slot;      // wildcard_policy_map index
+    __s32 priority;  // -1 = no match yet
+};
+
+// Helper: Refine one candidate rule against the full flow key, keeping the
+// highest priority match
+static __always_inline void match_rule(struct flow_key *key, struct match_attrs *attrs,
+                                       __u32 slot, struct rule_match *best) {
+    struct wildcard_policy *wildcard = bpf_map_lookup_elem(&wildcard_policy_map, &slot);
+    if (!wildcard || wildcard->rule_id == 0)
+        return;
+
+    if (!matches_wildcard(key, attrs, wildcard))
+        return;
+
+    // Select highest priority match
+    if ((__s32)wildcard->priority > best->priority) {
+        best->slot = slot;
+        best->priority = wildcard->priority;
+    }
+}
+
+// Walk over candidate rule sets, run one step at a time by rule_walk_step
+struct rule_walk {
+    struct flow_key *key;
+    struct match_attrs *attrs;
+    struct rule_match best;      // Highest priority match so far
+    void *trie;                  // CIDR trie holding set, NULL for an identity set
+    struct cidr_rule_set *set;   // Set being checked, NULL once the walk is done
+    struct lpm_key lpm;          // Trie key set was found under
+    __u32 next;                  // Next rule of set to check
+};
+
+// Helper: One walk step, as a bpf_loop callback. It checks the next rule of
+// the current set or, once that set is done, moves on to the longest prefix
+// covering it. Userspace keeps the number of steps for any address within
+// MAX_CIDR_CANDIDATES.
+static long rule_walk_step(__u64 index, void *ctx) {
+    struct rule_walk *walk = ctx;
+    struct cidr_rule_set *set = walk->set;
+
+    if (!set)
+        return 1;
+
+    if (walk->next >= set->count) {
+        if (!walk->trie || set->prefixlen == 0)
+            return 1;
+
+        // Continue with the longest prefix covering this one
+        walk->lpm.prefixlen = set->prefixlen - 1;
+        walk->set = bpf_map_lookup_elem(walk->trie, &walk->lpm);
+        walk->next = 0;
+        return 0;
+    }
+
+    __u32 i = walk->next & (MAX_CIDR_RULES_PER_PREFIX - 1);
+    walk->next += 1;
+    match_rule(walk->key, walk->attrs, set->slots[i], &walk->best);
+    return 0;
+}
+
+// Helper: Refine the rules of every prefix in a CIDR trie covering addr,
+// from the longest prefix up, keeping the highest priority match
+static __always_inline void walk_cidr_rules(struct rule_walk *walk, void *trie, __u32 *addr) {
+    walk->trie = trie;
+    walk->lpm.prefixlen = 128;
+    __builtin_memcpy(walk->lpm.addr, addr, sizeof(walk->lpm.addr));
+    walk->set = bpf_map_lookup_elem(trie, &walk->lpm);
+    walk->next = 0;
+    bpf_loop(MAX_CIDR_CANDIDATES, rule_walk_step, walk, 0);
+}
+
+// Helper: Refine the rules indexed under a security identity, keeping the
+// highest priority match
+static __always_inline void walk_identity_rules(struct rule_walk *walk, void *index,
+                                                __u32 *identity) {
+    walk->trie = NULL;
+    walk->set = bpf_map_lookup_elem(index, identity);
+    walk->next = 0;
+    bpf_loop(MAX_CIDR_RULES_PER_PREFIX, rule_walk_step, walk, 0);
+}
+
+// Helper: Runtime configuration written by userspace
+static __always_inline struct global_config *get_global_config() {
+    __u32 idx = 0;
+    return bpf_map_lookup_elem(&config_map, &idx);
+}
+
+// Helper: Check if an address is IPv4 loopback (127.0.0.0/8, IPv4-mapped) or ::1
+static __always_inline bool is_loopback(__u32 *addr) {
+    if (addr[0] != 0 || addr[1] != 0)
+        return false;
+
+    if (addr[2] == bpf_htonl(0x0000ffff))
+        return (addr[3] & bpf_htonl(0xff000000)) == bpf_htonl(0x7f000000);
+
+    return addr[2] == 0 && addr[3] == bpf_htonl(1);
+}
+
+// Helper: Safety exemptions that keep the host reachable under default-deny
+// or an overly broad deny rule: loopback traffic and the agent's own API
+// port always pass. Only the local end of a flow is the API port, so it is
+// the destination on ingress and the source on egress; a remote peer
+// picking the API port as its source port is not exempt. ARP and other
+// non-IP traffic never reach policy lookup.
+static __always_inline bool is_exempt(struct flow_key *key, struct global_config *cfg) {
+    if (!cfg || !cfg->safety_exemptions)
+        return false;
+
+    if (is_loopback(key->src_ip) || is_loopback(key->dst_ip))
+        return true;
+
+    if (cfg->api_port != 0 && key->protocol == IPPROTO_TCP) {
+        __u16 local = key->direction == DIRECTION_INGRESS ? key->dst_port : key->src_port;
+        if (local == bpf_htons(cfg->api_port))
+            return true;
+    }
+
+    return false;
+}
+
+// Helper: Security identity of an address, 0 if it has none
+static __always_inline __u32 resolve_identity(__u32 *addr) {
+    struct lpm_key lpm = { .prefixlen = 128 };
+
+    __builtin_memcpy(lpm.addr, addr, sizeof(lpm.addr));
+    __u32 *identity = bpf_map_lookup_elem(&ipcache_map, &lpm);
+    return identity ? *identity : 0;
+}
+
+// Helper: Lookup policy with wildcard support
+// Fast path: Try exact match first (most common)
+// Slow path: Covering prefixes of source and destination, plus the
+// rules of both sides' security identities, then refine the bounded
+// candidate sets on ports/protocol/direction and attrs (only for first
+// packet, or when a session is re-evaluated)
+// It is a global function: the verifier checks it once on its own instead
+// of at every call site, and requires the pointer checks.
+__noinline __u8 lookup_policy_action(struct flow_key *key, struct match_attrs *attrs,
+                                     struct policy_match *match) {
+    struct global_config *cfg = get_global_config();
+
+    if (!key || !attrs || !match)
+        return POLICY_ACTION_ALLOW;
+
+    match->rule_id = 0;
+    match->session_limit = 0;
+    match->monitor = 0;
+    match->exempt = 0;
+
+    if (is_exempt(key, cfg)) {
+        match->exempt = 1;
+        update_stats(STATS_EXEMPTED_FLOWS);
+        return POLICY_ACTION_ALLOW;
+    }
+
+    // FAST PATH: Try exact match first (O(1) hash lookup)
+    struct policy_value *policy = bpf_map_lookup_elem(&policy_map, key);
+    if (policy) {
+        // Increment hit count (simple increment, not atomic for speed)
+        policy->hit_count += 1;
+        update_stats(STATS_POLICY_HITS);
+        count_rule_hit(policy->rule_id);
+        match->rule_id = policy->rule_id;
+        match->session_limit = policy->session_limit;
+        match->monitor = policy->monitor;
+        return policy->action;
+    }
+
+    // SLOW PATH: CIDR tries and identity indexes. Identities are resolved
+    // on every lookup, so re-evaluated sessions see ipcache changes.
+    struct rule_walk walk = { .key = key, .attrs = attrs, .best = { .priority = -1 } };
+
+    attrs->src_identity = resolve_identity(key->src_ip);
+    attrs->dst_identity = resolve_identity(key->dst_ip);
+
+    walk_cidr_rules(&walk, &dst_cidr_map, key->dst_ip);
+    walk_cidr_rules(&walk, &src_cidr_map, key->src_ip);
+
+    if (attrs->dst_identity)
+        walk_identity_rules(&walk, &dst_identity_map, &attrs->dst_identity);
+    if (attrs->src_identity)
+        walk_identity_rules(&walk, &src_identity_map, &attrs->src_identity);
+
+    struct wildcard_policy *best_match = NULL;
+    if (walk.best.priority >= 0)
+        best_match = bpf_map_lookup_elem(&wildcard_policy_map, &walk.best.slot);
+    if (best_match) {
+        update_stats(STATS_POLICY_HITS);
+        count_rule_hit(best_match->rule_id);
+        match->rule_id = best_match->rule_id;
+        match->session_limit = best_match->session_limit;
+        match->monitor = best_match->monitor;
+        return best_match->action;
+    }
+
+    update_stats(STATS_POLICY_MISSES);
+    return cfg ? cfg->default_action : POLICY_ACTION_ALLOW;  // Configurable default action
+}
+
+// Helper: Cached session decision, recomputed if policies changed since
+// it was made. session_key is the key the session is stored under; the
+// decision is recomputed for the attributes of the packet that created it.
+static __always_inline __u8 session_action(struct flow_key *session_key,
+                                           struct session_value *session,
+                                           __u32 generation) {
+    if (session->policy_generation != generation) {
+        struct policy_match match = {0};
+        struct match_attrs attrs = {
+            .conn_state = session->conn_state,
+            .vlan_id = session->vlan_id,
+            .vni = session->vni,
+        };
+        session->policy_action = lookup_policy_action(session_key, &attrs, &match);
+        session->policy_generation = generation;
+        session->rule_id = match.rule_id;
+        if (match.monitor)
+            session->flags |= SESSION_FLAG_MONITOR;
+        else
+            session->flags &= ~SESSION_FLAG_MONITOR;
+        update_stats(STATS_SESSIONS_REEVALUATED);
+    }
+    return session->policy_action;
+}
+
+// Helper: Initial TCP state for a session opened by a packet with these flags.
+// Connections picked up mid-stream (no SYN) are treated as established.
+static __always_inline __u8 initial_tcp_state(__u8 tcp_flags) {
+    if ((tcp_flags & (TCP_FLAG_SYN | TCP_FLAG_ACK)) == TCP_FLAG_SYN)
+        return TCP_STATE_SYN_SENT;
+    return TCP_STATE_ESTABLISHED;
+}
+
+// Helper: A bare SYN on a session past the handshake starts a new
+// connection (e.g. after the session was picked up mid-stream or a port
+// was reused). Its cached decision does not apply; the session is closed
+// and the SYN evaluated like any new flow.
+static __always_inline bool syn_restarts_session(struct session_value *session,
+                                                 __u8 tcp_flags) {
+    if ((tcp_flags & (TCP_FLAG_SYN | TCP_FLAG_ACK)) != TCP_FLAG_SYN)
+        return false;
+    return session->tcp_state != TCP_STATE_SYN_SENT &&
+           session->tcp_state != TCP_STATE_SYN_RECV;
+}
+
+// Helper: Advance the TCP state machine of a session.
+// from_client is true for packets travelling in the session key's direction.
+// Returns true once the connection is finished and the session should be closed.
+static __always_inline bool update_tcp_state(struct session_value *session,
+                                             __u8 tcp_flags, bool from_client) {
+    if (tcp_flags & TCP_FLAG_RST)
+        return true;
+
+    if (tcp_flags & TCP_FLAG_FIN) {
+        session->flags |= from_client ? SESSION_FLAG_FIN_CLIENT : SESSION_FLAG_FIN_SERVER;
+        session->state = SESSION_STATE_CLOSING;
+
+        if ((session->flags & SESSION_FLAG_FIN_CLIENT) &&
+            (session->flags & SESSION_FLAG_FIN_SERVER))
+            session->tcp_state = TCP_STATE_LAST_ACK;   // Both sides done, wait for final ACK
+        else
+            session->tcp_state = from_client ? TCP_STATE_FIN_WAIT1 : TCP_STATE_CLOSE_WAIT;
+        return false;
+    }
+
+    if (!(tcp_flags & TCP_FLAG_ACK))
+        return false;
+
+    switch (session->tcp_state) {
+    case TCP_STATE_SYN_SENT:
+        if (!from_client && (tcp_flags & TCP_FLAG_SYN))
+            session->tcp_state = TCP_STATE_SYN_RECV;
+        break;
+    case TCP_STATE_SYN_RECV:
+        if (from_client) {
+            session->tcp_state = TCP_STATE_ESTABLISHED;
+            session->state = SESSION_STATE_ESTABLISHED;
+            // Later packets belong to an established connection: drop the
+            // decision cached for the SYN so they are evaluated again
+            session->conn_state = CONN_STATE_ESTABLISHED;
+            session->policy_generation -= 1;
+        }
+        break;
+    case TCP_STATE_FIN_WAIT1:
+        if (!from_client)
+            session->tcp_state = TCP_STATE_FIN_WAIT2;
+        break;
+    case TCP_STATE_LAST_ACK:
+        session->tcp_state = TCP_STATE_TIME_WAIT;
+        return true;
+    }
+
+    return false;
+}
+
+// Helper: Session quota key of a client address, masked to the configured
+// IPv4 or IPv6 source prefix
+static __always_inline void build_source_key(__u32 *addr, struct global_config *cfg,
+                                             struct source_key *skey) {
+    bool v4 = addr[0] == 0 && addr[1] == 0 && addr[2] == bpf_htonl(0x0000ffff);
+    __u32 prefixlen = 128;
+
+    if (cfg && v4 && cfg->source_prefix_v4)
+        prefixlen = 96 + cfg->source_prefix_v4;
+    else if (cfg && !v4 && cfg->source_prefix_v6)
+        prefixlen = cfg->source_prefix_v6;
+    if (prefixlen > 128)
+        prefixlen = 128;
+
+    skey->prefixlen = prefixlen;
+#pragma unroll
+    for (int i = 0; i < 4; i++) {
+        __u32 start = i * 32;
+        if (prefixlen >= start + 32)
+            skey->addr[i] = addr[i];
+        else if (prefixlen <= start)
+            skey->addr[i] = 0;
+        else
+            skey->addr[i] = addr[i] & bpf_htonl(0xffffffffU << (32 - (prefixlen - start)));
+    }
+}
+
+// Helper: Check whether a source may open another session under limit
+// (0 = unlimited)
+static __always_inline bool source_under_limit(struct source_key *skey, __u32 limit) {
+    if (!limit)
+        return true;
+    __u64 *count = bpf_map_lookup_elem(&source_sessions_map, skey);
+    return !count || *count < limit;
+}
+
+// Helper: Count a session opened by a source. Counters are shared by all
+// CPUs, so updates are atomic.
+static __always_inline void source_session_opened(struct source_key *skey) {
+    __u64 *count = bpf_map_lookup_elem(&source_sessions_map, skey);
+    if (!count) {
+        __u64 first = 1;
+        if (bpf_map_update_elem(&source_sessions_map, skey, &first, BPF_NOEXIST) == 0)
+            return;
+        count = bpf_map_lookup_elem(&source_sessions_map, skey);  // Lost the race
+        if (!count)
+            return;
+    }
+    __sync_fetch_and_add(count, 1);
+}
+
+// Helper: Uncount a session of the client at addr. Sessions the LRU evicts
+// are never uncounted here; the userspace sweeper recounts periodically.
+static __always_inline void source_session_closed(__u32 *addr) {
+    struct source_key skey = {0};
+    build_source_key(addr, get_global_config(), &skey);
+
+    __u64 *count = bpf_map_lookup_elem(&source_sessions_map, &skey);
+    if (count && *count > 0)
+        __sync_fetch_and_sub(count, 1);
+}
+
+// Helper: Copy a flow key into a flow event. The key starts the packed
+// event, which the ring buffer keeps 8-byte aligned, so it is copied as an
+// aligned struct instead of byte by byte.
+static __always_inline void set_event_key(struct flow_event *event, struct flow_key *key) {
+    struct flow_key *dst = (void *)event;
+    *dst = *key;
+}
+
+// Helper: Remove a finished session and report its final totals
+static __noinline void close_session(struct flow_key *key, struct session_value *session,
+                                          __u64 ts) {
+    __u64 packets = session->packets_to_server + session->packets_to_client;
+    __u64 bytes = session->bytes_to_server + session->bytes_to_client;
+    __u8 action = session->policy_action;
+
+    // Only the CPU that actually removed the entry accounts for the close
+    if (bpf_map_delete_elem(&session_map, key) != 0)
+        return;
+
+    update_stats(STATS_CLOSED_SESSIONS);
+    decrement_stats(STATS_ACTIVE_SESSIONS);
+    source_session_closed(key->src_ip);
+
+    struct flow_event *event = bpf_ringbuf_reserve(&flow_events, sizeof(*event), 0);
+    if (event) {
+        set_event_key(event, key);
+        event->timestamp = ts;
+        event->packets = packets;
+        event->bytes = bytes;
+        event->action = action;
+        event->event_type = FLOW_EVENT_CLOSE;
+        event->flags = 0;
+        event->pad = 0;
+        bpf_ringbuf_submit(event, 0);
+    } else {
+        update_stats(STATS_RINGBUF_DROPS);
+    }
+}
+
+// Helper: Check whether an action drops the packet: DENY, or REJECT which
+// also answers the sender
+static __always_inline bool action_denies(__u8 action) {
+    return action == POLICY_ACTION_DENY || action == POLICY_ACTION_REJECT;
+}
+
+// Helper: Check whether denies are only reported for this packet: globally,
+// for the interface it arrived on, or for the matched rule (session flag)
+static __always_inline bool monitor_active(struct global_config *cfg, __u32 ifindex,
+                                           __u8 session_flags) {
+    if (session_flags & SESSION_FLAG_MONITOR)
+        return true;
+    if (cfg && cfg->monitor_mode)
+        return true;
+    return bpf_map_lookup_elem(&monitor_iface_map, &ifindex) != NULL;
+}
+
+// Helper: Enforce a policy action. Monitored denies are counted as
+// would-deny and let through.
+static __always_inline int enforce_action(__u8 action, bool monitored, __u8 direction) {
+    if (!action_denies(action)) {
+        update_verdict_stats(direction, false);
+        return VERDICT_PASS;  // Allow packet
+    }
+
+    if (monitored) {
+        update_stats(STATS_WOULD_DENY);
+        update_verdict_stats(direction, false);
+        return VERDICT_PASS;  // Report only
+    }
+
+    update_verdict_stats(direction, true);
+    if (action == POLICY_ACTION_REJECT)
+        return VERDICT_REJECT;  // Drop and answer
+    return VERDICT_DROP;  // Drop packet
+}
+
+// Helper: Charge a packet to the token bucket of a RATE_LIMIT rule.
+// Returns false if the bucket holds too few tokens. A packet larger than
+// the burst of a bytes bucket costs the full burst; connection buckets
+// only charge packets that open a session (new_flow).
+static __always_inline bool rate_limit_allows(__u32 rule_id, __u32 len, bool new_flow) {
+    struct rate_limit *rl = bpf_map_lookup_elem(&rate_limit_map, &rule_id);
+    if (!rl)
+        return true;  // No bucket installed: fail open
+    if (rl->unit == RATE_LIMIT_CONNECTIONS && !new_flow)
+        return true;  // Admitted connections are not limited further
+
+    // No helper calls are allowed while holding the lock
+    __u64 now = get_timestamp_ns();
+    bool allowed = false;
+
+    bpf_spin_lock(&rl->lock);
+    if (rl->rate && rl->burst) {
+        __u64 cap = rl->burst * NSEC_PER_SEC;
+        __u64 elapsed = now - rl->last_ts;
+
+        // Refill, bounding elapsed so elapsed * rate cannot overflow
+        if (elapsed >= cap / rl->rate)
+            rl->tokens = cap;
+        else
+            rl->tokens += elapsed * rl->rate;
+        if (rl->tokens > cap)
+            rl->tokens = cap;
+        rl->last_ts = now;
+
+        __u64 cost = 1;
+        if (rl->unit == RATE_LIMIT_BYTES)
+            cost = len < rl->burst ? len : rl->burst;
+        cost *= NSEC_PER_SEC;
+        if (rl->tokens >= cost) {
+            rl->tokens -= cost;
+            allowed = true;
+        }
+    }
+    bpf_spin_unlock(&rl->lock);
+
+    return allowed;
+}
+
+// Helper: Resolve a RATE_LIMIT action to ALLOW or DENY for this packet,
+// counting packets over the limit globally and per rule
+static __always_inline __u8 rate_limit_action(__u8 action, __u32 rule_id, __u32 len,
+                                              bool new_flow) {
+    if (action != POLICY_ACTION_RATE_LIMIT)
+        return action;
+    if (rate_limit_allows(rule_id, len, new_flow))
+        return POLICY_ACTION_ALLOW;
+
+    update_stats(STATS_RATE_LIMITED);
+    __u64 *drops = bpf_map_lookup_elem(&rate_limited_map, &rule_id);
+    if (drops) {
+        *drops += 1;
+    } else {
+        __u64 first = 1;
+        bpf_map_update_elem(&rate_limited_map, &rule_id, &first, BPF_NOEXIST);
+    }
+    return POLICY_ACTION_DENY;
+}
+
+// Helper: Check for TCP flag combinations no legitimate stack sends:
+// NULL and XMAS scans, SYN with FIN or RST, FIN with RST, FIN without ACK
+static __always_inline bool tcp_flags_invalid(__u8 flags) {
+    if (flags == 0)
+        return true;
+    if ((flags & (TCP_FLAG_FIN | TCP_FLAG_PSH | TCP_FLAG_URG)) ==
+        (TCP_FLAG_FIN | TCP_FLAG_PSH | TCP_FLAG_URG))
+        return true;
+    if ((flags & TCP_FLAG_SYN) && (flags & (TCP_FLAG_FIN | TCP_FLAG_RST)))
+        return true;
+    if ((flags & TCP_FLAG_FIN) && (flags & TCP_FLAG_RST))
+        return true;
+    return (flags & (TCP_FLAG_FIN | TCP_FLAG_ACK)) == TCP_FLAG_FIN;
+}
+
+// Helper: Check whether the flow quoted by an ICMP error is tracked, in
+// either orientation and on either hook
+static __always_inline bool related_session_exists(struct flow_key *quoted, __u8 direction) {
+    struct flow_key rev = {0};
+
+    quoted->direction = direction ^ 1;
+    if (bpf_map_lookup_elem(&session_map, quoted))
+        return true;
+    quoted->direction = direction;
+    if (bpf_map_lookup_elem(&session_map, quoted))
+        return true;
+
+    if (!reverse_flow_key(quoted, &rev, direction))
+        return false;
+    if (bpf_map_lookup_elem(&session_map, &rev))
+        return true;
+    rev.direction = direction ^ 1;
+    return bpf_map_lookup_elem(&session_map, &rev) != NULL;
+}
+
+// Helper: Connection state of a packet without a session. Only a bare SYN
+// opens a TCP connection; any other TCP packet without a session belongs
+// to no connection the data plane knows of and is invalid, so
+// "established" rules can't be satisfied by forged mid-stream segments.
+// ICMP replies continue a request the data plane did not see (e.g. when
+// only the ingress hook is attached) and count as established.
+static __always_inline __u8 packet_conn_state(struct flow_key *key, struct packet_meta *meta,
+                                              __u8 direction) {
+    if (key->protocol == IPPROTO_TCP && meta->has_l4) {
+        __u8 flags = meta->tcp_flags;
+        if (!tcp_flags_invalid(flags) && (flags & (TCP_FLAG_SYN | TCP_FLAG_ACK)) == TCP_FLAG_SYN)
+            return CONN_STATE_NEW;
+        return CONN_STATE_INVALID;
+    }
+
+    if (key->protocol == IPPROTO_ICMP || key->protocol == IPPROTO_ICMPV6) {
+        if (meta->icmp_error)
+            return related_session_exists(&meta->related, direction) ?
+                   CONN_STATE_RELATED : CONN_STATE_INVALID;
+        if (icmp_request_type(key->protocol, bpf_ntohs(key->dst_port) >> 8) >= 0)
+            return CONN_STATE_ESTABLISHED;
+    }
+
+    return CONN_STATE_NEW;
+}
+
+// Helper: Create new session (optimized - minimal initialization)
+static __always_inline int create_session(struct flow_key *key, __u8 action, __u64 ts,
+                                          __u32 packet_len, __u8 tcp_flags, __u32 generation,
+                                          __u8 session_flags, __u32 rule_id,
+                                          struct match_attrs *attrs, bool simulated) {
+    __u8 tcp_state = TCP_STATE_CLOSED;
+    __u8 state = SESSION_STATE_NEW;
+
+    if (key->protocol == IPPROTO_TCP) {
+        tcp_state = initial_tcp_state(tcp_flags);
+        if (tcp_state == TCP_STATE_ESTABLISHED)
+            state = SESSION_STATE_ESTABLISHED;
+    }
+
+    __u32 zero = 0;
+    struct session_value *new_session = bpf_map_lookup_elem(&session_scratch_map, &zero);
+    if (!new_session)
+        return -1;
+
+    *new_session = (struct session_value){
+        .created_ts = ts,
+        .last_seen_ts = ts,
+        .packets_to_server = 1,       // First packet
+        .packets_to_client = 0,
+        .bytes_to_server = packet_len, // First packet bytes
+        .bytes_to_client = 0,
+        .state = state,
+        .tcp_state = tcp_state,
+        .policy_action = action,
+        .flags = session_flags,
+        .direction = key->direction,
+        .conn_state = attrs->conn_state,
+        .vlan_id = attrs->vlan_id,
+        .policy_generation = generation,
+        .vni = attrs->vni,
+        .rule_id = rule_id,
+    };
+    
+    int ret = bpf_map_update_elem(&session_map, key, new_session, BPF_NOEXIST);
+    if (ret == 0) {
+        update_stats(STATS_NEW_SESSIONS);
+        update_stats(STATS_ACTIVE_SESSIONS);
+        
+        // Only send events for DENY or if explicitly logging
+        if (action_denies(action) || action == POLICY_ACTION_LOG) {
+            struct flow_event *event = bpf_ringbuf_reserve(&flow_events, sizeof(*event), 0);
+            if (event) {
+                set_event_key(event, key);
+                event->timestamp = ts;
+                event->packets = 1;
+                event->bytes = packet_len;
+                event->action = action;
+                event->event_type = FLOW_EVENT_NEW;
+                event->flags = simulated ? FLOW_EVENT_FLAG_SIMULATED : 0;
+                event->pad = 0;
+                bpf_ringbuf_submit(event, 0);
+            } else {
+                update_stats(STATS_RINGBUF_DROPS);
+            }
+        }
+    }
+    
+    return ret;
+}
+
+// Helper: Enforce an action applied before policy lookup (invalid TCP
+// flags, fragments, malformed headers), counting enforced drops as reason
+static __always_inline int enforce_early_action(__u8 action, __u32 reason,
+                                                struct global_config *cfg, __u32 ifindex,
+                                                __u8 direction) {
+    bool monitored = action == POLICY_ACTION_DENY && monitor_active(cfg, ifindex, 0);
+    if (action == POLICY_ACTION_DENY && !monitored)
+        update_stats(reason);
+    return enforce_action(action, monitored, direction);
+}
+
+// Helper: Key of the datagram a fragment belongs to
+static __always_inline void build_frag_key(struct flow_key *key, struct packet_meta *meta,
+                                           struct frag_key *fkey) {
+    __builtin_memcpy(fkey->src_ip, key->src_ip, sizeof(fkey->src_ip));
+    __builtin_memcpy(fkey->dst_ip, key->dst_ip, sizeof(fkey->dst_ip));
+    fkey->id = meta->frag_id;
+    fkey->protocol = key->protocol;
+    fkey->direction = key->direction;
+}
+
+// Helper: Record the verdict of a first fragment for the rest of the datagram
+static __always_inline void remember_fragment(struct flow_key *key, struct packet_meta *meta,
+                                              int verdict) {
+    struct frag_key fkey = {0};
+    build_frag_key(key, meta, &fkey);
+
+    struct frag_value value = {
+        .created_ts = get_timestamp_ns(),
+        .drop = verdict != VERDICT_PASS,
+    };
+    bpf_map_update_elem(&frag_map, &fkey, &value, BPF_ANY);
+}
+
+// Helper: Non-first fragments have no ports to evaluate. They follow the
+// verdict of their first fragment, or the configured fragment action if it
+// was not seen (reordered, lost or crafted fragments).
+static __always_inline int handle_later_fragment(struct flow_key *key, struct packet_meta *meta,
+                                                 struct global_config *cfg, __u32 ifindex,
+                                                 __u8 direction) {
+    struct frag_key fkey = {0};
+    build_frag_key(key, meta, &fkey);
+
+    struct frag_value *first = bpf_map_lookup_elem(&frag_map, &fkey);
+    if (first && get_timestamp_ns() - first->created_ts < FRAG_TIMEOUT_NS) {
+        update_verdict_stats(direction, first->drop);
+        return first->drop ? VERDICT_DROP : VERDICT_PASS;
+    }
+
+    __u8 action = cfg ? cfg->fragment_action : POLICY_ACTION_ALLOW;
+    return enforce_early_action(action, STATS_FRAGMENT_DROPS, cfg, ifindex, direction);
+}
+
+// Session and policy processing of a parsed packet, in the direction of
+// its key. A global function, so the verifier checks it once on its own
+// instead of for every path of the caller.
+__noinline int handle_flow(struct flow_key *key, struct packet_meta *meta,
+                           struct global_config *cfg, __u32 len, __u32 ifindex) {
+    if (!key || !meta)
+        return VERDICT_PASS;
+
+    __u8 direction = key->direction;
+    __u32 generation = cfg ? cfg->policy_generation : 0;
+
+    // Scan and evasion flag combinations are dropped before any lookup
+    if (cfg && cfg->drop_invalid_tcp && key->protocol == IPPROTO_TCP && meta->has_l4 &&
+        tcp_flags_invalid(meta->tcp_flags))
+        return enforce_early_action(POLICY_ACTION_DENY, STATS_INVALID_TCP_DROPS, cfg,
+                                    ifindex, direction);
+    
+    // Fast path: Lookup existing session (most common case)
+    struct session_value *session = bpf_map_lookup_elem(&session_map, key);
+    if (session && key->protocol == IPPROTO_TCP && meta->has_l4 &&
+        syn_restarts_session(session, meta->tcp_flags)) {
+        close_session(key, session, get_timestamp_ns());
+        session = NULL;
+    }
+    
+    if (session) {
+        // HOT PATH: Existing session - use cached policy decision
+        // This is the most performance-critical path (>99% of packets)
+        
+        __u8 action = session_action(key, session, generation);
+        __u8 session_flags = session->flags;
+        __u64 now = get_timestamp_ns();
+        meta->rule_id = session->rule_id;
+
+        // Every packet of a rate limited session is charged to its rule
+        action = rate_limit_action(action, session->rule_id, len, false);
+        
+        // Update session stats (inline for speed)
+        session->last_seen_ts = now;
+        session->packets_to_server += 1;
+        session->bytes_to_server += len;
+
+        if (key->protocol == IPPROTO_TCP && update_tcp_state(session, meta->tcp_flags, true))
+            close_session(key, session, now);
+        
+        // Fast enforcement check
+        bool monitored = action_denies(action) &&
+                         monitor_active(cfg, ifindex, session_flags);
+#if DEBUG_MODE
+        if (action_denies(action))
+            bpf_printk("DENY%s: %pI6:%d -> %pI6:%d (cached)\n", monitored ? " (monitor)" : "",
+                       key->src_ip, bpf_ntohs(key->src_port),
+                       key->dst_ip, bpf_ntohs(key->dst_port));
+#endif
+        return enforce_action(action, monitored, direction);
+    }
+
+    // REPLY PATH: Packet may belong to a session opened by the peer.
+    // Replies to an ingress session leave through egress (and vice versa),
+    // so try the opposite hook first; the same hook covers loopback-style
+    // paths where both directions cross one hook.
+    struct flow_key rev_key = {0};
+    if (reverse_flow_key(key, &rev_key, direction ^ 1)) {
+        session = bpf_map_lookup_elem(&session_map, &rev_key);
+        if (!session) {
+            rev_key.direction = direction;
+            session = bpf_map_lookup_elem(&session_map, &rev_key);
+        }
+    }
+    if (session && key->protocol == IPPROTO_TCP && meta->has_l4 &&
+        syn_restarts_session(session, meta->tcp_flags)) {
+        close_session(&rev_key, session, get_timestamp_ns());
+        session = NULL;
+    }
+
+    if (session) {
+        // Reply inherits the originating session's decision
+        __u8 action = session_action(&rev_key, session, generation);
+        __u8 session_flags = session->flags;
+        __u64 now = get_timestamp_ns();
+        meta->rule_id = session->rule_id;
+
+        action = rate_limit_action(action, session->rule_id, len, false);
+
+        session->last_seen_ts = now;
+        session->packets_to_client += 1;
+        session->bytes_to_client += len;
+        update_stats(STATS_REPLY_PACKETS);
+
+        if (key->protocol == IPPROTO_TCP) {
+            if (update_tcp_state(session, meta->tcp_flags, false))
+                close_session(&rev_key, session, now);
+        } else if (session->state == SESSION_STATE_NEW) {
+            // First reply of a connectionless flow
+            session->state = SESSION_STATE_ESTABLISHED;
+        }
+
+        bool monitored = action_denies(action) &&
+                         monitor_active(cfg, ifindex, session_flags);
+        return enforce_action(action, monitored, direction);
+    }
+    
+    // SLOW PATH: New session - lookup policy with wildcard support
+    // This happens less frequently, so more overhead is acceptable
+
+    __u64 now = get_timestamp_ns();
+    struct policy_match match = {0};
+    struct match_attrs attrs = {
+        .conn_state = packet_conn_state(key, meta, direction),
+        .vlan_id = meta->vlan_id,
+        .vni = meta->vni,
+    };
+    __u8 action = lookup_policy_action(key, &attrs, &match);
+    __u8 session_flags = match.monitor ? SESSION_FLAG_MONITOR : 0;
+    meta->rule_id = match.rule_id;
+
+    // A source at its session quota can't open another flow. The rule's
+    // limit takes precedence over the global one.
+    struct source_key skey = {0};
+    build_source_key(key->src_ip, cfg, &skey);
+    __u32 session_limit = match.session_limit ? match.session_limit :
+                          (cfg ? cfg->source_session_limit : 0);
+    bool over_quota = !match.exempt && !source_under_limit(&skey, session_limit);
+
+    // The session caches RATE_LIMIT; this packet gets the bucket's verdict
+    __u8 verdict = POLICY_ACTION_DENY;
+    if (!over_quota)
+        verdict = rate_limit_action(action, match.rule_id, len, true);
+    else if (!action_denies(action))
+        update_stats(STATS_SESSION_LIMIT_DROPS);
+    bool limited = over_quota ||
+                   (action == POLICY_ACTION_RATE_LIMIT && verdict == POLICY_ACTION_DENY);
+    bool monitored = action_denies(verdict) &&
+                     monitor_active(cfg, ifindex, session_flags);
+
+#if DEBUG_MODE
+    if (match.rule_id != 0) {
+        bpf_printk("Policy %d matched: %pI6:%d -> %pI6:%d action=%d\n",
+                   match.rule_id,
+                   key->src_ip, bpf_ntohs(key->src_port),
+                   key->dst_ip, bpf_ntohs(key->dst_port),
                    action);
     }
 #endif
     
-    // Create new session with policy action (includes first packet stats)
-    create_session(&key, action, now, skb->len);
+    // Create new session with policy action (includes first packet stats).
+    // A stray RST has no connection to track, and a flow over its rate
+    // limit or session quota is checked again on its next attempt.
+    if (!limited && !(key->protocol == IPPROTO_TCP && (meta->tcp_flags & TCP_FLAG_RST)) &&
+        create_session(key, action, now, len, meta->tcp_flags, generation,
+                       session_flags, match.rule_id, &attrs, monitored) == 0)
+        source_session_opened(&skey);
     
     // Enforce policy
-    if (action == POLICY_ACTION_DENY) {
-        update_stats(STATS_DENIED_PACKETS);
 #if DEBUG_MODE
-        bpf_printk("DENY: %pI4:%d -> %pI4:%d (new)\n",
-                   &key.src_ip, bpf_ntohs(key.src_port),
-                   &key.dst_ip, bpf_ntohs(key.dst_port));
+    if (action_denies(verdict))
+        bpf_printk("DENY%s: %pI6:%d -> %pI6:%d (new)\n", monitored ? " (monitor)" : "",
+                   key->src_ip, bpf_ntohs(key->src_port),
+                   key->dst_ip, bpf_ntohs(key->dst_port));
 #endif
-        return TC_ACT_SHOT;  // Drop packet
+    return enforce_action(verdict, monitored, direction);
+}
+
+// Helper: Verdict for one parsed flow: the packet itself, or one layer of
+// a tunnel packet
+static __always_inline int evaluate_flow(struct flow_key *key, struct packet_meta *meta,
+                                         struct global_config *cfg, __u32 len,
+                                         __u8 direction, __u32 ifindex) {
+    // Malformed headers can't be evaluated reliably
+    if (meta->malformed) {
+        __u8 action = cfg ? cfg->malformed_action : POLICY_ACTION_ALLOW;
+        return enforce_early_action(action, STATS_MALFORMED_DROPS, cfg, ifindex, direction);
+    }
+
+    if (meta->frag == FRAG_LATER)
+        return handle_later_fragment(key, meta, cfg, ifindex, direction);
+
+    int verdict = handle_flow(key, meta, cfg, len, ifindex);
+    if (meta->frag == FRAG_FIRST)
+        remember_fragment(key, meta, verdict);
+    return verdict;
+}
+
+// Helper: Pick the interface a packet decided by a rule is mirrored to,
+// applying the rule's sampling ratio. Returns 0 if it is not mirrored.
+static __always_inline __u32 mirror_ifindex(__u32 rule_id) {
+    if (rule_id == 0)
+        return 0;
+
+    struct mirror_target *target = bpf_map_lookup_elem(&mirror_map, &rule_id);
+    if (!target)
+        return 0;
+    if (target->sample_rate > 1 && bpf_get_prandom_u32() % target->sample_rate != 0)
+        return 0;
+    return target->ifindex;
+}
+
+// Packet processing shared by the TC and XDP hooks (optimized for minimal latency).
+// mirror is set to the interface a copy of the packet goes to, if any.
+static __always_inline int handle_packet(void *data, void *data_end, __u32 len, __u8 direction,
+                                         __u32 ifindex, __u16 vlan_id, __u32 *mirror) {
+    __u32 zero = 0;
+    struct packet_scratch *scratch = bpf_map_lookup_elem(&packet_scratch_map, &zero);
+    if (!scratch)
+        return VERDICT_PASS;
+    __builtin_memset(scratch, 0, sizeof(*scratch));
+
+    struct flow_key *key = &scratch->key;
+    struct packet_meta *meta = &scratch->meta;
+    struct global_config *cfg = get_global_config();
+    
+    // Extract flow key from packet (fast path)
+    if (extract_flow_key(data, data_end, key, meta, vlan_id) < 0) {
+        return VERDICT_PASS;  // Pass non-IP packets
     }
     
-    update_stats(STATS_ALLOWED_PACKETS);
-    return TC_ACT_OK;  // Allow packet
+    // Update total packets counter
+    update_stats(STATS_TOTAL_PACKETS);
+
+    // A tunnel packet enabled for decapsulation is evaluated on its outer
+    // flow first; its inner flow only if the outer one is allowed. Both
+    // frames are parsed before either is evaluated, while the verifier
+    // still sees few distinct states. A non-IP inner frame keeps the
+    // verdict of the outer flow.
+    __u8 decap = cfg ? cfg->decap_tunnels : 0;
+    __u32 inner = tunnel_inner_frame(data, data_end, key, meta, &scratch->inner_meta, decap);
+    bool has_inner = inner && extract_inner_flow_key(data + inner, data_end, meta,
+                                                     &scratch->inner_key,
+                                                     &scratch->inner_meta) == 0;
+
+    int verdict = VERDICT_PASS;
+    for (int layer = 0; layer < 2; layer++) {
+        key->direction = direction;
+        verdict = evaluate_flow(key, meta, cfg, len, direction, ifindex);
+        if (verdict != VERDICT_PASS || layer > 0 || !has_inner)
+            break;
+
+        key = &scratch->inner_key;
+        meta = &scratch->inner_meta;
+    }
+    *mirror = mirror_ifindex(meta->rule_id);
+
+    // A reply to the inner flow of a tunnel would have to be encapsulated
+    if (verdict == VERDICT_REJECT && meta->decapsulated)
+        return VERDICT_DROP;
+    return verdict;
+}
+
+// Reply sent for a rejected packet
+enum reject_reply {
+    REJECT_REPLY_NONE = 0,
+    REJECT_REPLY_TCP_RESET,
+    REJECT_REPLY_UNREACHABLE,
+};
+
+// An ICMP unreachable quotes the rejected packet's IP header and 8 bytes
+// of its payload; the reply's IP and ICMP headers are inserted in front
+#define UNREACH_V4_QUOTE (sizeof(struct iphdr) + 8)
+#define UNREACH_V6_QUOTE (sizeof(struct ipv6hdr) + 8)
+#define UNREACH_V4_ROOM (sizeof(struct iphdr) + sizeof(struct icmphdr))
+#define UNREACH_V6_ROOM (sizeof(struct ipv6hdr) + sizeof(struct icmp6hdr))
+
+// How to answer a rejected packet
+struct reject_plan {
+    struct ethhdr eth;  // Ethernet header of the rejected packet
+    __u8  reply;        // enum reject_reply
+    __u8  ipv6;
+    __u8  code;         // ICMP unreachable code
+    __u32 len;          // Length of the reply frame
+    __u32 room;         // Bytes to insert after the Ethernet header
+};
+
+// Helper: Check whether an IPv4 address must never be answered:
+// unspecified, multicast, reserved or broadcast
+static __always_inline bool ipv4_no_reply(__be32 addr) {
+    __u32 host = bpf_ntohl(addr);
+    return host == 0 || host >= 0xe0000000;
+}
+
+// Helper: Decide how to answer a rejected packet. TCP is answered with a
+// RST, everything else with an ICMP port (UDP) or administratively
+// prohibited unreachable. Packets with VLAN tags in the frame, IPv4
+// options, multicast or broadcast addresses, TCP RSTs and ICMP errors are
+// not answered. Returns -1 if the packet should just be dropped.
+static __always_inline int plan_reject(void *data, void *data_end, struct reject_plan *plan) {
+    struct ethhdr *eth = data;
+    if ((void *)(eth + 1) > data_end)
+        return -1;
+    if (eth->h_dest[0] & 1)  // Multicast or broadcast frame
+        return -1;
+    __builtin_memcpy(&plan->eth, eth, sizeof(plan->eth));
+
+    __u8 protocol;
+    void *l4;
+    if (eth->h_proto == bpf_htons(ETH_P_IP)) {
+        struct iphdr *iph = (void *)(eth + 1);
+        if ((void *)iph + UNREACH_V4_QUOTE > data_end)
+            return -1;
+        if (iph->ihl != 5 || ipv4_no_reply(iph->saddr) || ipv4_no_reply(iph->daddr))
+            return -1;
+
+        protocol = iph->protocol;
+        l4 = (void *)(iph + 1);
+        plan->code = protocol == IPPROTO_UDP ? ICMP_PORT_UNREACH : ICMP_PKT_FILTERED;
+        plan->len = sizeof(*eth) + UNREACH_V4_ROOM + UNREACH_V4_QUOTE;
+        plan->room = UNREACH_V4_ROOM;
+    } else if (eth->h_proto == bpf_htons(ETH_P_IPV6)) {
+        struct ipv6hdr *ip6h = (void *)(eth + 1);
+        if ((void *)ip6h + UNREACH_V6_QUOTE > data_end)
+            return -1;
+        __u32 *src = ip6h->saddr.in6_u.u6_addr32;
+        if (ip6h->daddr.in6_u.u6_addr8[0] == 0xff || !(src[0] | src[1] | src[2] | src[3]))
+            return -1;
+
+        protocol = ip6h->nexthdr;
+        l4 = (void *)(ip6h + 1);
+        plan->ipv6 = 1;
+        plan->code = protocol == IPPROTO_UDP ? ICMPV6_PORT_UNREACH : ICMPV6_ADM_PROHIBITED;
+        plan->len = sizeof(*eth) + UNREACH_V6_ROOM + UNREACH_V6_QUOTE;
+        plan->room = UNREACH_V6_ROOM;
+    } else {
+        return -1;
+    }
+
+    if (protocol == IPPROTO_TCP) {
+        struct tcphdr *tcph = l4;
+        if ((void *)(tcph + 1) > data_end || (((__u8 *)tcph)[13] & TCP_FLAG_RST))
+            return -1;
+
+        // The reply reuses the headers, minus TCP options and payload
+        plan->reply = REJECT_REPLY_TCP_RESET;
+        plan->len = (void *)(tcph + 1) - data;
+        plan->room = 0;
+        return 0;
+    }
+
+    if (protocol == IPPROTO_ICMP || protocol == IPPROTO_ICMPV6) {
+        struct icmphdr *icmph = l4;
+        if ((void *)(icmph + 1) > data_end || icmp_is_error(protocol, icmph->type))
+            return -1;
+    }
+
+    plan->reply = REJECT_REPLY_UNREACHABLE;
+    return 0;
+}
+
+// Helper: Fold a 32-bit checksum into the 16-bit Internet checksum
+static __always_inline __u16 csum_fold(__s64 csum) {
+    __u32 sum = (__u32)csum;
+    sum = (sum & 0xffff) + (sum >> 16);
+    sum = (sum & 0xffff) + (sum >> 16);
+    return (__u16)~sum;
+}
+
+// Helper: Checksum of a transport segment with its IPv4 pseudo header
+static __always_inline __u16 l4_csum_v4(__be32 saddr, __be32 daddr, __u8 protocol,
+                                        void *l4, __u32 len) {
+    struct {
+        __be32 saddr;
+        __be32 daddr;
+        __u8   zero;
+        __u8   protocol;
+        __be16 len;
+    } pseudo = {
+        .saddr = saddr,
+        .daddr = daddr,
+        .protocol = protocol,
+        .len = bpf_htons(len),
+    };
+
+    __s64 csum = bpf_csum_diff(NULL, 0, (__be32 *)&pseudo, sizeof(pseudo), 0);
+    return csum_fold(bpf_csum_diff(NULL, 0, l4, len, csum));
+}
+
+// Helper: Checksum of a transport segment with its IPv6 pseudo header
+static __always_inline __u16 l4_csum_v6(struct in6_addr *saddr, struct in6_addr *daddr,
+                                        __u8 nexthdr, void *l4, __u32 len) {
+    struct {
+        struct in6_addr saddr;
+        struct in6_addr daddr;
+        __be32 len;
+        __u8   zero[3];
+        __u8   nexthdr;
+    } pseudo = {
+        .saddr = *saddr,
+        .daddr = *daddr,
+        .len = bpf_htonl(len),
+        .nexthdr = nexthdr,
+    };
+
+    __s64 csum = bpf_csum_diff(NULL, 0, (__be32 *)&pseudo, sizeof(pseudo), 0);
+    return csum_fold(bpf_csum_diff(NULL, 0, l4, len, csum));
+}
+
+// Helper: Write the IPv4 header of a reply
+static __always_inline void fill_ipv4_reply(struct iphdr *iph, __be32 saddr, __be32 daddr,
+                                            __u8 protocol, __u16 tot_len) {
+    *(__u8 *)iph = 0x45;  // Version 4, 20-byte header
+    iph->tos = 0;
+    iph->tot_len = bpf_htons(tot_len);
+    iph->id = 0;
+    iph->frag_off = 0;
+    iph->ttl = REJECT_TTL;
+    iph->protocol = protocol;
+    iph->check = 0;
+    iph->saddr = saddr;
+    iph->daddr = daddr;
+    iph->check = csum_fold(bpf_csum_diff(NULL, 0, (__be32 *)iph, sizeof(*iph), 0));
+}
+
+// Helper: Write the IPv6 header of a reply
+static __always_inline void fill_ipv6_reply(struct ipv6hdr *ip6h, struct in6_addr *saddr,
+                                            struct in6_addr *daddr, __u8 nexthdr,
+                                            __u16 payload_len) {
+    *(__be32 *)ip6h = bpf_htonl(0x60000000);  // Version 6, no traffic class or flow label
+    ip6h->payload_len = bpf_htons(payload_len);
+    ip6h->nexthdr = nexthdr;
+    ip6h->hop_limit = REJECT_TTL;
+    ip6h->saddr = *saddr;
+    ip6h->daddr = *daddr;
+}
+
+// Helper: Turn a TCP header into the RST answering its segment (RFC 9293
+// 3.10.7.1): a segment with ACK is reset at its acknowledgment number,
+// any other segment is acknowledged
+static __always_inline void fill_tcp_reset(struct tcphdr *tcph, __u32 payload_len) {
+    __u8 flags = ((__u8 *)tcph)[13];
+    __be32 seq = tcph->seq;
+    __be16 port = tcph->source;
+
+    tcph->source = tcph->dest;
+    tcph->dest = port;
+    if (flags & TCP_FLAG_ACK) {
+        tcph->seq = tcph->ack_seq;
+        tcph->ack_seq = 0;
+        flags = TCP_FLAG_RST;
+    } else {
+        __u32 ack = bpf_ntohl(seq) + payload_len;
+        if (flags & TCP_FLAG_SYN)
+            ack++;
+        if (flags & TCP_FLAG_FIN)
+            ack++;
+        tcph->seq = 0;
+        tcph->ack_seq = bpf_htonl(ack);
+        flags = TCP_FLAG_RST | TCP_FLAG_ACK;
+    }
+
+    ((__u8 *)tcph)[12] = 5 << 4;  // 20-byte header, no options
+    ((__u8 *)tcph)[13] = flags;
+    tcph->window = 0;
+    tcph->check = 0;
+    tcph->urg_ptr = 0;
+}
+
+// Helper: Rewrite a trimmed IPv4 TCP packet into its RST
+static __always_inline int build_tcp_reset_v4(struct iphdr *iph, void *data_end) {
+    struct tcphdr *tcph = (void *)(iph + 1);
+    if ((void *)(tcph + 1) > data_end)
+        return -1;
+
+    // Only the payload was trimmed, the lengths are still the original ones
+    __u32 hdr_len = sizeof(*iph) + tcph->doff * 4;
+    __u32 tot_len = bpf_ntohs(iph->tot_len);
+    fill_tcp_reset(tcph, tot_len > hdr_len ? tot_len - hdr_len : 0);
+
+    fill_ipv4_reply(iph, iph->daddr, iph->saddr, IPPROTO_TCP, sizeof(*iph) + sizeof(*tcph));
+    tcph->check = l4_csum_v4(iph->saddr, iph->daddr, IPPROTO_TCP, tcph, sizeof(*tcph));
+    return 0;
+}
+
+// Helper: Rewrite a trimmed IPv6 TCP packet into its RST
+static __always_inline int build_tcp_reset_v6(struct ipv6hdr *ip6h, void *data_end) {
+    struct tcphdr *tcph = (void *)(ip6h + 1);
+    if ((void *)(tcph + 1) > data_end)
+        return -1;
+
+    __u32 hdr_len = tcph->doff * 4;
+    __u32 payload_len = bpf_ntohs(ip6h->payload_len);
+    fill_tcp_reset(tcph, payload_len > hdr_len ? payload_len - hdr_len : 0);
+
+    struct in6_addr saddr = ip6h->daddr;
+    struct in6_addr daddr = ip6h->saddr;
+    fill_ipv6_reply(ip6h, &saddr, &daddr, IPPROTO_TCP, sizeof(*tcph));
+    tcph->check = l4_csum_v6(&saddr, &daddr, IPPROTO_TCP, tcph, sizeof(*tcph));
+    return 0;
+}
+
+// Helper: Write an ICMP destination unreachable in the room inserted in
+// front of the quoted IPv4 packet
+static __always_inline int build_unreach_v4(struct iphdr *iph, void *data_end, __u8 code) {
+    struct icmphdr *icmph = (void *)(iph + 1);
+    struct iphdr *quoted = (void *)(icmph + 1);
+    if ((void *)quoted + UNREACH_V4_QUOTE > data_end)
+        return -1;
+
+    icmph->type = ICMP_DEST_UNREACHABLE;
+    icmph->code = code;
+    icmph->checksum = 0;
+    icmph->un.gateway = 0;
+    icmph->checksum = csum_fold(bpf_csum_diff(NULL, 0, (__be32 *)icmph,
+                                              sizeof(*icmph) + UNREACH_V4_QUOTE, 0));
+
+    fill_ipv4_reply(iph, quoted->daddr, quoted->saddr, IPPROTO_ICMP,
+                    UNREACH_V4_ROOM + UNREACH_V4_QUOTE);
+    return 0;
+}
+
+// Helper: Write an ICMPv6 destination unreachable in the room inserted in
+// front of the quoted IPv6 packet
+static __always_inline int build_unreach_v6(struct ipv6hdr *ip6h, void *data_end, __u8 code) {
+    struct icmp6hdr *icmp6h = (void *)(ip6h + 1);
+    struct ipv6hdr *quoted = (void *)(icmp6h + 1);
+    if ((void *)quoted + UNREACH_V6_QUOTE > data_end)
+        return -1;
+
+    struct in6_addr saddr = quoted->daddr;
+    struct in6_addr daddr = quoted->saddr;
+    __u16 len = sizeof(*icmp6h) + UNREACH_V6_QUOTE;
+
+    icmp6h->icmp6_type = ICMPV6_DEST_UNREACHABLE;
+    icmp6h->icmp6_code = code;
+    icmp6h->icmp6_cksum = 0;
+    icmp6h->icmp6_dataun.un_data32[0] = 0;
+    icmp6h->icmp6_cksum = l4_csum_v6(&saddr, &daddr, IPPROTO_ICMPV6, icmp6h, len);
+
+    fill_ipv6_reply(ip6h, &saddr, &daddr, IPPROTO_ICMPV6, len);
+    return 0;
+}
+
+// Helper: Write the planned reply over the resized frame of a rejected
+// packet. Returns -1 if the frame is too short.
+static __always_inline int build_reject(void *data, void *data_end, struct reject_plan *plan) {
+    struct ethhdr *eth = data;
+    if ((void *)(eth + 1) > data_end)
+        return -1;
+
+    __builtin_memcpy(eth->h_dest, plan->eth.h_source, sizeof(eth->h_dest));
+    __builtin_memcpy(eth->h_source, plan->eth.h_dest, sizeof(eth->h_source));
+    eth->h_proto = plan->eth.h_proto;
+
+    void *l3 = (void *)(eth + 1);
+    if (plan->reply == REJECT_REPLY_TCP_RESET)
+        return plan->ipv6 ? build_tcp_reset_v6(l3, data_end) : build_tcp_reset_v4(l3, data_end);
+    return plan->ipv6 ? build_unreach_v6(l3, data_end, plan->code) :
+                        build_unreach_v4(l3, data_end, plan->code);
+}
+
+// Helper: Check whether the XDP program already handled this packet, and
+// which mirror target it picked
+static __always_inline bool xdp_handled(struct __sk_buff *skb, __u32 *mirror) {
+    void *data = (void *)(long)skb->data;
+    struct xdp_meta *meta = (void *)(long)skb->data_meta;
+
+    if ((void *)(meta + 1) > data || meta->marker != XDP_META_HANDLED)
+        return false;
+    *mirror = meta->mirror_ifindex;
+    return true;
+}
+
+// Helper: Count a copy sent, or failed to send, to a mirror target
+static __always_inline void count_mirror(__u32 ifindex, __u32 len, bool failed) {
+    struct mirror_stats *stats = bpf_map_lookup_elem(&mirror_stats_map, &ifindex);
+    if (!stats) {
+        struct mirror_stats first = {0};
+        bpf_map_update_elem(&mirror_stats_map, &ifindex, &first, BPF_NOEXIST);
+        stats = bpf_map_lookup_elem(&mirror_stats_map, &ifindex);
+        if (!stats)
+            return;
+    }
+
+    if (failed) {
+        stats->errors += 1;
+        return;
+    }
+    stats->packets += 1;
+    stats->bytes += len;
+}
+
+// Helper: Send a copy of the packet out of a mirror target. The copy is
+// marked and recorded as in flight so a TC program on the target lets it
+// through: bpf_clone_redirect runs the target's egress hook before it
+// returns.
+static __always_inline void mirror_skb(struct __sk_buff *skb, __u32 ifindex) {
+    __u32 zero = 0;
+    struct mirror_inflight *inflight = bpf_map_lookup_elem(&mirror_inflight_map, &zero);
+    if (!inflight)
+        return;
+
+    __u32 mark = skb->mark;
+    __u32 len = skb->len;
+
+    inflight->ifindex = ifindex;
+    inflight->mark = mark;
+    skb->mark = MIRROR_MARK;
+    long err = bpf_clone_redirect(skb, ifindex, 0);
+    skb->mark = mark;
+    inflight->ifindex = 0;
+    count_mirror(ifindex, len, err != 0);
+}
+
+// Helper: Check whether a packet carrying MIRROR_MARK on an egress hook is
+// the copy this CPU is sending out of the interface, and give it back the
+// original's mark if so
+static __always_inline bool take_mirror_copy(struct __sk_buff *skb, __u8 direction) {
+    __u32 zero = 0;
+    if (direction != DIRECTION_EGRESS)
+        return false;
+
+    struct mirror_inflight *inflight = bpf_map_lookup_elem(&mirror_inflight_map, &zero);
+    if (!inflight || !inflight->ifindex || inflight->ifindex != skb->ifindex)
+        return false;
+
+    skb->mark = inflight->mark;
+    inflight->ifindex = 0;
+    return true;
+}
+
+// Helper: Record a reject reply redirected to the hook of ifindex in
+// direction, before the redirect happens
+static __always_inline int expect_reject_reply(__u32 ifindex, __u8 direction) {
+    struct reject_key key = {
+        .ifindex = ifindex,
+        .direction = direction,
+    };
+    struct reject_pending *pending = bpf_map_lookup_elem(&reject_pending_map, &key);
+    if (!pending) {
+        struct reject_pending init = {0};
+        bpf_map_update_elem(&reject_pending_map, &key, &init, BPF_NOEXIST);
+        pending = bpf_map_lookup_elem(&reject_pending_map, &key);
+        if (!pending)
+            return -1;
+    }
+
+    __u64 now = get_timestamp_ns();
+    // Replies that never arrived (a failed redirect) are not awaited forever
+    if (pending->expires_ts < now || pending->count < 0)
+        pending->count = 0;
+    __sync_fetch_and_add(&pending->count, 1);
+    pending->expires_ts = now + REJECT_PENDING_TIMEOUT_NS;
+    return 0;
+}
+
+// Helper: Check whether a packet carrying REJECT_MARK on the hook of
+// ifindex in direction is a reply the program redirected there, and
+// consume the pending reply if so
+static __always_inline bool take_reject_reply(__u32 ifindex, __u8 direction) {
+    struct reject_key key = {
+        .ifindex = ifindex,
+        .direction = direction,
+    };
+    struct reject_pending *pending = bpf_map_lookup_elem(&reject_pending_map, &key);
+    if (!pending || pending->count <= 0 || pending->expires_ts < get_timestamp_ns())
+        return false;
+
+    __sync_fetch_and_add(&pending->count, -1);
+    return true;
+}
+
+// Helper: Answer a rejected packet on a TC hook. The packet is rewritten
+// into its reply and redirected back towards the sender: out of the
+// interface on ingress, into the local stack on egress. Not inlined, so
+// the reply headers don't add to the stack of the policy evaluation.
+static __noinline int tc_send_reject(struct __sk_buff *skb, __u8 direction) {
+    struct reject_plan plan = {0};
+    void *data = (void *)(long)skb->data;
+    void *data_end = (void *)(long)skb->data_end;
+
+    // A GSO packet can't be turned into a single reply segment
+    if (skb->gso_segs > 1 || plan_reject(data, data_end, &plan) < 0)
+        return TC_ACT_SHOT;
+
+    // Trim to the headers kept, then make room for the new ones
+    if (bpf_skb_change_tail(skb, plan.len - plan.room, 0) < 0)
+        return TC_ACT_SHOT;
+    if (plan.room && bpf_skb_adjust_room(skb, plan.room, BPF_ADJ_ROOM_MAC, 0) < 0)
+        return TC_ACT_SHOT;
+    if (bpf_skb_pull_data(skb, plan.len) < 0)
+        return TC_ACT_SHOT;
+
+    data = (void *)(long)skb->data;
+    data_end = (void *)(long)skb->data_end;
+    if (build_reject(data, data_end, &plan) < 0)
+        return TC_ACT_SHOT;
+
+    // The reply is seen next by the opposite hook of the same interface
+    __u8 reply_direction = direction == DIRECTION_INGRESS ? DIRECTION_EGRESS : DIRECTION_INGRESS;
+    if (expect_reject_reply(skb->ifindex, reply_direction) < 0)
+        return TC_ACT_SHOT;
+
+    skb->mark = REJECT_MARK;
+    update_stats(STATS_REJECTS_SENT);
+    return bpf_redirect(skb->ifindex, direction == DIRECTION_INGRESS ? 0 : BPF_F_INGRESS);
+}
+
+// Helper: Run the shared packet path on an skb and map the verdict to a TC action
+static __always_inline int handle_skb(struct __sk_buff *skb, __u8 direction) {
+    // Replies to rejected packets pass the hook they are redirected to. A
+    // mark nobody is waiting for is someone else's and is left alone.
+    void *data = (void *)(long)skb->data;
+    void *data_end = (void *)(long)skb->data_end;
+    __u32 mark = skb->mark;
+
+    if (mark == REJECT_MARK && take_reject_reply(skb->ifindex, direction)) {
+        skb->mark = 0;
+        return TC_ACT_OK;
+    }
+    // Mirrored copies pass the TC program on the mirror target
+    if (mark == MIRROR_MARK && take_mirror_copy(skb, direction))
+        return TC_ACT_OK;
+
+    // A tag offloaded to the NIC is no longer in the packet data
+    __u16 vlan_id = skb->vlan_present ? skb->vlan_tci & VLAN_VID_MASK : 0;
+
+    __u32 mirror = 0;
+    int verdict = handle_packet(data, data_end, skb->len, direction, skb->ifindex, vlan_id,
+                                &mirror);
+
+    // The copy is taken before the verdict, so denied packets are mirrored too
+    if (mirror)
+        mirror_skb(skb, mirror);
+
+    switch (verdict) {
+    case VERDICT_DROP:
+        return TC_ACT_SHOT;  // Drop packet
+    case VERDICT_REJECT:
+        return tc_send_reject(skb, direction);
+    default:
+        return TC_ACT_OK;    // Allow packet
+    }
+}
+
+// Ingress TC program
+SEC("tc")
+int tc_microsegment_filter(struct __sk_buff *skb) {
+    // In xdp+tc mode the XDP program enforces first; it can't copy packets,
+    // so it leaves mirroring to TC
+    __u32 mirror = 0;
+    if (xdp_handled(skb, &mirror)) {
+        if (mirror)
+            mirror_skb(skb, mirror);
+        return TC_ACT_OK;
+    }
+    return handle_skb(skb, DIRECTION_INGRESS);
+}
+
+// Egress TC program (optional, evaluates outbound connections)
+SEC("tc")
+int tc_microsegment_egress(struct __sk_buff *skb) {
+    return handle_skb(skb, DIRECTION_EGRESS);
+}
+
+// Helper: Tag an allowed packet so the TC ingress program skips it, only
+// sending the copy for its mirror target
+static __always_inline void mark_xdp_handled(struct xdp_md *ctx, __u32 mirror) {
+    if (bpf_xdp_adjust_meta(ctx, -(int)sizeof(struct xdp_meta)) != 0)
+        return;  // No metadata support: TC evaluates the packet again
+
+    void *data = (void *)(long)ctx->data;
+    struct xdp_meta *meta = (void *)(long)ctx->data_meta;
+    if ((void *)(meta + 1) > data)
+        return;
+    meta->mirror_ifindex = mirror;
+    meta->marker = XDP_META_HANDLED;
+}
+
+// Helper: Answer a rejected packet on the XDP hook, bouncing the reply
+// out of the interface it arrived on. Not inlined, like tc_send_reject.
+static __noinline int xdp_send_reject(struct xdp_md *ctx) {
+    struct reject_plan plan = {0};
+    void *data = (void *)(long)ctx->data;
+    void *data_end = (void *)(long)ctx->data_end;
+
+    if (plan_reject(data, data_end, &plan) < 0)
+        return XDP_DROP;
+
+    // Trim to the headers kept, then make room in front for the new ones;
+    // build_reject writes the Ethernet header at the new start
+    int delta = (int)(plan.len - plan.room) - (int)(data_end - data);
+    if (delta && bpf_xdp_adjust_tail(ctx, delta) < 0)
+        return XDP_DROP;
+    if (plan.room && bpf_xdp_adjust_head(ctx, -(int)plan.room) < 0)
+        return XDP_DROP;
+
+    data = (void *)(long)ctx->data;
+    data_end = (void *)(long)ctx->data_end;
+    if (build_reject(data, data_end, &plan) < 0)
+        return XDP_DROP;
+
+    update_stats(STATS_REJECTS_SENT);
+    return XDP_TX;
+}
+
+// Ingress XDP program: drops denied traffic before an skb is allocated
+SEC("xdp")
+int xdp_microsegment_filter(struct xdp_md *ctx) {
+    void *data = (void *)(long)ctx->data;
+    void *data_end = (void *)(long)ctx->data_end;
+
+    __u32 mirror = 0;
+    int verdict = handle_packet(data, data_end, data_end - data, DIRECTION_INGRESS,
+                                ctx->ingress_ifindex, 0, &mirror);
+    if (verdict == VERDICT_REJECT && xdp_send_reject(ctx) == XDP_TX)
+        return XDP_TX;
+    if (verdict != VERDICT_PASS) {
+        update_stats(STATS_XDP_DROPPED);
+        return XDP_DROP;
+    }
+
+    mark_xdp_handled(ctx, mirror);
+    return XDP_PASS;
 }